@@ -14,18 +14,15 @@ package dnsrp
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
-	"net/http"
 	"time"
 
-	"bytes"
-
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/miekg/dns"
+	"github.com/nicewrld/gameserver/client"
 )
 
 // the main plugin struct - keeps track of:
@@ -33,9 +30,9 @@ import (
 // - how to talk to the game server
 // - what to do next if we fail
 type DNSRP struct {
-	Next          plugin.Handler  // the next plugin to call if we tap out
+	Next          plugin.Handler // the next plugin to call if we tap out
 	GameServerURL string         // where our game server lives
-	Client        *http.Client   // for talking to the game server
+	Client        *client.Client // for talking to the game server
 }
 
 // this is where we intercept dns requests
@@ -44,20 +41,22 @@ func (d DNSRP) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 	log.Infof("dnsrp plugin invoked for query: %s", question.Name)
 
 	// Prepare the DNS request data to send to the game server
-	dnsRequest := DNSRequest{
-		Name:  question.Name,
-		Type:  dns.TypeToString[question.Qtype],
-		Class: dns.ClassToString[question.Qclass],
+	dnsRequest := client.DNSQuery{
+		Name:     question.Name,
+		Type:     dns.TypeToString[question.Qtype],
+		Class:    dns.ClassToString[question.Qclass],
+		ClientIP: clientIP(w),
 	}
 
 	// Send the request to the game server
-	action, err := d.GetActionFromGameServer(dnsRequest)
+	gameResponse, err := d.GetActionFromGameServer(ctx, dnsRequest)
+	action := gameResponse.Action
 	log.Infof("Sending DNS request to game server: %s", d.GameServerURL)
 	if err != nil {
 		log.Errorf("Error posting to game server: %v", err)
 		if errors.Is(err, context.DeadlineExceeded) || isTimeoutError(err) {
 			log.Warningf("Timeout waiting for game server response, proceeding with default action 'correct'")
-			action = "correct"
+			action = client.ActionCorrect
 		} else {
 			log.Errorf("Error communicating with game server: %v", err)
 			// Fallback to next plugin or return SERVFAIL
@@ -72,19 +71,18 @@ func (d DNSRP) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 	msg.SetReply(r)
 
 	switch action {
-	case "correct":
+	case client.ActionCorrect:
 		// Forward the request to the next plugin (e.g., resolve normally)
 		return plugin.NextOrFailure(d.Name(), d.Next, ctx, w, r)
-	case "corrupt":
+	case client.ActionCorrupt:
 		// Return a corrupt response (e.g., wrong IP address)
-		rr, _ := dns.NewRR(fmt.Sprintf("%s A 127.0.0.1", question.Name))
-		msg.Answer = []dns.RR{rr}
-	case "delay":
+		msg.Answer = []dns.RR{corruptAnswer(question, gameResponse.Answer)}
+	case client.ActionDelay:
 		// Delay the response
 		time.Sleep(5 * time.Second)
 		// Then forward the request
 		return plugin.NextOrFailure(d.Name(), d.Next, ctx, w, r)
-	case "nxdomain":
+	case client.ActionNXDomain:
 		// Return NXDOMAIN
 		msg.Rcode = dns.RcodeNameError
 	default:
@@ -100,37 +98,36 @@ func (d DNSRP) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (
 func (d DNSRP) Name() string { return "dnsrp" }
 
 // GetActionFromGameServer communicates with the game server
-func (d DNSRP) GetActionFromGameServer(req DNSRequest) (string, error) {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return "", err
-	}
+// the client retries if the game server says it's busy, and gives up with ctx
+func (d DNSRP) GetActionFromGameServer(ctx context.Context, req client.DNSQuery) (client.DNSResponse, error) {
+	return d.Client.SubmitDNSRequest(ctx, req)
+}
 
-	resp, err := d.Client.Post(d.GameServerURL+"/dnsrequest", "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return "", err
+// corruptAnswer builds the lie we tell for a corrupted query
+// uses the player's address when it fits the question, 127.0.0.1 otherwise
+func corruptAnswer(question dns.Question, answer string) dns.RR {
+	ip := net.ParseIP(answer)
+	switch {
+	case ip != nil && ip.To4() != nil && question.Qtype == dns.TypeA:
+		return &dns.A{Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeA, Class: dns.ClassINET}, A: ip.To4()}
+	case ip != nil && ip.To4() == nil && question.Qtype == dns.TypeAAAA:
+		return &dns.AAAA{Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET}, AAAA: ip}
 	}
-	defer resp.Body.Close()
+	rr, _ := dns.NewRR(fmt.Sprintf("%s A 127.0.0.1", question.Name))
+	return rr
+}
 
-	var gameResponse DNSResponse
-	err = json.NewDecoder(resp.Body).Decode(&gameResponse)
+// clientIP pulls the querying client's address off the response writer
+func clientIP(w dns.ResponseWriter) string {
+	addr := w.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
 	if err != nil {
-		return "", err
+		return addr.String()
 	}
-
-	return gameResponse.Action, nil
-}
-
-// DNSRequest represents the DNS query sent to the game server
-type DNSRequest struct {
-	Name  string `json:"name"`
-	Type  string `json:"type"`
-	Class string `json:"class"`
-}
-
-// DNSResponse represents the response from the game server
-type DNSResponse struct {
-	Action string `json:"action"`
+	return host
 }
 
 // Helper function to check for timeout errors
@@ -3,12 +3,12 @@
 package dnsrp
 
 import (
-	"net/http"
 	"time"
 
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/nicewrld/gameserver/client"
 )
 
 func init() {
@@ -16,11 +16,7 @@ func init() {
 }
 
 func setup(c *caddy.Controller) error {
-	dnsrp := &DNSRP{
-		Client: &http.Client{
-			Timeout: 35 * time.Second, // Set to slightly more than 30 seconds
-		},
-	}
+	dnsrp := &DNSRP{}
 
 	for c.Next() {
 		args := c.RemainingArgs()
@@ -30,6 +26,9 @@ func setup(c *caddy.Controller) error {
 		dnsrp.GameServerURL = args[0]
 	}
 
+	dnsrp.Client = client.New(dnsrp.GameServerURL)
+	dnsrp.Client.HTTPClient.Timeout = 35 * time.Second // Set to slightly more than 30 seconds
+
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		dnsrp.Next = next
 		return dnsrp
@@ -0,0 +1,179 @@
+// gameserver/achievements.go
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nicewrld/gameserver/achievements"
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/events"
+	"github.com/nicewrld/gameserver/queue"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//////////////////////////////////////////
+// Achievement Constants
+//////////////////////////////////////////
+
+const (
+	// achievementJobType identifies job queue jobs that save an unlocked achievement.
+	achievementJobType = "achievement"
+)
+
+//////////////////////////////////////////
+// Achievement Metrics and State
+//////////////////////////////////////////
+
+var (
+	// achievementsUnlocked counts badges handed out, by achievement.
+	achievementsUnlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gameserver_achievements_unlocked_total",
+		Help: "Achievements unlocked by players, by achievement",
+	}, []string{"achievement"})
+
+	// achievementTracker watches decisions for achievements. main replaces it when ACHIEVEMENTS_CONFIG is set.
+	achievementTracker = achievements.NewTracker(achievements.DefaultConfig().Achievements)
+)
+
+//////////////////////////////////////////
+// Achievement Functions
+//////////////////////////////////////////
+
+// loadAchievements tells the tracker which achievements players already have.
+func loadAchievements() {
+	unlocked, err := db.GetUnlockedAchievements()
+	if err != nil {
+		log.Printf("Warning: Failed to load achievements from database: %v", err)
+		return
+	}
+	for playerID, ids := range unlocked {
+		achievementTracker.Restore(playerID, ids)
+	}
+}
+
+// trackAchievements feeds a player's decision to the achievement tracker and hands out anything it unlocked.
+func trackAchievements(dnsReq *DNSRequest, playerID, action string, decidedAt time.Time) {
+	if playerID == "" {
+		return
+	}
+	unlocks := achievementTracker.Observe(achievements.Decision{
+		PlayerID:  playerID,
+		RequestID: dnsReq.RequestID,
+		Action:    action,
+		Alignment: currentScoringEngine().Alignment(action),
+		QType:     dnsReq.Type,
+		Elapsed:   decidedAt.Sub(dnsReq.Timestamp),
+		Protected: protected(dnsReq.Name),
+		At:        decidedAt,
+	})
+	for _, u := range unlocks {
+		unlockAchievement(u)
+	}
+}
+
+// protected reports whether a rule stops players from doing whatever they like to a domain.
+func protected(name string) bool {
+	return len(rulesEngine.Evaluate(name).Allowed) < len(actionNames)
+}
+
+// unlockAchievement hands out a freshly unlocked achievement. It is saved through the job queue and
+// only announced once the save went through, so the player's browser never shows off a badge that was lost.
+func unlockAchievement(u achievements.Unlock) {
+	if dbJobs == nil {
+		if err := saveAchievement(u); err != nil {
+			log.Printf("Warning: Failed to record achievement %s for player %s: %v", u.Achievement.ID, u.PlayerID, err)
+		}
+		return
+	}
+	dbJobs.Submit(queue.Job{Type: achievementJobType, PlayerID: u.PlayerID, Data: u})
+}
+
+// saveAchievement writes an unlocked achievement and announces it once it's saved.
+func saveAchievement(u achievements.Unlock) error {
+	a := u.Achievement
+	err := db.UnlockAchievement(db.Achievement{PlayerID: u.PlayerID, AchievementID: a.ID, RequestID: u.RequestID, UnlockedAt: u.At})
+	if err != nil {
+		return err
+	}
+	achievementsUnlocked.With(prometheus.Labels{"achievement": a.ID}).Inc()
+
+	log.Printf("[PlayerID: %s] Unlocked achievement %s", u.PlayerID, a.ID)
+	eventBus.Publish(events.Event{
+		Type:      events.AchievementUnlocked,
+		RequestID: u.RequestID,
+		PlayerID:  u.PlayerID,
+		Data: map[string]interface{}{
+			"achievement": a.ID,
+			"name":        a.Name,
+			"description": a.Description,
+		},
+	})
+	return nil
+}
+
+//////////////////////////////////////////
+// Achievement Handlers
+//////////////////////////////////////////
+
+// AchievementView is one achievement as returned by /players/{id}/achievements.
+type AchievementView struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Unlocked    bool       `json:"unlocked"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+	RequestID   string     `json:"request_id,omitempty"` // decision that unlocked it
+	Progress    int        `json:"progress,omitempty"`   // decisions into the streak so far
+	Goal        int        `json:"goal,omitempty"`       // decisions in a row it takes
+}
+
+// achievementsHandler lists every achievement with whether the player has unlocked it and how close they are.
+func achievementsHandler(w http.ResponseWriter, r *http.Request, playerID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	playersMu.RLock()
+	_, exists := players[playerID]
+	playersMu.RUnlock()
+	if !exists {
+		http.Error(w, errInvalidPlayer.Error(), http.StatusNotFound)
+		return
+	}
+
+	unlocked, err := db.GetAchievementsContext(r.Context(), playerID)
+	if err != nil {
+		log.Printf("Failed to load achievements of player %s: %v", playerID, err)
+		http.Error(w, "Failed to load achievements", http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]db.Achievement, len(unlocked))
+	for _, a := range unlocked {
+		byID[a.AchievementID] = a
+	}
+
+	progress := achievementTracker.Progress(playerID)
+	defs := achievementTracker.Definitions()
+	views := make([]AchievementView, 0, len(defs))
+	for _, d := range defs {
+		view := AchievementView{ID: d.ID, Name: d.Name, Description: d.Description}
+		if a, ok := byID[d.ID]; ok {
+			unlockedAt := a.UnlockedAt.UTC()
+			view.Unlocked = true
+			view.UnlockedAt = &unlockedAt
+			view.RequestID = a.RequestID
+		} else if d.Streak > 1 {
+			view.Progress = progress[d.ID]
+			view.Goal = d.Streak
+		}
+		views = append(views, view)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
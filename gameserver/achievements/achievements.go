@@ -0,0 +1,198 @@
+// achievements: badges players unlock by playing a certain way
+// each one is a few conditions on a decision, plus how many in a row it takes
+// gameserver/achievements/achievements.go
+
+package achievements
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+)
+
+// Definition is one achievement and what a decision has to look like to count towards it
+// conditions left empty match anything
+type Definition struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Action      string          `json:"action,omitempty"`    // the player picked this action
+	Alignment   string          `json:"alignment,omitempty"` // pure or evil
+	QType       string          `json:"qtype,omitempty"`     // record type, like AAAA
+	Within      config.Duration `json:"within,omitempty"`    // decided in under this long after the query came in
+	Protected   bool            `json:"protected,omitempty"` // the domain is protected by a rule
+	Streak      int             `json:"streak,omitempty"`    // this many matching decisions in a row (default 1)
+}
+
+// Match reports whether a decision meets the definition's conditions
+func (d Definition) Match(dec Decision) bool {
+	switch {
+	case d.Action != "" && dec.Action != d.Action:
+		return false
+	case d.Alignment != "" && dec.Alignment != d.Alignment:
+		return false
+	case d.QType != "" && dec.QType != d.QType:
+		return false
+	case d.Within > 0 && dec.Elapsed >= time.Duration(d.Within):
+		return false
+	case d.Protected && !dec.Protected:
+		return false
+	}
+	return true
+}
+
+// Config lists the achievements
+type Config struct {
+	Achievements []Definition `json:"achievements"`
+}
+
+// DefaultConfig is the starter set
+func DefaultConfig() Config {
+	return Config{Achievements: []Definition{
+		{ID: "first_corruption", Name: "First Blood", Description: "Corrupt your first DNS answer", Action: "corrupt"},
+		{ID: "pure_streak_100", Name: "Incorruptible", Description: "Make 100 pure decisions in a row", Alignment: "pure", Streak: 100},
+		{ID: "corrupted_aaaa", Name: "Six Ways From Sunday", Description: "Corrupt an AAAA record", Action: "corrupt", QType: "AAAA"},
+		{ID: "quick_draw", Name: "Quick Draw", Description: "Decide a request in under 2 seconds", Within: config.Duration(2 * time.Second)},
+		{ID: "guardian", Name: "Guardian", Description: "Answer a protected domain correctly", Action: "correct", Protected: true},
+	}}
+}
+
+// LoadConfig reads an achievements config file
+func LoadConfig(path string) (Config, error) {
+	return config.Load(path, DefaultConfig())
+}
+
+// Validate catches achievements nobody could unlock or tell apart
+func (c Config) Validate() error {
+	seen := make(map[string]bool)
+	for _, d := range c.Achievements {
+		if d.ID == "" {
+			return fmt.Errorf("achievement %q needs an id", d.Name)
+		}
+		if seen[d.ID] {
+			return fmt.Errorf("achievement %q is defined twice", d.ID)
+		}
+		seen[d.ID] = true
+		if d.Name == "" {
+			return fmt.Errorf("achievement %q needs a name", d.ID)
+		}
+		if d.Alignment != "" && d.Alignment != "pure" && d.Alignment != "evil" {
+			return fmt.Errorf("achievement %q: alignment must be pure or evil", d.ID)
+		}
+		if d.Streak < 0 || d.Within < 0 {
+			return fmt.Errorf("achievement %q: streak and within can't be negative", d.ID)
+		}
+	}
+	return nil
+}
+
+// Decision is what the tracker needs to know about one player's call
+type Decision struct {
+	PlayerID  string
+	RequestID string
+	Action    string
+	Alignment string        // pure or evil, from the scoring rules
+	QType     string        // A, AAAA, MX, etc
+	Elapsed   time.Duration // from the query coming in to the decision
+	Protected bool          // a rule restricted what could be done to the domain
+	At        time.Time
+}
+
+// Unlock is an achievement a player just earned
+type Unlock struct {
+	PlayerID    string
+	Achievement Definition
+	RequestID   string // the decision that did it
+	At          time.Time
+}
+
+// Tracker counts streaks and remembers who has unlocked what
+//
+// streaks only live in memory, so a restart sends everyone back to zero on the
+// ones they haven't finished. unlocked achievements are the caller's to persist
+type Tracker struct {
+	defs []Definition
+
+	mu       sync.Mutex
+	streaks  map[string]map[string]int  // player -> achievement -> matching decisions in a row
+	unlocked map[string]map[string]bool // player -> achievement
+}
+
+// NewTracker starts a tracker with nobody having unlocked anything
+func NewTracker(defs []Definition) *Tracker {
+	return &Tracker{
+		defs:     defs,
+		streaks:  make(map[string]map[string]int),
+		unlocked: make(map[string]map[string]bool),
+	}
+}
+
+// Definitions returns the achievements being tracked
+func (t *Tracker) Definitions() []Definition {
+	return t.defs
+}
+
+// Restore marks achievements a player unlocked before, so they aren't handed out twice
+func (t *Tracker) Restore(playerID string, ids []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, id := range ids {
+		t.unlockedBy(playerID)[id] = true
+	}
+}
+
+// Observe feeds a decision to every achievement the player hasn't unlocked yet
+// and returns the ones it completed
+func (t *Tracker) Observe(dec Decision) []Unlock {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	unlocked := t.unlockedBy(dec.PlayerID)
+	streaks := t.streaks[dec.PlayerID]
+	if streaks == nil {
+		streaks = make(map[string]int)
+		t.streaks[dec.PlayerID] = streaks
+	}
+
+	var unlocks []Unlock
+	for _, d := range t.defs {
+		if unlocked[d.ID] {
+			continue
+		}
+		if !d.Match(dec) {
+			delete(streaks, d.ID)
+			continue
+		}
+		streaks[d.ID]++
+		if streaks[d.ID] < d.Streak {
+			continue
+		}
+		delete(streaks, d.ID)
+		unlocked[d.ID] = true
+		unlocks = append(unlocks, Unlock{PlayerID: dec.PlayerID, Achievement: d, RequestID: dec.RequestID, At: dec.At})
+	}
+	return unlocks
+}
+
+// Progress returns how far into each streak achievement a player is
+func (t *Tracker) Progress(playerID string) map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	progress := make(map[string]int, len(t.streaks[playerID]))
+	for id, n := range t.streaks[playerID] {
+		progress[id] = n
+	}
+	return progress
+}
+
+// unlockedBy returns a player's unlocked set, making it if needed. callers hold mu
+func (t *Tracker) unlockedBy(playerID string) map[string]bool {
+	set := t.unlocked[playerID]
+	if set == nil {
+		set = make(map[string]bool)
+		t.unlocked[playerID] = set
+	}
+	return set
+}
@@ -0,0 +1,117 @@
+// gameserver/achievements/achievements_test.go
+
+package achievements
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+)
+
+// TestMatch tests each condition a definition can put on a decision
+func TestMatch(t *testing.T) {
+	dec := Decision{Action: "corrupt", Alignment: "evil", QType: "AAAA", Elapsed: time.Second, Protected: true}
+	tests := []struct {
+		name string
+		def  Definition
+		want bool
+	}{
+		{"no conditions", Definition{}, true},
+		{"action", Definition{Action: "corrupt"}, true},
+		{"other action", Definition{Action: "correct"}, false},
+		{"alignment", Definition{Alignment: "evil"}, true},
+		{"other alignment", Definition{Alignment: "pure"}, false},
+		{"qtype", Definition{QType: "AAAA"}, true},
+		{"other qtype", Definition{QType: "MX"}, false},
+		{"within", Definition{Within: config.Duration(2 * time.Second)}, true},
+		{"not within", Definition{Within: config.Duration(time.Second)}, false},
+		{"protected", Definition{Protected: true}, true},
+		{"every condition", Definition{Action: "corrupt", Alignment: "evil", QType: "AAAA", Within: config.Duration(time.Minute), Protected: true}, true},
+		{"one condition off", Definition{Action: "corrupt", Alignment: "evil", QType: "A"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.def.Match(dec); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+	if (Definition{Protected: true}).Match(Decision{}) {
+		t.Error("Expected a protected-only achievement not to match an unprotected domain")
+	}
+}
+
+// TestTrackerStreaks tests that streak achievements unlock on the last decision in a row, once
+func TestTrackerStreaks(t *testing.T) {
+	streak := Definition{ID: "pure_3", Name: "Three Good Deeds", Alignment: "pure", Streak: 3}
+	tests := []struct {
+		name       string
+		alignments []string
+		want       []int // decisions, counting from 1, that unlocked it
+		progress   int
+	}{
+		{"three in a row", []string{"pure", "pure", "pure"}, []int{3}, 0},
+		{"not yet", []string{"pure", "pure"}, nil, 2},
+		{"broken streak starts over", []string{"pure", "pure", "evil", "pure", "pure"}, nil, 2},
+		{"only once", []string{"pure", "pure", "pure", "pure", "pure", "pure"}, []int{3}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTracker([]Definition{streak})
+			var got []int
+			for i, alignment := range tt.alignments {
+				if unlocks := tr.Observe(Decision{PlayerID: "alice", Alignment: alignment}); len(unlocks) > 0 {
+					got = append(got, i+1)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected unlocks on decisions %v, got %v", tt.want, got)
+			}
+			if p := tr.Progress("alice")[streak.ID]; p != tt.progress {
+				t.Errorf("Expected progress %d, got %d", tt.progress, p)
+			}
+		})
+	}
+}
+
+// TestTrackerRestore tests that restored achievements aren't handed out again, and players don't share them
+func TestTrackerRestore(t *testing.T) {
+	first := Definition{ID: "first_corruption", Name: "First Blood", Action: "corrupt"}
+	tr := NewTracker([]Definition{first})
+	tr.Restore("alice", []string{first.ID})
+
+	if unlocks := tr.Observe(Decision{PlayerID: "alice", Action: "corrupt"}); len(unlocks) != 0 {
+		t.Errorf("Expected alice's restored achievement to stay unlocked once, got %+v", unlocks)
+	}
+	at := time.Now()
+	unlocks := tr.Observe(Decision{PlayerID: "bob", RequestID: "req-1", Action: "corrupt", At: at})
+	want := []Unlock{{PlayerID: "bob", Achievement: first, RequestID: "req-1", At: at}}
+	if !reflect.DeepEqual(unlocks, want) {
+		t.Errorf("Expected %+v, got %+v", want, unlocks)
+	}
+}
+
+// TestValidate tests the achievement configs nobody could unlock or tell apart
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		defs    []Definition
+		wantErr bool
+	}{
+		{"default", DefaultConfig().Achievements, false},
+		{"no id", []Definition{{Name: "Nameless"}}, true},
+		{"no name", []Definition{{ID: "nameless"}}, true},
+		{"twice", []Definition{{ID: "a", Name: "A"}, {ID: "a", Name: "B"}}, true},
+		{"unknown alignment", []Definition{{ID: "a", Name: "A", Alignment: "chaotic"}}, true},
+		{"negative streak", []Definition{{ID: "a", Name: "A", Streak: -1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (Config{Achievements: tt.defs}).Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,761 @@
+// gameserver/admin.go
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/events"
+	"github.com/nicewrld/gameserver/rules"
+	"github.com/nicewrld/gameserver/scoring"
+	"github.com/nicewrld/gameserver/voting"
+)
+
+//////////////////////////////////////////
+// Admin Constants
+//////////////////////////////////////////
+
+const (
+	// AdminUserHeader names the moderator making an admin request, for the audit trail.
+	AdminUserHeader = "X-Admin-User"
+)
+
+//////////////////////////////////////////
+// Admin State
+//////////////////////////////////////////
+
+var (
+	// adminToken is the bearer token admin endpoints require. main sets it from ADMIN_TOKEN;
+	// while it is empty every admin endpoint refuses to run.
+	adminToken string
+
+	// gamePaused makes every DNS request resolve as "correct" without reaching players.
+	gamePaused atomic.Bool
+
+	errPlayerBanned    = errors.New("You have been banned.")
+	errRequestNotFound = errors.New("Unknown request")
+)
+
+//////////////////////////////////////////
+// Admin Authentication
+//////////////////////////////////////////
+
+// authenticateAdmin checks the request carries the admin token.
+func authenticateAdmin(r *http.Request) error {
+	token := sessionTokenFromRequest(r)
+	if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		log.Printf("Rejected admin request to %s from %s", r.URL.Path, r.RemoteAddr)
+		return errUnauthorized
+	}
+	return nil
+}
+
+// adminActor returns the moderator named by the request, for the audit trail.
+func adminActor(r *http.Request) string {
+	if actor := strings.TrimSpace(r.Header.Get(AdminUserHeader)); actor != "" {
+		return actor
+	}
+	return "admin"
+}
+
+// audit records an admin action. Failures are logged rather than undoing the action.
+func audit(r *http.Request, action, target string, detail interface{}) {
+	data, err := json.Marshal(detail)
+	if err != nil {
+		data = []byte("{}")
+	}
+	entry := db.AuditEntry{
+		Actor:     adminActor(r),
+		Action:    action,
+		Target:    target,
+		Detail:    string(data),
+		CreatedAt: time.Now(),
+	}
+	log.Printf("Admin %s: %s %s %s", entry.Actor, action, target, entry.Detail)
+	if err := db.InsertAudit(entry); err != nil {
+		log.Printf("Failed to write audit entry for %s %s: %v", action, target, err)
+	}
+}
+
+//////////////////////////////////////////
+// Admin Views
+//////////////////////////////////////////
+
+// AdminRequestView is a DNS request as shown to moderators, including who holds it.
+type AdminRequestView struct {
+	RequestID  string        `json:"request_id"`
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Class      string        `json:"class"`
+	ClientIP   string        `json:"client_ip"`
+	Timestamp  time.Time     `json:"timestamp"`
+	AgeSeconds float64       `json:"age_seconds"`
+	Assigned   bool          `json:"assigned"`
+	AssignedTo string        `json:"assigned_to,omitempty"`
+	TimedOut   bool          `json:"timed_out"`
+	Open       bool          `json:"open"`    // the DNS request handler is still waiting on it
+	Pending    bool          `json:"pending"` // still in the queue players are assigned from
+	Mode       string        `json:"mode"`
+	Votes      int           `json:"votes"`
+	Rules      rules.Verdict `json:"rules"`
+}
+
+// AdminPlayerView is a player as shown to moderators.
+type AdminPlayerView struct {
+	PlayerID          string  `json:"player_id"`
+	Nickname          string  `json:"nickname"`
+	PurePoints        float64 `json:"pure_points"`
+	EvilPoints        float64 `json:"evil_points"`
+	TeamID            string  `json:"team_id,omitempty"`
+	AssignedRequestID string  `json:"assigned_request_id,omitempty"`
+	Banned            bool    `json:"banned"`
+	Quarantined       bool    `json:"quarantined"`
+	Suspicion         float64 `json:"suspicion"`
+}
+
+// AuditView is an audit entry as returned by /admin/audit.
+type AuditView struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target,omitempty"`
+	Detail    json.RawMessage `json:"detail"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+//////////////////////////////////////////
+// Admin Functions
+//////////////////////////////////////////
+
+// adminRequestViews lists every DNS request the server is holding, oldest first.
+func adminRequestViews() []AdminRequestView {
+	pending := make(map[string]bool)
+	pendingRequestsMu.Lock()
+	for _, req := range pendingRequests {
+		pending[req.RequestID] = true
+	}
+	pendingRequestsMu.Unlock()
+
+	now := time.Now()
+	dnsRequestsMu.RLock()
+	views := make([]AdminRequestView, 0, len(dnsRequests))
+	for _, req := range dnsRequests {
+		views = append(views, adminRequestView(req, pending[req.RequestID], now))
+	}
+	dnsRequestsMu.RUnlock()
+
+	sort.Slice(views, func(i, j int) bool { return views[i].Timestamp.Before(views[j].Timestamp) })
+	return views
+}
+
+// adminRequestView builds the moderator's view of a DNS request.
+func adminRequestView(req *DNSRequest, pending bool, now time.Time) AdminRequestView {
+	assigned, assignedTo := requestAssignee(req)
+	view := AdminRequestView{
+		RequestID:  req.RequestID,
+		Name:       req.Name,
+		Type:       req.Type,
+		Class:      req.Class,
+		ClientIP:   req.ClientIP,
+		Timestamp:  req.Timestamp,
+		AgeSeconds: now.Sub(req.Timestamp).Seconds(),
+		Assigned:   assigned,
+		AssignedTo: assignedTo,
+		TimedOut:   req.timedOut(),
+		Open:       requestOpen(req),
+		Pending:    pending,
+		Mode:       voting.ModeSingle,
+		Rules:      req.Rules,
+	}
+	if req.ballot != nil {
+		view.Mode = voting.ModeVote
+		view.Votes = len(req.ballot.Votes())
+	}
+	return view
+}
+
+// forceResolve answers a DNS request on an admin's behalf. Nobody scores a forced decision.
+func forceResolve(requestID, action string) error {
+	if !validActions[action] {
+		return errInvalidAction
+	}
+	dnsRequestsMu.RLock()
+	dnsReq, exists := dnsRequests[requestID]
+	dnsRequestsMu.RUnlock()
+	if !exists {
+		return errRequestNotFound
+	}
+	if !requestOpen(dnsReq) || !notifyDNSRequestHandler(requestID, action) {
+		return errRequestHandled
+	}
+
+	// awaitBallot records forced votes itself, as the ballot has to be closed first.
+	if dnsReq.ballot != nil {
+		return nil
+	}
+
+	now := time.Now()
+	cleanupDNSRequest(requestID, action)
+	recordDecision(dnsReq, "", action, false, now, nil)
+	trackObjectives(dnsReq, "", action, now)
+	eventBus.Publish(events.Event{
+		Type:      events.RequestDecided,
+		RequestID: requestID,
+		Domain:    dnsReq.Name,
+		Data:      map[string]interface{}{"action": action, "forced": true},
+	})
+	return nil
+}
+
+// resolveOpenRequests force-resolves every request still waiting on players and returns how many it resolved.
+func resolveOpenRequests(action string) int {
+	dnsRequestsMu.RLock()
+	ids := make([]string, 0, len(dnsRequests))
+	for id := range dnsRequests {
+		ids = append(ids, id)
+	}
+	dnsRequestsMu.RUnlock()
+
+	resolved := 0
+	for _, id := range ids {
+		if forceResolve(id, action) == nil {
+			resolved++
+		}
+	}
+	return resolved
+}
+
+// loadBans marks banned players loaded from the database.
+func loadBans() {
+	bans, err := db.GetBans()
+	if err != nil {
+		log.Printf("Warning: Failed to load bans from database: %v", err)
+		return
+	}
+	playersMu.Lock()
+	for id := range bans {
+		if player, exists := players[id]; exists {
+			player.Banned = true
+		}
+	}
+	playersMu.Unlock()
+	log.Printf("Loaded %d bans from database", len(bans))
+}
+
+// playerBanned reports whether a player is banned.
+func playerBanned(playerID string) bool {
+	playersMu.RLock()
+	defer playersMu.RUnlock()
+	player, exists := players[playerID]
+	return exists && player.Banned
+}
+
+// setBanned bans or unbans a player, taking away any request they hold.
+func setBanned(playerID string, banned bool) (string, error) {
+	playersMu.Lock()
+	player, exists := players[playerID]
+	if !exists {
+		playersMu.Unlock()
+		return "", errInvalidPlayer
+	}
+	player.Banned = banned
+	rankPlayer(player)
+	held := player.AssignedRequestID
+	if banned {
+		player.AssignedRequestID = ""
+	}
+	playersMu.Unlock()
+
+	if banned && held != "" {
+		endAssignment(playerID, held, outcomeReleased, time.Now())
+		returnToQueue(held, playerID)
+	}
+	return held, nil
+}
+
+// returnToQueue puts a request taken from a player back in front of everyone else.
+func returnToQueue(requestID, playerID string) {
+	dnsRequestsMu.RLock()
+	dnsReq, exists := dnsRequests[requestID]
+	dnsRequestsMu.RUnlock()
+	if !exists || dnsReq.ballot != nil || !requestOpen(dnsReq) {
+		return
+	}
+
+	pendingRequestsMu.Lock()
+	defer pendingRequestsMu.Unlock()
+	if dnsReq.AssignedTo != playerID {
+		return
+	}
+	dnsReq.Assigned = false
+	dnsReq.AssignedTo = ""
+	dnsReq.answer = ""
+	pendingRequests = append([]*DNSRequest{dnsReq}, pendingRequests...)
+	pendingDNSRequests.Set(float64(len(pendingRequests)))
+}
+
+// adminPlayerView builds the moderator's view of a player. Callers must hold playersMu.
+func adminPlayerView(player *Player) AdminPlayerView {
+	return AdminPlayerView{
+		PlayerID:          player.ID,
+		Nickname:          player.Nickname,
+		PurePoints:        player.PurePoints,
+		EvilPoints:        player.EvilPoints,
+		TeamID:            player.TeamID,
+		AssignedRequestID: player.AssignedRequestID,
+		Banned:            player.Banned,
+		Quarantined:       player.Quarantined,
+		Suspicion:         antiCheat.Report(player.ID, time.Now()).Score,
+	}
+}
+
+//////////////////////////////////////////
+// Admin Handlers
+//////////////////////////////////////////
+
+// adminHandler routes everything under /admin/. Every admin endpoint needs the admin token,
+// and everything that changes the game is written to the audit trail.
+//
+//	GET  /admin/requests                      open DNS requests and who holds them
+//	GET  /admin/requests/{id}                 one request
+//	POST /admin/requests/{id}/resolve?action= answer a request now
+//	GET  /admin/players?q=&limit=             search players by id or nickname
+//	GET  /admin/players/{id}                  one player
+//	POST /admin/players/{id}/ban              {"reason": "..."}
+//	POST /admin/players/{id}/unban
+//	POST /admin/players/{id}/rename           {"nickname": "..."}
+//	POST /admin/players/{id}/points           {"pure": 0, "evil": 0, "reason": "..."}
+//	POST /admin/players/{id}/quarantine       hide from leaderboards pending review
+//	POST /admin/players/{id}/release          clear anti-cheat suspicion and unhide
+//	GET  /admin/suspects?min=                 players anti-cheat has flagged
+//	GET  /admin/assignments?request_id=&player_id=&outcome=&cursor=&limit=
+//	                                          who held which request and how it ended
+//	GET  /admin/audit?target=&cursor=&limit=  the audit trail, newest first
+//	GET  /admin/export?kind=&format=          stream players, decisions or seasons as jsonl or csv
+//	POST /admin/import?kind=&format=          load an export back in, skipping what's already there
+//	POST /admin/pause, /admin/resume          answer everything "correct" while paused
+//	GET  /admin/config                        scoring, voting and rules in effect
+//	PUT  /admin/config/scoring, /voting       replace a config until the next restart
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if err := authenticateAdmin(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/"), "/")
+	switch {
+	case parts[0] == "requests":
+		adminRequestsHandler(w, r, parts[1:])
+	case parts[0] == "players":
+		adminPlayersHandler(w, r, parts[1:])
+	case parts[0] == "suspects" && len(parts) == 1:
+		adminSuspectsHandler(w, r)
+	case parts[0] == "assignments" && len(parts) == 1:
+		adminAssignmentsHandler(w, r)
+	case parts[0] == "audit" && len(parts) == 1:
+		adminAuditHandler(w, r)
+	case parts[0] == "export" && len(parts) == 1:
+		adminExportHandler(w, r)
+	case parts[0] == "import" && len(parts) == 1:
+		adminImportHandler(w, r)
+	case (parts[0] == "pause" || parts[0] == "resume") && len(parts) == 1:
+		adminPauseHandler(w, r, parts[0] == "pause")
+	case parts[0] == "config":
+		adminConfigHandler(w, r, parts[1:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// adminRequestsHandler lists, shows and force-resolves DNS requests.
+func adminRequestsHandler(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 || (len(parts) == 1 && parts[0] == ""):
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(adminRequestViews())
+
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		for _, view := range adminRequestViews() {
+			if view.RequestID == parts[0] {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(view)
+				return
+			}
+		}
+		http.Error(w, errRequestNotFound.Error(), http.StatusNotFound)
+
+	case len(parts) == 2 && parts[1] == "resolve":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		action := r.URL.Query().Get("action")
+		if action == "" {
+			action = voting.FallbackAction
+		}
+		switch err := forceResolve(parts[0], action); err {
+		case nil:
+		case errRequestNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errRequestHandled:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		audit(r, "resolve", parts[0], map[string]string{"action": action})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// adminPlayersHandler searches, shows and moderates players.
+func adminPlayersHandler(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 0 || (len(parts) == 1 && parts[0] == "") {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		adminPlayerSearchHandler(w, r)
+		return
+	}
+
+	playerID := parts[0]
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		playersMu.RLock()
+		player, exists := players[playerID]
+		var view AdminPlayerView
+		if exists {
+			view = adminPlayerView(player)
+		}
+		playersMu.RUnlock()
+		if !exists {
+			http.Error(w, errInvalidPlayer.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(view)
+		return
+	}
+
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch parts[1] {
+	case "ban":
+		adminBanHandler(w, r, playerID)
+	case "unban":
+		adminUnbanHandler(w, r, playerID)
+	case "rename":
+		adminRenameHandler(w, r, playerID)
+	case "points":
+		adminPointsHandler(w, r, playerID)
+	case "quarantine":
+		adminQuarantineHandler(w, r, playerID)
+	case "release":
+		adminReleaseHandler(w, r, playerID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// adminPlayerSearchHandler finds players whose id or nickname contains q, ordered by id.
+//
+// Query parameters: q, limit.
+func adminPlayerSearchHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, defaultHistoryLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := strings.ToLower(r.URL.Query().Get("q"))
+
+	playersMu.RLock()
+	views := make([]AdminPlayerView, 0)
+	for _, player := range players {
+		if query == "" || strings.Contains(strings.ToLower(player.ID), query) ||
+			strings.Contains(strings.ToLower(player.Nickname), query) {
+			views = append(views, adminPlayerView(player))
+		}
+	}
+	playersMu.RUnlock()
+
+	sort.Slice(views, func(i, j int) bool { return views[i].PlayerID < views[j].PlayerID })
+	if len(views) > limit {
+		views = views[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// adminBanHandler bans a player, hiding them from leaderboards and returning any request they hold.
+func adminBanHandler(w http.ResponseWriter, r *http.Request, playerID string) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Reason) == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+
+	held, err := setBanned(playerID, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	ban := db.Ban{PlayerID: playerID, Reason: body.Reason, BannedBy: adminActor(r), BannedAt: time.Now()}
+	if err := db.BanPlayer(ban); err != nil {
+		log.Printf("Failed to persist ban for player %s: %v", playerID, err)
+		http.Error(w, "Player banned but the ban could not be saved", http.StatusInternalServerError)
+		return
+	}
+	audit(r, "ban", playerID, map[string]string{"reason": body.Reason, "released_request": held})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminUnbanHandler lifts a player's ban.
+func adminUnbanHandler(w http.ResponseWriter, r *http.Request, playerID string) {
+	if _, err := setBanned(playerID, false); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := db.UnbanPlayer(playerID); err != nil {
+		log.Printf("Failed to remove ban for player %s: %v", playerID, err)
+		http.Error(w, "Player unbanned but the change could not be saved", http.StatusInternalServerError)
+		return
+	}
+	audit(r, "unban", playerID, struct{}{})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminRenameHandler replaces a player's nickname. Moderators skip the rename cooldown but not the nickname rules.
+func adminRenameHandler(w http.ResponseWriter, r *http.Request, playerID string) {
+	var body struct {
+		Nickname string `json:"nickname"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request data.", http.StatusBadRequest)
+		return
+	}
+
+	previous, nickname, err := renamePlayer(r.Context(), playerID, body.Nickname, adminActor(r))
+	if err != nil {
+		http.Error(w, err.Error(), nicknameErrorStatus(err))
+		return
+	}
+	audit(r, "rename", playerID, map[string]string{"from": previous, "to": nickname})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminPointsHandler adds to or takes from a player's score. The change syncs to the database like any other award.
+func adminPointsHandler(w http.ResponseWriter, r *http.Request, playerID string) {
+	var body struct {
+		Pure   float64 `json:"pure"`
+		Evil   float64 `json:"evil"`
+		Reason string  `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request data.", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(body.Reason) == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+	if body.Pure == 0 && body.Evil == 0 {
+		http.Error(w, "Nothing to adjust", http.StatusBadRequest)
+		return
+	}
+
+	var awards []scoring.Award
+	if body.Pure != 0 {
+		awards = append(awards, scoring.Award{Rule: "admin_adjustment", Alignment: "pure", Points: body.Pure, Detail: body.Reason})
+	}
+	if body.Evil != 0 {
+		awards = append(awards, scoring.Award{Rule: "admin_adjustment", Alignment: "evil", Points: body.Evil, Detail: body.Reason})
+	}
+
+	playersMu.Lock()
+	player, exists := players[playerID]
+	var view AdminPlayerView
+	if exists {
+		applyAwards(player, awards)
+		view = adminPlayerView(player)
+	}
+	playersMu.Unlock()
+	if !exists {
+		http.Error(w, errInvalidPlayer.Error(), http.StatusNotFound)
+		return
+	}
+
+	audit(r, "adjust_points", playerID, body)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// adminAuditHandler returns a page of the audit trail, newest first.
+//
+// Query parameters: target, cursor, limit.
+func adminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit, err := parseLimit(r, defaultHistoryLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var beforeID int64
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		beforeID, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || beforeID <= 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := db.QueryAuditContext(r.Context(), r.URL.Query().Get("target"), beforeID, limit)
+	if err != nil {
+		log.Printf("Failed to query audit trail: %v", err)
+		http.Error(w, "Failed to load audit trail", http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		Entries    []AuditView `json:"entries"`
+		NextCursor string      `json:"next_cursor,omitempty"`
+	}{Entries: make([]AuditView, 0, len(entries))}
+	for _, e := range entries {
+		page.Entries = append(page.Entries, AuditView{
+			ID:        e.ID,
+			Actor:     e.Actor,
+			Action:    e.Action,
+			Target:    e.Target,
+			Detail:    json.RawMessage(e.Detail),
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	if len(entries) == limit {
+		page.NextCursor = strconv.FormatInt(entries[len(entries)-1].ID, 10)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// adminPauseHandler pauses or resumes the game. Pausing answers every open request "correct".
+func adminPauseHandler(w http.ResponseWriter, r *http.Request, pause bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !pause {
+		gamePaused.Store(false)
+		audit(r, "resume", "", struct{}{})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	gamePaused.Store(true)
+	resolved := resolveOpenRequests(voting.FallbackAction)
+	audit(r, "pause", "", map[string]int{"resolved": resolved})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"resolved": resolved})
+}
+
+// adminConfigHandler shows the config in effect and swaps scoring or voting config at runtime.
+//
+// Replaced configs last until the next restart; domain rules live at /admin/rules.
+func adminConfigHandler(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 0 || (len(parts) == 1 && parts[0] == "") {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminConfig(w)
+		return
+	}
+	if len(parts) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch parts[0] {
+	case "scoring":
+		cfg := scoring.DefaultConfig()
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, "Invalid scoring config: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := cfg.Validate(); err != nil {
+			http.Error(w, "Invalid scoring config: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		setScoringEngine(scoring.NewEngine(cfg))
+		audit(r, "set_scoring", "", cfg)
+	case "voting":
+		cfg := voting.DefaultConfig()
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, "Invalid voting config: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := cfg.Validate(); err != nil {
+			http.Error(w, "Invalid voting config: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		setVotingConfig(cfg)
+		audit(r, "set_voting", "", cfg)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	writeAdminConfig(w)
+}
+
+// writeAdminConfig writes the config in effect.
+func writeAdminConfig(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Paused  bool           `json:"paused"`
+		Scoring scoring.Config `json:"scoring"`
+		Voting  voting.Config  `json:"voting"`
+		Rules   rules.Config   `json:"rules"`
+	}{gamePaused.Load(), currentScoringEngine().Config(), currentVotingConfig(), rulesEngine.Config()})
+}
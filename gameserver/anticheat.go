@@ -0,0 +1,336 @@
+// gameserver/anticheat.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicewrld/gameserver/anticheat"
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//////////////////////////////////////////
+// Anti-Cheat Metrics
+//////////////////////////////////////////
+
+var (
+	// antiCheatSignals counts inhuman behaviour by kind.
+	antiCheatSignals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gameserver_anticheat_signals_total",
+		Help: "Suspicious behaviour detected, by signal (fast_decision, regular_timing, shared_sequence, rate_limited)",
+	}, []string{"signal"})
+
+	// rateLimitedRequests counts calls turned away by the assign and submit rate limits.
+	rateLimitedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gameserver_rate_limited_total",
+		Help: "Assign and submit calls rejected for going too fast, by endpoint and limit (player, ip)",
+	}, []string{"endpoint", "scope"})
+
+	// quarantinedPlayers tracks how many players are hidden from the leaderboard pending review.
+	quarantinedPlayers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gameserver_quarantined_players",
+		Help: "Players pulled off the leaderboard by anti-cheat and waiting for an admin",
+	})
+)
+
+//////////////////////////////////////////
+// Anti-Cheat State
+//////////////////////////////////////////
+
+// rateLimits holds a player and a client address token bucket for each rate limited endpoint.
+type rateLimits struct {
+	player *ratelimit.Limiter
+	ip     *ratelimit.Limiter
+}
+
+var (
+	// antiCheat watches decisions for bots. main replaces it when ANTICHEAT_CONFIG is set.
+	antiCheat = anticheat.NewDetector(anticheat.DefaultConfig())
+
+	// endpointLimits rate limits assigning and submitting, keyed by endpoint.
+	endpointLimits = newEndpointLimits(anticheat.DefaultConfig())
+
+	// trustedProxies are peers allowed to tell us the client's address in X-Forwarded-For.
+	// main replaces them when TRUSTED_PROXIES is set.
+	trustedProxies = parseCIDRs("127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7")
+
+	errRateLimited = errors.New("Slow down! You're making requests too quickly.")
+)
+
+// newEndpointLimits builds the assign and submit limiters from an anti-cheat config.
+func newEndpointLimits(cfg anticheat.Config) map[string]rateLimits {
+	limiter := func(l anticheat.Limit) *ratelimit.Limiter {
+		return ratelimit.New(time.Duration(l.Every), l.Burst)
+	}
+	return map[string]rateLimits{
+		"assign": {player: limiter(cfg.Assign), ip: limiter(cfg.AssignIP)},
+		"submit": {player: limiter(cfg.Submit), ip: limiter(cfg.SubmitIP)},
+	}
+}
+
+//////////////////////////////////////////
+// Anti-Cheat Functions
+//////////////////////////////////////////
+
+// parseCIDRs parses a comma-separated list of CIDRs, skipping (and logging) bad entries.
+func parseCIDRs(list string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Warning: Ignoring invalid CIDR %q: %v", entry, err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// trustedProxy reports whether ip belongs to a proxy we trust to forward client addresses.
+func trustedProxy(ip net.IP) bool {
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the player behind a request. X-Forwarded-For is only believed
+// when it was added by a trusted proxy, walking back from the nearest hop to the first one we don't trust.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trustedProxy(ip) {
+		return host
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// allowCall spends a token from the player's and the client address's bucket for an endpoint.
+// Players who hit a limit pick up a little suspicion.
+func allowCall(endpoint, playerID, ip string) error {
+	limits := endpointLimits[endpoint]
+	scope := ""
+	switch {
+	case !limits.player.Allow(playerID):
+		scope = "player"
+	case ip != "" && !limits.ip.Allow(ip):
+		scope = "ip"
+	default:
+		return nil
+	}
+
+	rateLimitedRequests.With(prometheus.Labels{"endpoint": endpoint, "scope": scope}).Inc()
+	raiseFlags([]anticheat.Flag{{PlayerID: playerID, Signal: anticheat.SignalRateLimited, Detail: endpoint + " limit (" + scope + ")"}}, time.Now())
+	return errRateLimited
+}
+
+// observeAssignment starts the clock on how quickly a player answers a request.
+func observeAssignment(playerID, requestID string, at time.Time) {
+	antiCheat.Assigned(playerID, requestID, at)
+}
+
+// observeDecision checks a decision for inhuman patterns.
+func observeDecision(playerID, requestID, action string, at time.Time) {
+	raiseFlags(antiCheat.Decided(playerID, requestID, action, at), at)
+}
+
+// raiseFlags counts and logs anti-cheat flags and quarantines anyone they push over the limit.
+// Flags from Decided are already scored; others are scored here.
+func raiseFlags(flags []anticheat.Flag, at time.Time) {
+	for _, f := range flags {
+		if f.Signal == anticheat.SignalRateLimited {
+			antiCheat.Flag(f, at)
+		}
+		antiCheatSignals.With(prometheus.Labels{"signal": string(f.Signal)}).Inc()
+		log.Printf("[PlayerID: %s] Anti-cheat %s: %s", f.PlayerID, f.Signal, f.Detail)
+
+		if report := antiCheat.Report(f.PlayerID, at); report.Score >= antiCheat.Config().QuarantineScore {
+			quarantinePlayer(f.PlayerID, string(f.Signal)+": "+f.Detail, report.Score)
+		}
+	}
+}
+
+// quarantinePlayer hides a player from leaderboards until an admin releases them.
+func quarantinePlayer(playerID, reason string, score float64) {
+	playersMu.Lock()
+	player, exists := players[playerID]
+	already := exists && player.Quarantined
+	if exists {
+		player.Quarantined = true
+		rankPlayer(player)
+	}
+	playersMu.Unlock()
+	if !exists || already {
+		return
+	}
+
+	quarantinedPlayers.Inc()
+	log.Printf("[PlayerID: %s] Quarantined from the leaderboard (suspicion %.1f, %s)", playerID, score, reason)
+	err := db.QuarantinePlayer(db.Quarantine{PlayerID: playerID, Reason: reason, Score: score, QuarantinedAt: time.Now()})
+	if err != nil {
+		log.Printf("Warning: Failed to persist quarantine of player %s: %v", playerID, err)
+	}
+}
+
+// releasePlayer puts a quarantined player back on the leaderboard and forgets their suspicion.
+func releasePlayer(playerID string) error {
+	playersMu.Lock()
+	player, exists := players[playerID]
+	was := exists && player.Quarantined
+	if exists {
+		player.Quarantined = false
+		rankPlayer(player)
+	}
+	playersMu.Unlock()
+	if !exists {
+		return errInvalidPlayer
+	}
+
+	antiCheat.Clear(playerID)
+	if was {
+		quarantinedPlayers.Dec()
+	}
+	return db.ReleasePlayer(playerID)
+}
+
+// loadQuarantine marks quarantined players loaded from the database.
+func loadQuarantine() {
+	quarantined, err := db.GetQuarantined()
+	if err != nil {
+		log.Printf("Warning: Failed to load quarantined players from database: %v", err)
+		return
+	}
+	count := 0
+	playersMu.Lock()
+	for id := range quarantined {
+		if player, exists := players[id]; exists {
+			player.Quarantined = true
+			count++
+		}
+	}
+	playersMu.Unlock()
+	quarantinedPlayers.Set(float64(count))
+}
+
+// listed reports whether a player belongs on public leaderboards. Callers must hold playersMu.
+func listed(player *Player) bool {
+	return !player.Banned && !player.Quarantined
+}
+
+//////////////////////////////////////////
+// Anti-Cheat Handlers
+//////////////////////////////////////////
+
+// SuspectView is a player anti-cheat has its eye on, as returned by /admin/suspects.
+type SuspectView struct {
+	anticheat.Report
+	Nickname    string `json:"nickname"`
+	Quarantined bool   `json:"quarantined"`
+}
+
+// adminSuspectsHandler lists players with suspicion, most suspicious first, along with quarantined
+// players whose suspicion has since decayed.
+//
+// Query parameters: min (default: any suspicion).
+func adminSuspectsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var min float64
+	if value := r.URL.Query().Get("min"); value != "" {
+		var err error
+		if min, err = strconv.ParseFloat(value, 64); err != nil {
+			http.Error(w, "Invalid min", http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	reports := antiCheat.Suspects(min, now)
+	seen := make(map[string]bool, len(reports))
+	views := make([]SuspectView, 0, len(reports))
+
+	playersMu.RLock()
+	for _, report := range reports {
+		seen[report.PlayerID] = true
+		view := SuspectView{Report: report}
+		if player, exists := players[report.PlayerID]; exists {
+			view.Nickname = player.Nickname
+			view.Quarantined = player.Quarantined
+		}
+		views = append(views, view)
+	}
+	for _, player := range players {
+		if player.Quarantined && !seen[player.ID] {
+			views = append(views, SuspectView{Report: antiCheat.Report(player.ID, now), Nickname: player.Nickname, Quarantined: true})
+		}
+	}
+	playersMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// adminQuarantineHandler pulls a player off the leaderboard by hand.
+func adminQuarantineHandler(w http.ResponseWriter, r *http.Request, playerID string) {
+	report := antiCheat.Report(playerID, time.Now())
+	playersMu.RLock()
+	_, exists := players[playerID]
+	playersMu.RUnlock()
+	if !exists {
+		http.Error(w, errInvalidPlayer.Error(), http.StatusNotFound)
+		return
+	}
+	quarantinePlayer(playerID, "quarantined by "+adminActor(r), report.Score)
+	audit(r, "quarantine", playerID, report)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminReleaseHandler clears a player after review, putting them back on the leaderboard.
+func adminReleaseHandler(w http.ResponseWriter, r *http.Request, playerID string) {
+	report := antiCheat.Report(playerID, time.Now())
+	switch err := releasePlayer(playerID); err {
+	case nil:
+	case errInvalidPlayer:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		log.Printf("Failed to release player %s: %v", playerID, err)
+		http.Error(w, "Player released but the change could not be saved", http.StatusInternalServerError)
+		return
+	}
+	audit(r, "release", playerID, report)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,376 @@
+// spotting scripts pretending to be players
+// humans are slow, jittery and unpredictable, bots usually aren't
+// gameserver/anticheat/anticheat.go
+
+package anticheat
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+)
+
+// Signal is something a player did that a human rarely does
+type Signal string
+
+const (
+	SignalFast        Signal = "fast_decision"   // decided quicker than anyone can read a domain
+	SignalRegular     Signal = "regular_timing"  // decisions spaced like clockwork
+	SignalSequence    Signal = "shared_sequence" // same run of actions as another account
+	SignalRateLimited Signal = "rate_limited"    // hammered assign or submit
+)
+
+// Limit is a token bucket: one call per Every, saving up to Burst
+type Limit struct {
+	Every config.Duration `json:"every"`
+	Burst int             `json:"burst"`
+}
+
+// Config tunes the limits and detectors
+type Config struct {
+	Assign   Limit `json:"assign"`    // per player
+	AssignIP Limit `json:"assign_ip"` // per client address, shared by everyone behind a NAT
+	Submit   Limit `json:"submit"`
+	SubmitIP Limit `json:"submit_ip"`
+
+	FastDecision   config.Duration `json:"fast_decision"`   // decisions quicker than this after assignment are flagged
+	RegularWindow  int             `json:"regular_window"`  // how many gaps between decisions to look at
+	RegularJitter  float64         `json:"regular_jitter"`  // flag when the gaps vary less than this (stddev / mean)
+	SequenceLength int             `json:"sequence_length"` // how many actions in a row make a fingerprint
+	SequenceWindow config.Duration `json:"sequence_window"` // how long fingerprints are remembered
+
+	Weights         map[Signal]float64 `json:"weights"`          // suspicion added per signal
+	HalfLife        config.Duration    `json:"half_life"`        // suspicion halves this often
+	QuarantineScore float64            `json:"quarantine_score"` // pull a player off the leaderboard at this much suspicion
+}
+
+// DefaultConfig allows a brisk human pace and needs several strikes to quarantine
+func DefaultConfig() Config {
+	return Config{
+		Assign:   Limit{Every: config.Duration(500 * time.Millisecond), Burst: 10},
+		AssignIP: Limit{Every: config.Duration(50 * time.Millisecond), Burst: 100},
+		Submit:   Limit{Every: config.Duration(500 * time.Millisecond), Burst: 10},
+		SubmitIP: Limit{Every: config.Duration(50 * time.Millisecond), Burst: 100},
+
+		FastDecision:   config.Duration(100 * time.Millisecond),
+		RegularWindow:  10,
+		RegularJitter:  0.05,
+		SequenceLength: 12,
+		SequenceWindow: config.Duration(24 * time.Hour),
+
+		Weights: map[Signal]float64{
+			SignalFast:        1,
+			SignalRegular:     3,
+			SignalSequence:    5,
+			SignalRateLimited: 0.5,
+		},
+		HalfLife:        config.Duration(time.Hour),
+		QuarantineScore: 10,
+	}
+}
+
+// LoadConfig reads an anti-cheat config file over the defaults
+func LoadConfig(path string) (Config, error) {
+	return config.Load(path, DefaultConfig())
+}
+
+// Validate catches settings that would flag or limit everyone
+func (c Config) Validate() error {
+	for name, l := range map[string]Limit{"assign": c.Assign, "assign_ip": c.AssignIP, "submit": c.Submit, "submit_ip": c.SubmitIP} {
+		if l.Every <= 0 || l.Burst < 1 {
+			return fmt.Errorf("%s: every must be positive and burst at least 1", name)
+		}
+	}
+	if c.RegularWindow < 3 {
+		return fmt.Errorf("regular_window must be at least 3")
+	}
+	if c.SequenceLength < 4 {
+		return fmt.Errorf("sequence_length must be at least 4")
+	}
+	if c.HalfLife <= 0 {
+		return fmt.Errorf("half_life must be positive")
+	}
+	if c.QuarantineScore <= 0 {
+		return fmt.Errorf("quarantine_score must be positive")
+	}
+	return nil
+}
+
+// Flag is a signal raised against a player
+type Flag struct {
+	PlayerID string
+	Signal   Signal
+	Detail   string
+}
+
+// Report is what the detector thinks of a player
+type Report struct {
+	PlayerID   string         `json:"player_id"`
+	Score      float64        `json:"score"`
+	Signals    map[Signal]int `json:"signals"`
+	LastSignal time.Time      `json:"last_signal"`
+	LastDetail string         `json:"last_detail,omitempty"`
+}
+
+// Detector watches decisions and keeps a decaying suspicion score per player
+type Detector struct {
+	cfg Config
+
+	mu        sync.Mutex
+	players   map[string]*record
+	sequences map[string]sighting // fingerprint -> who made it last
+	calls     int
+}
+
+type record struct {
+	assigned   map[string]time.Time // request id -> when the player got it
+	decisions  []time.Time          // recent decision times, oldest first
+	actions    []string             // recent actions, oldest first
+	score      float64
+	scoredAt   time.Time
+	signals    map[Signal]int
+	lastSignal time.Time
+	lastDetail string
+}
+
+type sighting struct {
+	playerID string
+	at       time.Time
+}
+
+// pruneEvery is how many decisions go by between sweeps for stale fingerprints
+const pruneEvery = 1024
+
+// NewDetector starts watching with the given config
+func NewDetector(cfg Config) *Detector {
+	return &Detector{
+		cfg:       cfg,
+		players:   make(map[string]*record),
+		sequences: make(map[string]sighting),
+	}
+}
+
+// Config returns the detector's config
+func (d *Detector) Config() Config {
+	return d.cfg
+}
+
+func (d *Detector) record(playerID string) *record {
+	r, ok := d.players[playerID]
+	if !ok {
+		r = &record{assigned: make(map[string]time.Time), signals: make(map[Signal]int)}
+		d.players[playerID] = r
+	}
+	return r
+}
+
+// Assigned notes when a player was handed a request, so their reaction time can be measured
+func (d *Detector) Assigned(playerID, requestID string, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	r := d.record(playerID)
+	if _, ok := r.assigned[requestID]; !ok {
+		r.assigned[requestID] = at
+	}
+	// a player only holds one request at a time, so anything much older was abandoned
+	for id, t := range r.assigned {
+		if at.Sub(t) > 5*time.Minute {
+			delete(r.assigned, id)
+		}
+	}
+}
+
+// Decided feeds in a decision and returns every flag it raised, possibly against other players too
+func (d *Detector) Decided(playerID, requestID, action string, at time.Time) []Flag {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls++
+	if d.calls%pruneEvery == 0 {
+		d.prune(at)
+	}
+
+	r := d.record(playerID)
+	var flags []Flag
+
+	// reaction time, when we saw the assignment (chat players just shout, so we don't)
+	if assignedAt, ok := r.assigned[requestID]; ok {
+		delete(r.assigned, requestID)
+		if took := at.Sub(assignedAt); took < time.Duration(d.cfg.FastDecision) {
+			flags = append(flags, Flag{playerID, SignalFast, fmt.Sprintf("decided in %s", took.Round(time.Millisecond))})
+		}
+	}
+
+	// clockwork timing
+	r.decisions = appendCapped(r.decisions, at, d.cfg.RegularWindow+1)
+	if len(r.decisions) == d.cfg.RegularWindow+1 {
+		if mean, jitter := spacing(r.decisions); jitter < d.cfg.RegularJitter {
+			flags = append(flags, Flag{playerID, SignalRegular, fmt.Sprintf("every %s ±%.1f%%", mean.Round(time.Millisecond), jitter*100)})
+			// start over so one bot run isn't counted on every decision
+			r.decisions = r.decisions[:0]
+		}
+	}
+
+	// the same run of actions as someone else. runs of one action are how honest players play,
+	// so only mixed runs count as a fingerprint
+	r.actions = appendCapped(r.actions, action, d.cfg.SequenceLength)
+	if len(r.actions) == d.cfg.SequenceLength && !allSame(r.actions) {
+		fingerprint := strings.Join(r.actions, ",")
+		seen, ok := d.sequences[fingerprint]
+		if ok && seen.playerID != playerID && at.Sub(seen.at) < time.Duration(d.cfg.SequenceWindow) {
+			detail := fmt.Sprintf("same %d actions as %s", d.cfg.SequenceLength, seen.playerID)
+			flags = append(flags, Flag{playerID, SignalSequence, detail})
+			flags = append(flags, Flag{seen.playerID, SignalSequence, fmt.Sprintf("same %d actions as %s", d.cfg.SequenceLength, playerID)})
+			r.actions = r.actions[:0]
+		}
+		d.sequences[fingerprint] = sighting{playerID, at}
+	}
+
+	for _, f := range flags {
+		d.flag(f, at)
+	}
+	return flags
+}
+
+// Flag raises a signal against a player from outside, like a rate limit
+func (d *Detector) Flag(f Flag, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flag(f, at)
+}
+
+func (d *Detector) flag(f Flag, at time.Time) {
+	r := d.record(f.PlayerID)
+	r.score = d.decayed(r, at) + d.cfg.Weights[f.Signal]
+	r.scoredAt = at
+	r.signals[f.Signal]++
+	r.lastSignal = at
+	r.lastDetail = f.Detail
+}
+
+// decayed is the player's score as of at
+func (d *Detector) decayed(r *record, at time.Time) float64 {
+	if r.score == 0 || !at.After(r.scoredAt) {
+		return r.score
+	}
+	halves := float64(at.Sub(r.scoredAt)) / float64(d.cfg.HalfLife)
+	return r.score * math.Pow(0.5, halves)
+}
+
+// Suspicious reports whether a player has earned quarantine
+func (d *Detector) Suspicious(playerID string, at time.Time) bool {
+	return d.Report(playerID, at).Score >= d.cfg.QuarantineScore
+}
+
+// Report returns what the detector thinks of a player
+func (d *Detector) Report(playerID string, at time.Time) Report {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	r, ok := d.players[playerID]
+	if !ok {
+		return Report{PlayerID: playerID, Signals: map[Signal]int{}}
+	}
+	return d.report(playerID, r, at)
+}
+
+func (d *Detector) report(playerID string, r *record, at time.Time) Report {
+	signals := make(map[Signal]int, len(r.signals))
+	for s, n := range r.signals {
+		signals[s] = n
+	}
+	return Report{
+		PlayerID:   playerID,
+		Score:      math.Round(d.decayed(r, at)*100) / 100,
+		Signals:    signals,
+		LastSignal: r.lastSignal,
+		LastDetail: r.lastDetail,
+	}
+}
+
+// Suspects returns every player with at least min suspicion, most suspicious first
+func (d *Detector) Suspects(min float64, at time.Time) []Report {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var reports []Report
+	for id, r := range d.players {
+		if len(r.signals) == 0 {
+			continue
+		}
+		if report := d.report(id, r, at); report.Score >= min {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Score != reports[j].Score {
+			return reports[i].Score > reports[j].Score
+		}
+		return reports[i].PlayerID < reports[j].PlayerID
+	})
+	return reports
+}
+
+// Clear forgets everything held against a player, after an admin has looked at them
+func (d *Detector) Clear(playerID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.players, playerID)
+}
+
+// prune forgets old fingerprints and players with nothing left worth remembering
+func (d *Detector) prune(at time.Time) {
+	for fingerprint, seen := range d.sequences {
+		if at.Sub(seen.at) >= time.Duration(d.cfg.SequenceWindow) {
+			delete(d.sequences, fingerprint)
+		}
+	}
+	for id, r := range d.players {
+		idle := len(r.decisions) == 0 || at.Sub(r.decisions[len(r.decisions)-1]) > time.Duration(d.cfg.HalfLife)
+		if idle && len(r.assigned) == 0 && d.decayed(r, at) < 0.01 {
+			delete(d.players, id)
+		}
+	}
+}
+
+// spacing returns the mean gap between times and how much the gaps vary relative to it
+func spacing(times []time.Time) (time.Duration, float64) {
+	n := float64(len(times) - 1)
+	var sum float64
+	for i := 1; i < len(times); i++ {
+		sum += float64(times[i].Sub(times[i-1]))
+	}
+	mean := sum / n
+	if mean <= 0 {
+		return 0, 0
+	}
+	var variance float64
+	for i := 1; i < len(times); i++ {
+		diff := float64(times[i].Sub(times[i-1])) - mean
+		variance += diff * diff
+	}
+	return time.Duration(mean), math.Sqrt(variance/n) / mean
+}
+
+func appendCapped[T any](s []T, v T, max int) []T {
+	s = append(s, v)
+	if len(s) > max {
+		s = s[len(s)-max:]
+	}
+	return s
+}
+
+func allSame(s []string) bool {
+	for _, v := range s[1:] {
+		if v != s[0] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+// gameserver/anticheat/anticheat_test.go
+
+package anticheat
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+)
+
+// signals counts the flags raised against each player by signal
+func signals(flags []Flag) map[string]map[Signal]int {
+	out := make(map[string]map[Signal]int)
+	for _, f := range flags {
+		if out[f.PlayerID] == nil {
+			out[f.PlayerID] = make(map[Signal]int)
+		}
+		out[f.PlayerID][f.Signal]++
+	}
+	return out
+}
+
+// TestFastDecision tests flagging decisions made quicker than a person can read the request
+func TestFastDecision(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		assigned bool
+		took     time.Duration
+		want     bool
+	}{
+		{"instant", true, 10 * time.Millisecond, true},
+		{"just under", true, 99 * time.Millisecond, true},
+		{"human", true, 800 * time.Millisecond, false},
+		{"never assigned, like chat", false, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(DefaultConfig())
+			if tt.assigned {
+				d.Assigned("alice", "req-1", start)
+			}
+			got := signals(d.Decided("alice", "req-1", "correct", start.Add(tt.took)))["alice"][SignalFast] > 0
+			if got != tt.want {
+				t.Errorf("Expected flagged %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestRegularTiming tests flagging decisions spaced like clockwork, and not spaced like a person
+func TestRegularTiming(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		gap  func(i int) time.Duration
+		want int
+	}{
+		{"clockwork", func(int) time.Duration { return 2 * time.Second }, 1},
+		{"nearly clockwork", func(i int) time.Duration { return 2*time.Second + time.Duration(i%2)*10*time.Millisecond }, 1},
+		{"human", func(i int) time.Duration { return time.Duration(1+i%4) * time.Second }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(DefaultConfig())
+			at := start
+			got := 0
+			// one more than the window, so a flag that started over could be raised twice
+			for i := 0; i <= d.Config().RegularWindow+1; i++ {
+				got += signals(d.Decided("alice", fmt.Sprintf("req-%d", i), "correct", at))["alice"][SignalRegular]
+				at = at.Add(tt.gap(i))
+			}
+			if got != tt.want {
+				t.Errorf("Expected %d regular timing flags, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestSharedSequence tests flagging both accounts when two make the same mixed run of actions
+func TestSharedSequence(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SequenceLength = 4
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		alice []string
+		bob   []string
+		after time.Duration
+		want  bool
+	}{
+		{"same mixed run", []string{"corrupt", "correct", "delay", "corrupt"}, []string{"corrupt", "correct", "delay", "corrupt"}, time.Minute, true},
+		{"same run of one action", []string{"correct", "correct", "correct", "correct"}, []string{"correct", "correct", "correct", "correct"}, time.Minute, false},
+		{"different runs", []string{"corrupt", "correct", "delay", "corrupt"}, []string{"corrupt", "correct", "delay", "nxdomain"}, time.Minute, false},
+		{"too long ago", []string{"corrupt", "correct", "delay", "corrupt"}, []string{"corrupt", "correct", "delay", "corrupt"}, 25 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(cfg)
+			for i, action := range tt.alice {
+				d.Decided("alice", fmt.Sprintf("a-%d", i), action, start.Add(time.Duration(i)*time.Second))
+			}
+			var flags []Flag
+			for i, action := range tt.bob {
+				flags = append(flags, d.Decided("bob", fmt.Sprintf("b-%d", i), action, start.Add(tt.after+time.Duration(i)*time.Second))...)
+			}
+			got := signals(flags)
+			if flagged := got["alice"][SignalSequence] > 0 && got["bob"][SignalSequence] > 0; flagged != tt.want {
+				t.Errorf("Expected both flagged %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestSuspicion tests that suspicion adds up per signal, halves every half life and orders suspects
+func TestSuspicion(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDetector(DefaultConfig())
+	for i := 0; i < 4; i++ {
+		d.Flag(Flag{PlayerID: "bot", Signal: SignalSequence}, start)
+	}
+	d.Flag(Flag{PlayerID: "eager", Signal: SignalRateLimited}, start)
+
+	tests := []struct {
+		player     string
+		after      time.Duration
+		want       float64
+		suspicious bool
+	}{
+		{"bot", 0, 20, true},
+		{"bot", time.Hour, 10, true},
+		{"bot", 2 * time.Hour, 5, false},
+		{"eager", 0, 0.5, false},
+		{"nobody", 0, 0, false},
+	}
+	for _, tt := range tests {
+		at := start.Add(tt.after)
+		if got := d.Report(tt.player, at).Score; got != tt.want {
+			t.Errorf("Expected %s at %v after %s, got %v", tt.player, tt.want, tt.after, got)
+		}
+		if got := d.Suspicious(tt.player, at); got != tt.suspicious {
+			t.Errorf("Expected %s suspicious %v after %s, got %v", tt.player, tt.suspicious, tt.after, got)
+		}
+	}
+
+	suspects := d.Suspects(0.1, start)
+	if len(suspects) != 2 || suspects[0].PlayerID != "bot" || suspects[0].Signals[SignalSequence] != 4 || suspects[1].PlayerID != "eager" {
+		t.Errorf("Expected bot then eager, got %+v", suspects)
+	}
+	d.Clear("bot")
+	if got := d.Report("bot", start).Score; got != 0 {
+		t.Errorf("Expected a cleared player to start over, got %v", got)
+	}
+}
+
+// TestValidate tests the anti-cheat configs that would flag or limit everyone
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr bool
+	}{
+		{"default", func(*Config) {}, false},
+		{"no burst", func(c *Config) { c.Submit.Burst = 0 }, true},
+		{"no interval", func(c *Config) { c.AssignIP.Every = 0 }, true},
+		{"tiny regular window", func(c *Config) { c.RegularWindow = 2 }, true},
+		{"tiny sequences", func(c *Config) { c.SequenceLength = 3 }, true},
+		{"no half life", func(c *Config) { c.HalfLife = config.Duration(0) }, true},
+		{"no quarantine score", func(c *Config) { c.QuarantineScore = 0 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.change(&cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// gameserver/api.go
+
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nicewrld/gameserver/client"
+)
+
+//////////////////////////////////////////
+// API State
+//////////////////////////////////////////
+
+var (
+	// openAPIDocument describes the /v1 API. It is served at /v1/openapi.json and the tests check
+	// every request and response against it.
+	//
+	//go:embed openapi.json
+	openAPIDocument []byte
+
+	errMethodNotAllowed = errors.New("Method not allowed")
+	errUnknownEndpoint  = errors.New("Unknown endpoint")
+	errMissingPlayerID  = errors.New("Missing player_id")
+	errInvalidRequest   = errors.New("Invalid request data.")
+)
+
+// apiVersionKey marks a request as arriving on a /v1 route.
+type apiVersionKey struct{}
+
+//////////////////////////////////////////
+// API Routes
+//////////////////////////////////////////
+
+// apiRoute is one endpoint of the player and CoreDNS API.
+type apiRoute struct {
+	method  string
+	path    string // under /v1; the deprecated alias is the same path without it
+	handler http.HandlerFunc
+}
+
+// apiRoutes lists the /v1 endpoints. Reads are GETs with query parameters and writes are POSTs
+// with JSON bodies; the deprecated aliases keep accepting what they always have.
+var apiRoutes = []apiRoute{
+	{http.MethodPost, "/dnsrequest", dnsRequestHandler},
+	{http.MethodPost, "/register", registerHandler},
+	{http.MethodPost, "/logout", logoutHandler},
+	{http.MethodPost, "/assign", assignDNSRequestHandler},
+	{http.MethodPost, "/submitaction", submitActionHandler},
+	{http.MethodGet, "/leaderboard", leaderboardHandler},
+	{http.MethodGet, "/leaderboard/rank", leaderboardRankHandler},
+}
+
+// registerAPIRoutes adds the /v1 API, its OpenAPI document and the deprecated unversioned aliases to a mux.
+func registerAPIRoutes(mux *http.ServeMux) {
+	for _, route := range apiRoutes {
+		mux.HandleFunc("/v1"+route.path, v1(route.method, route.handler))
+		mux.HandleFunc(route.path, deprecated("/v1"+route.path, route.handler))
+	}
+	mux.HandleFunc("/v1/openapi.json", v1(http.MethodGet, openAPIHandler))
+	mux.HandleFunc("/v1/", v1("", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, "not_found", errUnknownEndpoint)
+	}))
+}
+
+// v1 serves a handler as a /v1 endpoint, turning away any other method. An empty method allows all.
+func v1(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, 1))
+		if method != "" && r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, r, http.StatusMethodNotAllowed, "method_not_allowed", errMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// deprecated serves a handler on its old unversioned path, pointing callers at its /v1 successor.
+func deprecated(successor string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		handler(w, r)
+	}
+}
+
+// isV1 reports whether a request arrived on a /v1 route.
+func isV1(r *http.Request) bool {
+	return r.Context().Value(apiVersionKey{}) != nil
+}
+
+//////////////////////////////////////////
+// API Responses
+//////////////////////////////////////////
+
+// writeError refuses a request. /v1 routes get a JSON envelope with a machine-readable code
+// (listed in the OpenAPI document); the deprecated routes get the plain-text message they always did.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, err error) {
+	if !isV1(r) {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(client.ErrorResponse{Error: client.ErrorDetail{Code: code, Message: err.Error()}})
+}
+
+// openAPIHandler serves the OpenAPI document describing the /v1 API.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
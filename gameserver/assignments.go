@@ -0,0 +1,169 @@
+// gameserver/assignments.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/queue"
+)
+
+//////////////////////////////////////////
+// Assignment History Constants
+//////////////////////////////////////////
+
+const (
+	// assignmentJobType identifies job queue jobs that start or end a player's hold on a request.
+	assignmentJobType = "assignment"
+
+	// How a player's hold on a request ended.
+	outcomeDecided  = "decided"   // they answered it
+	outcomeVoted    = "voted"     // they voted on it
+	outcomeTimedOut = "timed_out" // it ran out of time while they held it
+	outcomeReleased = "released"  // it was taken back or settled without them
+)
+
+// assignmentOutcomes lists the outcomes /admin/assignments can filter on.
+var assignmentOutcomes = map[string]bool{
+	outcomeDecided:  true,
+	outcomeVoted:    true,
+	outcomeTimedOut: true,
+	outcomeReleased: true,
+}
+
+//////////////////////////////////////////
+// Assignment History Functions
+//////////////////////////////////////////
+
+// startAssignment queues a player picking up a request for persistence, which also makes it the
+// player's current request in the database so it can be restored after a restart.
+func startAssignment(playerID string, dnsReq *DNSRequest, at time.Time) {
+	if dbJobs == nil {
+		return
+	}
+	dbJobs.Submit(queue.Job{Type: assignmentJobType, PlayerID: playerID, Data: db.Assignment{
+		RequestID:  dnsReq.RequestID,
+		PlayerID:   playerID,
+		QName:      normalizeQName(dnsReq.Name),
+		AssignedAt: at,
+	}})
+}
+
+// endAssignment queues how a player's hold on a request ended.
+func endAssignment(playerID, requestID, outcome string, at time.Time) {
+	if dbJobs == nil || requestID == "" {
+		return
+	}
+	dbJobs.Submit(queue.Job{Type: assignmentJobType, PlayerID: playerID, Data: db.Assignment{
+		RequestID: requestID,
+		PlayerID:  playerID,
+		EndedAt:   at,
+		Outcome:   outcome,
+	}})
+}
+
+// saveAssignment writes a queued assignment start or end.
+func saveAssignment(a db.Assignment) error {
+	if a.EndedAt.IsZero() {
+		// A player the database doesn't know has nothing to restore into, and retrying won't change that.
+		if err := db.UpdatePlayerRequest(a.PlayerID, a.RequestID); err != nil && !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+		return db.StartAssignment(a)
+	}
+	return db.EndAssignment(a)
+}
+
+// releaseOutcome says how a hold ended when the request was settled without the player answering it.
+func releaseOutcome(dnsReq *DNSRequest) string {
+	if dnsReq != nil && dnsReq.timedOut() {
+		return outcomeTimedOut
+	}
+	return outcomeReleased
+}
+
+//////////////////////////////////////////
+// Assignment History Handlers
+//////////////////////////////////////////
+
+// AssignmentView is one player's hold on a request as returned by /admin/assignments.
+type AssignmentView struct {
+	ID         int64      `json:"id"`
+	RequestID  string     `json:"request_id"`
+	PlayerID   string     `json:"player_id"`
+	Domain     string     `json:"domain"`
+	AssignedAt time.Time  `json:"assigned_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+	Outcome    string     `json:"outcome,omitempty"` // empty while the player still holds it
+}
+
+// adminAssignmentsHandler lists who held which request, newest first. outcome=timed_out shows who was
+// sitting on each request that timed out.
+func adminAssignmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit, err := parseLimit(r, defaultHistoryLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	q := db.AssignmentQuery{
+		RequestID: query.Get("request_id"),
+		PlayerID:  query.Get("player_id"),
+		Outcome:   query.Get("outcome"),
+		Limit:     limit,
+	}
+	if q.Outcome != "" && !assignmentOutcomes[q.Outcome] {
+		http.Error(w, "Invalid outcome", http.StatusBadRequest)
+		return
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		q.BeforeID, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || q.BeforeID <= 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	assignments, err := db.QueryAssignmentsContext(r.Context(), q)
+	if err != nil {
+		log.Printf("Failed to query assignments: %v", err)
+		http.Error(w, "Failed to load assignments", http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		Assignments []AssignmentView `json:"assignments"`
+		NextCursor  string           `json:"next_cursor,omitempty"`
+	}{Assignments: make([]AssignmentView, 0, len(assignments))}
+	for _, a := range assignments {
+		view := AssignmentView{
+			ID:         a.ID,
+			RequestID:  a.RequestID,
+			PlayerID:   a.PlayerID,
+			Domain:     a.QName,
+			AssignedAt: a.AssignedAt,
+			Outcome:    a.Outcome,
+		}
+		if !a.EndedAt.IsZero() {
+			endedAt := a.EndedAt
+			view.EndedAt = &endedAt
+		}
+		page.Assignments = append(page.Assignments, view)
+	}
+	if len(assignments) == limit {
+		page.NextCursor = strconv.FormatInt(assignments[len(assignments)-1].ID, 10)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,400 @@
+// gameserver/chat.go
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nicewrld/gameserver/chat"
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/events"
+	"github.com/nicewrld/gameserver/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//////////////////////////////////////////
+// Chat Constants
+//////////////////////////////////////////
+
+const (
+	// chatPlayerPrefix namespaces players created from chat usernames.
+	chatPlayerPrefix = "chat-"
+
+	// chatDialTimeout bounds connecting and logging in to the IRC server.
+	chatDialTimeout = 30 * time.Second
+
+	// chatMaxBackoff caps the wait between reconnect attempts.
+	chatMaxBackoff = 1 * time.Minute
+
+	// chatAnnounceInterval is how often the bot looks for a new request to announce when chat is quiet.
+	chatAnnounceInterval = 1 * time.Second
+
+	// chatPersistTimeout bounds writing a new chat player to the database.
+	chatPersistTimeout = 5 * time.Second
+)
+
+//////////////////////////////////////////
+// Chat Metrics
+//////////////////////////////////////////
+
+var (
+	// chatCommands counts chat commands by what became of them.
+	chatCommands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gameserver_chat_commands_total",
+		Help: "Chat commands received, by result (accepted, rate_limited, invalid, no_request, rejected)",
+	}, []string{"result"})
+
+	// chatMessagesDropped counts bot messages dropped by the send rate limit.
+	chatMessagesDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gameserver_chat_messages_dropped_total",
+		Help: "Chat announcements dropped because the bot was sending too fast",
+	})
+)
+
+//////////////////////////////////////////
+// Chat Bot
+//////////////////////////////////////////
+
+// chatBot sits in an IRC channel, announces DNS requests and turns chat commands into player actions.
+// All of its state is owned by the goroutine running session.
+type chatBot struct {
+	cfg     chat.Config
+	users   *ratelimit.Limiter // per-chatter command limit
+	channel *ratelimit.Limiter // limit on commands from the whole channel
+	conn    *chat.Conn
+	current *DNSRequest // request chat is currently deciding
+}
+
+// newChatBot creates a bot that lets each chatter issue a command every userEvery, and the channel
+// as a whole one every channelEvery.
+func newChatBot(cfg chat.Config, userEvery, channelEvery time.Duration) *chatBot {
+	return &chatBot{
+		cfg:     cfg,
+		users:   ratelimit.New(userEvery, 2),
+		channel: ratelimit.New(channelEvery, 50),
+	}
+}
+
+// run keeps the bot connected, reconnecting with backoff until ctx is cancelled.
+func (b *chatBot) run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := b.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Chat connection to %s lost: %v", b.cfg.Addr, err)
+
+		// A session that stayed up for a while earns a fresh backoff.
+		if time.Since(started) > chatMaxBackoff {
+			backoff = time.Second
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > chatMaxBackoff {
+			backoff = chatMaxBackoff
+		}
+	}
+}
+
+// session connects once and serves chat until the connection drops or ctx is cancelled.
+func (b *chatBot) session(ctx context.Context) error {
+	dialCtx, cancel := context.WithTimeout(ctx, chatDialTimeout)
+	conn, err := chat.Dial(dialCtx, b.cfg)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	b.conn = conn
+	b.current = nil
+	log.Printf("Joined chat channel %s on %s as %s", b.cfg.Channel, b.cfg.Addr, b.cfg.Nick)
+
+	sub := eventBus.Subscribe(events.Filter{Types: map[events.Type]bool{
+		events.RequestReceived: true,
+		events.RequestDecided:  true,
+		events.RequestTimedOut: true,
+	}}, 64)
+	defer sub.Close()
+
+	messages := make(chan chat.Message, 64)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			m, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			messages <- m
+		}
+	}()
+
+	ticker := time.NewTicker(chatAnnounceInterval)
+	defer ticker.Stop()
+
+	b.announceNext()
+	for {
+		select {
+		case m := <-messages:
+			b.handleMessage(ctx, m)
+		case event := <-sub.C:
+			b.handleEvent(event)
+		case <-ticker.C:
+			b.announceNext()
+		case err := <-readErr:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handleEvent reports how the current request ended and moves chat on to the next one.
+func (b *chatBot) handleEvent(event events.Event) {
+	if event.Type == events.RequestReceived {
+		b.announceNext()
+		return
+	}
+	if b.current == nil || event.RequestID != b.current.RequestID {
+		return
+	}
+
+	name := strings.TrimSuffix(b.current.Name, ".")
+	switch event.Type {
+	case events.RequestDecided:
+		action := ""
+		if data, ok := event.Data.(map[string]interface{}); ok {
+			action, _ = data["action"].(string)
+		}
+		b.say(fmt.Sprintf("%s %s -> %s", b.current.Type, name, action))
+	case events.RequestTimedOut:
+		b.say(fmt.Sprintf("Nobody answered %s %s in time, so it resolved normally", b.current.Type, name))
+	}
+	b.current = nil
+	b.announceNext()
+}
+
+// handleMessage turns a chat line into a player action on the current request.
+func (b *chatBot) handleMessage(ctx context.Context, m chat.Message) {
+	if m.Command != "PRIVMSG" {
+		return
+	}
+	cmd, err := chat.ParseCommand(m.Text())
+	if err == chat.ErrNotCommand {
+		return
+	}
+	user := m.Nick()
+	if !b.channel.Allow("") || !b.users.Allow(strings.ToLower(user)) {
+		chatCommands.With(prometheus.Labels{"result": "rate_limited"}).Inc()
+		return
+	}
+	if err != nil {
+		chatCommands.With(prometheus.Labels{"result": "invalid"}).Inc()
+		return
+	}
+	if b.current == nil || !requestOpen(b.current) {
+		chatCommands.With(prometheus.Labels{"result": "no_request"}).Inc()
+		return
+	}
+
+	playerID, err := chatPlayer(ctx, user)
+	if err != nil {
+		log.Printf("Chat command '%s' from %s rejected: %v", m.Text(), user, err)
+		chatCommands.With(prometheus.Labels{"result": "rejected"}).Inc()
+		return
+	}
+	answer := ""
+	if cmd.Address != nil {
+		answer = cmd.Address.String()
+	}
+	if err := submitChatAction(playerID, b.current, cmd.Action, answer); err != nil {
+		log.Printf("Chat command '%s' from %s rejected: %v", m.Text(), user, err)
+		chatCommands.With(prometheus.Labels{"result": "rejected"}).Inc()
+		return
+	}
+	chatCommands.With(prometheus.Labels{"result": "accepted"}).Inc()
+}
+
+// announceNext puts the next open request in front of chat if it isn't already deciding one.
+func (b *chatBot) announceNext() {
+	if b.current != nil && requestOpen(b.current) {
+		return
+	}
+	b.current = nextChatRequest()
+	if b.current == nil {
+		return
+	}
+
+	prompt := "first to answer decides"
+	if b.current.ballot != nil {
+		prompt = fmt.Sprintf("vote within %s", time.Until(b.current.ballot.Deadline).Round(time.Second))
+	}
+	b.say(fmt.Sprintf("DNS request: %s %s - %s with !correct, !corrupt <ip>, !delay or !nxdomain",
+		b.current.Type, strings.TrimSuffix(b.current.Name, "."), prompt))
+}
+
+// say posts to the channel, counting messages the send limit drops.
+func (b *chatBot) say(text string) {
+	switch err := b.conn.Say(text); err {
+	case nil:
+	case chat.ErrRateLimited:
+		chatMessagesDropped.Inc()
+	default:
+		log.Printf("Failed to send chat message: %v", err)
+	}
+}
+
+//////////////////////////////////////////
+// Chat Functions
+//////////////////////////////////////////
+
+// requestOpen reports whether the DNS request handler is still waiting on the request.
+func requestOpen(dnsReq *DNSRequest) bool {
+	select {
+	case <-dnsReq.resolved:
+		return false
+	default:
+		return !dnsReq.timedOut()
+	}
+}
+
+// nextChatRequest returns the oldest pending request that chat could still decide.
+func nextChatRequest() *DNSRequest {
+	pendingRequestsMu.Lock()
+	defer pendingRequestsMu.Unlock()
+
+	now := time.Now()
+	for _, req := range pendingRequests {
+		if !req.TimedOut && assignable(req, now) && (req.ballot != nil || !req.Assigned) {
+			return req
+		}
+	}
+	return nil
+}
+
+// chatPlayer returns the player for a chat username, creating one the first time they speak. A new
+// player is written to the database before anyone can see them, like a registration.
+func chatPlayer(ctx context.Context, username string) (string, error) {
+	playerID := chatPlayerPrefix + strings.ToLower(username)
+
+	playersMu.Lock()
+	if _, exists := players[playerID]; exists {
+		playersMu.Unlock()
+		return playerID, nil
+	}
+	// Chat names that are taken or not allowed fall back to the player ID, which is unique.
+	player := &Player{ID: playerID, Nickname: playerID}
+	nickname, err := checkNickname(playerID, username)
+	if err != nil {
+		nickname = playerID
+	}
+	claimNickname(player, nickname)
+	playersMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, chatPersistTimeout)
+	defer cancel()
+	if err := db.CreatePlayerContext(ctx, playerID, nickname); err != nil {
+		playersMu.Lock()
+		releaseNickname(player)
+		playersMu.Unlock()
+		return "", fmt.Errorf("persist chat player %s: %w", playerID, err)
+	}
+
+	playersMu.Lock()
+	players[playerID] = player
+	rankPlayer(player)
+	playerCount.Set(float64(len(players)))
+	playersMu.Unlock()
+
+	log.Printf("Registered chat player: %s (%s)", nickname, playerID)
+	eventBus.Publish(events.Event{
+		Type:     events.PlayerRegistered,
+		PlayerID: playerID,
+		Data:     map[string]string{"nickname": nickname, "source": "chat"},
+	})
+	return playerID, nil
+}
+
+// submitChatAction claims a specific DNS request for a chat player and submits their action on it.
+// Voted requests take the action as the player's vote; otherwise the first chatter to answer decides.
+func submitChatAction(playerID string, dnsReq *DNSRequest, action, answer string) error {
+	if !validActions[action] {
+		return errInvalidAction
+	}
+	if playerBanned(playerID) {
+		return errPlayerBanned
+	}
+	// Check what submitPlayerAction would turn down before claiming the request, so a doomed
+	// command doesn't take it away from everyone else.
+	if dnsReq.timedOut() {
+		return errRequestExpired
+	}
+	if !rulesEngine.Evaluate(dnsReq.Name).Allows(action) {
+		return errActionNotAllowed
+	}
+
+	pendingRequestsMu.Lock()
+	if dnsReq.ballot != nil {
+		// Returns false once the player already holds a seat; Cast sorts out the rest.
+		dnsReq.ballot.Assign(playerID)
+		dnsReq.Assigned = true
+	} else {
+		if dnsReq.Assigned {
+			pendingRequestsMu.Unlock()
+			return errRequestHandled
+		}
+		dnsReq.Assigned = true
+		dnsReq.AssignedTo = playerID
+		if action == "corrupt" {
+			dnsReq.answer = answer
+		}
+		for i, req := range pendingRequests {
+			if req == dnsReq {
+				pendingRequests = append(pendingRequests[:i], pendingRequests[i+1:]...)
+				pendingDNSRequests.Set(float64(len(pendingRequests)))
+				break
+			}
+		}
+	}
+	pendingRequestsMu.Unlock()
+
+	playersMu.Lock()
+	if player, exists := players[playerID]; exists {
+		player.AssignedRequestID = dnsReq.RequestID
+	}
+	playersMu.Unlock()
+	startAssignment(playerID, dnsReq, time.Now())
+
+	if _, err := submitPlayerAction(playerID, dnsReq.RequestID, action); err != nil {
+		releaseChatClaim(playerID, dnsReq)
+		return err
+	}
+	return nil
+}
+
+// releaseChatClaim undoes submitChatAction's claim when the action it was made for didn't go through,
+// so the request goes back to the front of the queue instead of waiting out its timeout.
+func releaseChatClaim(playerID string, dnsReq *DNSRequest) {
+	playersMu.Lock()
+	held := false
+	if player, exists := players[playerID]; exists && player.AssignedRequestID == dnsReq.RequestID {
+		player.AssignedRequestID = ""
+		held = true
+	}
+	playersMu.Unlock()
+
+	if held {
+		endAssignment(playerID, dnsReq.RequestID, outcomeReleased, time.Now())
+	}
+	returnToQueue(dnsReq.RequestID, playerID)
+}
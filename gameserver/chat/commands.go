@@ -0,0 +1,45 @@
+// chat commands that map onto game actions
+// gameserver/chat/commands.go
+
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrNotCommand means the message was just chatter
+var ErrNotCommand = errors.New("chat: not a command")
+
+// Command is a parsed !action from chat
+type Command struct {
+	Action  string // correct, corrupt, delay or nxdomain
+	Address net.IP // optional address to answer with for !corrupt
+}
+
+// ParseCommand reads "!correct", "!corrupt 10.0.0.1", "!delay" or "!nxdomain"
+// anything that isn't one of those gives ErrNotCommand
+func ParseCommand(text string) (Command, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "!") {
+		return Command{}, ErrNotCommand
+	}
+
+	cmd := Command{Action: strings.ToLower(strings.TrimPrefix(fields[0], "!"))}
+	switch cmd.Action {
+	case "correct", "delay", "nxdomain":
+		return cmd, nil
+	case "corrupt":
+		if len(fields) > 1 {
+			cmd.Address = net.ParseIP(fields[1])
+			if cmd.Address == nil {
+				return Command{}, fmt.Errorf("chat: %q is not an ip address", fields[1])
+			}
+		}
+		return cmd, nil
+	default:
+		return Command{}, ErrNotCommand
+	}
+}
@@ -0,0 +1,238 @@
+// irc client for running the game from a chat channel
+// speaks just enough irc (plus twitch's message tags) to sit in one
+// channel, read what people type and talk back
+// gameserver/chat/irc.go
+
+package chat
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/ratelimit"
+)
+
+var (
+	ErrRateLimited = errors.New("chat: message dropped by the send rate limit")
+	ErrLoginFailed = errors.New("chat: irc server rejected our login")
+)
+
+// Config is everything needed to get into a channel
+type Config struct {
+	Addr      string        // host:port of the irc server
+	TLS       bool          // twitch wants tls on 6697
+	Nick      string        // who we show up as
+	Pass      string        // server password, "oauth:..." on twitch
+	Channel   string        // channel to sit in, with or without the #
+	SendEvery time.Duration // one message per this long on average...
+	SendBurst int           // ...with bursts up to this many
+}
+
+// Message is one parsed irc line
+type Message struct {
+	Tags    map[string]string // twitch ircv3 tags, if any
+	Prefix  string            // nick!user@host of whoever sent it
+	Command string            // PRIVMSG, PING, 001...
+	Params  []string          // the rest, trailing param included
+}
+
+// Nick pulls the sender's nick out of the prefix
+// twitch puts the proper-cased name in the display-name tag
+func (m Message) Nick() string {
+	if name := m.Tags["display-name"]; name != "" {
+		return name
+	}
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	return nick
+}
+
+// Text is the last parameter, which is the message body for PRIVMSG
+func (m Message) Text() string {
+	if len(m.Params) == 0 {
+		return ""
+	}
+	return m.Params[len(m.Params)-1]
+}
+
+// ParseMessage splits a raw irc line into its parts
+func ParseMessage(line string) (Message, error) {
+	line = strings.TrimRight(line, "\r\n")
+	var m Message
+
+	if strings.HasPrefix(line, "@") {
+		var tags string
+		tags, line, _ = strings.Cut(line[1:], " ")
+		m.Tags = make(map[string]string)
+		for _, tag := range strings.Split(tags, ";") {
+			key, value, _ := strings.Cut(tag, "=")
+			m.Tags[key] = unescapeTag(value)
+		}
+	}
+	if strings.HasPrefix(line, ":") {
+		m.Prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+
+	line = strings.TrimLeft(line, " ")
+	for line != "" {
+		if strings.HasPrefix(line, ":") {
+			m.Params = append(m.Params, line[1:])
+			break
+		}
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		line = strings.TrimLeft(line, " ")
+		if m.Command == "" {
+			m.Command = strings.ToUpper(param)
+		} else {
+			m.Params = append(m.Params, param)
+		}
+	}
+
+	if m.Command == "" {
+		return m, fmt.Errorf("chat: no command in %q", line)
+	}
+	return m, nil
+}
+
+// unescapeTag undoes ircv3 tag value escaping
+func unescapeTag(v string) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+	r := strings.NewReplacer(`\:`, ";", `\s`, " ", `\\`, `\`, `\r`, "\r", `\n`, "\n")
+	return r.Replace(v)
+}
+
+// Conn is a logged in connection sitting in one channel
+type Conn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	channel string
+	send    *ratelimit.Limiter
+
+	writeMu sync.Mutex
+}
+
+// Dial connects, logs in, waits for the welcome and joins the channel
+func Dial(ctx context.Context, cfg Config) (*Conn, error) {
+	var d net.Dialer
+	var conn net.Conn
+	var err error
+	if cfg.TLS {
+		host, _, _ := net.SplitHostPort(cfg.Addr)
+		td := tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: host}}
+		conn, err = td.DialContext(ctx, "tcp", cfg.Addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	channel := cfg.Channel
+	if !strings.HasPrefix(channel, "#") {
+		channel = "#" + channel
+	}
+	c := &Conn{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		channel: strings.ToLower(channel),
+	}
+	if cfg.SendEvery > 0 {
+		c.send = ratelimit.New(cfg.SendEvery, cfg.SendBurst)
+	}
+
+	// don't let a silent server hang the login forever
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := c.login(cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// login registers with the server and joins the channel
+func (c *Conn) login(cfg Config) error {
+	// ask for twitch's tags; plain irc servers just say no
+	c.writeLine("CAP REQ :twitch.tv/tags")
+	if cfg.Pass != "" {
+		c.writeLine("PASS " + cfg.Pass)
+	}
+	c.writeLine("NICK " + cfg.Nick)
+	if err := c.writeLine("USER " + cfg.Nick + " 0 * :" + cfg.Nick); err != nil {
+		return err
+	}
+
+	for {
+		m, err := c.ReadMessage()
+		if err != nil {
+			return err
+		}
+		switch {
+		case m.Command == "001": // welcome, we're in
+			return c.writeLine("JOIN " + c.channel)
+		case m.Command == "464" || m.Command == "433" || m.Command == "ERROR":
+			return fmt.Errorf("%w: %s %s", ErrLoginFailed, m.Command, m.Text())
+		case m.Command == "NOTICE" && strings.Contains(strings.ToLower(m.Text()), "authentication failed"):
+			return fmt.Errorf("%w: %s", ErrLoginFailed, m.Text())
+		}
+	}
+}
+
+// ReadMessage returns the next message, answering server PINGs along the way
+func (c *Conn) ReadMessage() (Message, error) {
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return Message{}, err
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m, err := ParseMessage(line)
+		if err != nil {
+			continue
+		}
+		if m.Command == "PING" {
+			if err := c.writeLine("PONG :" + m.Text()); err != nil {
+				return Message{}, err
+			}
+			continue
+		}
+		return m, nil
+	}
+}
+
+// Say posts a message to the channel, or drops it if we've been too chatty
+func (c *Conn) Say(text string) error {
+	if c.send != nil && !c.send.Allow("") {
+		return ErrRateLimited
+	}
+	// a stray newline would let the text smuggle in its own irc command
+	text = strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+	return c.writeLine("PRIVMSG " + c.channel + " :" + text)
+}
+
+// Close hangs up
+func (c *Conn) Close() error {
+	c.writeLine("QUIT :bye")
+	return c.conn.Close()
+}
+
+func (c *Conn) writeLine(line string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	return err
+}
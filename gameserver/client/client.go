@@ -0,0 +1,369 @@
+// talking to the game server over http
+// ===========================
+// one typed method per endpoint, so the web interface, the coredns plugin and
+// the stress test all call the server the same way. calls take a context,
+// retry when the server says it's busy, and fail with errors you can check
+// with errors.Is instead of status codes
+// gameserver/client/client.go
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultRetries      = 2
+	DefaultRetryWait    = 250 * time.Millisecond
+	DefaultMaxRetryWait = 2 * time.Second
+
+	// headers /register also puts the new session in, for callers of the deprecated route
+	SessionTokenHeader   = "X-Session-Token"
+	SessionExpiresHeader = "X-Session-Expires" // rfc 3339
+)
+
+// what a failed call comes back as, for errors.Is
+var (
+	ErrBadRequest   = errors.New("bad request")         // 400, the message says what was wrong
+	ErrUnauthorized = errors.New("unauthorized")        // 401, the session is missing, expired or someone else's
+	ErrForbidden    = errors.New("forbidden")           // 403, banned or an action the rules don't allow
+	ErrNotFound     = errors.New("not found")           // 404
+	ErrConflict     = errors.New("conflict")            // 409, e.g. a nickname someone else has
+	ErrGone         = errors.New("gone")                // 410, the request expired or was already handled
+	ErrRateLimited  = errors.New("rate limited")        // 429
+	ErrUnavailable  = errors.New("unavailable")         // 503, busy or shutting down, try again later
+	ErrServer       = errors.New("server error")        // any other 5xx
+	ErrNoRequests   = errors.New("no requests to play") // /v1/assign had nothing to hand out
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:         ErrBadRequest,
+	http.StatusUnauthorized:       ErrUnauthorized,
+	http.StatusForbidden:          ErrForbidden,
+	http.StatusNotFound:           ErrNotFound,
+	http.StatusConflict:           ErrConflict,
+	http.StatusGone:               ErrGone,
+	http.StatusTooManyRequests:    ErrRateLimited,
+	http.StatusServiceUnavailable: ErrUnavailable,
+}
+
+// Error is a call the game server turned down
+type Error struct {
+	Status     int           // http status code
+	Code       string        // the server's machine code, e.g. nickname_taken; empty if it didn't send one
+	Message    string        // the server's reason, fine to show players
+	RetryAfter time.Duration // how long the server asked us to wait, if it did
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("game server: %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("game server: %d %s", e.Status, e.Message)
+}
+
+// Is matches the Err value for the status, so errors.Is(err, ErrConflict) works
+func (e *Error) Is(target error) bool {
+	if err, ok := statusErrors[e.Status]; ok {
+		return err == target
+	}
+	return e.Status >= 500 && target == ErrServer
+}
+
+// Client calls one game server. the zero value isn't usable, use New
+type Client struct {
+	BaseURL    string       // e.g. http://gameserver:8080
+	HTTPClient *http.Client // its Timeout caps each attempt, not the whole call
+
+	Retries      int           // extra attempts after a 503, or a failed connection on calls safe to repeat
+	RetryWait    time.Duration // first wait between attempts, doubling after that
+	MaxRetryWait time.Duration // longest we'll wait; a longer Retry-After gives up instead
+}
+
+// New returns a client for the game server at baseURL with the default timeout and retries
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		HTTPClient:   &http.Client{Timeout: DefaultTimeout},
+		Retries:      DefaultRetries,
+		RetryWait:    DefaultRetryWait,
+		MaxRetryWait: DefaultMaxRetryWait,
+	}
+}
+
+type forwardedForKey struct{}
+
+// ForwardedFor returns a context whose calls tell the server they're on behalf of addr
+// (an X-Forwarded-For value), so its rate limits apply per player rather than per caller
+func ForwardedFor(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, forwardedForKey{}, addr)
+}
+
+//////////////////////////////////////////
+// Endpoints
+//////////////////////////////////////////
+
+// Register creates a player and their first session
+// team is optional. a refused nickname is ErrBadRequest or ErrConflict with the reason in the message
+func (c *Client) Register(ctx context.Context, nickname, team string) (Session, error) {
+	// every attempt makes a new player, so only a 503 (nothing was made) is retried
+	_, body, err := c.do(ctx, call{method: http.MethodPost, path: "/v1/register", body: Registration{Nickname: nickname, Team: team}})
+	if err != nil {
+		return Session{}, err
+	}
+	var session Session
+	if err := decode(body, &session); err != nil {
+		return Session{}, err
+	}
+	if session.PlayerID == "" || session.Token == "" {
+		return Session{}, fmt.Errorf("game server: register returned no usable session")
+	}
+	return session, nil
+}
+
+// Assign hands the player their current assignment, or the next pending dns request
+// it's ErrNoRequests when there's nothing to play
+func (c *Client) Assign(ctx context.Context, s Session) (Assignment, error) {
+	var assignment Assignment
+	resp, body, err := c.do(ctx, call{
+		method:  http.MethodPost,
+		path:    "/v1/assign",
+		body:    AssignRequest{PlayerID: s.PlayerID},
+		session: &s,
+	})
+	if err != nil {
+		return assignment, err
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return assignment, ErrNoRequests
+	}
+	err = decode(body, &assignment)
+	return assignment, err
+}
+
+// Submit answers the player's assignment with one of the Action constants
+func (c *Client) Submit(ctx context.Context, s Session, requestID, action string) (SubmitResult, error) {
+	var result SubmitResult
+	_, body, err := c.do(ctx, call{
+		method:  http.MethodPost,
+		path:    "/v1/submitaction",
+		body:    Action{PlayerID: s.PlayerID, RequestID: requestID, Action: action},
+		session: &s,
+	})
+	if err != nil {
+		return result, err
+	}
+	err = decode(body, &result)
+	return result, err
+}
+
+// Leaderboard returns a page of the player leaderboard
+func (c *Client) Leaderboard(ctx context.Context, q LeaderboardQuery) ([]LeaderboardEntry, error) {
+	var entries []LeaderboardEntry
+	_, body, err := c.do(ctx, call{method: http.MethodGet, path: "/v1/leaderboard", query: q.values(), idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	err = decode(body, &entries)
+	return entries, err
+}
+
+// TeamLeaderboard returns a page of the team leaderboard. only Page and PageSize apply
+func (c *Client) TeamLeaderboard(ctx context.Context, q LeaderboardQuery) ([]TeamView, error) {
+	var teams []TeamView
+	query := LeaderboardQuery{Page: q.Page, PageSize: q.PageSize}.values()
+	query.Set("scope", "team")
+	_, body, err := c.do(ctx, call{method: http.MethodGet, path: "/v1/leaderboard", query: query, idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	err = decode(body, &teams)
+	return teams, err
+}
+
+// Rank says where a player stands on the board q's Sort and Window pick
+// it's ErrNotFound when they aren't on that board
+func (c *Client) Rank(ctx context.Context, playerID string, q LeaderboardQuery) (RankView, error) {
+	var view RankView
+	query := LeaderboardQuery{Sort: q.Sort, Window: q.Window}.values()
+	query.Set("player_id", playerID)
+	_, body, err := c.do(ctx, call{method: http.MethodGet, path: "/v1/leaderboard/rank", query: query, idempotent: true})
+	if err != nil {
+		return view, err
+	}
+	err = decode(body, &view)
+	return view, err
+}
+
+// Rename changes the player's nickname. during the cooldown it's ErrRateLimited with RetryAfter set
+func (c *Client) Rename(ctx context.Context, s Session, nickname string) (NicknameChange, error) {
+	var change NicknameChange
+	_, body, err := c.do(ctx, call{
+		method:  http.MethodPost,
+		path:    "/players/" + url.PathEscape(s.PlayerID) + "/nickname",
+		body:    NicknameRequest{Nickname: nickname},
+		session: &s,
+	})
+	if err != nil {
+		return change, err
+	}
+	err = decode(body, &change)
+	return change, err
+}
+
+// Logout revokes the session
+func (c *Client) Logout(ctx context.Context, s Session) error {
+	_, _, err := c.do(ctx, call{method: http.MethodPost, path: "/v1/logout", session: &s, idempotent: true})
+	return err
+}
+
+// SubmitDNSRequest asks the game what to do with a dns query, and waits while a player decides
+// the server falls back to correct after 30 seconds, so give HTTPClient a longer timeout than that
+func (c *Client) SubmitDNSRequest(ctx context.Context, q DNSQuery) (DNSResponse, error) {
+	var resp DNSResponse
+	_, body, err := c.do(ctx, call{method: http.MethodPost, path: "/v1/dnsrequest", body: q})
+	if err != nil {
+		return resp, err
+	}
+	err = decode(body, &resp)
+	return resp, err
+}
+
+//////////////////////////////////////////
+// Requests
+//////////////////////////////////////////
+
+// call is one request to make
+type call struct {
+	method     string
+	path       string
+	query      url.Values
+	body       interface{} // sent as json if set
+	session    *Session    // sent as the bearer token if set
+	idempotent bool        // safe to send again when we can't tell whether it arrived
+}
+
+// do makes a call, retrying while the server is unavailable, and returns the response
+// with its body read. anything but a 2xx comes back as an *Error
+func (c *Client) do(ctx context.Context, cl call) (*http.Response, []byte, error) {
+	var payload []byte
+	if cl.body != nil {
+		var err error
+		if payload, err = json.Marshal(cl.body); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.send(ctx, cl, payload)
+		if err == nil && resp.StatusCode < 400 {
+			return resp, body, nil
+		}
+
+		retry := attempt < c.Retries && ctx.Err() == nil
+		delay := wait
+		if err != nil {
+			// a dropped connection might have been after the server acted on it
+			retry = retry && cl.idempotent
+		} else {
+			apiErr := newError(resp, body)
+			err = apiErr
+			switch resp.StatusCode {
+			case http.StatusServiceUnavailable:
+				// the server is telling us it did nothing, so anything can try again
+			case http.StatusBadGateway, http.StatusGatewayTimeout:
+				retry = retry && cl.idempotent
+			default:
+				retry = false
+			}
+			if apiErr.RetryAfter > 0 {
+				delay = apiErr.RetryAfter
+			}
+		}
+		if !retry || delay > c.MaxRetryWait {
+			return resp, body, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, body, err
+		case <-timer.C:
+		}
+		wait *= 2
+		if wait > c.MaxRetryWait {
+			wait = c.MaxRetryWait
+		}
+	}
+}
+
+// send makes one attempt at a call
+func (c *Client) send(ctx context.Context, cl call, payload []byte) (*http.Response, []byte, error) {
+	target := c.BaseURL + cl.path
+	if len(cl.query) > 0 {
+		target += "?" + cl.query.Encode()
+	}
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, cl.method, target, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cl.session != nil {
+		req.Header.Set("Authorization", "Bearer "+cl.session.Token)
+	}
+	if addr, ok := ctx.Value(forwardedForKey{}).(string); ok && addr != "" {
+		req.Header.Set("X-Forwarded-For", addr)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+// newError turns a failed response into an *Error
+// /v1 refusals are an ErrorResponse; anything else (a proxy, an older route) keeps its body as the message
+func newError(resp *http.Response, body []byte) *Error {
+	e := &Error{Status: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	var envelope ErrorResponse
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error.Code != "" {
+		e.Code, e.Message = envelope.Error.Code, envelope.Error.Message
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return e
+}
+
+// decode reads a json response body
+func decode(body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("game server: bad response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// what goes over the wire between the game server and everything that talks to it
+// the server uses these same types, so changing one changes both ends at once
+// gameserver/client/types.go
+
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nicewrld/gameserver/rules"
+	"github.com/nicewrld/gameserver/scoring"
+)
+
+// the things a player can do to a dns request
+const (
+	ActionCorrect  = "correct"  // resolve it normally
+	ActionCorrupt  = "corrupt"  // answer with a wrong address
+	ActionDelay    = "delay"    // resolve it, slowly
+	ActionNXDomain = "nxdomain" // say the name doesn't exist
+)
+
+// Actions lists every action, in the order players are offered them
+var Actions = []string{ActionCorrect, ActionCorrupt, ActionDelay, ActionNXDomain}
+
+// DNSQuery is a dns question coredns hands to the game, as posted to /v1/dnsrequest
+type DNSQuery struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Class    string `json:"class"`
+	ClientIP string `json:"client_ip"` // who asked, kept for the decision history
+}
+
+// DNSResponse is what the game decided to do with a DNSQuery
+type DNSResponse struct {
+	Action string `json:"action"`           // one of the Action constants
+	Answer string `json:"answer,omitempty"` // address to answer with for corrupt, if the player picked one
+}
+
+// Registration asks for a new player, as posted to /v1/register
+type Registration struct {
+	Nickname string `json:"nickname"`
+	Team     string `json:"team,omitempty"` // team id to join, if any
+}
+
+// Session is a registered player and the token that proves it's them, as /v1/register returns it
+type Session struct {
+	PlayerID  string    `json:"player_id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AssignRequest asks for a player's next dns request, as posted to /v1/assign
+type AssignRequest struct {
+	PlayerID string `json:"player_id"`
+}
+
+// Assignment is a dns request handed to a player by /v1/assign
+type Assignment struct {
+	RequestID string        `json:"request_id"`
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	Class     string        `json:"class"`
+	Timestamp time.Time     `json:"timestamp"` // when coredns asked
+	Rules     rules.Verdict `json:"rules"`     // actions the domain's rules allow and what they are worth
+}
+
+// Action is a player's answer to their assignment, as posted to /v1/submitaction
+type Action struct {
+	PlayerID  string `json:"player_id"`
+	RequestID string `json:"request_id"`
+	Action    string `json:"action"`
+}
+
+// SubmitResult is what a submitted action earned and why
+type SubmitResult struct {
+	Awards []scoring.Award `json:"awards"`
+}
+
+// LeaderboardEntry is one player's row on the leaderboard
+type LeaderboardEntry struct {
+	Rank         int        `json:"rank"`
+	PlayerID     string     `json:"player_id"`
+	Nickname     string     `json:"nickname"`
+	PurePoints   float64    `json:"pure_points"`
+	EvilPoints   float64    `json:"evil_points"`
+	NetAlignment float64    `json:"net_alignment"`
+	LastActive   *time.Time `json:"last_active,omitempty"`
+}
+
+// RankView is where one player stands, as returned by /v1/leaderboard/rank
+type RankView struct {
+	LeaderboardEntry
+	Ranked int `json:"ranked"` // players on the board
+}
+
+// TeamView is one team's row on the team leaderboard
+type TeamView struct {
+	ID           string  `json:"team_id"`
+	Name         string  `json:"name"`
+	Members      int     `json:"members"`
+	PurePoints   float64 `json:"pure_points"`
+	EvilPoints   float64 `json:"evil_points"`
+	NetAlignment float64 `json:"net_alignment"`
+}
+
+// NicknameRequest asks for a new nickname, as posted to /players/{id}/nickname
+type NicknameRequest struct {
+	Nickname string `json:"nickname"`
+}
+
+// NicknameChange is a player's new nickname and when they can next change it
+type NicknameChange struct {
+	Nickname     string    `json:"nickname"`
+	NextRenameAt time.Time `json:"next_rename_at"`
+}
+
+// ErrorResponse is how every /v1 endpoint says no
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail is what went wrong: a code for programs and a message for people
+type ErrorDetail struct {
+	Code    string `json:"code"`    // e.g. nickname_taken, see the openapi document for the full list
+	Message string `json:"message"` // fine to show players
+}
+
+// LeaderboardQuery picks a page of the leaderboard; zero values leave the server's defaults
+type LeaderboardQuery struct {
+	Page     int
+	PageSize int    // at most 200
+	Sort     string // total, pure, evil, net or recent
+	Window   string // season, today or week
+	Search   string // part of a nickname
+	Season   int    // a finished season's final standings
+}
+
+func (q LeaderboardQuery) values() url.Values {
+	v := url.Values{}
+	if q.Page > 0 {
+		v.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.PageSize > 0 {
+		v.Set("page_size", strconv.Itoa(q.PageSize))
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	if q.Window != "" {
+		v.Set("window", q.Window)
+	}
+	if q.Search != "" {
+		v.Set("q", q.Search)
+	}
+	if q.Season > 0 {
+		v.Set("season", strconv.Itoa(q.Season))
+	}
+	return v
+}
@@ -0,0 +1,56 @@
+// the bits every game package needs to read its json config file
+// gameserver/config/config.go
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Duration is a time.Duration that reads "1.5s" style strings from json
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Validator is a config that can check itself once it's loaded
+type Validator interface {
+	Validate() error
+}
+
+// Read decodes the json file at path into v, leaving anything the file doesn't mention alone
+func Read(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Load reads the json file at path over cfg, which holds the defaults, and validates the result
+func Load[T Validator](path string, cfg T) (T, error) {
+	if err := Read(path, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
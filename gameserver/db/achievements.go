@@ -0,0 +1,93 @@
+// achievements
+// ===========================
+// which badges each player has unlocked and when. the definitions live
+// in config, so a row whose achievement got removed just sits there
+// gameserver/db/achievements.go
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// a badge one player unlocked
+type Achievement struct {
+	PlayerID      string
+	AchievementID string
+	RequestID     string    // the decision that unlocked it
+	UnlockedAt    time.Time // when
+}
+
+// UnlockAchievement saves an unlocked achievement. unlocking it again keeps the first time
+func UnlockAchievement(a Achievement) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return UnlockAchievementContext(ctx, a)
+}
+
+// UnlockAchievementContext is UnlockAchievement with a context
+func UnlockAchievementContext(ctx context.Context, a Achievement) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO player_achievements (player_id, achievement_id, request_id, unlocked_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (player_id, achievement_id) DO NOTHING
+	`, a.PlayerID, a.AchievementID, a.RequestID, a.UnlockedAt.UTC())
+	return err
+}
+
+// GetAchievements returns a player's achievements in the order they unlocked them
+func GetAchievements(playerID string) ([]Achievement, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetAchievementsContext(ctx, playerID)
+}
+
+// GetAchievementsContext is GetAchievements with a context
+func GetAchievementsContext(ctx context.Context, playerID string) ([]Achievement, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT player_id, achievement_id, request_id, unlocked_at
+		FROM player_achievements
+		WHERE player_id = ?
+		ORDER BY unlocked_at, achievement_id
+	`, playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var achievements []Achievement
+	for rows.Next() {
+		var a Achievement
+		if err := rows.Scan(&a.PlayerID, &a.AchievementID, &a.RequestID, &a.UnlockedAt); err != nil {
+			return nil, err
+		}
+		achievements = append(achievements, a)
+	}
+	return achievements, rows.Err()
+}
+
+// GetUnlockedAchievements returns every player's achievement ids, keyed by player id
+func GetUnlockedAchievements() (map[string][]string, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetUnlockedAchievementsContext(ctx)
+}
+
+// GetUnlockedAchievementsContext is GetUnlockedAchievements with a context
+func GetUnlockedAchievementsContext(ctx context.Context) (map[string][]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT player_id, achievement_id FROM player_achievements`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unlocked := make(map[string][]string)
+	for rows.Next() {
+		var playerID, achievementID string
+		if err := rows.Scan(&playerID, &achievementID); err != nil {
+			return nil, err
+		}
+		unlocked[playerID] = append(unlocked[playerID], achievementID)
+	}
+	return unlocked, rows.Err()
+}
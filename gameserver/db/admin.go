@@ -0,0 +1,303 @@
+// moderation
+// ===========================
+// bans, renames and the audit trail of everything admins touch
+// gameserver/db/admin.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// a banned player
+type Ban struct {
+	PlayerID string
+	Reason   string    // what the moderator wrote down
+	BannedBy string    // which moderator did it
+	BannedAt time.Time // when
+}
+
+// one thing an admin did
+type AuditEntry struct {
+	ID        int64     // row id, used as the pagination cursor
+	Actor     string    // which moderator
+	Action    string    // ban, unban, rename, adjust_points, resolve, pause...
+	Target    string    // player or request id, if any
+	Detail    string    // json blob with the specifics
+	CreatedAt time.Time // when they did it
+}
+
+// BanPlayer bans a player, replacing any earlier ban's reason
+func BanPlayer(b Ban) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return BanPlayerContext(ctx, b)
+}
+
+// BanPlayerContext is BanPlayer with a context
+func BanPlayerContext(ctx context.Context, b Ban) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO player_bans (player_id, reason, banned_by, banned_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (player_id) DO UPDATE SET reason = excluded.reason, banned_by = excluded.banned_by, banned_at = excluded.banned_at
+	`, b.PlayerID, b.Reason, b.BannedBy, b.BannedAt.UTC())
+	return err
+}
+
+// UnbanPlayer lifts a ban
+func UnbanPlayer(playerID string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return UnbanPlayerContext(ctx, playerID)
+}
+
+// UnbanPlayerContext is UnbanPlayer with a context
+func UnbanPlayerContext(ctx context.Context, playerID string) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM player_bans WHERE player_id = ?`, playerID)
+	return err
+}
+
+// GetBans returns every ban, keyed by player id
+func GetBans() (map[string]Ban, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetBansContext(ctx)
+}
+
+// GetBansContext is GetBans with a context
+func GetBansContext(ctx context.Context) (map[string]Ban, error) {
+	rows, err := db.QueryContext(ctx, `SELECT player_id, reason, banned_by, banned_at FROM player_bans`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := make(map[string]Ban)
+	for rows.Next() {
+		var b Ban
+		if err := rows.Scan(&b.PlayerID, &b.Reason, &b.BannedBy, &b.BannedAt); err != nil {
+			return nil, err
+		}
+		bans[b.PlayerID] = b
+	}
+	return bans, rows.Err()
+}
+
+// a nickname change
+type Rename struct {
+	PlayerID    string
+	OldNickname string
+	NewNickname string
+	RenamedBy   string // empty when the player did it themselves
+	RenamedAt   time.Time
+}
+
+// RenamePlayer changes a player's nickname and remembers the change
+func RenamePlayer(r Rename) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return RenamePlayerContext(ctx, r)
+}
+
+// RenamePlayerContext is RenamePlayer with a context
+func RenamePlayerContext(ctx context.Context, r Rename) error {
+	tx, err := db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE players
+		SET nickname = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, r.NewNickname, r.PlayerID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO player_renames (player_id, old_nickname, new_nickname, renamed_by, renamed_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, r.PlayerID, r.OldNickname, r.NewNickname, r.RenamedBy, r.RenamedAt.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LastSelfRename returns when a player last renamed themselves, ok is false if they never have
+// renames by moderators don't count
+func LastSelfRename(playerID string) (at time.Time, ok bool, err error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return LastSelfRenameContext(ctx, playerID)
+}
+
+// LastSelfRenameContext is LastSelfRename with a context
+func LastSelfRenameContext(ctx context.Context, playerID string) (at time.Time, ok bool, err error) {
+	err = db.QueryRowContext(ctx, `
+		SELECT renamed_at FROM player_renames
+		WHERE player_id = ? AND renamed_by = ''
+		ORDER BY renamed_at DESC
+		LIMIT 1
+	`, playerID).Scan(&at)
+	if err == sql.ErrNoRows {
+		return at, false, nil
+	}
+	return at, err == nil, err
+}
+
+// GetLastSelfRenames returns when each player last renamed themselves, keyed by player id
+func GetLastSelfRenames() (map[string]time.Time, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetLastSelfRenamesContext(ctx)
+}
+
+// GetLastSelfRenamesContext is GetLastSelfRenames with a context
+func GetLastSelfRenamesContext(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT player_id, MAX(renamed_at) FROM player_renames
+		WHERE renamed_by = ''
+		GROUP BY player_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	renames := make(map[string]time.Time)
+	for rows.Next() {
+		var playerID string
+		var at timestamp
+		if err := rows.Scan(&playerID, &at); err != nil {
+			return nil, err
+		}
+		renames[playerID] = at.Time
+	}
+	return renames, rows.Err()
+}
+
+// a player anti-cheat (or an admin) pulled off the leaderboard
+type Quarantine struct {
+	PlayerID      string
+	Reason        string  // the signal that tipped them over
+	Score         float64 // suspicion at the time
+	QuarantinedAt time.Time
+}
+
+// QuarantinePlayer hides a player from leaderboards until they're released
+func QuarantinePlayer(q Quarantine) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return QuarantinePlayerContext(ctx, q)
+}
+
+// QuarantinePlayerContext is QuarantinePlayer with a context
+func QuarantinePlayerContext(ctx context.Context, q Quarantine) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO player_quarantine (player_id, reason, score, quarantined_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (player_id) DO UPDATE SET reason = excluded.reason, score = excluded.score, quarantined_at = excluded.quarantined_at
+	`, q.PlayerID, q.Reason, q.Score, q.QuarantinedAt.UTC())
+	return err
+}
+
+// ReleasePlayer lets a quarantined player back onto the leaderboard
+func ReleasePlayer(playerID string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return ReleasePlayerContext(ctx, playerID)
+}
+
+// ReleasePlayerContext is ReleasePlayer with a context
+func ReleasePlayerContext(ctx context.Context, playerID string) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM player_quarantine WHERE player_id = ?`, playerID)
+	return err
+}
+
+// GetQuarantined returns every quarantined player, keyed by player id
+func GetQuarantined() (map[string]Quarantine, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetQuarantinedContext(ctx)
+}
+
+// GetQuarantinedContext is GetQuarantined with a context
+func GetQuarantinedContext(ctx context.Context) (map[string]Quarantine, error) {
+	rows, err := db.QueryContext(ctx, `SELECT player_id, reason, score, quarantined_at FROM player_quarantine`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quarantined := make(map[string]Quarantine)
+	for rows.Next() {
+		var q Quarantine
+		if err := rows.Scan(&q.PlayerID, &q.Reason, &q.Score, &q.QuarantinedAt); err != nil {
+			return nil, err
+		}
+		quarantined[q.PlayerID] = q
+	}
+	return quarantined, rows.Err()
+}
+
+// InsertAudit records something an admin did
+func InsertAudit(e AuditEntry) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return InsertAuditContext(ctx, e)
+}
+
+// InsertAuditContext is InsertAudit with a context
+func InsertAuditContext(ctx context.Context, e AuditEntry) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO admin_audit (actor, action, target, detail, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, e.Actor, e.Action, e.Target, e.Detail, e.CreatedAt.UTC())
+	return err
+}
+
+// QueryAudit returns audit entries newest first, optionally just for one target
+func QueryAudit(target string, beforeID int64, limit int) ([]AuditEntry, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return QueryAuditContext(ctx, target, beforeID, limit)
+}
+
+// QueryAuditContext is QueryAudit with a context
+func QueryAuditContext(ctx context.Context, target string, beforeID int64, limit int) ([]AuditEntry, error) {
+	var where []string
+	var args []interface{}
+	if target != "" {
+		where = append(where, "target = ?")
+		args = append(args, target)
+	}
+	if beforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, beforeID)
+	}
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, actor, action, target, detail, created_at
+		FROM admin_audit
+		`+whereClause(where)+`
+		ORDER BY id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
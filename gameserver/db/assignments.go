@@ -0,0 +1,154 @@
+// assignments
+// ===========================
+// who held which dns request and how it ended for them. the player's current
+// one also lives in players.last_request_id so it survives a restart
+// gameserver/db/assignments.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// one player holding one dns request
+type Assignment struct {
+	ID         int64     // row id, used as the pagination cursor
+	RequestID  string    // which dns request
+	PlayerID   string    // who held it
+	QName      string    // the domain, so the history reads without the decisions table
+	AssignedAt time.Time // when they got it
+	EndedAt    time.Time // zero while they still hold it
+	Outcome    string    // decided, voted, timed_out or released; empty while held
+}
+
+// what to look for in the assignment history, zero values don't filter
+type AssignmentQuery struct {
+	RequestID string
+	PlayerID  string
+	Outcome   string
+	BeforeID  int64 // cursor: only rows with a smaller id
+	Limit     int
+}
+
+// StartAssignment records that a player picked up a request
+// picking the same request up again (it went back in the queue) starts the row over
+func StartAssignment(a Assignment) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return StartAssignmentContext(ctx, a)
+}
+
+// StartAssignmentContext is StartAssignment with a context
+func StartAssignmentContext(ctx context.Context, a Assignment) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO assignments (request_id, player_id, qname, assigned_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (request_id, player_id) DO UPDATE SET assigned_at = excluded.assigned_at, ended_at = NULL, outcome = ''
+	`, a.RequestID, a.PlayerID, a.QName, a.AssignedAt.UTC())
+	return err
+}
+
+// EndAssignment records how a player's hold on a request ended, and clears it as their
+// current request if it still is. the first ending sticks, so a timeout isn't overwritten
+// by the cleanup that comes after it
+func EndAssignment(a Assignment) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return EndAssignmentContext(ctx, a)
+}
+
+// EndAssignmentContext is EndAssignment with a context
+func EndAssignmentContext(ctx context.Context, a Assignment) error {
+	tx, err := db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE assignments
+		SET ended_at = ?, outcome = ?
+		WHERE request_id = ? AND player_id = ? AND ended_at IS NULL
+	`, a.EndedAt.UTC(), a.Outcome, a.RequestID, a.PlayerID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE players
+		SET last_request_id = NULL
+		WHERE id = ? AND last_request_id = ?
+	`, a.PlayerID, a.RequestID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// QueryAssignments returns matching assignments newest first
+func QueryAssignments(q AssignmentQuery) ([]Assignment, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return QueryAssignmentsContext(ctx, q)
+}
+
+// QueryAssignmentsContext is QueryAssignments with a context
+func QueryAssignmentsContext(ctx context.Context, q AssignmentQuery) ([]Assignment, error) {
+	var where []string
+	var args []interface{}
+	if q.RequestID != "" {
+		where = append(where, "request_id = ?")
+		args = append(args, q.RequestID)
+	}
+	if q.PlayerID != "" {
+		where = append(where, "player_id = ?")
+		args = append(args, q.PlayerID)
+	}
+	if q.Outcome != "" {
+		where = append(where, "outcome = ?")
+		args = append(args, q.Outcome)
+	}
+	if q.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, q.BeforeID)
+	}
+	args = append(args, q.Limit)
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, request_id, player_id, qname, assigned_at, ended_at, outcome
+		FROM assignments
+		`+whereClause(where)+`
+		ORDER BY id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assignments []Assignment
+	for rows.Next() {
+		var a Assignment
+		var endedAt sql.NullTime
+		if err := rows.Scan(&a.ID, &a.RequestID, &a.PlayerID, &a.QName, &a.AssignedAt, &endedAt, &a.Outcome); err != nil {
+			return nil, err
+		}
+		a.EndedAt = endedAt.Time
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// PruneAssignments deletes assignments handed out before the cutoff and says how many went
+func PruneAssignments(before time.Time) (int64, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return PruneAssignmentsContext(ctx, before)
+}
+
+// PruneAssignmentsContext is PruneAssignments with a context
+func PruneAssignmentsContext(ctx context.Context, before time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM assignments WHERE assigned_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -2,23 +2,23 @@
 // ===========================
 // we use sqlite cuz it's simple and just works
 // litefs makes sure we don't lose data when things crash
+// (postgres works too, see store.go)
 // gameserver/db/db.go
 package db
 
 import (
+	"context"
 	"database/sql"
-	"log"
-	"os"
-	"path/filepath"
+	"strings"
 	"sync"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
-	db   *sql.DB   // our connection to sqlite
-	once sync.Once // makes sure we only set up once
+	db           *sqlDB    // our connection, sqlite or postgres
+	current      Store     // where players, scores, decisions and sessions go
+	once         sync.Once // makes sure we only set up once
+	queryTimeout = DefaultQueryTimeout
 )
 
 // all the stuff we track about players
@@ -32,119 +32,158 @@ type Player struct {
 	UpdatedAt     time.Time // last time we updated them
 }
 
+// one player's call on one dns request (or the fallback when nobody answered)
+type Decision struct {
+	ID        int64     // row id, handy as a pagination cursor
+	RequestID string    // which dns request this was
+	QName     string    // the domain that got queried
+	QType     string    // A, AAAA, MX, etc
+	QClass    string    // pretty much always IN
+	ClientIP  string    // who asked coredns
+	PlayerID  string    // who decided, empty if nobody picked it up
+	Action    string    // correct, corrupt, delay, nxdomain
+	LatencyMs int64     // how long from query to decision
+	TimedOut  bool      // true if we fell back because time ran out
+	CreatedAt time.Time // when the decision happened
+	Awards    []Award   // points handed out for it, saved alongside
+}
+
+// one line of a player's score receipt
+type Award struct {
+	ID        int64     // row id, used as the pagination cursor
+	PlayerID  string    // who got the points
+	RequestID string    // which dns request earned them
+	Rule      string    // which scoring rule fired
+	Alignment string    // pure or evil
+	Points    float64   // how many (negative for penalties)
+	Detail    string    // human readable explanation
+	CreatedAt time.Time // when they got them
+}
+
 // fire up the database
-func Initialize(dbPath string) error {
+// dsn is a sqlite file path or a postgres:// url
+func Initialize(dsn string, opts Options) error {
 	var err error
 	once.Do(func() {
-		// see if we already have a database
-		_, err = os.Stat(dbPath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				log.Printf("no database found at %s, making a fresh one", dbPath)
-				// make sure we have somewhere to put it
-				if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-					return
-				}
-			} else {
-				return
-			}
-		} else {
-			log.Printf("found existing database at %s", dbPath)
-		}
-
-		// Open database connection
-		db, err = sql.Open("sqlite3", dbPath)
+		var s *sqlStore
+		s, err = open(dsn, opts)
 		if err != nil {
 			return
 		}
-
-		// Test the connection
-		if err = db.Ping(); err != nil {
-			return
-		}
-
-		// Enable WAL mode for better concurrency
-		if _, err = db.Exec("PRAGMA journal_mode=WAL"); err != nil {
-			return
-		}
-
-		// Create tables if they don't exist
-		_, err = db.Exec(`
-			CREATE TABLE IF NOT EXISTS players (
-				id TEXT PRIMARY KEY,
-				nickname TEXT NOT NULL,
-				pure_points REAL DEFAULT 0,
-				evil_points REAL DEFAULT 0,
-				last_request_id TEXT,
-				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-			)
-		`)
+		db, current = s.db, s
+		queryTimeout = opts.withDefaults().QueryTimeout
 	})
 	return err
 }
 
-// CreatePlayer inserts a new player into the database
-func CreatePlayer(id, nickname string) error {
-	_, err := db.Exec(`
-		INSERT INTO players (id, nickname)
-		VALUES (?, ?)
-	`, id, nickname)
-	return err
+const createPlayerQuery = `
+	INSERT INTO players (id, nickname)
+	VALUES (?, ?)
+`
+
+// CreatePlayer inserts a new player
+func (st *sqlStore) CreatePlayer(ctx context.Context, id, nickname string) error {
+	_, err := st.stmts.createPlayer.ExecContext(ctx, id, nickname)
+	return conflictError(err)
 }
 
+const getPlayerQuery = `
+	SELECT id, nickname, pure_points, evil_points, last_request_id, created_at, updated_at
+	FROM players
+	WHERE id = ?
+`
+
 // GetPlayer retrieves a player from the database
-func GetPlayer(id string) (*Player, error) {
+func (st *sqlStore) GetPlayer(ctx context.Context, id string) (*Player, error) {
 	var p Player
 	var lastRequestID sql.NullString
-	err := db.QueryRow(`
-		SELECT id, nickname, pure_points, evil_points, last_request_id, created_at, updated_at
-		FROM players
-		WHERE id = ?
-	`, id).Scan(&p.ID, &p.Nickname, &p.PurePoints, &p.EvilPoints, &lastRequestID, &p.CreatedAt, &p.UpdatedAt)
-	if err == nil {
-		if lastRequestID.Valid {
-			p.LastRequestID = lastRequestID.String
-		} else {
-			p.LastRequestID = ""
-		}
-	}
+	err := st.stmts.getPlayer.QueryRowContext(ctx, id).Scan(&p.ID, &p.Nickname, &p.PurePoints, &p.EvilPoints, &lastRequestID, &p.CreatedAt, &p.UpdatedAt)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
-	return &p, err
+	p.LastRequestID = lastRequestID.String
+	return &p, nil
 }
 
+const addPlayerPointsQuery = `
+	UPDATE players
+	SET pure_points = pure_points + ?,
+		evil_points = evil_points + ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+`
+
 // AddPlayerPoints adds to a player's points
-func AddPlayerPoints(id string, pureDelta, evilDelta float64) error {
-	_, err := db.Exec(`
-		UPDATE players
+func (st *sqlStore) AddPlayerPoints(ctx context.Context, id string, pureDelta, evilDelta float64) error {
+	return rowAffected(st.stmts.addPlayerPoints.ExecContext(ctx, pureDelta, evilDelta, id))
+}
+
+// a change in points waiting to be written, for a player or a team
+type PointsDelta struct {
+	ID   string
+	Pure float64
+	Evil float64
+}
+
+// SyncPoints adds pending point changes for players and teams in one transaction,
+// so either every change lands or none of them do
+func (st *sqlStore) SyncPoints(ctx context.Context, players, teams []PointsDelta) error {
+	tx, err := st.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	playerStmt := tx.StmtContext(ctx, st.stmts.addPlayerPoints)
+	defer playerStmt.Close()
+	for _, d := range players {
+		if _, err := playerStmt.ExecContext(ctx, d.Pure, d.Evil, d.ID); err != nil {
+			return err
+		}
+	}
+
+	teamStmt, err := tx.PrepareContext(ctx, `
+		UPDATE teams
 		SET pure_points = pure_points + ?,
-			evil_points = evil_points + ?,
-			updated_at = CURRENT_TIMESTAMP
+			evil_points = evil_points + ?
 		WHERE id = ?
-	`, pureDelta, evilDelta, id)
-	return err
+	`)
+	if err != nil {
+		return err
+	}
+	defer teamStmt.Close()
+	for _, d := range teams {
+		if _, err := teamStmt.ExecContext(ctx, d.Pure, d.Evil, d.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
+const updatePlayerRequestQuery = `
+	UPDATE players
+	SET last_request_id = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+`
+
 // UpdatePlayerRequest updates a player's last assigned request
-func UpdatePlayerRequest(id, requestID string) error {
-	_, err := db.Exec(`
-		UPDATE players
-		SET last_request_id = ?,
-			updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`, requestID, id)
-	return err
+func (st *sqlStore) UpdatePlayerRequest(ctx context.Context, id, requestID string) error {
+	return rowAffected(st.stmts.updatePlayerRequest.ExecContext(ctx, requestID, id))
 }
 
+const getLeaderboardQuery = `
+	SELECT id, nickname, pure_points, evil_points, last_request_id, created_at, updated_at
+	FROM players
+	ORDER BY (pure_points + evil_points) DESC
+`
+
 // GetLeaderboard returns all players sorted by net alignment
-func GetLeaderboard() ([]Player, error) {
-	rows, err := db.Query(`
-		SELECT id, nickname, pure_points, evil_points, last_request_id, created_at, updated_at
-		FROM players
-		ORDER BY (pure_points + evil_points) DESC
-	`)
+func (st *sqlStore) GetLeaderboard(ctx context.Context) ([]Player, error) {
+	rows, err := st.stmts.getLeaderboard.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -158,24 +197,477 @@ func GetLeaderboard() ([]Player, error) {
 		if err != nil {
 			return nil, err
 		}
-		// Convert NULL to empty string if needed
-		if lastRequestID.Valid {
-			p.LastRequestID = lastRequestID.String
-		} else {
-			p.LastRequestID = ""
+		// NULL comes out as an empty string
+		p.LastRequestID = lastRequestID.String
+		players = append(players, p)
+	}
+	return players, rows.Err()
+}
+
+// InsertDecisions writes a batch of decisions in one transaction
+// either the whole batch lands or none of it does, so retries are safe
+func (st *sqlStore) InsertDecisions(ctx context.Context, decisions []Decision) error {
+	tx, err := st.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO decisions (request_id, qname, qtype, qclass, client_ip, player_id, action, latency_ms, timed_out, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	awardStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO score_awards (player_id, request_id, rule, alignment, points, detail, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer awardStmt.Close()
+
+	for _, d := range decisions {
+		_, err := stmt.ExecContext(ctx, d.RequestID, d.QName, d.QType, d.QClass, d.ClientIP, d.PlayerID, d.Action, d.LatencyMs, d.TimedOut, d.CreatedAt.UTC())
+		if err != nil {
+			return err
+		}
+		for _, a := range d.Awards {
+			_, err := awardStmt.ExecContext(ctx, d.PlayerID, d.RequestID, a.Rule, a.Alignment, a.Points, a.Detail, d.CreatedAt.UTC())
+			if err != nil {
+				return err
+			}
 		}
+	}
+	return tx.Commit()
+}
+
+// PruneDecisions deletes decisions (and their awards) older than the cutoff and says how many decisions went
+func (st *sqlStore) PruneDecisions(ctx context.Context, before time.Time) (int64, error) {
+	if _, err := st.db.ExecContext(ctx, `DELETE FROM score_awards WHERE created_at < ?`, before.UTC()); err != nil {
+		return 0, err
+	}
+	res, err := st.db.ExecContext(ctx, `DELETE FROM decisions WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// a logged in player - we only ever keep the hash of their token
+type Session struct {
+	TokenHash string    // sha256 of the secret token, hex encoded
+	PlayerID  string    // who this session belongs to
+	CreatedAt time.Time // when they logged in
+	ExpiresAt time.Time // when the token stops working
+}
+
+const createSessionQuery = `
+	INSERT INTO sessions (token_hash, player_id, created_at, expires_at)
+	VALUES (?, ?, ?, ?)
+`
+
+// CreateSession stores a new session
+func (st *sqlStore) CreateSession(ctx context.Context, s Session) error {
+	_, err := st.stmts.createSession.ExecContext(ctx, s.TokenHash, s.PlayerID, s.CreatedAt.UTC(), s.ExpiresAt.UTC())
+	return conflictError(err)
+}
+
+const getSessionQuery = `
+	SELECT token_hash, player_id, created_at, expires_at
+	FROM sessions
+	WHERE token_hash = ?
+`
+
+// GetSession looks up a session by token hash
+func (st *sqlStore) GetSession(ctx context.Context, tokenHash string) (*Session, error) {
+	var s Session
+	err := st.stmts.getSession.QueryRowContext(ctx, tokenHash).Scan(&s.TokenHash, &s.PlayerID, &s.CreatedAt, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+const deleteSessionQuery = `DELETE FROM sessions WHERE token_hash = ?`
+
+// DeleteSession logs a session out
+// logging out twice is fine, so a missing session isn't an error
+func (st *sqlStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := st.stmts.deleteSession.ExecContext(ctx, tokenHash)
+	return err
+}
+
+// PruneSessions clears out sessions that have already expired
+func (st *sqlStore) PruneSessions(ctx context.Context, now time.Time) (int64, error) {
+	res, err := st.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// what to look for when digging through decisions
+// zero values mean "don't filter on this"
+type DecisionQuery struct {
+	PlayerID string    // only this player's decisions
+	QName    string    // only this domain
+	Since    time.Time // at or after this time
+	Until    time.Time // before this time
+	BeforeID int64     // cursor: only rows with a smaller id
+	Limit    int       // max rows to return
+}
+
+// how often an action got picked
+type ActionCount struct {
+	Action   string
+	Count    int64
+	TimedOut int64 // how many of those were fallbacks
+}
+
+// how often a domain got hit with something
+type DomainCount struct {
+	Domain string
+	Count  int64
+}
+
+// decisionFilter turns the time range bits of a query into sql
+func decisionFilter(where []string, args []interface{}, since, until time.Time) ([]string, []interface{}) {
+	if !since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, since.UTC())
+	}
+	if !until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, until.UTC())
+	}
+	return where, args
+}
+
+// whereClause glues conditions together, or gives back nothing if there aren't any
+func whereClause(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(where, " AND ")
+}
+
+// QueryDecisions returns matching decisions newest first
+func (st *sqlStore) QueryDecisions(ctx context.Context, q DecisionQuery) ([]Decision, error) {
+	var where []string
+	var args []interface{}
+	if q.PlayerID != "" {
+		where = append(where, "player_id = ?")
+		args = append(args, q.PlayerID)
+	}
+	if q.QName != "" {
+		where = append(where, "qname = ?")
+		args = append(args, q.QName)
+	}
+	if q.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, q.BeforeID)
+	}
+	where, args = decisionFilter(where, args, q.Since, q.Until)
+	args = append(args, q.Limit)
+
+	rows, err := st.db.QueryContext(ctx, `
+		SELECT id, request_id, qname, qtype, qclass, client_ip, player_id, action, latency_ms, timed_out, created_at
+		FROM decisions
+		`+whereClause(where)+`
+		ORDER BY id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []Decision
+	for rows.Next() {
+		var d Decision
+		err := rows.Scan(&d.ID, &d.RequestID, &d.QName, &d.QType, &d.QClass, &d.ClientIP, &d.PlayerID, &d.Action, &d.LatencyMs, &d.TimedOut, &d.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
-		players = append(players, p)
+		decisions = append(decisions, d)
 	}
-	return players, rows.Err()
+	return decisions, rows.Err()
+}
+
+// QueryAwards returns a player's awards newest first
+// beforeID is the pagination cursor, 0 to start from the top
+func (st *sqlStore) QueryAwards(ctx context.Context, playerID string, beforeID int64, limit int) ([]Award, error) {
+	where := []string{"player_id = ?"}
+	args := []interface{}{playerID}
+	if beforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, beforeID)
+	}
+	args = append(args, limit)
+
+	rows, err := st.db.QueryContext(ctx, `
+		SELECT id, player_id, request_id, rule, alignment, points, detail, created_at
+		FROM score_awards
+		`+whereClause(where)+`
+		ORDER BY id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var awards []Award
+	for rows.Next() {
+		var a Award
+		if err := rows.Scan(&a.ID, &a.PlayerID, &a.RequestID, &a.Rule, &a.Alignment, &a.Points, &a.Detail, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		awards = append(awards, a)
+	}
+	return awards, rows.Err()
+}
+
+// CountActions tallies decisions by action over a time range
+func (st *sqlStore) CountActions(ctx context.Context, since, until time.Time) ([]ActionCount, error) {
+	where, args := decisionFilter(nil, nil, since, until)
+	rows, err := st.db.QueryContext(ctx, `
+		SELECT action, COUNT(*), SUM(CASE WHEN timed_out THEN 1 ELSE 0 END)
+		FROM decisions
+		`+whereClause(where)+`
+		GROUP BY action
+		ORDER BY COUNT(*) DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []ActionCount
+	for rows.Next() {
+		var c ActionCount
+		if err := rows.Scan(&c.Action, &c.Count, &c.TimedOut); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// TopDomains returns the domains that got a given action the most
+// an empty action counts everything
+func (st *sqlStore) TopDomains(ctx context.Context, action string, since, until time.Time, limit int) ([]DomainCount, error) {
+	var where []string
+	var args []interface{}
+	if action != "" {
+		where = append(where, "action = ?")
+		args = append(args, action)
+	}
+	where, args = decisionFilter(where, args, since, until)
+	args = append(args, limit)
+
+	rows, err := st.db.QueryContext(ctx, `
+		SELECT qname, COUNT(*)
+		FROM decisions
+		`+whereClause(where)+`
+		GROUP BY qname
+		ORDER BY COUNT(*) DESC, qname
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []DomainCount
+	for rows.Next() {
+		var c DomainCount
+		if err := rows.Scan(&c.Domain, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// a team and its running score
+type Team struct {
+	ID         string
+	Name       string
+	PurePoints float64
+	EvilPoints float64
+	CreatedAt  time.Time
+}
+
+// CreateTeam stores a new team
+// does nothing if a team with that id is already there
+func CreateTeam(t Team) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return CreateTeamContext(ctx, t)
+}
+
+// CreateTeamContext is CreateTeam with a context
+func CreateTeamContext(ctx context.Context, t Team) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO teams (id, name, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`, t.ID, t.Name, t.CreatedAt.UTC())
+	return err
+}
+
+// GetTeams returns every team
+func GetTeams() ([]Team, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetTeamsContext(ctx)
+}
+
+// GetTeamsContext is GetTeams with a context
+func GetTeamsContext(ctx context.Context) ([]Team, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, pure_points, evil_points, created_at
+		FROM teams
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []Team
+	for rows.Next() {
+		var t Team
+		if err := rows.Scan(&t.ID, &t.Name, &t.PurePoints, &t.EvilPoints, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
+// AddTeamPoints adds to a team's points
+func AddTeamPoints(id string, pureDelta, evilDelta float64) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return AddTeamPointsContext(ctx, id, pureDelta, evilDelta)
+}
+
+// AddTeamPointsContext is AddTeamPoints with a context
+func AddTeamPointsContext(ctx context.Context, id string, pureDelta, evilDelta float64) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE teams
+		SET pure_points = pure_points + ?,
+			evil_points = evil_points + ?
+		WHERE id = ?
+	`, pureDelta, evilDelta, id)
+	return err
+}
+
+// SetPlayerTeam puts a player on a team, moving them off any old one
+func SetPlayerTeam(playerID, teamID string, joinedAt time.Time) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return SetPlayerTeamContext(ctx, playerID, teamID, joinedAt)
+}
+
+// SetPlayerTeamContext is SetPlayerTeam with a context
+func SetPlayerTeamContext(ctx context.Context, playerID, teamID string, joinedAt time.Time) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO team_members (player_id, team_id, joined_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (player_id) DO UPDATE SET team_id = excluded.team_id, joined_at = excluded.joined_at
+	`, playerID, teamID, joinedAt.UTC())
+	return err
+}
+
+// GetTeamMembers maps every player on a team to their team id
+func GetTeamMembers() (map[string]string, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetTeamMembersContext(ctx)
+}
+
+// GetTeamMembersContext is GetTeamMembers with a context
+func GetTeamMembersContext(ctx context.Context) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT player_id, team_id FROM team_members`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make(map[string]string)
+	for rows.Next() {
+		var playerID, teamID string
+		if err := rows.Scan(&playerID, &teamID); err != nil {
+			return nil, err
+		}
+		members[playerID] = teamID
+	}
+	return members, rows.Err()
+}
+
+// RecordObjectiveCompletion notes that a team finished an objective
+func RecordObjectiveCompletion(teamID, objectiveID string, points float64, at time.Time) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return RecordObjectiveCompletionContext(ctx, teamID, objectiveID, points, at)
+}
+
+// RecordObjectiveCompletionContext is RecordObjectiveCompletion with a context
+func RecordObjectiveCompletionContext(ctx context.Context, teamID, objectiveID string, points float64, at time.Time) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO objective_completions (team_id, objective_id, points, completed_at)
+		VALUES (?, ?, ?, ?)
+	`, teamID, objectiveID, points, at.UTC())
+	return err
+}
+
+// CountObjectiveCompletions says how many times a team finished each objective
+func CountObjectiveCompletions(teamID string) (map[string]int64, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return CountObjectiveCompletionsContext(ctx, teamID)
+}
+
+// CountObjectiveCompletionsContext is CountObjectiveCompletions with a context
+func CountObjectiveCompletionsContext(ctx context.Context, teamID string) (map[string]int64, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT objective_id, COUNT(*)
+		FROM objective_completions
+		WHERE team_id = ?
+		GROUP BY objective_id
+	`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var objectiveID string
+		var n int64
+		if err := rows.Scan(&objectiveID, &n); err != nil {
+			return nil, err
+		}
+		counts[objectiveID] = n
+	}
+	return counts, rows.Err()
 }
 
 // Close closes the database connection
 func Close() error {
-	if db != nil {
-		return db.Close()
+	if current != nil {
+		return current.Close()
 	}
 	return nil
 }
@@ -0,0 +1,305 @@
+// backups
+// ===========================
+// streaming whole tables out so game data can be backed up or moved, and
+// reading them back in. imports skip whatever is already there, so loading
+// the same file twice changes nothing the second time
+// gameserver/db/export.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrSeasonRunning is what importing a season that isn't over yet, or isn't older than the one
+// being played, returns. it would clash with the next rollover
+var ErrSeasonRunning = errors.New("season isn't finished")
+
+// Backup reads and writes players, decisions and seasons in bulk on one database
+type Backup struct {
+	db    *sqlDB
+	owned bool // opened by OpenBackup, so Close closes it
+}
+
+// a season and where everyone finished in it
+type SeasonExport struct {
+	Season
+	Results []Standing // empty while the season is still running
+}
+
+// OpenBackup connects to the database a dsn points at without changing it, so it's safe on a
+// copy or a database another server is using. it won't touch a schema that needs migrating
+func OpenBackup(dsn string) (*Backup, error) {
+	if !isPostgres(dsn) {
+		// don't leave an empty sqlite file behind a typo
+		if _, err := os.Stat(dsn); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := connect(dsn, Options{})
+	if err != nil {
+		return nil, err
+	}
+	pending, err := pendingMigrations(context.Background(), conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if pending > 0 {
+		conn.Close()
+		return nil, fmt.Errorf("database has %d pending migrations, run migrate first", pending)
+	}
+	return &Backup{db: conn, owned: true}, nil
+}
+
+// CurrentBackup works on the database Initialize opened
+func CurrentBackup() *Backup {
+	return &Backup{db: db}
+}
+
+// Close lets go of a database OpenBackup opened, and leaves the shared one alone
+func (b *Backup) Close() error {
+	if !b.owned {
+		return nil
+	}
+	return b.db.Close()
+}
+
+// ExportPlayers hands every player to fn, oldest first, one row at a time
+func (b *Backup) ExportPlayers(ctx context.Context, fn func(Player) error) error {
+	rows, err := b.db.QueryContext(ctx, `
+		SELECT id, nickname, pure_points, evil_points, created_at, updated_at
+		FROM players
+		ORDER BY created_at, id
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Player
+		if err := rows.Scan(&p.ID, &p.Nickname, &p.PurePoints, &p.EvilPoints, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportDecisions hands every decision to fn, oldest first, one row at a time
+// awards aren't included, they're the scores' receipts rather than the game's history
+func (b *Backup) ExportDecisions(ctx context.Context, fn func(Decision) error) error {
+	rows, err := b.db.QueryContext(ctx, `
+		SELECT id, request_id, qname, qtype, qclass, client_ip, player_id, action, latency_ms, timed_out, created_at
+		FROM decisions
+		ORDER BY id
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Decision
+		if err := rows.Scan(&d.ID, &d.RequestID, &d.QName, &d.QType, &d.QClass, &d.ClientIP, &d.PlayerID, &d.Action, &d.LatencyMs, &d.TimedOut, &d.CreatedAt); err != nil {
+			return err
+		}
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportSeasons hands every season and its final standings to fn, oldest first
+func (b *Backup) ExportSeasons(ctx context.Context, fn func(SeasonExport) error) error {
+	rows, err := b.db.QueryContext(ctx, `SELECT number, started_at, ended_at FROM seasons ORDER BY number`)
+	if err != nil {
+		return err
+	}
+	// there are only ever a handful of seasons, so read them all before asking for results
+	var seasons []SeasonExport
+	for rows.Next() {
+		var s SeasonExport
+		var endedAt sql.NullTime
+		if err := rows.Scan(&s.Number, &s.StartedAt, &endedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		s.EndedAt = endedAt.Time
+		seasons = append(seasons, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range seasons {
+		rows, err := b.db.QueryContext(ctx, `
+			SELECT player_id, nickname, pure_points, evil_points, rank
+			FROM season_results
+			WHERE season = ?
+			ORDER BY rank, player_id
+		`, s.Number)
+		if err != nil {
+			return err
+		}
+		s.Results, err = scanStandings(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportPlayers adds the players that aren't there yet, in one transaction, and says how many it added
+// players who are already there keep their scores, so importing into a live game can't rewind anyone
+func (b *Backup) ImportPlayers(ctx context.Context, players []Player) (int64, error) {
+	tx, err := b.db.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO players (id, nickname, pure_points, evil_points, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var added int64
+	for _, p := range players {
+		res, err := stmt.ExecContext(ctx, p.ID, p.Nickname, p.PurePoints, p.EvilPoints, p.CreatedAt.UTC(), p.UpdatedAt.UTC())
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		added += n
+	}
+	return added, tx.Commit()
+}
+
+// ImportDecisions adds the decisions that aren't there yet, in one transaction, and says how many it added
+// a decision is already there if its request has one from the same player. ids are handed out fresh
+func (b *Backup) ImportDecisions(ctx context.Context, decisions []Decision) (int64, error) {
+	tx, err := b.db.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	existsStmt, err := tx.PrepareContext(ctx, `SELECT COUNT(*) FROM decisions WHERE request_id = ? AND player_id = ?`)
+	if err != nil {
+		return 0, err
+	}
+	defer existsStmt.Close()
+	insertStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO decisions (request_id, qname, qtype, qclass, client_ip, player_id, action, latency_ms, timed_out, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertStmt.Close()
+
+	var added int64
+	for _, d := range decisions {
+		var exists int
+		if err := existsStmt.QueryRowContext(ctx, d.RequestID, d.PlayerID).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if exists > 0 {
+			continue
+		}
+		_, err := insertStmt.ExecContext(ctx, d.RequestID, d.QName, d.QType, d.QClass, d.ClientIP, d.PlayerID, d.Action, d.LatencyMs, d.TimedOut, d.CreatedAt.UTC())
+		if err != nil {
+			return 0, err
+		}
+		added++
+	}
+	return added, tx.Commit()
+}
+
+// ImportSeasons adds the seasons and standings that aren't there yet, in one transaction,
+// and says how many seasons it added. a season that's already there keeps its dates
+// while a season is being played only finished seasons from before it go in, anything
+// else is ErrSeasonRunning and nothing is written
+func (b *Backup) ImportSeasons(ctx context.Context, seasons []SeasonExport) (int64, error) {
+	tx, err := b.db.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var running int64
+	err = tx.QueryRowContext(ctx, `SELECT number FROM seasons WHERE ended_at IS NULL ORDER BY number DESC LIMIT 1`).Scan(&running)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if running > 0 {
+		for _, s := range seasons {
+			if s.EndedAt.IsZero() || s.Number >= running {
+				return 0, fmt.Errorf("%w: season %d, season %d is being played", ErrSeasonRunning, s.Number, running)
+			}
+		}
+	}
+
+	seasonStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO seasons (number, started_at, ended_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (number) DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer seasonStmt.Close()
+	resultStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO season_results (season, player_id, nickname, pure_points, evil_points, rank)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (season, player_id) DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer resultStmt.Close()
+
+	var added int64
+	for _, s := range seasons {
+		var endedAt sql.NullTime
+		if !s.EndedAt.IsZero() {
+			endedAt = sql.NullTime{Time: s.EndedAt.UTC(), Valid: true}
+		}
+		res, err := seasonStmt.ExecContext(ctx, s.Number, s.StartedAt.UTC(), endedAt)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		added += n
+		for _, r := range s.Results {
+			if _, err := resultStmt.ExecContext(ctx, s.Number, r.PlayerID, r.Nickname, r.PurePoints, r.EvilPoints, r.Rank); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return added, tx.Commit()
+}
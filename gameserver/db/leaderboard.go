@@ -0,0 +1,185 @@
+// leaderboards over a time window
+// ===========================
+// the all-time board lives in memory, but "who scored most today" has to come
+// from score_awards. the database does the summing, ranking and paging so we never
+// pull more than one page of players out of the database
+// gameserver/db/leaderboard.go
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// what a window leaderboard can be sorted by
+var windowOrder = map[string]string{
+	"total":  "(w.pure + w.evil)",
+	"pure":   "w.pure",
+	"evil":   "w.evil",
+	"net":    "(w.pure - w.evil)",
+	"recent": "w.last_active",
+}
+
+// windowBoard ranks everyone who scored since a cutoff, leaving out banned and
+// quarantined players. ties go to the lower id, same as the in-memory board
+const windowBoard = `
+	WITH w AS (
+		SELECT player_id,
+			SUM(CASE WHEN alignment = 'pure' THEN points ELSE 0 END) AS pure,
+			SUM(CASE WHEN alignment = 'evil' THEN points ELSE 0 END) AS evil,
+			MAX(created_at) AS last_active
+		FROM score_awards
+		WHERE created_at >= ?
+		GROUP BY player_id
+	),
+	board AS (
+		SELECT w.player_id, p.nickname, w.pure, w.evil, w.last_active,
+			ROW_NUMBER() OVER (ORDER BY %s DESC, w.player_id) AS rank,
+			COUNT(*) OVER () AS ranked
+		FROM w
+		JOIN players p ON p.id = w.player_id
+		WHERE w.player_id NOT IN (SELECT player_id FROM player_bans)
+			AND w.player_id NOT IN (SELECT player_id FROM player_quarantine)
+	)
+	SELECT player_id, nickname, pure, evil, last_active, rank, ranked
+	FROM board
+`
+
+// one player's points inside a window
+type WindowStanding struct {
+	PlayerID   string
+	Nickname   string
+	PurePoints float64
+	EvilPoints float64
+	LastActive time.Time // their latest award in the window
+	Rank       int       // 1-based, among everyone on the board
+}
+
+// WindowQuery picks a page of a window leaderboard
+type WindowQuery struct {
+	Since  time.Time // only awards from here on count
+	Sort   string    // total, pure, evil, net or recent
+	Search string    // nickname substring, case insensitive for ascii
+	Offset int
+	Limit  int
+}
+
+// windowSQL fills the sort into windowBoard
+func windowSQL(sort string) (string, error) {
+	order, ok := windowOrder[sort]
+	if !ok {
+		return "", fmt.Errorf("unknown sort %q", sort)
+	}
+	return fmt.Sprintf(windowBoard, order), nil
+}
+
+// WindowLeaderboard returns a page of players ranked by what they scored since q.Since
+// searching keeps everyone's real rank, it just skips the players that don't match
+func WindowLeaderboard(q WindowQuery) ([]WindowStanding, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return WindowLeaderboardContext(ctx, q)
+}
+
+// WindowLeaderboardContext is WindowLeaderboard with a context
+func WindowLeaderboardContext(ctx context.Context, q WindowQuery) ([]WindowStanding, error) {
+	query, err := windowSQL(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query+`
+		WHERE ? = '' OR LOWER(nickname) LIKE LOWER(?) ESCAPE '\'
+		ORDER BY rank
+		LIMIT ? OFFSET ?
+	`, q.Since.UTC(), q.Search, likePattern(q.Search), q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var standings []WindowStanding
+	for rows.Next() {
+		var s WindowStanding
+		var lastActive timestamp
+		var ranked int
+		if err := rows.Scan(&s.PlayerID, &s.Nickname, &s.PurePoints, &s.EvilPoints, &lastActive, &s.Rank, &ranked); err != nil {
+			return nil, err
+		}
+		s.LastActive = lastActive.Time
+		standings = append(standings, s)
+	}
+	return standings, rows.Err()
+}
+
+// WindowRank returns where a player stands in a window leaderboard and how many are on it
+// ok is false when they scored nothing in the window or aren't listed
+func WindowRank(playerID string, since time.Time, sort string) (WindowStanding, int, bool, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return WindowRankContext(ctx, playerID, since, sort)
+}
+
+// WindowRankContext is WindowRank with a context
+func WindowRankContext(ctx context.Context, playerID string, since time.Time, sort string) (WindowStanding, int, bool, error) {
+	var s WindowStanding
+	query, err := windowSQL(sort)
+	if err != nil {
+		return s, 0, false, err
+	}
+	rows, err := db.QueryContext(ctx, query+` WHERE player_id = ?`, since.UTC(), playerID)
+	if err != nil {
+		return s, 0, false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return s, 0, false, rows.Err()
+	}
+	var lastActive timestamp
+	var ranked int
+	if err := rows.Scan(&s.PlayerID, &s.Nickname, &s.PurePoints, &s.EvilPoints, &lastActive, &s.Rank, &ranked); err != nil {
+		return s, 0, false, err
+	}
+	s.LastActive = lastActive.Time
+	return s, ranked, true, nil
+}
+
+// timestamp scans a time that came back from an aggregate like MAX(). postgres
+// keeps the type, but sqlite loses it and hands the time over as plain text
+type timestamp struct {
+	time.Time
+}
+
+func (t *timestamp) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		t.Time = v.UTC()
+	case string:
+		t.Time = parseTimestamp(v)
+	case []byte:
+		t.Time = parseTimestamp(string(v))
+	default:
+		t.Time = time.Time{}
+	}
+	return nil
+}
+
+// parseTimestamp reads a time sqlite handed over as text
+func parseTimestamp(value string) time.Time {
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// likePattern turns a search string into a LIKE pattern matching it anywhere
+func likePattern(search string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(search) + "%"
+}
@@ -0,0 +1,339 @@
+// in-memory store
+// ===========================
+// a Store that lives in a few maps, for tests that don't want a database
+// on disk. nothing survives the process, and there are no teams, so team
+// point deltas are dropped like an UPDATE on a team that isn't there
+// gameserver/db/memory.go
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps everything in memory, behaving like the sql stores
+type memoryStore struct {
+	mu        sync.Mutex
+	players   map[string]*Player
+	decisions []Decision // oldest first, ids counting up
+	awards    []Award    // same
+	sessions  map[string]Session
+	nextID    int64 // shared by decisions and awards, which is fine for cursors
+}
+
+// NewMemoryStore returns an empty Store that keeps everything in memory
+func NewMemoryStore() Store {
+	return &memoryStore{
+		players:  make(map[string]*Player),
+		sessions: make(map[string]Session),
+	}
+}
+
+// lock takes mu, unless the caller has already given up
+func (m *memoryStore) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	return nil
+}
+
+func (m *memoryStore) CreatePlayer(ctx context.Context, id, nickname string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if _, exists := m.players[id]; exists {
+		return fmt.Errorf("%w: player %s", ErrConflict, id)
+	}
+	now := time.Now().UTC()
+	m.players[id] = &Player{ID: id, Nickname: nickname, CreatedAt: now, UpdatedAt: now}
+	return nil
+}
+
+func (m *memoryStore) GetPlayer(ctx context.Context, id string) (*Player, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	p, exists := m.players[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	copied := *p
+	return &copied, nil
+}
+
+func (m *memoryStore) GetLeaderboard(ctx context.Context) ([]Player, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	var players []Player
+	for _, p := range m.players {
+		players = append(players, *p)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		a, b := players[i].PurePoints+players[i].EvilPoints, players[j].PurePoints+players[j].EvilPoints
+		if a != b {
+			return a > b
+		}
+		return players[i].ID < players[j].ID
+	})
+	return players, nil
+}
+
+func (m *memoryStore) UpdatePlayerRequest(ctx context.Context, id, requestID string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	p, exists := m.players[id]
+	if !exists {
+		return ErrNotFound
+	}
+	p.LastRequestID = requestID
+	p.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (m *memoryStore) AddPlayerPoints(ctx context.Context, id string, pureDelta, evilDelta float64) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if !m.addPoints(id, pureDelta, evilDelta) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *memoryStore) SyncPoints(ctx context.Context, players, teams []PointsDelta) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	for _, d := range players {
+		m.addPoints(d.ID, d.Pure, d.Evil)
+	}
+	return nil
+}
+
+// addPoints adds to a player's points if they exist, and says whether they did. callers hold mu
+func (m *memoryStore) addPoints(id string, pureDelta, evilDelta float64) bool {
+	p, exists := m.players[id]
+	if exists {
+		p.PurePoints += pureDelta
+		p.EvilPoints += evilDelta
+		p.UpdatedAt = time.Now().UTC()
+	}
+	return exists
+}
+
+func (m *memoryStore) QueryAwards(ctx context.Context, playerID string, beforeID int64, limit int) ([]Award, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	var awards []Award
+	for i := len(m.awards) - 1; i >= 0 && (limit < 0 || len(awards) < limit); i-- {
+		a := m.awards[i]
+		if a.PlayerID == playerID && (beforeID <= 0 || a.ID < beforeID) {
+			awards = append(awards, a)
+		}
+	}
+	return awards, nil
+}
+
+func (m *memoryStore) InsertDecisions(ctx context.Context, decisions []Decision) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	for _, d := range decisions {
+		d.CreatedAt = d.CreatedAt.UTC()
+		m.nextID++
+		d.ID = m.nextID
+		for _, a := range d.Awards {
+			m.nextID++
+			m.awards = append(m.awards, Award{
+				ID:        m.nextID,
+				PlayerID:  d.PlayerID,
+				RequestID: d.RequestID,
+				Rule:      a.Rule,
+				Alignment: a.Alignment,
+				Points:    a.Points,
+				Detail:    a.Detail,
+				CreatedAt: d.CreatedAt,
+			})
+		}
+		d.Awards = nil
+		m.decisions = append(m.decisions, d)
+	}
+	return nil
+}
+
+func (m *memoryStore) PruneDecisions(ctx context.Context, before time.Time) (int64, error) {
+	if err := m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+	awards := m.awards[:0]
+	for _, a := range m.awards {
+		if !a.CreatedAt.Before(before) {
+			awards = append(awards, a)
+		}
+	}
+	m.awards = awards
+
+	var pruned int64
+	decisions := m.decisions[:0]
+	for _, d := range m.decisions {
+		if d.CreatedAt.Before(before) {
+			pruned++
+			continue
+		}
+		decisions = append(decisions, d)
+	}
+	m.decisions = decisions
+	return pruned, nil
+}
+
+// inRange says whether t falls in [since, until), zero ends being open
+func inRange(t, since, until time.Time) bool {
+	return (since.IsZero() || !t.Before(since)) && (until.IsZero() || t.Before(until))
+}
+
+func (m *memoryStore) QueryDecisions(ctx context.Context, q DecisionQuery) ([]Decision, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	var decisions []Decision
+	for i := len(m.decisions) - 1; i >= 0 && (q.Limit < 0 || len(decisions) < q.Limit); i-- {
+		d := m.decisions[i]
+		switch {
+		case q.PlayerID != "" && d.PlayerID != q.PlayerID:
+		case q.QName != "" && d.QName != q.QName:
+		case q.BeforeID > 0 && d.ID >= q.BeforeID:
+		case !inRange(d.CreatedAt, q.Since, q.Until):
+		default:
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions, nil
+}
+
+func (m *memoryStore) CountActions(ctx context.Context, since, until time.Time) ([]ActionCount, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	byAction := make(map[string]*ActionCount)
+	var counts []*ActionCount
+	for _, d := range m.decisions {
+		if !inRange(d.CreatedAt, since, until) {
+			continue
+		}
+		c := byAction[d.Action]
+		if c == nil {
+			c = &ActionCount{Action: d.Action}
+			byAction[d.Action] = c
+			counts = append(counts, c)
+		}
+		c.Count++
+		if d.TimedOut {
+			c.TimedOut++
+		}
+	}
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+
+	result := make([]ActionCount, 0, len(counts))
+	for _, c := range counts {
+		result = append(result, *c)
+	}
+	return result, nil
+}
+
+func (m *memoryStore) TopDomains(ctx context.Context, action string, since, until time.Time, limit int) ([]DomainCount, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	byDomain := make(map[string]int64)
+	for _, d := range m.decisions {
+		if (action == "" || d.Action == action) && inRange(d.CreatedAt, since, until) {
+			byDomain[d.QName]++
+		}
+	}
+	var counts []DomainCount
+	for domain, n := range byDomain {
+		counts = append(counts, DomainCount{Domain: domain, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Domain < counts[j].Domain
+	})
+	if limit >= 0 && len(counts) > limit {
+		counts = counts[:limit]
+	}
+	return counts, nil
+}
+
+func (m *memoryStore) CreateSession(ctx context.Context, s Session) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	if _, exists := m.sessions[s.TokenHash]; exists {
+		return fmt.Errorf("%w: session", ErrConflict)
+	}
+	s.CreatedAt, s.ExpiresAt = s.CreatedAt.UTC(), s.ExpiresAt.UTC()
+	m.sessions[s.TokenHash] = s
+	return nil
+}
+
+func (m *memoryStore) GetSession(ctx context.Context, tokenHash string) (*Session, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	s, exists := m.sessions[tokenHash]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (m *memoryStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	delete(m.sessions, tokenHash)
+	return nil
+}
+
+func (m *memoryStore) PruneSessions(ctx context.Context, now time.Time) (int64, error) {
+	if err := m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+	var pruned int64
+	for hash, s := range m.sessions {
+		if s.ExpiresAt.Before(now) {
+			delete(m.sessions, hash)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,296 @@
+// schema migrations
+// ===========================
+// every schema change is a numbered .sql file under migrations/<dialect>,
+// embedded in the binary and applied in order when the database opens.
+// schema_migrations remembers which ones ran. the first ten are the tables
+// Initialize used to create by hand, all IF NOT EXISTS, so a database from
+// before migrations just picks up from wherever it had got to
+// gameserver/db/migrations.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// postgres advisory lock held while migrating, so two servers starting together don't both migrate
+const migrationLockKey = 7_310_452_115
+
+// one schema change
+type Migration struct {
+	Version int    // from the file name, 1 upwards with no gaps
+	Name    string // the rest of the file name
+	SQL     string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// a migration and whether this database has it yet
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time // zero if it hasn't been applied
+}
+
+// Migrate applies any pending migrations to the database a dsn points at and returns the ones it applied
+func Migrate(dsn string) ([]Migration, error) {
+	conn, err := connect(dsn, Options{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return migrate(conn)
+}
+
+// MigrationStatus lists every migration and whether the database a dsn points at has it
+// it only reads, so it's also the dry run: the pending ones are what Migrate would apply
+func MigrationStatus(dsn string) ([]MigrationState, error) {
+	if !isPostgres(dsn) {
+		// don't make an empty sqlite file just to say everything is pending
+		if _, err := os.Stat(dsn); os.IsNotExist(err) {
+			return migrationStates(sqliteDialect, nil)
+		}
+	}
+	conn, err := connect(dsn, Options{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	exists, err := conn.dialect.hasMigrationsTable(ctx, conn.DB)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return migrationStates(conn.dialect, nil)
+	}
+	applied, err := appliedMigrations(ctx, conn.DB)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStates(conn.dialect, applied)
+}
+
+// migrationStates pairs every migration up with when it was applied
+func migrationStates(d dialect, applied map[int]time.Time) ([]MigrationState, error) {
+	migrations, err := loadMigrations(d)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := applied[m.Version]
+		states = append(states, MigrationState{Migration: m, Applied: ok, AppliedAt: at})
+	}
+	return states, nil
+}
+
+// migrate applies pending migrations in one transaction, holding the database's write lock
+// (sqlite) or an advisory lock (postgres) so nobody else migrates at the same time
+func migrate(conn *sqlDB) ([]Migration, error) {
+	migrations, err := loadMigrations(conn.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	// one connection, so the lock and every statement share the transaction
+	ctx := context.Background()
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if _, err := c.ExecContext(ctx, conn.dialect.beginLocked()); err != nil {
+		return nil, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			c.ExecContext(ctx, "ROLLBACK")
+		}
+	}()
+
+	if _, err := c.ExecContext(ctx, conn.dialect.migrationsTable()); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	for _, m := range pending {
+		if _, err := c.ExecContext(ctx, m.SQL); err != nil {
+			return nil, fmt.Errorf("migration %s: %w", m, err)
+		}
+		_, err := c.ExecContext(ctx, conn.dialect.rebind(`
+			INSERT INTO schema_migrations (version, name, applied_at)
+			VALUES (?, ?, ?)
+		`), m.Version, m.Name, time.Now().UTC())
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", m, err)
+		}
+		log.Printf("applied migration %s", m)
+	}
+
+	if _, err := c.ExecContext(ctx, "COMMIT"); err != nil {
+		return nil, err
+	}
+	committed = true
+	return pending, nil
+}
+
+// pendingMigrations counts the migrations a database doesn't have yet, without applying them
+func pendingMigrations(ctx context.Context, conn *sqlDB) (int, error) {
+	migrations, err := loadMigrations(conn.dialect)
+	if err != nil {
+		return 0, err
+	}
+	exists, err := conn.dialect.hasMigrationsTable(ctx, conn.DB)
+	if err != nil || !exists {
+		return len(migrations), err
+	}
+	applied, err := appliedMigrations(ctx, conn.DB)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// querier is a *sql.DB or a *sql.Conn
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// appliedMigrations maps each applied version to when it was applied
+func appliedMigrations(ctx context.Context, q querier) (map[int]time.Time, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at timestamp
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at.Time
+	}
+	return applied, rows.Err()
+}
+
+// loadMigrations reads a dialect's embedded migrations in version order
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := "migrations/" + d.String()
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name it like 0001_what_it_does.sql", e.Name())
+		}
+		data, err := fs.ReadFile(migrationFiles, dir+"/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %s: expected version %d, versions have to count up from 1 with no gaps or repeats", m, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+func (d dialect) String() string {
+	if d == postgresDialect {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// beginLocked starts a transaction that nobody else can migrate alongside
+func (d dialect) beginLocked() string {
+	if d == postgresDialect {
+		return fmt.Sprintf("BEGIN; SELECT pg_advisory_xact_lock(%d)", migrationLockKey)
+	}
+	// IMMEDIATE takes the write lock up front, so a second server waits instead of racing us
+	return "BEGIN IMMEDIATE"
+}
+
+// migrationsTable creates schema_migrations if it isn't there yet
+func (d dialect) migrationsTable() string {
+	appliedAt := "DATETIME"
+	if d == postgresDialect {
+		appliedAt = "TIMESTAMPTZ"
+	}
+	return `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at ` + appliedAt + ` NOT NULL
+		)
+	`
+}
+
+// hasMigrationsTable says whether schema_migrations exists, without creating it
+func (d dialect) hasMigrationsTable(ctx context.Context, q querier) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	if d == postgresDialect {
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'`
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var n int
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return false, err
+		}
+	}
+	return n > 0, rows.Err()
+}
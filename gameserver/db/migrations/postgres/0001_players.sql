@@ -0,0 +1,10 @@
+-- players and their running score
+CREATE TABLE IF NOT EXISTS players (
+	id TEXT PRIMARY KEY,
+	nickname TEXT NOT NULL,
+	pure_points DOUBLE PRECISION DEFAULT 0,
+	evil_points DOUBLE PRECISION DEFAULT 0,
+	last_request_id TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
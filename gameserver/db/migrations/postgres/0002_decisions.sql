@@ -0,0 +1,17 @@
+-- every decision ever made, indexed for player and domain lookups
+CREATE TABLE IF NOT EXISTS decisions (
+	id BIGSERIAL PRIMARY KEY,
+	request_id TEXT NOT NULL,
+	qname TEXT NOT NULL,
+	qtype TEXT NOT NULL,
+	qclass TEXT NOT NULL DEFAULT '',
+	client_ip TEXT NOT NULL DEFAULT '',
+	player_id TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	latency_ms BIGINT NOT NULL,
+	timed_out BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_decisions_player ON decisions (player_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_decisions_qname ON decisions (qname, created_at);
+CREATE INDEX IF NOT EXISTS idx_decisions_created ON decisions (created_at);
@@ -0,0 +1,13 @@
+-- every point ever awarded and the rule behind it
+CREATE TABLE IF NOT EXISTS score_awards (
+	id BIGSERIAL PRIMARY KEY,
+	player_id TEXT NOT NULL,
+	request_id TEXT NOT NULL,
+	rule TEXT NOT NULL,
+	alignment TEXT NOT NULL,
+	points DOUBLE PRECISION NOT NULL,
+	detail TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_score_awards_player ON score_awards (player_id, id);
+CREATE INDEX IF NOT EXISTS idx_score_awards_created ON score_awards (created_at);
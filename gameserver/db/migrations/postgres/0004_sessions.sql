@@ -0,0 +1,9 @@
+-- player sessions, looked up by token hash
+CREATE TABLE IF NOT EXISTS sessions (
+	token_hash TEXT PRIMARY KEY,
+	player_id TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_player ON sessions (player_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions (expires_at);
@@ -0,0 +1,24 @@
+-- teams, who's on them and the objectives they've finished
+-- team names are unique ignoring case, like COLLATE NOCASE in sqlite
+CREATE TABLE IF NOT EXISTS teams (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	pure_points DOUBLE PRECISION NOT NULL DEFAULT 0,
+	evil_points DOUBLE PRECISION NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_teams_name ON teams (LOWER(name));
+CREATE TABLE IF NOT EXISTS team_members (
+	player_id TEXT PRIMARY KEY,
+	team_id TEXT NOT NULL,
+	joined_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_team_members_team ON team_members (team_id);
+CREATE TABLE IF NOT EXISTS objective_completions (
+	id BIGSERIAL PRIMARY KEY,
+	team_id TEXT NOT NULL,
+	objective_id TEXT NOT NULL,
+	points DOUBLE PRECISION NOT NULL,
+	completed_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_objective_completions_team ON objective_completions (team_id, objective_id);
@@ -0,0 +1,31 @@
+-- seasons, their frozen leaderboards, and the short rounds played inside them
+CREATE TABLE IF NOT EXISTS seasons (
+	number BIGINT PRIMARY KEY,
+	started_at TIMESTAMPTZ NOT NULL,
+	ended_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS season_results (
+	season BIGINT NOT NULL,
+	player_id TEXT NOT NULL,
+	nickname TEXT NOT NULL,
+	pure_points DOUBLE PRECISION NOT NULL,
+	evil_points DOUBLE PRECISION NOT NULL,
+	rank INTEGER NOT NULL,
+	PRIMARY KEY (season, player_id)
+);
+CREATE INDEX IF NOT EXISTS idx_season_results_rank ON season_results (season, rank);
+CREATE TABLE IF NOT EXISTS rounds (
+	id BIGSERIAL PRIMARY KEY,
+	started_at TIMESTAMPTZ NOT NULL,
+	ends_at TIMESTAMPTZ NOT NULL,
+	ended_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS round_results (
+	round_id BIGINT NOT NULL,
+	player_id TEXT NOT NULL,
+	nickname TEXT NOT NULL,
+	pure_points DOUBLE PRECISION NOT NULL,
+	evil_points DOUBLE PRECISION NOT NULL,
+	rank INTEGER NOT NULL,
+	PRIMARY KEY (round_id, player_id)
+);
@@ -0,0 +1,7 @@
+-- players anti-cheat pulled off the leaderboard until an admin looks at them
+CREATE TABLE IF NOT EXISTS player_quarantine (
+	player_id TEXT PRIMARY KEY,
+	reason TEXT NOT NULL DEFAULT '',
+	score DOUBLE PRECISION NOT NULL DEFAULT 0,
+	quarantined_at TIMESTAMPTZ NOT NULL
+);
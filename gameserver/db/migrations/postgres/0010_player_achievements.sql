@@ -0,0 +1,8 @@
+-- badges players have unlocked, one row per player and achievement
+CREATE TABLE IF NOT EXISTS player_achievements (
+	player_id TEXT NOT NULL,
+	achievement_id TEXT NOT NULL,
+	request_id TEXT NOT NULL DEFAULT '',
+	unlocked_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (player_id, achievement_id)
+);
@@ -0,0 +1,10 @@
+-- players and their running score
+CREATE TABLE IF NOT EXISTS players (
+	id TEXT PRIMARY KEY,
+	nickname TEXT NOT NULL,
+	pure_points REAL DEFAULT 0,
+	evil_points REAL DEFAULT 0,
+	last_request_id TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
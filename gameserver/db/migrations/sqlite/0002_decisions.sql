@@ -0,0 +1,17 @@
+-- every decision ever made, indexed for player and domain lookups
+CREATE TABLE IF NOT EXISTS decisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	request_id TEXT NOT NULL,
+	qname TEXT NOT NULL,
+	qtype TEXT NOT NULL,
+	qclass TEXT NOT NULL DEFAULT '',
+	client_ip TEXT NOT NULL DEFAULT '',
+	player_id TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	latency_ms INTEGER NOT NULL,
+	timed_out INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_decisions_player ON decisions (player_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_decisions_qname ON decisions (qname, created_at);
+CREATE INDEX IF NOT EXISTS idx_decisions_created ON decisions (created_at);
@@ -0,0 +1,22 @@
+-- teams, who's on them and the objectives they've finished
+CREATE TABLE IF NOT EXISTS teams (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	pure_points REAL NOT NULL DEFAULT 0,
+	evil_points REAL NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL
+);
+CREATE TABLE IF NOT EXISTS team_members (
+	player_id TEXT PRIMARY KEY,
+	team_id TEXT NOT NULL,
+	joined_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_team_members_team ON team_members (team_id);
+CREATE TABLE IF NOT EXISTS objective_completions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	team_id TEXT NOT NULL,
+	objective_id TEXT NOT NULL,
+	points REAL NOT NULL,
+	completed_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_objective_completions_team ON objective_completions (team_id, objective_id);
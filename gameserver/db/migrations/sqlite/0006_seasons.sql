@@ -0,0 +1,31 @@
+-- seasons, their frozen leaderboards, and the short rounds played inside them
+CREATE TABLE IF NOT EXISTS seasons (
+	number INTEGER PRIMARY KEY,
+	started_at DATETIME NOT NULL,
+	ended_at DATETIME
+);
+CREATE TABLE IF NOT EXISTS season_results (
+	season INTEGER NOT NULL,
+	player_id TEXT NOT NULL,
+	nickname TEXT NOT NULL,
+	pure_points REAL NOT NULL,
+	evil_points REAL NOT NULL,
+	rank INTEGER NOT NULL,
+	PRIMARY KEY (season, player_id)
+);
+CREATE INDEX IF NOT EXISTS idx_season_results_rank ON season_results (season, rank);
+CREATE TABLE IF NOT EXISTS rounds (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at DATETIME NOT NULL,
+	ends_at DATETIME NOT NULL,
+	ended_at DATETIME
+);
+CREATE TABLE IF NOT EXISTS round_results (
+	round_id INTEGER NOT NULL,
+	player_id TEXT NOT NULL,
+	nickname TEXT NOT NULL,
+	pure_points REAL NOT NULL,
+	evil_points REAL NOT NULL,
+	rank INTEGER NOT NULL,
+	PRIMARY KEY (round_id, player_id)
+);
@@ -0,0 +1,15 @@
+-- moderation: who's banned and everything admins have done
+CREATE TABLE IF NOT EXISTS player_bans (
+	player_id TEXT PRIMARY KEY,
+	reason TEXT NOT NULL DEFAULT '',
+	banned_by TEXT NOT NULL DEFAULT '',
+	banned_at DATETIME NOT NULL
+);
+CREATE TABLE IF NOT EXISTS admin_audit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL DEFAULT '',
+	detail TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
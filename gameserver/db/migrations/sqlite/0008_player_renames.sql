@@ -0,0 +1,10 @@
+-- every nickname change, so renames can be rate limited
+CREATE TABLE IF NOT EXISTS player_renames (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	player_id TEXT NOT NULL,
+	old_nickname TEXT NOT NULL DEFAULT '',
+	new_nickname TEXT NOT NULL,
+	renamed_by TEXT NOT NULL DEFAULT '',
+	renamed_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_player_renames_player ON player_renames(player_id, renamed_at);
@@ -0,0 +1,15 @@
+-- who held each dns request, and how it ended for them, so moderators can
+-- see who was sitting on a request when it timed out
+CREATE TABLE IF NOT EXISTS assignments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	request_id TEXT NOT NULL,
+	player_id TEXT NOT NULL,
+	qname TEXT NOT NULL DEFAULT '',
+	assigned_at DATETIME NOT NULL,
+	ended_at DATETIME,
+	outcome TEXT NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_assignments_request_player ON assignments (request_id, player_id);
+CREATE INDEX IF NOT EXISTS idx_assignments_player ON assignments (player_id, id);
+CREATE INDEX IF NOT EXISTS idx_assignments_outcome ON assignments (outcome, id);
+CREATE INDEX IF NOT EXISTS idx_assignments_assigned ON assignments (assigned_at);
@@ -0,0 +1,47 @@
+// postgres
+// ===========================
+// for running more than one game server against the same data. same tables
+// as sqlite, just with postgres types (see migrations/postgres)
+// gameserver/db/postgres.go
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// connectPostgres connects to the postgres database at dsn, without touching the schema
+// a query waits up to lockTimeout for a row or table lock, unless the dsn sets lock_timeout itself
+func connectPostgres(dsn string, lockTimeout time.Duration) (*sqlDB, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	if query.Get("lock_timeout") == "" {
+		// pq hands settings it doesn't know about to the server
+		query.Set("lock_timeout", strconv.FormatInt(lockTimeout.Milliseconds(), 10))
+		u.RawQuery = query.Encode()
+	}
+
+	conn, err := sql.Open("postgres", u.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &sqlDB{DB: conn, dialect: postgresDialect}, nil
+}
+
+// isPostgresConflict says whether err is postgres refusing a duplicate key
+func isPostgresConflict(err error) bool {
+	var e *pq.Error
+	return errors.As(err, &e) && e.Code == "23505" // unique_violation
+}
@@ -0,0 +1,283 @@
+// seasons and rounds
+// ===========================
+// a season ends by freezing everyone's score into season_results and
+// starting the board over. rounds are short sprints inside a season.
+// gameserver/db/seasons.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// one season of the game
+type Season struct {
+	Number    int64
+	StartedAt time.Time
+	EndedAt   time.Time // zero while it's still running
+}
+
+// where a player finished in a season or round
+type Standing struct {
+	PlayerID   string
+	Nickname   string
+	PurePoints float64
+	EvilPoints float64
+	Rank       int
+}
+
+// one short round
+type Round struct {
+	ID        int64
+	StartedAt time.Time
+	EndsAt    time.Time
+	EndedAt   time.Time  // zero while it's still running
+	Winners   []Standing // filled in by GetRounds
+}
+
+// CurrentSeason returns the running season, starting season 1 if there's never been one
+func CurrentSeason(now time.Time) (Season, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return CurrentSeasonContext(ctx, now)
+}
+
+// CurrentSeasonContext is CurrentSeason with a context
+func CurrentSeasonContext(ctx context.Context, now time.Time) (Season, error) {
+	var s Season
+	err := db.QueryRowContext(ctx, `
+		SELECT number, started_at
+		FROM seasons
+		WHERE ended_at IS NULL
+		ORDER BY number DESC
+		LIMIT 1
+	`).Scan(&s.Number, &s.StartedAt)
+	if err == sql.ErrNoRows {
+		s = Season{Number: 1, StartedAt: now}
+		_, err = db.ExecContext(ctx, `INSERT INTO seasons (number, started_at) VALUES (?, ?)`, s.Number, now.UTC())
+	}
+	return s, err
+}
+
+// GetSeasons lists every season, newest first
+func GetSeasons() ([]Season, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetSeasonsContext(ctx)
+}
+
+// GetSeasonsContext is GetSeasons with a context
+func GetSeasonsContext(ctx context.Context) ([]Season, error) {
+	rows, err := db.QueryContext(ctx, `SELECT number, started_at, ended_at FROM seasons ORDER BY number DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seasons []Season
+	for rows.Next() {
+		var s Season
+		var endedAt sql.NullTime
+		if err := rows.Scan(&s.Number, &s.StartedAt, &endedAt); err != nil {
+			return nil, err
+		}
+		s.EndedAt = endedAt.Time
+		seasons = append(seasons, s)
+	}
+	return seasons, rows.Err()
+}
+
+// RolloverSeason ends a season in one transaction: the final standings are saved,
+// every player and team goes back to zero and the next season starts
+// standings are what the caller holds in memory, which is the real score
+func RolloverSeason(season int64, standings []Standing, at time.Time) (Season, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return RolloverSeasonContext(ctx, season, standings, at)
+}
+
+// RolloverSeasonContext is RolloverSeason with a context
+func RolloverSeasonContext(ctx context.Context, season int64, standings []Standing, at time.Time) (Season, error) {
+	next := Season{Number: season + 1, StartedAt: at}
+
+	tx, err := db.BeginTx(ctx)
+	if err != nil {
+		return next, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO season_results (season, player_id, nickname, pure_points, evil_points, rank)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return next, err
+	}
+	defer stmt.Close()
+	for _, s := range standings {
+		if _, err := stmt.ExecContext(ctx, season, s.PlayerID, s.Nickname, s.PurePoints, s.EvilPoints, s.Rank); err != nil {
+			return next, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE seasons SET ended_at = ? WHERE number = ?`, at.UTC(), season); err != nil {
+		return next, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO seasons (number, started_at) VALUES (?, ?)`, next.Number, at.UTC()); err != nil {
+		return next, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE players SET pure_points = 0, evil_points = 0, updated_at = CURRENT_TIMESTAMP`); err != nil {
+		return next, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE teams SET pure_points = 0, evil_points = 0`); err != nil {
+		return next, err
+	}
+	return next, tx.Commit()
+}
+
+// GetSeasonResults returns a page of a finished season's leaderboard, best first
+// ok is false if the season never finished
+func GetSeasonResults(season int64, offset, limit int) (results []Standing, ok bool, err error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetSeasonResultsContext(ctx, season, offset, limit)
+}
+
+// GetSeasonResultsContext is GetSeasonResults with a context
+func GetSeasonResultsContext(ctx context.Context, season int64, offset, limit int) (results []Standing, ok bool, err error) {
+	var exists int
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM seasons WHERE number = ? AND ended_at IS NOT NULL`, season).Scan(&exists)
+	if err != nil || exists == 0 {
+		return nil, false, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT player_id, nickname, pure_points, evil_points, rank
+		FROM season_results
+		WHERE season = ?
+		ORDER BY rank
+		LIMIT ? OFFSET ?
+	`, season, limit, offset)
+	if err != nil {
+		return nil, true, err
+	}
+	defer rows.Close()
+
+	results, err = scanStandings(rows)
+	return results, true, err
+}
+
+// CreateRound starts a round and returns its id
+func CreateRound(startedAt, endsAt time.Time) (int64, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return CreateRoundContext(ctx, startedAt, endsAt)
+}
+
+// CreateRoundContext is CreateRound with a context
+func CreateRoundContext(ctx context.Context, startedAt, endsAt time.Time) (int64, error) {
+	// RETURNING rather than LastInsertId, which postgres doesn't have
+	var id int64
+	err := db.QueryRowContext(ctx, `INSERT INTO rounds (started_at, ends_at) VALUES (?, ?) RETURNING id`, startedAt.UTC(), endsAt.UTC()).Scan(&id)
+	return id, err
+}
+
+// FinishRound saves a round's final standings and marks it over
+func FinishRound(id int64, endedAt time.Time, standings []Standing) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return FinishRoundContext(ctx, id, endedAt, standings)
+}
+
+// FinishRoundContext is FinishRound with a context
+func FinishRoundContext(ctx context.Context, id int64, endedAt time.Time, standings []Standing) error {
+	tx, err := db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO round_results (round_id, player_id, nickname, pure_points, evil_points, rank)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, s := range standings {
+		if _, err := stmt.ExecContext(ctx, id, s.PlayerID, s.Nickname, s.PurePoints, s.EvilPoints, s.Rank); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE rounds SET ended_at = ? WHERE id = ?`, endedAt.UTC(), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRounds returns the most recent finished rounds with their top finishers
+func GetRounds(limit, winners int) ([]Round, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetRoundsContext(ctx, limit, winners)
+}
+
+// GetRoundsContext is GetRounds with a context
+func GetRoundsContext(ctx context.Context, limit, winners int) ([]Round, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, started_at, ends_at, ended_at
+		FROM rounds
+		WHERE ended_at IS NOT NULL
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	var rounds []Round
+	for rows.Next() {
+		var r Round
+		if err := rows.Scan(&r.ID, &r.StartedAt, &r.EndsAt, &r.EndedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rounds = append(rounds, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range rounds {
+		rows, err := db.QueryContext(ctx, `
+			SELECT player_id, nickname, pure_points, evil_points, rank
+			FROM round_results
+			WHERE round_id = ? AND rank <= ?
+			ORDER BY rank
+		`, rounds[i].ID, winners)
+		if err != nil {
+			return nil, err
+		}
+		rounds[i].Winners, err = scanStandings(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rounds, nil
+}
+
+// scanStandings reads player_id, nickname, pure_points, evil_points, rank rows
+func scanStandings(rows *sql.Rows) ([]Standing, error) {
+	var standings []Standing
+	for rows.Next() {
+		var s Standing
+		if err := rows.Scan(&s.PlayerID, &s.Nickname, &s.PurePoints, &s.EvilPoints, &s.Rank); err != nil {
+			return nil, err
+		}
+		standings = append(standings, s)
+	}
+	return standings, rows.Err()
+}
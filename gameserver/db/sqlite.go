@@ -0,0 +1,64 @@
+// sqlite
+// ===========================
+// the default store, one file on disk that litefs replicates
+// gameserver/db/sqlite.go
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// connectSQLite opens (or makes) the sqlite file at dbPath, without touching the schema
+// a query waits up to busyTimeout for another connection's lock instead of failing straight away
+func connectSQLite(dbPath string, busyTimeout time.Duration) (*sqlDB, error) {
+	// see if we already have a database
+	if _, err := os.Stat(dbPath); err == nil {
+		log.Printf("found existing database at %s", dbPath)
+	} else if os.IsNotExist(err) {
+		log.Printf("no database found at %s, making a fresh one", dbPath)
+		// make sure we have somewhere to put it
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	// transactions take the write lock when they begin, so they wait out the busy timeout
+	// rather than failing on the spot when a read lock can't be upgraded
+	dsn := fmt.Sprintf("%s?_busy_timeout=%d&_txlock=immediate", dbPath, busyTimeout.Milliseconds())
+	conn, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := setupSQLite(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &sqlDB{DB: conn, dialect: sqliteDialect}, nil
+}
+
+// setupSQLite checks the connection works and turns on WAL
+func setupSQLite(conn *sql.DB) error {
+	if err := conn.Ping(); err != nil {
+		return err
+	}
+	// Enable WAL mode for better concurrency
+	_, err := conn.Exec("PRAGMA journal_mode=WAL")
+	return err
+}
+
+// isSQLiteConflict says whether err is sqlite refusing a duplicate key
+func isSQLiteConflict(err error) bool {
+	var e sqlite3.Error
+	return errors.As(err, &e) &&
+		(e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
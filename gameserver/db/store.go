@@ -0,0 +1,509 @@
+// pluggable storage
+// ===========================
+// players, scores, decisions and sessions go through a Store so the game can
+// run on sqlite (the default), postgres, or a map in memory for tests.
+// the rest of the package (teams, seasons, moderation...) talks sql directly
+// through the same connection, written so it runs on both databases
+// gameserver/db/store.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store is everything the game keeps about players, their scores, their decisions and their sessions
+// every backend has to behave the same way, which the conformance tests in gameserver check
+type Store interface {
+	// players
+	CreatePlayer(ctx context.Context, id, nickname string) error // ErrConflict if the id is taken
+	GetPlayer(ctx context.Context, id string) (*Player, error)   // ErrNotFound if there's no such player
+	GetLeaderboard(ctx context.Context) ([]Player, error)        // everyone, best net score first
+	UpdatePlayerRequest(ctx context.Context, id, requestID string) error
+
+	// scores
+	AddPlayerPoints(ctx context.Context, id string, pureDelta, evilDelta float64) error
+	SyncPoints(ctx context.Context, players, teams []PointsDelta) error
+	QueryAwards(ctx context.Context, playerID string, beforeID int64, limit int) ([]Award, error)
+
+	// decisions
+	InsertDecisions(ctx context.Context, decisions []Decision) error
+	PruneDecisions(ctx context.Context, before time.Time) (int64, error)
+	QueryDecisions(ctx context.Context, q DecisionQuery) ([]Decision, error)
+	CountActions(ctx context.Context, since, until time.Time) ([]ActionCount, error)
+	TopDomains(ctx context.Context, action string, since, until time.Time, limit int) ([]DomainCount, error)
+
+	// sessions
+	CreateSession(ctx context.Context, s Session) error                 // ErrConflict if the token hash is taken
+	GetSession(ctx context.Context, tokenHash string) (*Session, error) // ErrNotFound if there's no such session
+	DeleteSession(ctx context.Context, tokenHash string) error
+	PruneSessions(ctx context.Context, now time.Time) (int64, error)
+
+	Close() error
+}
+
+var (
+	// ErrNotFound is what lookups and updates of a player or session that isn't there return
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is what creating something whose id is already taken returns
+	ErrConflict = errors.New("already exists")
+)
+
+// conflictError turns a unique constraint failure from either database into ErrConflict
+func conflictError(err error) error {
+	if err != nil && (isSQLiteConflict(err) || isPostgresConflict(err)) {
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	}
+	return err
+}
+
+// rowAffected turns an update that matched nothing into ErrNotFound
+func rowAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Options tunes how long the database waits before giving up, zero values get the defaults
+type Options struct {
+	BusyTimeout  time.Duration // how long a query waits for another connection's lock
+	QueryTimeout time.Duration // the deadline for the package level calls that don't take a context
+}
+
+const (
+	DefaultBusyTimeout  = 5 * time.Second
+	DefaultQueryTimeout = 10 * time.Second
+)
+
+// withDefaults fills in whatever wasn't set
+func (o Options) withDefaults() Options {
+	if o.BusyTimeout <= 0 {
+		o.BusyTimeout = DefaultBusyTimeout
+	}
+	if o.QueryTimeout <= 0 {
+		o.QueryTimeout = DefaultQueryTimeout
+	}
+	return o
+}
+
+// Open connects to the database a dsn points at and applies any pending migrations
+// postgres:// and postgresql:// urls go to postgres, anything else is a sqlite file path
+func Open(dsn string, opts Options) (Store, error) {
+	return open(dsn, opts)
+}
+
+// open is Open, keeping hold of the sql store so Initialize can share its connection
+func open(dsn string, opts Options) (*sqlStore, error) {
+	conn, err := connect(dsn, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	st, err := newSQLStore(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// connect opens the database a dsn points at, leaving the schema alone
+func connect(dsn string, opts Options) (*sqlDB, error) {
+	opts = opts.withDefaults()
+	if isPostgres(dsn) {
+		return connectPostgres(dsn, opts.BusyTimeout)
+	}
+	return connectSQLite(dsn, opts.BusyTimeout)
+}
+
+// isPostgres says whether a dsn is a postgres url
+func isPostgres(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// which flavour of sql a connection speaks
+type dialect int
+
+const (
+	sqliteDialect dialect = iota
+	postgresDialect
+)
+
+// rebind rewrites ? placeholders into $1, $2... for postgres
+// question marks inside quoted strings are left alone
+func (d dialect) rebind(query string) string {
+	if d != postgresDialect || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlDB is a connection that rewrites queries for its dialect, so the same sql runs on either database
+type sqlDB struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (c *sqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(c.dialect.rebind(query), args...)
+}
+
+func (c *sqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.Query(c.dialect.rebind(query), args...)
+}
+
+func (c *sqlDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRow(c.dialect.rebind(query), args...)
+}
+
+func (c *sqlDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.ExecContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c *sqlDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.QueryContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c *sqlDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c *sqlDB) Begin() (*sqlTx, error) {
+	return c.BeginTx(context.Background())
+}
+
+func (c *sqlDB) BeginTx(ctx context.Context) (*sqlTx, error) {
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: c.dialect}, nil
+}
+
+// sqlTx is a transaction that rewrites queries for its dialect
+type sqlTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t *sqlTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(t.dialect.rebind(query), args...)
+}
+
+func (t *sqlTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *sqlTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *sqlTx) Prepare(query string) (*sql.Stmt, error) {
+	return t.Tx.Prepare(t.dialect.rebind(query))
+}
+
+func (t *sqlTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.Tx.PrepareContext(ctx, t.dialect.rebind(query))
+}
+
+// sqlStore is the Store for sqlite and postgres, which only differ in their schema and placeholders
+type sqlStore struct {
+	db    *sqlDB
+	stmts statements
+}
+
+// the queries that run on every request, prepared once when the store opens
+type statements struct {
+	createPlayer        *sql.Stmt
+	getPlayer           *sql.Stmt
+	getLeaderboard      *sql.Stmt
+	updatePlayerRequest *sql.Stmt
+	addPlayerPoints     *sql.Stmt
+	createSession       *sql.Stmt
+	getSession          *sql.Stmt
+	deleteSession       *sql.Stmt
+}
+
+// newSQLStore prepares the hot queries against a connection that's already migrated
+func newSQLStore(conn *sqlDB) (*sqlStore, error) {
+	st := &sqlStore{db: conn}
+	queries := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&st.stmts.createPlayer, createPlayerQuery},
+		{&st.stmts.getPlayer, getPlayerQuery},
+		{&st.stmts.getLeaderboard, getLeaderboardQuery},
+		{&st.stmts.updatePlayerRequest, updatePlayerRequestQuery},
+		{&st.stmts.addPlayerPoints, addPlayerPointsQuery},
+		{&st.stmts.createSession, createSessionQuery},
+		{&st.stmts.getSession, getSessionQuery},
+		{&st.stmts.deleteSession, deleteSessionQuery},
+	}
+	for _, q := range queries {
+		stmt, err := conn.DB.Prepare(conn.dialect.rebind(q.query))
+		if err != nil {
+			st.closeStatements()
+			return nil, err
+		}
+		*q.stmt = stmt
+	}
+	return st, nil
+}
+
+// closeStatements closes whichever statements got prepared
+func (st *sqlStore) closeStatements() {
+	for _, stmt := range []*sql.Stmt{
+		st.stmts.createPlayer, st.stmts.getPlayer, st.stmts.getLeaderboard, st.stmts.updatePlayerRequest,
+		st.stmts.addPlayerPoints, st.stmts.createSession, st.stmts.getSession, st.stmts.deleteSession,
+	} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+func (st *sqlStore) Close() error {
+	st.closeStatements()
+	return st.db.Close()
+}
+
+// the package level functions below go to whichever store Initialize opened.
+// the XContext ones stop when ctx is done; the rest get Options.QueryTimeout
+
+// queryContext is the deadline the calls without a context run under
+func queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), queryTimeout)
+}
+
+// CreatePlayer inserts a new player
+// ErrConflict if the id is already taken
+func CreatePlayer(id, nickname string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return CreatePlayerContext(ctx, id, nickname)
+}
+
+// CreatePlayerContext is CreatePlayer with a context
+func CreatePlayerContext(ctx context.Context, id, nickname string) error {
+	return current.CreatePlayer(ctx, id, nickname)
+}
+
+// GetPlayer retrieves a player from the database
+// ErrNotFound if there isn't one
+func GetPlayer(id string) (*Player, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetPlayerContext(ctx, id)
+}
+
+// GetPlayerContext is GetPlayer with a context
+func GetPlayerContext(ctx context.Context, id string) (*Player, error) {
+	return current.GetPlayer(ctx, id)
+}
+
+// GetLeaderboard returns all players sorted by net alignment
+func GetLeaderboard() ([]Player, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetLeaderboardContext(ctx)
+}
+
+// GetLeaderboardContext is GetLeaderboard with a context
+func GetLeaderboardContext(ctx context.Context) ([]Player, error) {
+	return current.GetLeaderboard(ctx)
+}
+
+// UpdatePlayerRequest updates a player's last assigned request
+// ErrNotFound if there's no such player
+func UpdatePlayerRequest(id, requestID string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return UpdatePlayerRequestContext(ctx, id, requestID)
+}
+
+// UpdatePlayerRequestContext is UpdatePlayerRequest with a context
+func UpdatePlayerRequestContext(ctx context.Context, id, requestID string) error {
+	return current.UpdatePlayerRequest(ctx, id, requestID)
+}
+
+// AddPlayerPoints adds to a player's points
+// ErrNotFound if there's no such player
+func AddPlayerPoints(id string, pureDelta, evilDelta float64) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return AddPlayerPointsContext(ctx, id, pureDelta, evilDelta)
+}
+
+// AddPlayerPointsContext is AddPlayerPoints with a context
+func AddPlayerPointsContext(ctx context.Context, id string, pureDelta, evilDelta float64) error {
+	return current.AddPlayerPoints(ctx, id, pureDelta, evilDelta)
+}
+
+// SyncPoints adds pending point changes for players and teams in one transaction,
+// so either every change lands or none of them do
+func SyncPoints(players, teams []PointsDelta) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return SyncPointsContext(ctx, players, teams)
+}
+
+// SyncPointsContext is SyncPoints with a context
+func SyncPointsContext(ctx context.Context, players, teams []PointsDelta) error {
+	return current.SyncPoints(ctx, players, teams)
+}
+
+// QueryAwards returns a player's awards newest first
+// beforeID is the pagination cursor, 0 to start from the top
+func QueryAwards(playerID string, beforeID int64, limit int) ([]Award, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return QueryAwardsContext(ctx, playerID, beforeID, limit)
+}
+
+// QueryAwardsContext is QueryAwards with a context
+func QueryAwardsContext(ctx context.Context, playerID string, beforeID int64, limit int) ([]Award, error) {
+	return current.QueryAwards(ctx, playerID, beforeID, limit)
+}
+
+// InsertDecisions writes a batch of decisions in one transaction
+// either the whole batch lands or none of it does, so retries are safe
+func InsertDecisions(decisions []Decision) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return InsertDecisionsContext(ctx, decisions)
+}
+
+// InsertDecisionsContext is InsertDecisions with a context
+func InsertDecisionsContext(ctx context.Context, decisions []Decision) error {
+	return current.InsertDecisions(ctx, decisions)
+}
+
+// PruneDecisions deletes decisions (and their awards) older than the cutoff and says how many decisions went
+func PruneDecisions(before time.Time) (int64, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return PruneDecisionsContext(ctx, before)
+}
+
+// PruneDecisionsContext is PruneDecisions with a context
+func PruneDecisionsContext(ctx context.Context, before time.Time) (int64, error) {
+	return current.PruneDecisions(ctx, before)
+}
+
+// QueryDecisions returns matching decisions newest first
+func QueryDecisions(q DecisionQuery) ([]Decision, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return QueryDecisionsContext(ctx, q)
+}
+
+// QueryDecisionsContext is QueryDecisions with a context
+func QueryDecisionsContext(ctx context.Context, q DecisionQuery) ([]Decision, error) {
+	return current.QueryDecisions(ctx, q)
+}
+
+// CountActions tallies decisions by action over a time range
+func CountActions(since, until time.Time) ([]ActionCount, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return CountActionsContext(ctx, since, until)
+}
+
+// CountActionsContext is CountActions with a context
+func CountActionsContext(ctx context.Context, since, until time.Time) ([]ActionCount, error) {
+	return current.CountActions(ctx, since, until)
+}
+
+// TopDomains returns the domains that got a given action the most
+// an empty action counts everything
+func TopDomains(action string, since, until time.Time, limit int) ([]DomainCount, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return TopDomainsContext(ctx, action, since, until, limit)
+}
+
+// TopDomainsContext is TopDomains with a context
+func TopDomainsContext(ctx context.Context, action string, since, until time.Time, limit int) ([]DomainCount, error) {
+	return current.TopDomains(ctx, action, since, until, limit)
+}
+
+// CreateSession stores a new session
+// ErrConflict if the token hash is already taken
+func CreateSession(s Session) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return CreateSessionContext(ctx, s)
+}
+
+// CreateSessionContext is CreateSession with a context
+func CreateSessionContext(ctx context.Context, s Session) error {
+	return current.CreateSession(ctx, s)
+}
+
+// GetSession looks up a session by token hash
+// ErrNotFound if there isn't one
+func GetSession(tokenHash string) (*Session, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return GetSessionContext(ctx, tokenHash)
+}
+
+// GetSessionContext is GetSession with a context
+func GetSessionContext(ctx context.Context, tokenHash string) (*Session, error) {
+	return current.GetSession(ctx, tokenHash)
+}
+
+// DeleteSession logs a session out
+func DeleteSession(tokenHash string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return DeleteSessionContext(ctx, tokenHash)
+}
+
+// DeleteSessionContext is DeleteSession with a context
+func DeleteSessionContext(ctx context.Context, tokenHash string) error {
+	return current.DeleteSession(ctx, tokenHash)
+}
+
+// PruneSessions clears out sessions that have already expired
+func PruneSessions(now time.Time) (int64, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	return PruneSessionsContext(ctx, now)
+}
+
+// PruneSessionsContext is PruneSessions with a context
+func PruneSessionsContext(ctx context.Context, now time.Time) (int64, error) {
+	return current.PruneSessions(ctx, now)
+}
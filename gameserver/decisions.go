@@ -0,0 +1,188 @@
+// gameserver/decisions.go
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/achievements"
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/domains"
+	"github.com/nicewrld/gameserver/queue"
+	"github.com/nicewrld/gameserver/scoring"
+	"github.com/nicewrld/gameserver/teams"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//////////////////////////////////////////
+// Decision History Constants
+//////////////////////////////////////////
+
+const (
+	// decisionJobType identifies job queue jobs that carry a batch of decisions.
+	decisionJobType = "decisions"
+
+	// decisionPruneInterval is how often decisions older than the retention window are deleted.
+	decisionPruneInterval = 1 * time.Hour
+)
+
+//////////////////////////////////////////
+// Decision History Metrics
+//////////////////////////////////////////
+
+var (
+	// decisionsRecorded counts decisions handed to the history writer.
+	decisionsRecorded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gameserver_decisions_recorded_total",
+		Help: "Decisions queued for persistence, by whether the request timed out",
+	}, []string{"timed_out"})
+
+	// decisionsPruned counts decisions deleted by the retention policy.
+	decisionsPruned = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gameserver_decisions_pruned_total",
+		Help: "Decisions deleted because they fell outside the retention window",
+	})
+)
+
+//////////////////////////////////////////
+// Decision Batcher
+//////////////////////////////////////////
+
+// decisionBatcher buffers decisions in memory and hands them to the job queue in batches,
+// so a busy game issues one transaction per batch instead of one insert per decision.
+type decisionBatcher struct {
+	mu        sync.Mutex
+	pending   []db.Decision
+	batchSize int
+	jobs      *queue.JobQueue
+}
+
+// newDecisionBatcher creates a batcher that flushes whenever batchSize decisions are buffered.
+func newDecisionBatcher(batchSize int, jobs *queue.JobQueue) *decisionBatcher {
+	return &decisionBatcher{
+		batchSize: batchSize,
+		jobs:      jobs,
+	}
+}
+
+// Add buffers a decision, flushing if the batch is full.
+func (b *decisionBatcher) Add(d db.Decision) {
+	b.mu.Lock()
+	b.pending = append(b.pending, d)
+	full := len(b.pending) >= b.batchSize
+	b.mu.Unlock()
+
+	decisionsRecorded.With(prometheus.Labels{"timed_out": fmt.Sprint(d.TimedOut)}).Inc()
+
+	if full {
+		b.Flush()
+	}
+}
+
+// Flush submits everything buffered so far as a single job and returns how many decisions it held.
+func (b *decisionBatcher) Flush() int {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return 0
+	}
+	b.jobs.Submit(queue.Job{Type: decisionJobType, Data: batch})
+	return len(batch)
+}
+
+// run flushes the batcher on a fixed interval so quiet periods still get persisted promptly.
+func (b *decisionBatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		b.Flush()
+	}
+}
+
+//////////////////////////////////////////
+// Decision History State
+//////////////////////////////////////////
+
+var (
+	// dbJobs runs database writes off the request path.
+	dbJobs *queue.JobQueue
+
+	// decisionHistory buffers decisions for dbJobs. Nil until main sets it up, in which case decisions are not recorded.
+	decisionHistory *decisionBatcher
+)
+
+// handleDBJob performs a queued database write.
+func handleDBJob(job queue.Job) error {
+	switch job.Type {
+	case decisionJobType:
+		return db.InsertDecisions(job.Data.([]db.Decision))
+	case assignmentJobType:
+		return saveAssignment(job.Data.(db.Assignment))
+	case achievementJobType:
+		return saveAchievement(job.Data.(achievements.Unlock))
+	case objectiveJobType:
+		return saveObjective(job.Data.(teams.Completion))
+	default:
+		return fmt.Errorf("unknown job type %q", job.Type)
+	}
+}
+
+// recordDecision queues the outcome of a DNS request, and any points it earned, for persistence.
+func recordDecision(dnsReq *DNSRequest, playerID, action string, timedOut bool, decidedAt time.Time, awards []scoring.Award) {
+	if decisionHistory == nil {
+		return
+	}
+
+	dbAwards := make([]db.Award, 0, len(awards))
+	for _, a := range awards {
+		dbAwards = append(dbAwards, db.Award{Rule: a.Rule, Alignment: a.Alignment, Points: a.Points, Detail: a.Detail})
+	}
+
+	decisionHistory.Add(db.Decision{
+		RequestID: dnsReq.RequestID,
+		QName:     normalizeQName(dnsReq.Name),
+		QType:     dnsReq.Type,
+		QClass:    dnsReq.Class,
+		ClientIP:  dnsReq.ClientIP,
+		PlayerID:  playerID,
+		Action:    action,
+		LatencyMs: decidedAt.Sub(dnsReq.Timestamp).Milliseconds(),
+		TimedOut:  timedOut,
+		CreatedAt: decidedAt,
+		Awards:    dbAwards,
+	})
+}
+
+// normalizeQName lowercases a queried name and strips the root dot so history can be looked up by plain domain.
+func normalizeQName(name string) string {
+	return domains.Normalize(name)
+}
+
+// pruneDecisions periodically deletes decisions, and the assignment history, older than the retention window.
+func pruneDecisions(retention time.Duration) {
+	ticker := time.NewTicker(decisionPruneInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := db.PruneDecisions(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Error pruning decision history: %v", err)
+			continue
+		}
+		decisionsPruned.Add(float64(deleted))
+		if deleted > 0 {
+			log.Printf("Pruned %d decisions older than %s", deleted, retention)
+		}
+		if _, err := db.PruneAssignments(time.Now().Add(-retention)); err != nil {
+			log.Printf("Error pruning assignment history: %v", err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// domain name helpers shared by anything that matches rules against queries
+// gameserver/domains/domains.go
+
+package domains
+
+import "strings"
+
+// Normalize lowercases a name and drops the trailing root dot
+// so "WWW.Example.com." and "www.example.com" compare equal
+func Normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// Match checks a name against a pattern
+//
+//	example.com   only example.com itself
+//	*.example.com any subdomain of example.com (not example.com itself)
+//	ads.*         any name whose first label is "ads"
+//	*             everything
+func Match(pattern, name string) bool {
+	pattern = Normalize(pattern)
+	name = Normalize(name)
+
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(name, pattern[1:])
+	case strings.HasSuffix(pattern, ".*"):
+		return strings.HasPrefix(name, pattern[:len(pattern)-1]) && len(name) > len(pattern)-1
+	default:
+		return name == pattern
+	}
+}
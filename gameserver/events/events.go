@@ -0,0 +1,159 @@
+// event bus for broadcasting what's happening in the game
+// spectators, stream overlays and the live ticker all hang off this
+// gameserver/events/events.go
+
+package events
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type names a kind of game event
+type Type string
+
+// every event the game server emits
+const (
+	RequestReceived     Type = "request_received"     // coredns handed us a query
+	RequestAssigned     Type = "request_assigned"     // a player picked it up
+	RequestDecided      Type = "request_decided"      // a player chose an action
+	RequestTimedOut     Type = "request_timed_out"    // nobody answered in time
+	PlayerRegistered    Type = "player_registered"    // someone new showed up
+	LeaderboardChanged  Type = "leaderboard_changed"  // the top of the board moved
+	TeamJoined          Type = "team_joined"          // a player picked a side
+	ObjectiveCompleted  Type = "objective_completed"  // a team held an objective long enough
+	SeasonStarted       Type = "season_started"       // the board was archived and reset
+	RoundStarted        Type = "round_started"        // a timed round kicked off
+	RoundEnded          Type = "round_ended"          // a timed round finished, winners attached
+	AchievementUnlocked Type = "achievement_unlocked" // a player earned a badge
+)
+
+// Event is one thing that happened in the game
+type Event struct {
+	ID        uint64      `json:"id"`                   // increases with every published event
+	Type      Type        `json:"type"`                 // what happened
+	Time      time.Time   `json:"time"`                 // when it happened
+	RequestID string      `json:"request_id,omitempty"` // dns request involved, if any
+	PlayerID  string      `json:"player_id,omitempty"`  // player involved, if any
+	Domain    string      `json:"domain,omitempty"`     // queried name, if any
+	Data      interface{} `json:"data,omitempty"`       // type specific details
+}
+
+// Filter picks which events a subscriber cares about
+// an empty filter matches everything
+type Filter struct {
+	Types  map[Type]bool // only these types (all if empty)
+	Domain string        // only this domain and its subdomains (all if empty)
+	Player string        // only events involving this player (all if empty)
+}
+
+// Match reports whether the event passes the filter
+func (f Filter) Match(e Event) bool {
+	if len(f.Types) > 0 && !f.Types[e.Type] {
+		return false
+	}
+	if f.Player != "" && e.PlayerID != f.Player {
+		return false
+	}
+	if f.Domain != "" {
+		domain := normalizeDomain(e.Domain)
+		want := normalizeDomain(f.Domain)
+		if domain != want && !strings.HasSuffix(domain, "."+want) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeDomain lowercases a name and drops the trailing root dot so
+// "Example.com." and "example.com" compare equal
+func normalizeDomain(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// Subscription receives matching events on C until closed
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	filter  Filter
+	bus     *Bus
+	dropped atomic.Uint64
+	once    sync.Once
+}
+
+// Dropped returns how many events were skipped because the subscriber was too slow
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes and closes C
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Bus fans events out to every subscriber
+// publishing never blocks - slow subscribers just miss events
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	nextID atomic.Uint64
+}
+
+// NewBus makes an empty bus
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe starts receiving events that match the filter
+// buffer is how many events can queue up before we start dropping
+func (b *Bus) Subscribe(filter Filter, buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+	s := &Subscription{
+		C:      ch,
+		ch:     ch,
+		filter: filter,
+		bus:    b,
+	}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Subscribers returns how many subscriptions are open
+func (b *Bus) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// Publish stamps the event and hands it to every matching subscriber
+func (b *Bus) Publish(e Event) {
+	e.ID = b.nextID.Add(1)
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
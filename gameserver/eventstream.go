@@ -0,0 +1,277 @@
+// gameserver/eventstream.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/events"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//////////////////////////////////////////
+// Event Stream Constants
+//////////////////////////////////////////
+
+const (
+	// eventBufferSize is how many events a spectator may fall behind before events are dropped.
+	eventBufferSize = 256
+
+	// eventHeartbeatInterval is how often an idle event stream sends a keep-alive comment.
+	eventHeartbeatInterval = 15 * time.Second
+
+	// leaderboardWatchInterval is how often the top of the leaderboard is checked for changes.
+	leaderboardWatchInterval = 5 * time.Second
+
+	// leaderboardWatchSize is how many leading players are watched for leaderboard_changed events.
+	leaderboardWatchSize = 10
+)
+
+//////////////////////////////////////////
+// Event Stream Metrics and State
+//////////////////////////////////////////
+
+var (
+	// eventBus carries game events to spectators and other in-process listeners.
+	eventBus = events.NewBus()
+
+	// eventSubscribers tracks the number of connected spectators.
+	eventSubscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gameserver_event_subscribers",
+		Help: "Current number of clients connected to the event stream",
+	})
+
+	// eventsDropped counts events skipped because a spectator could not keep up.
+	eventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gameserver_events_dropped_total",
+		Help: "Events not delivered to slow event stream clients",
+	})
+
+	// eventStreams holds a stop channel for every open event stream, so a shutdown can end them.
+	// http.Server.Shutdown waits for handlers to return but never cancels their requests.
+	eventStreams   = make(map[chan struct{}]struct{})
+	eventStreamsMu sync.Mutex
+)
+
+// LeaderboardSnapshotEntry is one player in a leaderboard_changed event.
+type LeaderboardSnapshotEntry struct {
+	PlayerID   string  `json:"player_id"`
+	Nickname   string  `json:"nickname"`
+	PurePoints float64 `json:"pure_points"`
+	EvilPoints float64 `json:"evil_points"`
+}
+
+//////////////////////////////////////////
+// Event Stream Handler
+//////////////////////////////////////////
+
+// eventsHandler streams game events to spectators as Server-Sent Events.
+//
+// Query parameters:
+//   - type: comma-separated event types to include (default: all)
+//   - domain: only events for this domain and its subdomains (default: all)
+//   - player: only events involving this player (default: all)
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	stop, ok := openEventStream()
+	if !ok {
+		http.Error(w, errShuttingDown.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer closeEventStream(stop)
+
+	// Event streams outlive the server's write timeout.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline for event stream: %v", err)
+	}
+
+	sub := eventBus.Subscribe(filter, eventBufferSize)
+	defer sub.Close()
+	eventSubscribers.Inc()
+	defer eventSubscribers.Dec()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var reportedDrops uint64
+	for {
+		select {
+		case event := <-sub.C:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Failed to encode event %d: %v", event.ID, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			if dropped := sub.Dropped(); dropped > reportedDrops {
+				eventsDropped.Add(float64(dropped - reportedDrops))
+				reportedDrops = dropped
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+// openEventStream registers an event stream to be ended at shutdown. It reports false once the
+// server has started shutting down.
+func openEventStream() (chan struct{}, bool) {
+	eventStreamsMu.Lock()
+	defer eventStreamsMu.Unlock()
+	if shuttingDown.Load() {
+		return nil, false
+	}
+	stop := make(chan struct{})
+	eventStreams[stop] = struct{}{}
+	return stop, true
+}
+
+// closeEventStream forgets an event stream that has ended.
+func closeEventStream(stop chan struct{}) {
+	eventStreamsMu.Lock()
+	delete(eventStreams, stop)
+	eventStreamsMu.Unlock()
+}
+
+// stopEventStreams ends every open event stream.
+func stopEventStreams() {
+	eventStreamsMu.Lock()
+	defer eventStreamsMu.Unlock()
+	for stop := range eventStreams {
+		close(stop)
+		delete(eventStreams, stop)
+	}
+}
+
+// parseEventFilter builds an event filter from the request's query parameters.
+func parseEventFilter(r *http.Request) (events.Filter, error) {
+	filter := events.Filter{
+		Domain: r.URL.Query().Get("domain"),
+		Player: r.URL.Query().Get("player"),
+	}
+
+	known := map[events.Type]bool{
+		events.RequestReceived:     true,
+		events.RequestAssigned:     true,
+		events.RequestDecided:      true,
+		events.RequestTimedOut:     true,
+		events.PlayerRegistered:    true,
+		events.LeaderboardChanged:  true,
+		events.TeamJoined:          true,
+		events.ObjectiveCompleted:  true,
+		events.SeasonStarted:       true,
+		events.RoundStarted:        true,
+		events.RoundEnded:          true,
+		events.AchievementUnlocked: true,
+	}
+	if types := r.URL.Query().Get("type"); types != "" {
+		filter.Types = make(map[events.Type]bool)
+		for _, name := range strings.Split(types, ",") {
+			t := events.Type(strings.TrimSpace(name))
+			if !known[t] {
+				return filter, fmt.Errorf("Unknown event type %q", t)
+			}
+			filter.Types[t] = true
+		}
+	}
+	return filter, nil
+}
+
+//////////////////////////////////////////
+// Leaderboard Watcher
+//////////////////////////////////////////
+
+// watchLeaderboard periodically publishes a leaderboard_changed event when the top players or their scores change.
+func watchLeaderboard() {
+	ticker := time.NewTicker(leaderboardWatchInterval)
+	defer ticker.Stop()
+
+	var previous []LeaderboardSnapshotEntry
+	for range ticker.C {
+		current := topPlayers(leaderboardWatchSize)
+		if leaderboardEqual(previous, current) {
+			continue
+		}
+		previous = current
+		eventBus.Publish(events.Event{
+			Type: events.LeaderboardChanged,
+			Data: current,
+		})
+	}
+}
+
+// topPlayers returns the n players with the most total points.
+func topPlayers(n int) []LeaderboardSnapshotEntry {
+	playersMu.RLock()
+	entries := make([]LeaderboardSnapshotEntry, 0, len(players))
+	for _, player := range players {
+		if !listed(player) {
+			continue
+		}
+		entries = append(entries, LeaderboardSnapshotEntry{
+			PlayerID:   player.ID,
+			Nickname:   player.Nickname,
+			PurePoints: player.PurePoints,
+			EvilPoints: player.EvilPoints,
+		})
+	}
+	playersMu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].PurePoints+entries[i].EvilPoints > entries[j].PurePoints+entries[j].EvilPoints
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// leaderboardEqual reports whether two leaderboard snapshots are identical.
+func leaderboardEqual(a, b []LeaderboardSnapshotEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
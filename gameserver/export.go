@@ -0,0 +1,834 @@
+// gameserver/export.go
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicewrld/gameserver/db"
+)
+
+//////////////////////////////////////////
+// Export Constants
+//////////////////////////////////////////
+
+const (
+	exportFormatJSONL = "jsonl"
+	exportFormatCSV   = "csv"
+
+	exportKindPlayers   = "players"
+	exportKindDecisions = "decisions"
+	exportKindSeasons   = "seasons"
+
+	// maxImportBytes caps the size of an import upload.
+	maxImportBytes = 256 << 20
+
+	// importBatchSize is how many records are written per transaction.
+	importBatchSize = 500
+
+	// maxImportErrors is how many invalid records an import lists before it stops reading.
+	maxImportErrors = 20
+)
+
+var (
+	// exportColumns is the CSV header for each kind of export.
+	exportColumns = map[string][]string{
+		exportKindPlayers:   {"id", "nickname", "pure_points", "evil_points", "created_at", "updated_at"},
+		exportKindDecisions: {"request_id", "qname", "qtype", "qclass", "client_ip", "player_id", "action", "latency_ms", "timed_out", "created_at"},
+		exportKindSeasons:   {"season", "started_at", "ended_at", "player_id", "nickname", "pure_points", "evil_points", "rank"},
+	}
+
+	errUnknownExportKind   = errors.New("kind must be players, decisions or seasons")
+	errUnknownExportFormat = errors.New("format must be jsonl or csv")
+)
+
+//////////////////////////////////////////
+// Export Records
+//////////////////////////////////////////
+
+// exportRecord is one line of an export: written as JSON or CSV rows, and checked before import.
+type exportRecord interface {
+	csvRows() [][]string
+	validate() error
+}
+
+// PlayerRecord is a player in an export.
+type PlayerRecord struct {
+	ID         string    `json:"id"`
+	Nickname   string    `json:"nickname"`
+	PurePoints float64   `json:"pure_points"`
+	EvilPoints float64   `json:"evil_points"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// DecisionRecord is a decision in an export.
+type DecisionRecord struct {
+	RequestID string    `json:"request_id"`
+	QName     string    `json:"qname"`
+	QType     string    `json:"qtype"`
+	QClass    string    `json:"qclass"`
+	ClientIP  string    `json:"client_ip"`
+	PlayerID  string    `json:"player_id"`
+	Action    string    `json:"action"`
+	LatencyMs int64     `json:"latency_ms"`
+	TimedOut  bool      `json:"timed_out"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SeasonRecord is a season and its final standings in an export. In CSV each standing is a row
+// of its own, repeating the season's columns; a season without standings is a single row.
+type SeasonRecord struct {
+	Number    int64            `json:"number"`
+	StartedAt time.Time        `json:"started_at"`
+	EndedAt   *time.Time       `json:"ended_at,omitempty"`
+	Results   []StandingRecord `json:"results,omitempty"`
+}
+
+// StandingRecord is where a player finished a season.
+type StandingRecord struct {
+	PlayerID   string  `json:"player_id"`
+	Nickname   string  `json:"nickname"`
+	PurePoints float64 `json:"pure_points"`
+	EvilPoints float64 `json:"evil_points"`
+	Rank       int     `json:"rank"`
+}
+
+func (p *PlayerRecord) csvRows() [][]string {
+	return [][]string{{
+		p.ID, p.Nickname, formatCSVFloat(p.PurePoints), formatCSVFloat(p.EvilPoints),
+		formatCSVTime(p.CreatedAt), formatCSVTime(p.UpdatedAt),
+	}}
+}
+
+func (d *DecisionRecord) csvRows() [][]string {
+	return [][]string{{
+		d.RequestID, d.QName, d.QType, d.QClass, d.ClientIP, d.PlayerID, d.Action,
+		strconv.FormatInt(d.LatencyMs, 10), strconv.FormatBool(d.TimedOut), formatCSVTime(d.CreatedAt),
+	}}
+}
+
+func (s *SeasonRecord) csvRows() [][]string {
+	season := []string{strconv.FormatInt(s.Number, 10), formatCSVTime(s.StartedAt), ""}
+	if s.EndedAt != nil {
+		season[2] = formatCSVTime(*s.EndedAt)
+	}
+	if len(s.Results) == 0 {
+		return [][]string{append(season, "", "", "", "", "")}
+	}
+	rows := make([][]string, 0, len(s.Results))
+	for _, r := range s.Results {
+		rows = append(rows, append(append([]string(nil), season...),
+			r.PlayerID, r.Nickname, formatCSVFloat(r.PurePoints), formatCSVFloat(r.EvilPoints), strconv.Itoa(r.Rank)))
+	}
+	return rows
+}
+
+func (p *PlayerRecord) validate() error {
+	switch {
+	case p.ID == "":
+		return errors.New("id is required")
+	case p.Nickname == "":
+		return errors.New("nickname is required")
+	case !finite(p.PurePoints) || !finite(p.EvilPoints):
+		return errors.New("points must be finite numbers")
+	case p.CreatedAt.IsZero():
+		return errors.New("created_at is required")
+	}
+	return nil
+}
+
+func (d *DecisionRecord) validate() error {
+	switch {
+	case d.RequestID == "":
+		return errors.New("request_id is required")
+	case d.QName == "" || d.QType == "":
+		return errors.New("qname and qtype are required")
+	case !validActions[d.Action]:
+		return fmt.Errorf("unknown action %q", d.Action)
+	case d.LatencyMs < 0:
+		return errors.New("latency_ms can't be negative")
+	case d.CreatedAt.IsZero():
+		return errors.New("created_at is required")
+	}
+	return nil
+}
+
+func (s *SeasonRecord) validate() error {
+	switch {
+	case s.Number < 1:
+		return errors.New("season numbers start at 1")
+	case s.StartedAt.IsZero():
+		return errors.New("started_at is required")
+	case s.EndedAt != nil && s.EndedAt.Before(s.StartedAt):
+		return errors.New("ended_at is before started_at")
+	case s.EndedAt == nil && len(s.Results) > 0:
+		return errors.New("a season that hasn't ended has no results")
+	}
+	seen := make(map[string]bool, len(s.Results))
+	for _, r := range s.Results {
+		switch {
+		case r.PlayerID == "":
+			return errors.New("results need a player_id")
+		case seen[r.PlayerID]:
+			return fmt.Errorf("player %s is in the results twice", r.PlayerID)
+		case r.Rank < 1:
+			return fmt.Errorf("player %s has rank %d, ranks start at 1", r.PlayerID, r.Rank)
+		case !finite(r.PurePoints) || !finite(r.EvilPoints):
+			return fmt.Errorf("player %s has points that aren't finite numbers", r.PlayerID)
+		}
+		seen[r.PlayerID] = true
+	}
+	return nil
+}
+
+// mergeCSV folds the next CSV row's standing into this season if it belongs to it.
+func (s *SeasonRecord) mergeCSV(next exportRecord) bool {
+	n, ok := next.(*SeasonRecord)
+	if !ok || n.Number != s.Number {
+		return false
+	}
+	s.Results = append(s.Results, n.Results...)
+	return true
+}
+
+// finite says whether f is a real number rather than NaN or an infinity.
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+//////////////////////////////////////////
+// Export Functions
+//////////////////////////////////////////
+
+// exportParams reads and checks the kind and format query parameters.
+func exportParams(r *http.Request) (string, string, error) {
+	kind := r.URL.Query().Get("kind")
+	if _, ok := exportColumns[kind]; !ok {
+		return "", "", errUnknownExportKind
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatJSONL
+	}
+	if format != exportFormatJSONL && format != exportFormatCSV {
+		return "", "", errUnknownExportFormat
+	}
+	return kind, format, nil
+}
+
+// exportRecords streams every record of a kind from b to w, one at a time.
+func exportRecords(ctx context.Context, b *db.Backup, kind, format string, w io.Writer) error {
+	buffered := bufio.NewWriter(w)
+	var write func(exportRecord) error
+	var csvWriter *csv.Writer
+	if format == exportFormatCSV {
+		csvWriter = csv.NewWriter(buffered)
+		if err := csvWriter.Write(exportColumns[kind]); err != nil {
+			return err
+		}
+		write = func(record exportRecord) error {
+			return csvWriter.WriteAll(record.csvRows())
+		}
+	} else {
+		encoder := json.NewEncoder(buffered)
+		write = func(record exportRecord) error {
+			return encoder.Encode(record)
+		}
+	}
+
+	var err error
+	switch kind {
+	case exportKindPlayers:
+		err = b.ExportPlayers(ctx, func(p db.Player) error {
+			return write(&PlayerRecord{
+				ID:         p.ID,
+				Nickname:   p.Nickname,
+				PurePoints: p.PurePoints,
+				EvilPoints: p.EvilPoints,
+				CreatedAt:  p.CreatedAt.UTC(),
+				UpdatedAt:  p.UpdatedAt.UTC(),
+			})
+		})
+	case exportKindDecisions:
+		err = b.ExportDecisions(ctx, func(d db.Decision) error {
+			return write(&DecisionRecord{
+				RequestID: d.RequestID,
+				QName:     d.QName,
+				QType:     d.QType,
+				QClass:    d.QClass,
+				ClientIP:  d.ClientIP,
+				PlayerID:  d.PlayerID,
+				Action:    d.Action,
+				LatencyMs: d.LatencyMs,
+				TimedOut:  d.TimedOut,
+				CreatedAt: d.CreatedAt.UTC(),
+			})
+		})
+	case exportKindSeasons:
+		err = b.ExportSeasons(ctx, func(s db.SeasonExport) error {
+			record := &SeasonRecord{Number: s.Number, StartedAt: s.StartedAt.UTC()}
+			if !s.EndedAt.IsZero() {
+				endedAt := s.EndedAt.UTC()
+				record.EndedAt = &endedAt
+			}
+			for _, r := range s.Results {
+				record.Results = append(record.Results, StandingRecord(r))
+			}
+			return write(record)
+		})
+	default:
+		err = errUnknownExportKind
+	}
+	if err != nil {
+		return err
+	}
+	if csvWriter != nil {
+		// WriteAll flushes into buffered already; Error reports anything it hit doing so.
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+//////////////////////////////////////////
+// Import Functions
+//////////////////////////////////////////
+
+// ImportReport says what an import did.
+type ImportReport struct {
+	Kind    string `json:"kind"`
+	Records int    `json:"records"` // valid records read
+	Added   int64  `json:"added"`   // how many of them weren't there already
+}
+
+// importErrors lists the invalid records that stopped an import, one per line.
+type importErrors []string
+
+func (e importErrors) Error() string {
+	return strings.Join(e, "\n")
+}
+
+// numberedRecord is a record and the line it started on, for error messages.
+type numberedRecord struct {
+	line   int
+	record exportRecord
+}
+
+// csvMerger is a record that can span several CSV rows, like a season and its standings.
+type csvMerger interface {
+	mergeCSV(next exportRecord) bool
+}
+
+// newExportRecord returns an empty record of a kind to decode into.
+func newExportRecord(kind string) exportRecord {
+	switch kind {
+	case exportKindPlayers:
+		return &PlayerRecord{}
+	case exportKindDecisions:
+		return &DecisionRecord{}
+	default:
+		return &SeasonRecord{}
+	}
+}
+
+// readRecords reads and validates a whole import before any of it is written, so a file with a
+// bad record changes nothing. The error lists the bad records by line.
+func readRecords(r io.Reader, kind, format string) ([]exportRecord, error) {
+	var read []numberedRecord
+	var invalid importErrors
+	var err error
+	if format == exportFormatCSV {
+		read, invalid, err = readCSVRecords(r, kind)
+	} else {
+		read, invalid, err = readJSONRecords(r, kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]exportRecord, 0, len(read))
+	for _, nr := range read {
+		if len(invalid) >= maxImportErrors {
+			break
+		}
+		if err := nr.record.validate(); err != nil {
+			invalid = append(invalid, fmt.Sprintf("line %d: %v", nr.line, err))
+		}
+		records = append(records, nr.record)
+	}
+	if len(invalid) > 0 {
+		return nil, invalid
+	}
+	return records, nil
+}
+
+// readJSONRecords decodes one record per line, skipping blank lines and rejecting unknown fields.
+func readJSONRecords(r io.Reader, kind string) ([]numberedRecord, importErrors, error) {
+	reader := bufio.NewReader(r)
+	var records []numberedRecord
+	var invalid importErrors
+	for line := 1; len(invalid) < maxImportErrors; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			record := newExportRecord(kind)
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			if derr := decoder.Decode(record); derr != nil {
+				invalid = append(invalid, fmt.Sprintf("line %d: %v", line, derr))
+			} else if decoder.More() {
+				invalid = append(invalid, fmt.Sprintf("line %d: one record per line", line))
+			} else {
+				records = append(records, numberedRecord{line: line, record: record})
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return records, invalid, nil
+}
+
+// readCSVRecords reads rows under a header naming the kind's columns, in any order.
+func readCSVRecords(r io.Reader, kind string) ([]numberedRecord, importErrors, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	want := exportColumns[kind]
+	for _, name := range want {
+		if _, ok := columns[name]; !ok || len(header) != len(want) {
+			return nil, nil, fmt.Errorf("CSV header must be %s", strings.Join(want, ","))
+		}
+	}
+
+	var records []numberedRecord
+	var invalid importErrors
+	for len(invalid) < maxImportErrors {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		record, err := parseCSVRecord(kind, &csvFields{row: row, columns: columns})
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		if len(records) > 0 {
+			if merger, ok := records[len(records)-1].record.(csvMerger); ok && merger.mergeCSV(record) {
+				continue
+			}
+		}
+		records = append(records, numberedRecord{line: line, record: record})
+	}
+	return records, invalid, nil
+}
+
+// parseCSVRecord turns one CSV row into a record of a kind.
+func parseCSVRecord(kind string, f *csvFields) (exportRecord, error) {
+	var record exportRecord
+	switch kind {
+	case exportKindPlayers:
+		record = &PlayerRecord{
+			ID:         f.str("id"),
+			Nickname:   f.str("nickname"),
+			PurePoints: f.float("pure_points"),
+			EvilPoints: f.float("evil_points"),
+			CreatedAt:  f.time("created_at"),
+			UpdatedAt:  f.time("updated_at"),
+		}
+	case exportKindDecisions:
+		record = &DecisionRecord{
+			RequestID: f.str("request_id"),
+			QName:     f.str("qname"),
+			QType:     f.str("qtype"),
+			QClass:    f.str("qclass"),
+			ClientIP:  f.str("client_ip"),
+			PlayerID:  f.str("player_id"),
+			Action:    f.str("action"),
+			LatencyMs: f.int("latency_ms"),
+			TimedOut:  f.bool("timed_out"),
+			CreatedAt: f.time("created_at"),
+		}
+	default:
+		season := &SeasonRecord{Number: f.int("season"), StartedAt: f.time("started_at")}
+		if endedAt := f.time("ended_at"); !endedAt.IsZero() {
+			season.EndedAt = &endedAt
+		}
+		// A row with the standing columns all empty is a season nobody finished yet.
+		if f.str("player_id")+f.str("nickname")+f.str("pure_points")+f.str("evil_points")+f.str("rank") != "" {
+			season.Results = []StandingRecord{{
+				PlayerID:   f.str("player_id"),
+				Nickname:   f.str("nickname"),
+				PurePoints: f.float("pure_points"),
+				EvilPoints: f.float("evil_points"),
+				Rank:       int(f.int("rank")),
+			}}
+		}
+		record = season
+	}
+	return record, f.err
+}
+
+// csvFields reads typed values out of a CSV row by column name, keeping the first error.
+type csvFields struct {
+	row     []string
+	columns map[string]int
+	err     error
+}
+
+func (f *csvFields) str(name string) string {
+	return f.row[f.columns[name]]
+}
+
+func (f *csvFields) float(name string) float64 {
+	value, err := strconv.ParseFloat(f.str(name), 64)
+	f.fail(name, err)
+	return value
+}
+
+func (f *csvFields) int(name string) int64 {
+	value, err := strconv.ParseInt(f.str(name), 10, 64)
+	f.fail(name, err)
+	return value
+}
+
+func (f *csvFields) bool(name string) bool {
+	value, err := strconv.ParseBool(f.str(name))
+	f.fail(name, err)
+	return value
+}
+
+// time parses an RFC 3339 timestamp, leaving an empty one zero.
+func (f *csvFields) time(name string) time.Time {
+	if f.str(name) == "" {
+		return time.Time{}
+	}
+	value, err := time.Parse(time.RFC3339Nano, f.str(name))
+	f.fail(name, err)
+	return value
+}
+
+func (f *csvFields) fail(name string, err error) {
+	if err != nil && f.err == nil {
+		f.err = fmt.Errorf("%s: %v", name, err)
+	}
+}
+
+// formatCSVFloat writes a number so it reads back exactly.
+func formatCSVFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatCSVTime writes a timestamp as RFC 3339 in UTC, or nothing if it's zero.
+func formatCSVTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// importRecords writes validated records to b a batch at a time and says how many were new and
+// how many of the records, from the start, made it into the database. A failure part way leaves
+// the earlier batches in place; importing the same file again skips them and carries on.
+func importRecords(ctx context.Context, b *db.Backup, kind string, records []exportRecord) (added int64, written int, err error) {
+	for start := 0; start < len(records); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		n, err := importBatch(ctx, b, kind, records[start:end])
+		added += n
+		if err != nil {
+			// The failed batch was rolled back, so only the ones before it count.
+			return added, start, err
+		}
+	}
+	return added, len(records), nil
+}
+
+// importBatch writes one batch of records in a single transaction.
+func importBatch(ctx context.Context, b *db.Backup, kind string, batch []exportRecord) (int64, error) {
+	switch kind {
+	case exportKindPlayers:
+		players := make([]db.Player, 0, len(batch))
+		for _, record := range batch {
+			p := record.(*PlayerRecord)
+			updatedAt := p.UpdatedAt
+			if updatedAt.IsZero() {
+				updatedAt = p.CreatedAt
+			}
+			players = append(players, db.Player{
+				ID:         p.ID,
+				Nickname:   p.Nickname,
+				PurePoints: p.PurePoints,
+				EvilPoints: p.EvilPoints,
+				CreatedAt:  p.CreatedAt,
+				UpdatedAt:  updatedAt,
+			})
+		}
+		return b.ImportPlayers(ctx, players)
+	case exportKindDecisions:
+		decisions := make([]db.Decision, 0, len(batch))
+		for _, record := range batch {
+			d := record.(*DecisionRecord)
+			decisions = append(decisions, db.Decision{
+				RequestID: d.RequestID,
+				QName:     d.QName,
+				QType:     d.QType,
+				QClass:    d.QClass,
+				ClientIP:  d.ClientIP,
+				PlayerID:  d.PlayerID,
+				Action:    d.Action,
+				LatencyMs: d.LatencyMs,
+				TimedOut:  d.TimedOut,
+				CreatedAt: d.CreatedAt,
+			})
+		}
+		return b.ImportDecisions(ctx, decisions)
+	default:
+		seasons := make([]db.SeasonExport, 0, len(batch))
+		for _, record := range batch {
+			s := record.(*SeasonRecord)
+			season := db.SeasonExport{Season: db.Season{Number: s.Number, StartedAt: s.StartedAt}}
+			if s.EndedAt != nil {
+				season.EndedAt = *s.EndedAt
+			}
+			for _, r := range s.Results {
+				season.Results = append(season.Results, db.Standing(r))
+			}
+			seasons = append(seasons, season)
+		}
+		return b.ImportSeasons(ctx, seasons)
+	}
+}
+
+// checkLiveSeasons turns away seasons that a running game, playing season current, can't take:
+// ones that haven't ended and ones that aren't older than the current season. The next rollover
+// would end up writing on top of them.
+func checkLiveSeasons(records []exportRecord, current int64) error {
+	var invalid importErrors
+	for _, record := range records {
+		if len(invalid) >= maxImportErrors {
+			break
+		}
+		switch s := record.(*SeasonRecord); {
+		case s.EndedAt == nil:
+			invalid = append(invalid, fmt.Sprintf("season %d hasn't ended, only finished seasons can be imported into a running game", s.Number))
+		case s.Number >= current:
+			invalid = append(invalid, fmt.Sprintf("season %d isn't before the current season %d", s.Number, current))
+		}
+	}
+	if len(invalid) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// addImportedPlayers puts imported players who aren't in the game yet into it. Players already
+// playing were skipped by the import too, so their live scores stand.
+func addImportedPlayers(records []exportRecord) {
+	playersMu.Lock()
+	defer playersMu.Unlock()
+	for _, record := range records {
+		p := record.(*PlayerRecord)
+		if _, exists := players[p.ID]; exists {
+			continue
+		}
+		player := &Player{ID: p.ID, Nickname: p.Nickname, PurePoints: p.PurePoints, EvilPoints: p.EvilPoints, LastActive: p.UpdatedAt}
+		// As when loading at startup, a clashing nickname is kept but stays owned by whoever had it.
+		if _, err := checkNickname(p.ID, p.Nickname); err == nil {
+			claimNickname(player, p.Nickname)
+		}
+		players[p.ID] = player
+		rankPlayer(player)
+	}
+	playerCount.Set(float64(len(players)))
+}
+
+//////////////////////////////////////////
+// Export Handlers
+//////////////////////////////////////////
+
+// countingWriter counts the bytes that have gone through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// adminExportHandler streams every player, decision or season as JSON Lines or CSV.
+//
+// Query parameters: kind (players, decisions or seasons), format (jsonl, the default, or csv).
+func adminExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	kind, format, err := exportParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == exportFormatCSV {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, kind, format))
+	out := &countingWriter{w: w}
+	if err := exportRecords(r.Context(), db.CurrentBackup(), kind, format, out); err != nil {
+		log.Printf("Failed to export %s: %v", kind, err)
+		// Once rows have gone out the status is sent, so all that's left is to cut the stream short.
+		if out.n == 0 {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Failed to export", http.StatusInternalServerError)
+		}
+	}
+}
+
+// adminImportHandler loads an export back in. The whole upload is checked first and nothing is
+// written if any record is invalid. Records that are already there are skipped, so importing
+// the same file twice is harmless. Seasons have to be finished and older than the one being played.
+//
+// Query parameters: kind (players, decisions or seasons), format (jsonl, the default, or csv).
+func adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	kind, format, err := exportParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := readRecords(http.MaxBytesReader(w, r.Body, maxImportBytes), kind, format)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, "Import is too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if kind == exportKindSeasons {
+		if err := checkLiveSeasons(records, seasonNumber()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report := ImportReport{Kind: kind, Records: len(records)}
+	var written int
+	report.Added, written, err = importRecords(r.Context(), db.CurrentBackup(), kind, records)
+	if kind == exportKindPlayers {
+		// Only players that reached the database join the game, or they'd score without being saved.
+		addImportedPlayers(records[:written])
+	}
+	audit(r, "import", kind, report)
+	if err != nil {
+		log.Printf("Failed to import %s after adding %d: %v", kind, report.Added, err)
+		http.Error(w, "Failed to import, running it again picks up where it stopped", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+//////////////////////////////////////////
+// Export Command
+//////////////////////////////////////////
+
+// runExport implements `gameserver export`, which writes one kind of record from a database to
+// standard output or a file. It doesn't need a running server and doesn't change the database,
+// so it works on a copy. It returns the process exit code.
+func runExport(args []string, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	dsn := flags.String("db", databaseDSN(), "database to export, a SQLite path or postgres:// URL")
+	kind := flags.String("kind", exportKindPlayers, "what to export: players, decisions or seasons")
+	format := flags.String("format", exportFormatJSONL, "jsonl or csv")
+	output := flags.String("o", "", "file to write instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if _, ok := exportColumns[*kind]; !ok {
+		fmt.Fprintln(errOut, errUnknownExportKind)
+		return 2
+	}
+	if *format != exportFormatJSONL && *format != exportFormatCSV {
+		fmt.Fprintln(errOut, errUnknownExportFormat)
+		return 2
+	}
+
+	backup, err := db.OpenBackup(*dsn)
+	if err != nil {
+		fmt.Fprintf(errOut, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer backup.Close()
+
+	dest := out
+	var file *os.File
+	if *output != "" {
+		if file, err = os.Create(*output); err != nil {
+			fmt.Fprintf(errOut, "Failed to create %s: %v\n", *output, err)
+			return 1
+		}
+		defer file.Close()
+		dest = file
+	}
+	if err := exportRecords(context.Background(), backup, *kind, *format, dest); err != nil {
+		fmt.Fprintf(errOut, "Failed to export %s: %v\n", *kind, err)
+		return 1
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			fmt.Fprintf(errOut, "Failed to write %s: %v\n", *output, err)
+			return 1
+		}
+	}
+	return 0
+}
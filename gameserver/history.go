@@ -0,0 +1,278 @@
+// gameserver/history.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicewrld/gameserver/db"
+)
+
+//////////////////////////////////////////
+// History API Constants
+//////////////////////////////////////////
+
+const (
+	// defaultHistoryLimit is the page size used when no limit is given.
+	defaultHistoryLimit = 50
+
+	// maxHistoryLimit caps the page size a client may request.
+	maxHistoryLimit = 500
+
+	// defaultTopDomainsLimit is the number of domains returned by /stats/domains/top when no limit is given.
+	defaultTopDomainsLimit = 10
+)
+
+//////////////////////////////////////////
+// History API Data Structures
+//////////////////////////////////////////
+
+// DecisionView is a stored decision as returned by the history API.
+// The querying client's address is deliberately left out.
+type DecisionView struct {
+	ID        int64     `json:"id"`
+	RequestID string    `json:"request_id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Class     string    `json:"class"`
+	PlayerID  string    `json:"player_id,omitempty"`
+	Action    string    `json:"action"`
+	LatencyMs int64     `json:"latency_ms"`
+	TimedOut  bool      `json:"timed_out"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// HistoryPage is one page of decisions. NextCursor is empty on the last page.
+type HistoryPage struct {
+	Decisions  []DecisionView `json:"decisions"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+//////////////////////////////////////////
+// History API Handlers
+//////////////////////////////////////////
+
+// playerResourceHandler routes /players/{id}/{resource} requests.
+func playerResourceHandler(w http.ResponseWriter, r *http.Request) {
+	playerID, resource, ok := splitResourcePath(r.URL.Path, "/players/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch resource {
+	case "history":
+		historyHandler(w, r, db.DecisionQuery{PlayerID: playerID})
+	case "awards":
+		awardsHandler(w, r, playerID)
+	case "achievements":
+		achievementsHandler(w, r, playerID)
+	case "nickname":
+		nicknameHandler(w, r, playerID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// domainResourceHandler routes /domains/{name}/{resource} requests.
+func domainResourceHandler(w http.ResponseWriter, r *http.Request) {
+	domain, resource, ok := splitResourcePath(r.URL.Path, "/domains/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch resource {
+	case "history":
+		historyHandler(w, r, db.DecisionQuery{QName: normalizeQName(domain)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// historyHandler returns a page of decisions matching the base query, newest first.
+//
+// Query parameters: cursor, limit, since, until.
+func historyHandler(w http.ResponseWriter, r *http.Request, query db.DecisionQuery) {
+	var err error
+	if query.Since, query.Until, err = parseTimeRange(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Limit, err = parseLimit(r, defaultHistoryLimit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		query.BeforeID, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || query.BeforeID <= 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	decisions, err := db.QueryDecisions(query)
+	if err != nil {
+		log.Printf("Failed to query decision history: %v", err)
+		http.Error(w, "Failed to load history", http.StatusInternalServerError)
+		return
+	}
+
+	page := HistoryPage{Decisions: make([]DecisionView, 0, len(decisions))}
+	for _, d := range decisions {
+		page.Decisions = append(page.Decisions, DecisionView{
+			ID:        d.ID,
+			RequestID: d.RequestID,
+			Name:      d.QName,
+			Type:      d.QType,
+			Class:     d.QClass,
+			PlayerID:  d.PlayerID,
+			Action:    d.Action,
+			LatencyMs: d.LatencyMs,
+			TimedOut:  d.TimedOut,
+			Timestamp: d.CreatedAt,
+		})
+	}
+	if len(decisions) == query.Limit {
+		page.NextCursor = strconv.FormatInt(decisions[len(decisions)-1].ID, 10)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// actionStatsHandler returns how often each action was chosen in a time range.
+func actionStatsHandler(w http.ResponseWriter, r *http.Request) {
+	since, until, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	counts, err := db.CountActions(since, until)
+	if err != nil {
+		log.Printf("Failed to count actions: %v", err)
+		http.Error(w, "Failed to load stats", http.StatusInternalServerError)
+		return
+	}
+
+	type ActionStat struct {
+		Action   string `json:"action"`
+		Count    int64  `json:"count"`
+		TimedOut int64  `json:"timed_out"`
+	}
+	stats := make([]ActionStat, 0, len(counts))
+	for _, c := range counts {
+		stats = append(stats, ActionStat{Action: c.Action, Count: c.Count, TimedOut: c.TimedOut})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// topDomainsHandler returns the domains that received an action most often in a time range.
+//
+// Query parameters: action (default: any), limit, since, until.
+func topDomainsHandler(w http.ResponseWriter, r *http.Request) {
+	since, until, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(r, defaultTopDomainsLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	action := r.URL.Query().Get("action")
+	if action != "" && !validActions[action] {
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	counts, err := db.TopDomains(action, since, until, limit)
+	if err != nil {
+		log.Printf("Failed to load top domains: %v", err)
+		http.Error(w, "Failed to load stats", http.StatusInternalServerError)
+		return
+	}
+
+	type DomainStat struct {
+		Domain string `json:"domain"`
+		Count  int64  `json:"count"`
+	}
+	stats := make([]DomainStat, 0, len(counts))
+	for _, c := range counts {
+		stats = append(stats, DomainStat{Domain: c.Domain, Count: c.Count})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+//////////////////////////////////////////
+// History API Helpers
+//////////////////////////////////////////
+
+// splitResourcePath splits "/prefix/{key}/{resource}" into its key and resource.
+func splitResourcePath(path, prefix string) (key, resource string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, prefix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// parseTimeRange reads the since and until query parameters.
+func parseTimeRange(r *http.Request) (since, until time.Time, err error) {
+	now := time.Now()
+	if since, err = parseTimeParam(r.URL.Query().Get("since"), now); err != nil {
+		return since, until, fmt.Errorf("Invalid since: %v", err)
+	}
+	if until, err = parseTimeParam(r.URL.Query().Get("until"), now); err != nil {
+		return since, until, fmt.Errorf("Invalid until: %v", err)
+	}
+	return since, until, nil
+}
+
+// parseTimeParam accepts an RFC 3339 timestamp, a duration before now (e.g. "24h"), or "today".
+// An empty value yields the zero time, meaning unbounded.
+func parseTimeParam(value string, now time.Time) (time.Time, error) {
+	switch {
+	case value == "":
+		return time.Time{}, nil
+	case value == "today":
+		year, month, day := now.Date()
+		return time.Date(year, month, day, 0, 0, 0, 0, now.Location()), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 time, duration or \"today\"")
+	}
+	return now.Add(-d), nil
+}
+
+// parseLimit reads the limit query parameter, clamped to maxHistoryLimit.
+func parseLimit(r *http.Request, fallback int) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("Invalid limit")
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	return limit, nil
+}
@@ -0,0 +1,371 @@
+// gameserver/leaderboard.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicewrld/gameserver/client"
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/ranking"
+)
+
+//////////////////////////////////////////
+// Leaderboard Constants
+//////////////////////////////////////////
+
+const (
+	defaultLeaderboardPageSize = 50
+	maxLeaderboardPageSize     = 200
+)
+
+// leaderboardSorts are the orders a leaderboard can be sorted in.
+var leaderboardSorts = []string{"total", "pure", "evil", "net", "recent"}
+
+//////////////////////////////////////////
+// Leaderboard State
+//////////////////////////////////////////
+
+var (
+	// rankings keeps listed players in order under every sort, so serving a page or a rank
+	// doesn't mean sorting every player. Guarded by playersMu, like the players it ranks.
+	rankings = newRankings()
+
+	errInvalidSort       = errors.New("Invalid sort")
+	errInvalidWindow     = errors.New("Invalid window")
+	errInvalidScope      = errors.New("Invalid scope")
+	errTeamSeason        = errors.New("Team leaderboards are only kept for the current season")
+	errNotRanked         = errors.New("Player is not on this leaderboard")
+	errLeaderboardFailed = errors.New("Failed to load leaderboard")
+)
+
+// newRankings returns an empty index for each sort.
+func newRankings() map[string]*ranking.Index {
+	indexes := make(map[string]*ranking.Index, len(leaderboardSorts))
+	for _, sortBy := range leaderboardSorts {
+		indexes[sortBy] = ranking.New()
+	}
+	return indexes
+}
+
+//////////////////////////////////////////
+// Leaderboard Functions
+//////////////////////////////////////////
+
+// sortScore returns what a player is ranked by under a sort.
+func sortScore(player *Player, sortBy string) float64 {
+	switch sortBy {
+	case "pure":
+		return player.PurePoints
+	case "evil":
+		return player.EvilPoints
+	case "net":
+		return player.PurePoints - player.EvilPoints
+	case "recent":
+		if player.LastActive.IsZero() {
+			return 0
+		}
+		return float64(player.LastActive.UnixMilli())
+	}
+	return player.PurePoints + player.EvilPoints
+}
+
+// rankPlayer moves a player to their place on every leaderboard, or takes them off
+// if they shouldn't be listed. Callers must hold playersMu.
+func rankPlayer(player *Player) {
+	for sortBy, index := range rankings {
+		if listed(player) {
+			index.Set(player.ID, sortScore(player, sortBy))
+		} else {
+			index.Remove(player.ID)
+		}
+	}
+}
+
+// rebuildRankings ranks every player from scratch. Callers must hold playersMu.
+func rebuildRankings() {
+	rankings = newRankings()
+	for _, player := range players {
+		rankPlayer(player)
+	}
+}
+
+// touchPlayer records that a player just made a decision, for the recent activity leaderboard.
+func touchPlayer(playerID string, at time.Time) {
+	playersMu.Lock()
+	defer playersMu.Unlock()
+	if player, exists := players[playerID]; exists {
+		player.LastActive = at
+		rankPlayer(player)
+	}
+}
+
+// windowStart returns when a leaderboard window began: midnight UTC for "today" and the
+// latest Monday for "week", but never before the current season. The season window is
+// the zero time, which leaves the board to the live scores in memory.
+func windowStart(window string, now time.Time) (time.Time, error) {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var start time.Time
+	switch window {
+	case "", "season":
+		return time.Time{}, nil
+	case "today":
+		start = midnight
+	case "week":
+		start = midnight.AddDate(0, 0, -((int(now.Weekday()) + 6) % 7))
+	default:
+		return time.Time{}, errInvalidWindow
+	}
+
+	seasonMu.Lock()
+	seasonStart := currentSeason.StartedAt
+	seasonMu.Unlock()
+	if seasonStart.After(start) {
+		start = seasonStart
+	}
+	return start, nil
+}
+
+// parseSort reads the sort query parameter, defaulting to total points.
+func parseSort(r *http.Request) (string, error) {
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		return "total", nil
+	}
+	if _, ok := rankings[sortBy]; !ok {
+		return "", errInvalidSort
+	}
+	return sortBy, nil
+}
+
+// parsePageSize reads the page_size query parameter, clamped to maxLeaderboardPageSize.
+func parsePageSize(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("page_size")
+	if value == "" {
+		return defaultLeaderboardPageSize, nil
+	}
+	pageSize, err := strconv.Atoi(value)
+	if err != nil || pageSize < 1 {
+		return 0, errors.New("Invalid page_size")
+	}
+	if pageSize > maxLeaderboardPageSize {
+		pageSize = maxLeaderboardPageSize
+	}
+	return pageSize, nil
+}
+
+//////////////////////////////////////////
+// Leaderboard Handlers
+//////////////////////////////////////////
+
+// LeaderboardEntry is one player's line on the leaderboard. Rank is their place on the
+// whole board, even when the page was narrowed down by a search.
+type LeaderboardEntry = client.LeaderboardEntry
+
+// leaderboardEntry builds an entry from a player in memory. Callers must hold playersMu.
+func leaderboardEntry(player *Player, rank int) LeaderboardEntry {
+	entry := LeaderboardEntry{
+		Rank:         rank,
+		PlayerID:     player.ID,
+		Nickname:     player.Nickname,
+		PurePoints:   player.PurePoints,
+		EvilPoints:   player.EvilPoints,
+		NetAlignment: player.PurePoints - player.EvilPoints,
+	}
+	if !player.LastActive.IsZero() {
+		lastActive := player.LastActive.UTC()
+		entry.LastActive = &lastActive
+	}
+	return entry
+}
+
+// windowEntry builds an entry from a player's points inside a leaderboard window.
+func windowEntry(s db.WindowStanding) LeaderboardEntry {
+	lastActive := s.LastActive
+	return LeaderboardEntry{
+		Rank:         s.Rank,
+		PlayerID:     s.PlayerID,
+		Nickname:     s.Nickname,
+		PurePoints:   s.PurePoints,
+		EvilPoints:   s.EvilPoints,
+		NetAlignment: s.PurePoints - s.EvilPoints,
+		LastActive:   &lastActive,
+	}
+}
+
+// leaderboardHandler returns a page of the leaderboard.
+//
+// Query parameters: page, page_size (default 50, at most 200), sort (total, pure, evil, net or
+// recent), window (season, today or week), q (nickname search), season (a finished season's
+// final standings) and scope (player or team).
+func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	// Parse pagination parameters.
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := parsePageSize(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_page_size", err)
+		return
+	}
+	sortBy, err := parseSort(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_sort", err)
+		return
+	}
+	now := time.Now()
+	since, err := windowStart(r.URL.Query().Get("window"), now)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_window", err)
+		return
+	}
+	search := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	// Finished seasons are served from their archived results.
+	season, err := parseSeason(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_season", err)
+		return
+	}
+	if season != 0 && season != seasonNumber() {
+		if r.URL.Query().Get("scope") == "team" {
+			writeError(w, r, http.StatusBadRequest, "invalid_scope", errTeamSeason)
+			return
+		}
+		seasonLeaderboardHandler(w, r, season, page, pageSize)
+		return
+	}
+
+	switch r.URL.Query().Get("scope") {
+	case "", "player":
+	case "team":
+		entries := teamViews()
+		startIndex, endIndex := pageBounds(len(entries), page, pageSize)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries[startIndex:endIndex])
+		return
+	default:
+		writeError(w, r, http.StatusBadRequest, "invalid_scope", errInvalidScope)
+		return
+	}
+
+	var leaderboard []LeaderboardEntry
+	switch {
+	case !since.IsZero():
+		// Today and this week are summed up from the stored awards.
+		standings, err := db.WindowLeaderboardContext(r.Context(), db.WindowQuery{
+			Since:  since,
+			Sort:   sortBy,
+			Search: search,
+			Offset: (page - 1) * pageSize,
+			Limit:  pageSize,
+		})
+		if err != nil {
+			log.Printf("Failed to load leaderboard since %s: %v", since.Format(time.RFC3339), err)
+			writeError(w, r, http.StatusInternalServerError, "internal_error", errLeaderboardFailed)
+			return
+		}
+		for _, s := range standings {
+			leaderboard = append(leaderboard, windowEntry(s))
+		}
+	case search != "":
+		// Searches look at every nickname, then put the matches in board order.
+		needle := strings.ToLower(search)
+		index := rankings[sortBy]
+		playersMu.RLock()
+		for _, player := range players {
+			if !listed(player) || !strings.Contains(strings.ToLower(player.Nickname), needle) {
+				continue
+			}
+			if rank, ok := index.Rank(player.ID); ok {
+				leaderboard = append(leaderboard, leaderboardEntry(player, rank))
+			}
+		}
+		playersMu.RUnlock()
+		sort.Slice(leaderboard, func(i, j int) bool {
+			return leaderboard[i].Rank < leaderboard[j].Rank
+		})
+		startIndex, endIndex := pageBounds(len(leaderboard), page, pageSize)
+		leaderboard = leaderboard[startIndex:endIndex]
+	default:
+		// Everything else is read straight off the live ranking.
+		offset := (page - 1) * pageSize
+		playersMu.RLock()
+		for i, ranked := range rankings[sortBy].Range(offset, pageSize) {
+			if player, exists := players[ranked.ID]; exists {
+				leaderboard = append(leaderboard, leaderboardEntry(player, offset+i+1))
+			}
+		}
+		playersMu.RUnlock()
+	}
+
+	// Return the paginated leaderboard slice.
+	if leaderboard == nil {
+		leaderboard = []LeaderboardEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leaderboard)
+}
+
+// RankView is where one player stands, as returned by /leaderboard/rank.
+type RankView = client.RankView
+
+// leaderboardRankHandler returns a player's place on the leaderboard.
+//
+// Query parameters: player_id, sort and window, as for /leaderboard.
+func leaderboardRankHandler(w http.ResponseWriter, r *http.Request) {
+	playerID := r.URL.Query().Get("player_id")
+	if playerID == "" {
+		writeError(w, r, http.StatusBadRequest, "missing_player_id", errMissingPlayerID)
+		return
+	}
+	sortBy, err := parseSort(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_sort", err)
+		return
+	}
+	since, err := windowStart(r.URL.Query().Get("window"), time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_window", err)
+		return
+	}
+
+	var view RankView
+	ranked := false
+	if since.IsZero() {
+		playersMu.RLock()
+		if player, exists := players[playerID]; exists {
+			index := rankings[sortBy]
+			var rank int
+			if rank, ranked = index.Rank(playerID); ranked {
+				view = RankView{LeaderboardEntry: leaderboardEntry(player, rank), Ranked: index.Len()}
+			}
+		}
+		playersMu.RUnlock()
+	} else {
+		standing, count, ok, err := db.WindowRankContext(r.Context(), playerID, since, sortBy)
+		if err != nil {
+			log.Printf("Failed to rank player %s since %s: %v", playerID, since.Format(time.RFC3339), err)
+			writeError(w, r, http.StatusInternalServerError, "internal_error", errLeaderboardFailed)
+			return
+		}
+		ranked = ok
+		view = RankView{LeaderboardEntry: windowEntry(standing), Ranked: count}
+	}
+	if !ranked {
+		writeError(w, r, http.StatusNotFound, "not_ranked", errNotRanked)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
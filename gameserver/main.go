@@ -5,19 +5,29 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"sort"
 	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/nicewrld/gameserver/achievements"
+	"github.com/nicewrld/gameserver/anticheat"
+	"github.com/nicewrld/gameserver/chat"
+	"github.com/nicewrld/gameserver/client"
 	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/events"
+	"github.com/nicewrld/gameserver/nicknames"
+	"github.com/nicewrld/gameserver/queue"
+	"github.com/nicewrld/gameserver/rules"
+	"github.com/nicewrld/gameserver/scoring"
+	"github.com/nicewrld/gameserver/teams"
+	"github.com/nicewrld/gameserver/voting"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -33,6 +43,9 @@ const (
 
 	// MinimumRemainingTime defines the minimum time a DNS request must have before timing out to be assigned to a player.
 	MinimumRemainingTime = 18 * time.Second
+
+	// RequestTimeout defines how long a DNS request waits for a player's action before falling back to "correct".
+	RequestTimeout = 30 * time.Second
 )
 
 //////////////////////////////////////////
@@ -82,29 +95,42 @@ var (
 
 // DNSRequest represents an incoming DNS query from CoreDNS.
 type DNSRequest struct {
-	RequestID string    `json:"request_id"` // Unique identifier for tracking
-	Name      string    `json:"name"`       // Queried domain name
-	Type      string    `json:"type"`       // Query type (e.g., A, AAAA)
-	Class     string    `json:"class"`      // Query class (usually IN)
-	Assigned  bool      `json:"assigned"`   // Indicates if a player has been assigned to handle this request
-	Timestamp time.Time `json:"timestamp"`  // Time when the request was received
-	TimedOut  bool      // Indicates if the request has timed out
+	RequestID  string        `json:"request_id"` // Unique identifier for tracking
+	Name       string        `json:"name"`       // Queried domain name
+	Type       string        `json:"type"`       // Query type (e.g., A, AAAA)
+	Class      string        `json:"class"`      // Query class (usually IN)
+	Assigned   bool          `json:"assigned"`   // Indicates if a player has been assigned to handle this request; guarded by pendingRequestsMu
+	Timestamp  time.Time     `json:"timestamp"`  // Time when the request was received
+	TimedOut   bool          // Indicates if the request has timed out; guarded by pendingRequestsMu
+	AssignedTo string        `json:"-"`     // ID of the player the request was assigned to, if any; guarded by pendingRequestsMu
+	Rules      rules.Verdict `json:"rules"` // Actions the domain's rules allow and what they are worth
+	ClientIP   string        `json:"-"`     // Address of the client that queried CoreDNS; never shown to players
+
+	resolved chan struct{}  // Closed once the DNS request handler has answered CoreDNS
+	ballot   *voting.Ballot // Crowd vote deciding this request; nil when a single player decides it
+	answer   string         // Address the deciding player wants a corrupt answer to point at, if any
 }
 
-// DNSResponse specifies the action to take on a DNS request.
-type DNSResponse struct {
-	Action string `json:"action"` // Possible actions: correct, corrupt, delay, nxdomain
-}
+// DNSResponse specifies the action to take on a DNS request. It is shared with the client
+// package, so CoreDNS and the game server can't disagree about it.
+type DNSResponse = client.DNSResponse
 
 // Player maintains the state and score of a game player.
 type Player struct {
-	ID                string  // Unique player identifier
-	Nickname          string  // Display name of the player
-	PurePoints        float64 // Points accumulated from correct responses
-	EvilPoints        float64 // Points accumulated from manipulated responses
-	PureDelta         float64 // Pending pure point changes to be synced to the database
-	EvilDelta         float64 // Pending evil point changes to be synced to the database
-	AssignedRequestID string  // ID of the current DNS request assigned to the player
+	ID                string    // Unique player identifier
+	Nickname          string    // Display name of the player
+	PurePoints        float64   // Points accumulated from correct responses
+	EvilPoints        float64   // Points accumulated from manipulated responses
+	PureDelta         float64   // Pending pure point changes to be synced to the database
+	EvilDelta         float64   // Pending evil point changes to be synced to the database
+	AssignedRequestID string    // ID of the current DNS request assigned to the player
+	Streak            int       // Consecutive decisions with the same alignment
+	StreakAlignment   string    // Alignment of the current streak (pure or evil)
+	TeamID            string    // ID of the team the player is on, if any
+	Banned            bool      // Banned players can't take requests and are hidden from leaderboards
+	Quarantined       bool      // Flagged by anti-cheat; hidden from leaderboards until an admin reviews them
+	LastActive        time.Time // When the player last made a decision
+	LastRenamedAt     time.Time // When the player last renamed themselves
 }
 
 //////////////////////////////////////////
@@ -148,6 +174,34 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvInt retrieves an integer environment variable, falling back to the default if it is unset or invalid.
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: Invalid integer %q for %s, using %d", value, key, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvDuration retrieves a duration environment variable (e.g. "30s", "720h"), falling back to the default if it is unset or invalid.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: Invalid duration %q for %s, using %s", value, key, fallback)
+		return fallback
+	}
+	return d
+}
+
 //////////////////////////////////////////
 // HTTP Handlers
 //////////////////////////////////////////
@@ -157,17 +211,37 @@ func dnsRequestHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	dnsRequestsTotal.Inc()
 
-	var dnsReq DNSRequest
-	if err := json.NewDecoder(r.Body).Decode(&dnsReq); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var query client.DNSQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", err)
 		return
 	}
 
 	// Initialize the DNS request.
+	dnsReq := DNSRequest{
+		Name:     query.Name,
+		Type:     query.Type,
+		Class:    query.Class,
+		ClientIP: query.ClientIP,
+	}
+	w.Header().Set("Content-Type", "application/json")
 	dnsReq.RequestID = generateRequestID()
 	dnsReq.Assigned = false
 	dnsReq.Timestamp = time.Now()
 	dnsReq.TimedOut = false // Initialize TimedOut to false
+	dnsReq.resolved = make(chan struct{})
+	defer close(dnsReq.resolved)
+
+	// While an admin has the game paused, or the server is shutting down, everything resolves
+	// normally without reaching players.
+	if gamePaused.Load() || shuttingDown.Load() {
+		json.NewEncoder(w).Encode(DNSResponse{Action: voting.FallbackAction})
+		dnsRequestLatency.With(prometheus.Labels{"action": voting.FallbackAction}).Observe(time.Since(start).Seconds())
+		return
+	}
+
+	dnsReq.ballot = openBallot(&dnsReq)
+	dnsReq.Rules = rulesEngine.Evaluate(dnsReq.Name)
 
 	// Create a channel to receive the player's action.
 	actionChan := make(chan string, 1) // Buffered to prevent blocking.
@@ -186,22 +260,31 @@ func dnsRequestHandler(w http.ResponseWriter, r *http.Request) {
 	pendingDNSRequests.Set(float64(len(pendingRequests)))
 	pendingRequestsMu.Unlock()
 
-	log.Printf("[RequestID: %s] Received DNS request: %v", dnsReq.RequestID, dnsReq)
+	log.Printf("[RequestID: %s] Received DNS request: %s %s %s from %s", dnsReq.RequestID, dnsReq.Name, dnsReq.Type, dnsReq.Class, dnsReq.ClientIP)
 
-	// Await the player's action or timeout after 30 seconds.
+	// Wake any streaming players waiting for work.
+	signalNewRequest()
+
+	eventBus.Publish(events.Event{
+		Type:      events.RequestReceived,
+		RequestID: dnsReq.RequestID,
+		Domain:    dnsReq.Name,
+		Data:      map[string]string{"type": dnsReq.Type, "class": dnsReq.Class},
+	})
+
+	// Await the crowd's verdict, or the player's action or timeout after 30 seconds.
 	var action string
-	select {
-	case action = <-actionChan:
-		// Player provided an action.
-	case <-time.After(30 * time.Second):
-		// Timeout occurred; default to "correct" action.
-		action = "correct"
-		dnsReq.TimedOut = true // Mark the request as timed out
-		log.Printf("[RequestID: %s] DNS request timed out after 30 seconds", dnsReq.RequestID)
+	if dnsReq.ballot != nil {
+		action = awaitBallot(&dnsReq, actionChan)
+	} else {
+		action = awaitPlayerAction(&dnsReq, actionChan)
 	}
 
 	// Respond to the DNS plugin with the chosen action.
 	dnsResp := DNSResponse{Action: action}
+	if action == "corrupt" {
+		dnsResp.Answer = dnsReq.answer
+	}
 	json.NewEncoder(w).Encode(dnsResp)
 
 	// Record the request duration with the action label.
@@ -212,58 +295,347 @@ func dnsRequestHandler(w http.ResponseWriter, r *http.Request) {
 	// Do NOT call cleanupDNSRequest here. Allow the player additional time to submit their action.
 }
 
-// assignDNSRequestHandler assigns a pending DNS request to a player.
+// awaitPlayerAction waits for the assigned player's action, falling back to "correct" after RequestTimeout.
+func awaitPlayerAction(dnsReq *DNSRequest, actionChan chan string) string {
+	var action string
+	select {
+	case action = <-actionChan:
+		// Player provided an action.
+	case <-time.After(RequestTimeout):
+		// Timeout occurred; default to "correct" action.
+		action = "correct"
+		dnsReq.markTimedOut()
+		log.Printf("[RequestID: %s] DNS request timed out after 30 seconds", dnsReq.RequestID)
+
+		_, assignedTo := requestAssignee(dnsReq)
+		eventBus.Publish(events.Event{
+			Type:      events.RequestTimedOut,
+			RequestID: dnsReq.RequestID,
+			PlayerID:  assignedTo,
+			Domain:    dnsReq.Name,
+		})
+		var penalty []scoring.Award
+		if assignedTo != "" {
+			penalty = penalizeTimeout(assignedTo)
+			endAssignment(assignedTo, dnsReq.RequestID, outcomeTimedOut, time.Now())
+		}
+		recordDecision(dnsReq, assignedTo, action, true, time.Now(), penalty)
+		// Nobody earns an objective hold by letting a request expire.
+		trackObjectives(dnsReq, "", action, time.Now())
+	}
+	return action
+}
+
+// assignDNSRequestHandler assigns a pending DNS request to a player. The player is named by
+// the player_id query parameter, or on /v1 by the JSON body.
 func assignDNSRequestHandler(w http.ResponseWriter, r *http.Request) {
 	playerID := r.URL.Query().Get("player_id")
+	if isV1(r) {
+		var body client.AssignRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", errInvalidRequest)
+			return
+		}
+		playerID = body.PlayerID
+	}
 	if playerID == "" {
-		http.Error(w, "Missing player_id", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "missing_player_id", errMissingPlayerID)
+		return
+	}
+	if err := authenticatePlayer(r, playerID); err != nil {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	if err := allowCall("assign", playerID, clientIP(r)); err != nil {
+		writeError(w, r, http.StatusTooManyRequests, "rate_limited", err)
+		return
+	}
+
+	dnsReq, err := assignRequestToPlayer(playerID)
+	switch err {
+	case nil:
+	case errInvalidPlayer:
+		writeError(w, r, http.StatusBadRequest, "invalid_player", errors.New("Invalid player_id"))
+		return
+	case errPlayerBanned:
+		writeError(w, r, http.StatusForbidden, "player_banned", err)
+		return
+	case errNoRequests:
+		if isV1(r) {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			http.Error(w, err.Error(), http.StatusNoContent)
+		}
+		return
+	case errShuttingDown:
+		w.Header().Set("Retry-After", "5")
+		writeError(w, r, http.StatusServiceUnavailable, "shutting_down", err)
+		return
+	default:
+		writeError(w, r, http.StatusGone, "request_expired", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if isV1(r) {
+		// Only what the player needs; the deprecated route keeps sending the whole request.
+		json.NewEncoder(w).Encode(client.Assignment{
+			RequestID: dnsReq.RequestID,
+			Name:      dnsReq.Name,
+			Type:      dnsReq.Type,
+			Class:     dnsReq.Class,
+			Timestamp: dnsReq.Timestamp,
+			Rules:     dnsReq.Rules,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(dnsReq.snapshot())
+}
+
+// submitActionHandler processes actions submitted by players.
+func submitActionHandler(w http.ResponseWriter, r *http.Request) {
+	var actionReq client.Action
+	if err := json.NewDecoder(r.Body).Decode(&actionReq); err != nil {
+		log.Printf("Failed to decode action request: %v", err)
+		writeError(w, r, http.StatusBadRequest, "invalid_request", errInvalidRequest)
+		return
+	}
+
+	if err := authenticatePlayer(r, actionReq.PlayerID); err != nil {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", err)
+		return
+	}
+	if err := allowCall("submit", actionReq.PlayerID, clientIP(r)); err != nil {
+		writeError(w, r, http.StatusTooManyRequests, "rate_limited", err)
+		return
+	}
+
+	awards, err := submitPlayerAction(actionReq.PlayerID, actionReq.RequestID, actionReq.Action)
+	if err == errActionNotAllowed || err == errPlayerBanned {
+		writeError(w, r, http.StatusForbidden, submitErrorCode(err), err)
+		return
+	} else if err != nil {
+		writeError(w, r, http.StatusBadRequest, submitErrorCode(err), err)
 		return
 	}
 
+	// Tell the player what they earned and why; a vote earns nothing until the ballot closes.
+	if awards == nil {
+		awards = []scoring.Award{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client.SubmitResult{Awards: awards})
+}
+
+// registerHandler handles player registration. The nickname and team come from the query
+// string, or on /v1 from the JSON body, which also gets the new session back as JSON.
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	registration := client.Registration{Nickname: r.URL.Query().Get("nickname"), Team: r.URL.Query().Get("team")}
+	if isV1(r) {
+		registration = client.Registration{}
+		if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_request", errInvalidRequest)
+			return
+		}
+	}
+
+	// Check the nickname up front so a bad one doesn't cost a session; it is checked again when claimed.
+	playersMu.RLock()
+	nickname, err := checkNickname("", registration.Nickname)
+	playersMu.RUnlock()
+	if err != nil {
+		writeError(w, r, nicknameErrorStatus(err), nicknameErrorCode(err), err)
+		return
+	}
+	teamID := registration.Team
+	if teamID != "" && !teamExists(teamID) {
+		writeError(w, r, http.StatusBadRequest, "invalid_team", errInvalidTeam)
+		return
+	}
+
+	playerID := generatePlayerID()
+
+	// Issue the player's secret session token before they exist anywhere else.
+	token, expiresAt, err := createSession(playerID)
+	if err != nil {
+		log.Printf("Failed to create session for player %s: %v", playerID, err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", errRegisterFailed)
+		return
+	}
+
+	// Hold the nickname while the player is written, unless someone claimed it in the meantime.
+	player := &Player{ID: playerID}
+	playersMu.Lock()
+	if _, err := checkNickname(playerID, nickname); err != nil {
+		playersMu.Unlock()
+		writeError(w, r, nicknameErrorStatus(err), nicknameErrorCode(err), err)
+		return
+	}
+	claimNickname(player, nickname)
+	playersMu.Unlock()
+
+	// Persist the player before anyone can see them, so a registration that succeeds survives a
+	// restart. If the database is busy or down, the player is told to try again instead.
+	if err := db.CreatePlayerContext(r.Context(), playerID, nickname); err != nil {
+		log.Printf("Failed to persist player %s: %v", playerID, err)
+		playersMu.Lock()
+		releaseNickname(player)
+		playersMu.Unlock()
+		hash := hashSessionToken(token)
+		sessionCache.Delete(hash)
+		if err := db.DeleteSession(hash); err != nil {
+			log.Printf("Failed to revoke session for player %s: %v", playerID, err)
+		}
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, http.StatusServiceUnavailable, "unavailable", errRegisterUnavailable)
+		return
+	}
+
+	// Store the player in memory.
+	playersMu.Lock()
+	players[playerID] = player
+	rankPlayer(player)
+	playerCount.Set(float64(len(players)))
+	playersMu.Unlock()
+
+	log.Printf("Registered player: %s (%s)", nickname, playerID)
+
+	// Put the player on their chosen team, if they picked one.
+	if teamID != "" {
+		if err := joinTeam(r.Context(), playerID, teamID); err != nil {
+			log.Printf("Failed to add player %s to team %s: %v", playerID, teamID, err)
+		}
+	}
+
+	eventBus.Publish(events.Event{
+		Type:     events.PlayerRegistered,
+		PlayerID: playerID,
+		Data:     map[string]string{"nickname": nickname},
+	})
+
+	w.Header().Set(SessionTokenHeader, token)
+	w.Header().Set(SessionExpiresHeader, expiresAt.UTC().Format(time.RFC3339))
+	if isV1(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(client.Session{PlayerID: playerID, Token: token, ExpiresAt: expiresAt.UTC()})
+		return
+	}
+	w.Write([]byte(playerID))
+}
+
+// pageBounds returns the slice bounds of a 1-based page, or an empty range past the end.
+func pageBounds(length, page, pageSize int) (int, int) {
+	startIndex := (page - 1) * pageSize
+	endIndex := startIndex + pageSize
+	if startIndex >= length {
+		return 0, 0
+	} else if endIndex > length {
+		endIndex = length
+	}
+	return startIndex, endIndex
+}
+
+//////////////////////////////////////////
+// Helper Functions for Handlers
+//////////////////////////////////////////
+
+// Errors returned by the shared assignment and submission paths. Their messages are
+// surfaced to players verbatim by both the HTTP handlers and the stream.
+var (
+	errInvalidPlayer   = errors.New("Invalid player ID")
+	errNoRequests      = errors.New("No DNS requests available")
+	errRequestTooOld   = errors.New("DNS request has timed out or is too old")
+	errRequestHandled  = errors.New("The DNS request has expired or was already handled.")
+	errRequestMismatch = errors.New("Invalid request_id for this player")
+	errRequestExpired  = errors.New("The DNS request has expired.")
+	errInvalidAction   = errors.New("Invalid action")
+
+	errRegisterFailed      = errors.New("Failed to register player")
+	errRegisterUnavailable = errors.New("Failed to register player, please try again")
+)
+
+// submitErrorCode picks the /v1 error code for an error from submitPlayerAction.
+func submitErrorCode(err error) string {
+	switch err {
+	case errActionNotAllowed:
+		return "action_not_allowed"
+	case errPlayerBanned:
+		return "player_banned"
+	case errInvalidAction:
+		return "invalid_action"
+	case errInvalidPlayer:
+		return "invalid_player"
+	case errRequestTooOld, errRequestExpired:
+		return "request_expired"
+	case errRequestHandled:
+		return "request_handled"
+	case errRequestMismatch:
+		return "request_mismatch"
+	case errVotingClosed:
+		return "voting_closed"
+	case errAlreadyVoted:
+		return "already_voted"
+	}
+	return "invalid_request"
+}
+
+// validActions lists the actions a player may choose for a DNS request.
+var validActions = map[string]bool{
+	client.ActionCorrect:  true,
+	client.ActionCorrupt:  true,
+	client.ActionDelay:    true,
+	client.ActionNXDomain: true,
+}
+
+// assignRequestToPlayer returns the player's still-valid assignment or assigns them the next pending DNS request.
+func assignRequestToPlayer(playerID string) (*DNSRequest, error) {
+	if shuttingDown.Load() {
+		return nil, errShuttingDown
+	}
 	playersMu.Lock()
 	player, exists := players[playerID]
 	if !exists {
 		playersMu.Unlock()
-		http.Error(w, "Invalid player_id", http.StatusBadRequest)
-		return
+		return nil, errInvalidPlayer
+	}
+	if player.Banned {
+		playersMu.Unlock()
+		return nil, errPlayerBanned
 	}
 
-	// Check if the player already has an assigned request.
+	// Check if the player already has an assigned request, which may have been restored from the
+	// database after a restart, and hand it back if it's still valid.
 	if player.AssignedRequestID != "" {
 		dnsRequestsMu.RLock()
 		dnsReq, exists := dnsRequests[player.AssignedRequestID]
 		dnsRequestsMu.RUnlock()
-		if exists && dnsReq.Assigned && !dnsReq.TimedOut {
+		if exists && !dnsReq.timedOut() && dnsReq.isAssigned() {
 			// Check if the assigned request has sufficient remaining time.
-			remainingTime := 30*time.Second - time.Since(dnsReq.Timestamp)
-			if remainingTime > MinimumRemainingTime {
+			if assignable(dnsReq, time.Now()) {
 				log.Printf("[PlayerID: %s] Already assigned request %s", playerID, dnsReq.RequestID)
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(dnsReq)
 				playersMu.Unlock()
-				return
+				return dnsReq, nil
 			}
 		}
 		// Clear the assigned request if it's no longer valid or has timed out.
 		log.Printf("[PlayerID: %s] Clearing expired or invalid assigned request %s", playerID, player.AssignedRequestID)
+		endAssignment(playerID, player.AssignedRequestID, releaseOutcome(dnsReq), time.Now())
 		player.AssignedRequestID = ""
 	}
 	playersMu.Unlock()
 
 	// Assign a new DNS request from the pendingRequests slice.
-	dnsReq := fetchPendingDNSRequest()
+	dnsReq := fetchPendingDNSRequest(playerID)
 	if dnsReq == nil {
 		log.Printf("[PlayerID: %s] No DNS requests available; cannot assign a DNS request", playerID)
-		http.Error(w, "No DNS requests available", http.StatusNoContent)
-		return
+		return nil, errNoRequests
 	}
 
 	// Double-check if the DNS request is still valid and has sufficient remaining time.
-	remainingTime := 30*time.Second - time.Since(dnsReq.Timestamp)
-	if dnsReq.TimedOut || remainingTime <= MinimumRemainingTime {
+	if dnsReq.timedOut() || !assignable(dnsReq, time.Now()) {
 		log.Printf("[RequestID: %s] DNS request has timed out or is too old; cannot assign to player %s", dnsReq.RequestID, playerID)
-		http.Error(w, "DNS request has timed out or is too old", http.StatusGone)
-		return
+		return nil, errRequestTooOld
 	}
 
 	// Assign the DNS request to the player.
@@ -271,200 +643,194 @@ func assignDNSRequestHandler(w http.ResponseWriter, r *http.Request) {
 	player, exists = players[playerID]
 	if !exists {
 		playersMu.Unlock()
-		http.Error(w, "Invalid player_id", http.StatusBadRequest)
-		return
+		return nil, errInvalidPlayer
 	}
+	pendingRequestsMu.Lock()
 	dnsReq.Assigned = true
+	if dnsReq.ballot == nil {
+		// Voted requests are shared by many players, so nobody owns them.
+		dnsReq.AssignedTo = playerID
+	}
+	pendingRequestsMu.Unlock()
 	player.AssignedRequestID = dnsReq.RequestID
 	log.Printf("[PlayerID: %s] Assigned request %s", playerID, dnsReq.RequestID)
 	playersMu.Unlock()
+	assignedAt := time.Now()
+	startAssignment(playerID, dnsReq, assignedAt)
+	observeAssignment(playerID, dnsReq.RequestID, assignedAt)
+
+	eventBus.Publish(events.Event{
+		Type:      events.RequestAssigned,
+		RequestID: dnsReq.RequestID,
+		PlayerID:  playerID,
+		Domain:    dnsReq.Name,
+	})
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(dnsReq)
+	return dnsReq, nil
 }
 
-// submitActionHandler processes actions submitted by players.
-func submitActionHandler(w http.ResponseWriter, r *http.Request) {
-	var actionReq struct {
-		PlayerID  string `json:"player_id"`
-		RequestID string `json:"request_id"`
-		Action    string `json:"action"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&actionReq); err != nil {
-		log.Printf("Failed to decode action request: %v", err)
-		http.Error(w, "Invalid request data.", http.StatusBadRequest)
-		return
+// submitPlayerAction validates a player's action for their assigned DNS request, applies it and returns the points it earned.
+func submitPlayerAction(playerID, requestID, action string) ([]scoring.Award, error) {
+	if !validActions[action] {
+		log.Printf("Invalid action '%s' submitted by player %s", action, playerID)
+		return nil, errInvalidAction
 	}
 
 	// Validate the player.
 	playersMu.RLock()
-	player, exists := players[actionReq.PlayerID]
+	player, exists := players[playerID]
+	var assignedRequestID string
+	var banned bool
+	if exists {
+		assignedRequestID = player.AssignedRequestID
+		banned = player.Banned
+	}
 	playersMu.RUnlock()
 	if !exists {
-		log.Printf("Invalid player ID: %s", actionReq.PlayerID)
-		http.Error(w, "Invalid player ID", http.StatusBadRequest)
-		return
+		log.Printf("Invalid player ID: %s", playerID)
+		return nil, errInvalidPlayer
+	}
+	if banned {
+		log.Printf("Banned player %s tried to submit an action", playerID)
+		return nil, errPlayerBanned
 	}
 
 	// Validate the assigned request.
-	assignedRequestID := player.AssignedRequestID
-	if assignedRequestID != actionReq.RequestID {
-		log.Printf("Player %s assigned request %s does not match submitted request %s", actionReq.PlayerID, assignedRequestID, actionReq.RequestID)
+	if assignedRequestID != requestID {
+		log.Printf("Player %s assigned request %s does not match submitted request %s", playerID, assignedRequestID, requestID)
 		if assignedRequestID == "" {
-			http.Error(w, "The DNS request has expired or was already handled.", http.StatusBadRequest)
-		} else {
-			http.Error(w, "Invalid request_id for this player", http.StatusBadRequest)
+			return nil, errRequestHandled
 		}
-		return
+		return nil, errRequestMismatch
 	}
 
 	// Validate the DNS request.
 	dnsRequestsMu.RLock()
-	dnsReq, exists := dnsRequests[actionReq.RequestID]
+	dnsReq, exists := dnsRequests[requestID]
 	dnsRequestsMu.RUnlock()
-	if !exists || !dnsReq.Assigned {
-		log.Printf("Invalid or unassigned DNS request: %s", actionReq.RequestID)
-		http.Error(w, "The DNS request has expired or was already handled.", http.StatusBadRequest)
-		return
+	if !exists || !dnsReq.isAssigned() {
+		log.Printf("Invalid or unassigned DNS request: %s", requestID)
+		return nil, errRequestHandled
 	}
 
 	// Check if the DNS request has timed out.
-	if dnsReq.TimedOut {
-		log.Printf("Player %s submitted action for timed-out request %s", actionReq.PlayerID, actionReq.RequestID)
-		http.Error(w, "The DNS request has expired.", http.StatusBadRequest)
-		return
+	if dnsReq.timedOut() {
+		log.Printf("Player %s submitted action for timed-out request %s", playerID, requestID)
+		return nil, errRequestExpired
 	}
 
-	// Update the player's score based on the submitted action.
-	updatePlayerScore(actionReq.PlayerID, actionReq.Action)
-
-	// Notify the DNS request handler of the player's action.
-	notifyDNSRequestHandler(actionReq.RequestID, actionReq.Action)
-
-	// Clear the player's assigned request.
-	clearPlayerAssignment(actionReq.PlayerID)
-
-	// Clean up the processed request.
-	cleanupDNSRequest(actionReq.RequestID, actionReq.Action)
-
-	log.Printf("Player %s submitted action '%s' for request %s", actionReq.PlayerID, actionReq.Action, actionReq.RequestID)
-
-	w.WriteHeader(http.StatusOK)
-}
-
-// registerHandler handles player registration.
-func registerHandler(w http.ResponseWriter, r *http.Request) {
-	nickname := r.URL.Query().Get("nickname")
-	if nickname == "" {
-		http.Error(w, "Nickname is required", http.StatusBadRequest)
-		return
-	}
-
-	playerID := generatePlayerID()
-
-	// Create a new player instance.
-	player := &Player{
-		ID:         playerID,
-		Nickname:   nickname,
-		PurePoints: 0,
-		EvilPoints: 0,
+	// Check the domain's current rules, in case an admin tightened them after the request was handed out.
+	if !rulesEngine.Evaluate(dnsReq.Name).Allows(action) {
+		log.Printf("Player %s tried restricted action '%s' on %s", playerID, action, dnsReq.Name)
+		return nil, errActionNotAllowed
 	}
 
-	// Store the player in memory.
-	playersMu.Lock()
-	players[playerID] = player
-	playerCount.Set(float64(len(players)))
-	playersMu.Unlock()
-
-	// Persist the new player to the database asynchronously.
-	go func() {
-		if err := db.CreatePlayer(playerID, nickname); err != nil {
-			log.Printf("Warning: Failed to persist player %s to database: %v", playerID, err)
+	// Requests decided by the crowd only take a vote; points are handed out once the ballot closes.
+	if dnsReq.ballot != nil {
+		if err := castVote(playerID, dnsReq, action); err != nil {
+			return nil, err
 		}
-	}()
-
-	log.Printf("Registered player: %s (%s)", nickname, playerID)
-	w.Write([]byte(playerID))
-}
-
-// leaderboardHandler returns the current leaderboard with pagination.
-func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
-	type LeaderboardEntry struct {
-		PlayerID     string  `json:"player_id"`
-		Nickname     string  `json:"nickname"`
-		PurePoints   float64 `json:"pure_points"`
-		EvilPoints   float64 `json:"evil_points"`
-		NetAlignment float64 `json:"net_alignment"`
-	}
-
-	// Parse pagination parameters.
-	page, err := strconv.Atoi(r.URL.Query().Get("page"))
-	if err != nil || page < 1 {
-		page = 1
+		clearPlayerAssignment(playerID, outcomeVoted)
+		touchPlayer(playerID, time.Now())
+		observeDecision(playerID, requestID, action, time.Now())
+		return nil, nil
 	}
-	pageSize := 50 // Fixed page size of 50 items.
 
-	playersMu.RLock()
-	defer playersMu.RUnlock()
+	decidedAt := time.Now()
 
-	var leaderboard []LeaderboardEntry
-	for _, player := range players {
-		leaderboard = append(leaderboard, LeaderboardEntry{
-			PlayerID:     player.ID,
-			Nickname:     player.Nickname,
-			PurePoints:   player.PurePoints,
-			EvilPoints:   player.EvilPoints,
-			NetAlignment: player.PurePoints - player.EvilPoints,
-		})
+	// Notify the DNS request handler of the player's action, unless an admin got there first.
+	if !notifyDNSRequestHandler(requestID, action) {
+		return nil, errRequestHandled
 	}
 
-	// Sort the leaderboard by total points in descending order.
-	sort.Slice(leaderboard, func(i, j int) bool {
-		totalI := leaderboard[i].PurePoints + leaderboard[i].EvilPoints
-		totalJ := leaderboard[j].PurePoints + leaderboard[j].EvilPoints
-		return totalI > totalJ
-	})
+	// Update the player's score based on the submitted action.
+	awards := scoreDecision(playerID, dnsReq, action, decidedAt)
 
-	// Calculate pagination bounds.
-	startIndex := (page - 1) * pageSize
-	endIndex := startIndex + pageSize
-	if startIndex >= len(leaderboard) {
-		startIndex = 0
-		endIndex = 0
-	} else if endIndex > len(leaderboard) {
-		endIndex = len(leaderboard)
-	}
+	// Clear the player's assigned request.
+	clearPlayerAssignment(playerID, outcomeDecided)
 
-	// Return the paginated leaderboard slice.
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(leaderboard[startIndex:endIndex])
+	// Clean up the processed request.
+	cleanupDNSRequest(requestID, action)
+
+	log.Printf("Player %s submitted action '%s' for request %s", playerID, action, requestID)
+	recordDecision(dnsReq, playerID, action, false, decidedAt, awards)
+	trackObjectives(dnsReq, playerID, action, decidedAt)
+	trackAchievements(dnsReq, playerID, action, decidedAt)
+	touchPlayer(playerID, decidedAt)
+	observeDecision(playerID, requestID, action, decidedAt)
+
+	eventBus.Publish(events.Event{
+		Type:      events.RequestDecided,
+		RequestID: requestID,
+		PlayerID:  playerID,
+		Domain:    dnsReq.Name,
+		Data: map[string]interface{}{
+			"action":     action,
+			"latency_ms": decidedAt.Sub(dnsReq.Timestamp).Milliseconds(),
+			"awards":     awards,
+		},
+	})
+	return awards, nil
 }
 
-//////////////////////////////////////////
-// Helper Functions for Handlers
-//////////////////////////////////////////
-
 // cleanupDNSRequest removes a processed DNS request from in-memory storage and updates metrics.
 func cleanupDNSRequest(requestID, action string) {
 	dnsRequestsMu.Lock()
+	dnsReq := dnsRequests[requestID]
 	delete(dnsRequests, requestID)
 	dnsRequestsMu.Unlock()
 
 	pendingActions.Delete(requestID)
 	removePendingRequest(requestID)
 
-	// Clear the player's assigned request if it matches this requestID.
+	// Clear the assigned request of every player holding this requestID (several when it was put to a vote).
+	now := time.Now()
 	playersMu.Lock()
 	for _, player := range players {
 		if player.AssignedRequestID == requestID {
 			player.AssignedRequestID = ""
+			endAssignment(player.ID, requestID, releaseOutcome(dnsReq), now)
 			log.Printf("Cleared AssignedRequestID for player %s because request %s was processed", player.ID, requestID)
-			break
 		}
 	}
 	playersMu.Unlock()
 }
 
+// requestAssignee reports whether a DNS request has been handed out and, unless it's voted on, to whom.
+func requestAssignee(dnsReq *DNSRequest) (bool, string) {
+	pendingRequestsMu.Lock()
+	defer pendingRequestsMu.Unlock()
+	return dnsReq.Assigned, dnsReq.AssignedTo
+}
+
+// isAssigned reports whether a player has been handed the DNS request.
+func (r *DNSRequest) isAssigned() bool {
+	assigned, _ := requestAssignee(r)
+	return assigned
+}
+
+// timedOut reports whether the DNS request was answered with the fallback because nobody decided in time.
+func (r *DNSRequest) timedOut() bool {
+	pendingRequestsMu.Lock()
+	defer pendingRequestsMu.Unlock()
+	return r.TimedOut
+}
+
+// markTimedOut records that nobody decided the DNS request in time.
+func (r *DNSRequest) markTimedOut() {
+	pendingRequestsMu.Lock()
+	r.TimedOut = true
+	pendingRequestsMu.Unlock()
+}
+
+// snapshot copies a DNS request for encoding, so its assignment can't change halfway through.
+func (r *DNSRequest) snapshot() *DNSRequest {
+	pendingRequestsMu.Lock()
+	defer pendingRequestsMu.Unlock()
+	snapshot := *r
+	return &snapshot
+}
+
 // removePendingRequest removes a DNS request from the pendingRequests slice by RequestID.
 func removePendingRequest(requestID string) {
 	pendingRequestsMu.Lock()
@@ -479,15 +845,24 @@ func removePendingRequest(requestID string) {
 	}
 }
 
-// fetchPendingDNSRequest retrieves and removes the first unassigned DNS request from the pendingRequests slice.
-func fetchPendingDNSRequest() *DNSRequest {
+// fetchPendingDNSRequest retrieves the first DNS request the player can take from the pendingRequests slice.
+// Requests decided by a single player are removed; voted requests stay until the ballot has no seats left.
+func fetchPendingDNSRequest(playerID string) *DNSRequest {
 	pendingRequestsMu.Lock()
 	defer pendingRequestsMu.Unlock()
 
 	now := time.Now()
 	for i, req := range pendingRequests {
-		remainingTime := 30*time.Second - now.Sub(req.Timestamp)
-		if !req.Assigned && !req.TimedOut && remainingTime > MinimumRemainingTime {
+		if req.TimedOut || !assignable(req, now) {
+			continue
+		}
+		if req.ballot != nil {
+			if req.ballot.Assign(playerID) {
+				return req
+			}
+			continue
+		}
+		if !req.Assigned {
 			// Remove the request from the slice.
 			pendingRequests = append(pendingRequests[:i], pendingRequests[i+1:]...)
 			pendingDNSRequests.Set(float64(len(pendingRequests)))
@@ -497,44 +872,25 @@ func fetchPendingDNSRequest() *DNSRequest {
 	return nil
 }
 
-// updatePlayerScore updates the player's score based on the action taken.
-func updatePlayerScore(playerID, action string) {
-	playersMu.Lock()
-	defer playersMu.Unlock()
-
-	player, exists := players[playerID]
-	if !exists {
-		log.Printf("Player %s not found while updating score", playerID)
-		return
-	}
-
-	switch action {
-	case "correct":
-		player.PurePoints += 1
-		player.PureDelta += 1
-		playerActionCounter.With(prometheus.Labels{"action": "correct"}).Inc()
-	case "corrupt", "delay", "nxdomain":
-		player.EvilPoints += 1
-		player.EvilDelta += 1
-		playerActionCounter.With(prometheus.Labels{"action": action}).Inc()
-	default:
-		log.Printf("Invalid action '%s' submitted by player %s", action, playerID)
-	}
-}
-
 // notifyDNSRequestHandler sends the player's action back to the DNS request handler.
-func notifyDNSRequestHandler(requestID, action string) {
+// It reports false if the request already has an action waiting, so two deciders can't both win.
+func notifyDNSRequestHandler(requestID, action string) bool {
 	value, ok := pendingActions.Load(requestID)
-	if ok {
-		actionChan := value.(chan string)
-		actionChan <- action
-	} else {
+	if !ok {
 		log.Printf("Action channel not found for request %s", requestID)
+		return true
+	}
+	select {
+	case value.(chan string) <- action:
+		return true
+	default:
+		log.Printf("Request %s already has an action; dropping '%s'", requestID, action)
+		return false
 	}
 }
 
-// clearPlayerAssignment clears the assigned DNS request for a player.
-func clearPlayerAssignment(playerID string) {
+// clearPlayerAssignment clears the assigned DNS request for a player and records how their hold on it ended.
+func clearPlayerAssignment(playerID, outcome string) {
 	playersMu.Lock()
 	defer playersMu.Unlock()
 
@@ -543,9 +899,35 @@ func clearPlayerAssignment(playerID string) {
 		log.Printf("Player %s not found while clearing assignment", playerID)
 		return
 	}
+	endAssignment(playerID, player.AssignedRequestID, outcome, time.Now())
 	player.AssignedRequestID = ""
 }
 
+// loadPlayers loads every player from the database into memory, along with the request each one held.
+func loadPlayers() error {
+	dbPlayers, err := db.GetLeaderboard()
+	if err != nil {
+		return err
+	}
+	playersMu.Lock()
+	for _, p := range dbPlayers {
+		players[p.ID] = &Player{
+			ID:         p.ID,
+			Nickname:   p.Nickname,
+			PurePoints: p.PurePoints,
+			EvilPoints: p.EvilPoints,
+			LastActive: p.UpdatedAt,
+			// Restored so a player reconnecting after a restart gets their request back if it's
+			// still open; assignRequestToPlayer clears it otherwise.
+			AssignedRequestID: p.LastRequestID,
+		}
+	}
+	playerCount.Set(float64(len(players)))
+	playersMu.Unlock()
+	log.Printf("Loaded %d players from database", len(dbPlayers))
+	return nil
+}
+
 //////////////////////////////////////////
 // Background Goroutines
 //////////////////////////////////////////
@@ -574,84 +956,189 @@ func cleanupExpiredRequests() {
 	}
 }
 
-// syncPlayersToDatabase periodically syncs in-memory player data to SQLite.
-func syncPlayersToDatabase() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		playersMu.Lock()
-		for _, player := range players {
-			if player.PureDelta != 0 || player.EvilDelta != 0 {
-				if err := db.AddPlayerPoints(player.ID, player.PureDelta, player.EvilDelta); err != nil {
-					log.Printf("Error syncing player %s to database: %v", player.ID, err)
-				} else {
-					// Reset deltas after successful sync.
-					player.PureDelta = 0
-					player.EvilDelta = 0
-				}
-			}
-		}
-		playersMu.Unlock()
-		log.Printf("Synced player deltas to database")
-	}
-}
-
 //////////////////////////////////////////
 // Main Function
 //////////////////////////////////////////
 
 func main() {
-	// Retrieve the database path from environment variables or use the default.
-	dbPath := getEnv("DB_PATH", "/litefs/gameserver.db")
-
-	// Ensure the database directory exists.
-	dbDir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		log.Printf("Warning: Failed to create database directory: %v", err)
+	// `gameserver migrate` manages the schema and `gameserver export` dumps game data; both exit
+	// without starting the game.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:], os.Stdout))
+		case "export":
+			os.Exit(runExport(os.Args[2:], os.Stdout, os.Stderr))
+		}
 	}
 
-	// Initialize the database connection.
-	if err := db.Initialize(dbPath); err != nil {
-		log.Printf("Warning: Failed to initialize database: %v", err)
+	// Initialize the database connection, creating the SQLite file and its directory if needed
+	// and applying any pending migrations. Running on a half-migrated schema would fail in odd ways.
+	if err := db.Initialize(databaseDSN(), databaseOptions()); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
 	// Load existing players from the database into memory.
-	dbPlayers, err := db.GetLeaderboard()
-	if err != nil {
+	if err := loadPlayers(); err != nil {
 		log.Printf("Warning: Failed to load players from database: %v", err)
-	} else {
-		playersMu.Lock()
-		for _, p := range dbPlayers {
-			players[p.ID] = &Player{
-				ID:         p.ID,
-				Nickname:   p.Nickname,
-				PurePoints: p.PurePoints,
-				EvilPoints: p.EvilPoints,
-			}
+	}
+	loadBans()
+	loadQuarantine()
+	loadRenames()
+	playersMu.Lock()
+	rebuildRankings()
+	playersMu.Unlock()
+
+	// Configure anti-cheat and which proxies may report client addresses.
+	if path := getEnv("ANTICHEAT_CONFIG", ""); path != "" {
+		cfg, err := anticheat.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load anti-cheat config %s: %v", path, err)
 		}
-		playerCount.Set(float64(len(players)))
-		playersMu.Unlock()
-		log.Printf("Loaded %d players from database", len(dbPlayers))
+		antiCheat = anticheat.NewDetector(cfg)
+		endpointLimits = newEndpointLimits(cfg)
+		log.Printf("Loaded anti-cheat config from %s", path)
+	}
+	if proxies, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		trustedProxies = parseCIDRs(proxies)
+	}
+
+	// Load the nickname policy, if configured, and index the nicknames already in use.
+	if path := getEnv("NICKNAME_CONFIG", ""); path != "" {
+		cfg, err := nicknames.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load nickname config %s: %v", path, err)
+		}
+		nicknamePolicy = nicknames.NewPolicy(cfg)
+		log.Printf("Loaded nickname config from %s", path)
+	}
+	indexNicknames()
+
+	// Load the scoring rules, if configured.
+	if path := getEnv("SCORING_CONFIG", ""); path != "" {
+		cfg, err := scoring.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load scoring config %s: %v", path, err)
+		}
+		setScoringEngine(scoring.NewEngine(cfg))
+		log.Printf("Loaded scoring config from %s", path)
+	}
+
+	// Load the domain rules, if configured.
+	if path := getEnv("RULES_CONFIG", ""); path != "" {
+		cfg, err := rules.LoadConfig(path)
+		if err == nil {
+			err = rulesEngine.Set(cfg)
+		}
+		if err != nil {
+			log.Fatalf("Failed to load domain rules %s: %v", path, err)
+		}
+		rulesConfigPath = path
+		log.Printf("Loaded %d domain rules from %s", len(cfg.Rules), path)
+	}
+
+	// Load the crowd voting config, if one is provided.
+	if path := getEnv("VOTING_CONFIG", ""); path != "" {
+		cfg, err := voting.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load voting config %s: %v", path, err)
+		}
+		setVotingConfig(cfg)
+		log.Printf("Loaded voting config from %s", path)
+	}
+
+	// Load teams and the objectives they can complete.
+	teamsConfig := teams.DefaultConfig()
+	if path := getEnv("TEAMS_CONFIG", ""); path != "" {
+		cfg, err := teams.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load teams config %s: %v", path, err)
+		}
+		teamsConfig = cfg
+		log.Printf("Loaded teams config from %s", path)
+	}
+	loadTeams(teamsConfig)
+	teamObjectives = teams.NewTracker(teamsConfig.Objectives)
+	go watchObjectives()
+
+	// Load the achievements players can unlock, if configured, and who already has them.
+	if path := getEnv("ACHIEVEMENTS_CONFIG", ""); path != "" {
+		cfg, err := achievements.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load achievements config %s: %v", path, err)
+		}
+		achievementTracker = achievements.NewTracker(cfg.Achievements)
+		log.Printf("Loaded achievements config from %s", path)
+	}
+	loadAchievements()
+
+	// Resume the current season and schedule rollovers and rounds, if configured.
+	adminToken = getEnv("ADMIN_TOKEN", "")
+	loadSeason()
+	if length := getEnvDuration("SEASON_LENGTH", 0); length > 0 {
+		go scheduleSeasons(length)
+	}
+	if length := getEnvDuration("ROUND_LENGTH", 0); length > 0 {
+		go runRounds(length, getEnvDuration("ROUND_PAUSE", 5*time.Minute))
 	}
 
 	// Start the periodic database synchronization.
-	go syncPlayersToDatabase()
+	go syncPlayersToDatabase(getEnvDuration("SCORE_SYNC_INTERVAL", defaultScoreSyncInterval))
+
+	// Configure session lifetime and start clearing out expired sessions.
+	sessionTTL = getEnvDuration("SESSION_TTL", sessionTTL)
+	go pruneSessions()
+
+	// Start the database job queue and decision history writer.
+	dbJobs = queue.NewJobQueue(getEnvInt("DB_JOB_QUEUE_SIZE", 1000), getEnvInt("DB_JOB_WORKERS", 1), handleDBJob)
+	decisionHistory = newDecisionBatcher(getEnvInt("DECISION_BATCH_SIZE", 100), dbJobs)
+	go decisionHistory.run(getEnvDuration("DECISION_FLUSH_INTERVAL", 5*time.Second))
+
+	// Prune old decisions unless retention is disabled with a zero duration.
+	if retention := getEnvDuration("DECISION_RETENTION", 30*24*time.Hour); retention > 0 {
+		go pruneDecisions(retention)
+	}
 
 	// Initialize the HTTP server multiplexer.
 	mux := http.NewServeMux()
 
 	// Register HTTP handlers.
 	mux.Handle("/metrics", promhttp.Handler())
-	mux.HandleFunc("/dnsrequest", dnsRequestHandler)
-	mux.HandleFunc("/submitaction", submitActionHandler)
-	mux.HandleFunc("/register", registerHandler)
-	mux.HandleFunc("/assign", assignDNSRequestHandler)
-	mux.HandleFunc("/leaderboard", leaderboardHandler)
+	registerAPIRoutes(mux)
+	mux.HandleFunc("/teams", teamsHandler)
+	mux.HandleFunc("/teams/", teamResourceHandler)
+	mux.HandleFunc("/seasons", seasonsHandler)
+	mux.HandleFunc("/seasons/rollover", seasonRolloverHandler)
+	mux.HandleFunc("/rounds", roundsHandler)
+	mux.HandleFunc("/admin/rules", adminRulesHandler)
+	mux.HandleFunc("/admin/", adminHandler)
+	mux.HandleFunc("/stream", streamHandler)
+	mux.HandleFunc("/events", eventsHandler)
+	mux.HandleFunc("/players/", playerResourceHandler)
+	mux.HandleFunc("/domains/", domainResourceHandler)
+	mux.HandleFunc("/stats/actions", actionStatsHandler)
+	mux.HandleFunc("/stats/domains/top", topDomainsHandler)
 
 	// Start the DNS request cleanup goroutine.
 	go cleanupExpiredRequests()
 
+	// Start watching the leaderboard for spectator events.
+	go watchLeaderboard()
+
+	// Run the game from a chat channel, if one is configured.
+	if addr := getEnv("CHAT_IRC_ADDR", ""); addr != "" {
+		bot := newChatBot(chat.Config{
+			Addr:      addr,
+			TLS:       getEnv("CHAT_IRC_TLS", "false") == "true",
+			Nick:      getEnv("CHAT_IRC_NICK", "dnsrp"),
+			Pass:      getEnv("CHAT_IRC_PASS", ""),
+			Channel:   getEnv("CHAT_IRC_CHANNEL", "#dnsrp"),
+			SendEvery: getEnvDuration("CHAT_SEND_INTERVAL", 1500*time.Millisecond),
+			SendBurst: getEnvInt("CHAT_SEND_BURST", 20),
+		}, getEnvDuration("CHAT_USER_COMMAND_INTERVAL", 2*time.Second), getEnvDuration("CHAT_COMMAND_INTERVAL", 20*time.Millisecond))
+		go bot.run(context.Background())
+	}
+
 	// Configure the HTTP server.
 	server := &http.Server{
 		Addr:         ":8080",
@@ -681,13 +1168,11 @@ func main() {
 	case sig := <-sigChan:
 		log.Printf("Received signal %v. Shutting down...", sig)
 
-		// Create a context with timeout for the shutdown process.
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-
-		// Attempt graceful shutdown.
-		if err := server.Shutdown(ctx); err != nil {
-			log.Fatalf("Could not gracefully shutdown the server: %v", err)
+		// Drain in-flight requests and write out everything held in memory, then close the database.
+		report := drain(server, getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+		if err := db.Close(); err != nil {
+			log.Printf("Warning: Failed to close database: %v", err)
 		}
+		logShutdown(report)
 	}
 }
@@ -1,21 +1,64 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nicewrld/gameserver/achievements"
+	"github.com/nicewrld/gameserver/anticheat"
+	"github.com/nicewrld/gameserver/chat"
+	"github.com/nicewrld/gameserver/client"
+	"github.com/nicewrld/gameserver/config"
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/events"
+	"github.com/nicewrld/gameserver/nicknames"
+	"github.com/nicewrld/gameserver/queue"
+	"github.com/nicewrld/gameserver/ratelimit"
+	"github.com/nicewrld/gameserver/rules"
+	"github.com/nicewrld/gameserver/scoring"
+	"github.com/nicewrld/gameserver/teams"
+	"github.com/nicewrld/gameserver/voting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
+// TestMain points the db package at a throwaway SQLite file so handlers that persist can run
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "gameserver-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := db.Initialize(filepath.Join(dir, "gameserver.db"), db.Options{}); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	db.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 // TestDNSRequestHandler tests the dnsRequestHandler function
 func TestDNSRequestHandler(t *testing.T) {
 	// Initialize necessary variables and state
 	dnsRequests = make(map[string]*DNSRequest)
 	pendingActions = sync.Map{}
-	dnsRequestChan = make(chan *DNSRequest, MaxDNSQueueSize)
 
 	// Create a sample DNSRequest
 	reqBody := DNSRequest{
@@ -105,6 +148,2633 @@ func TestRegisterHandler(t *testing.T) {
 	if player.Nickname != "TestPlayer" {
 		t.Errorf("Expected nickname 'TestPlayer', got '%s'", player.Nickname)
 	}
+
+	// Verify the issued session token authenticates as the new player
+	token := rr.Header().Get(SessionTokenHeader)
+	if token == "" {
+		t.Fatalf("Expected a session token header")
+	}
+	authed := httptest.NewRequest("GET", "/assign?player_id="+playerID, nil)
+	authed.Header.Set("Authorization", "Bearer "+token)
+	if err := authenticatePlayer(authed, playerID); err != nil {
+		t.Errorf("Expected session token to authenticate player: %v", err)
+	}
 }
 
-// Additional test functions for other handlers and functionalities can be added similarly
+// TestRegisterDatabaseFailure tests that a registration the database can't take is refused
+// rather than leaving a player who only exists until the next restart
+func TestRegisterDatabaseFailure(t *testing.T) {
+	players = make(map[string]*Player)
+	nicknameOwners = make(map[string]string)
+
+	// A request that is abandoned before the write stands in for a database that never answers.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rr := httptest.NewRecorder()
+	registerHandler(rr, httptest.NewRequest("GET", "/register?nickname=Unlucky", nil).WithContext(ctx))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 503 with Retry-After, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(players) != 0 || len(nicknameOwners) != 0 {
+		t.Errorf("Expected no player and no held nickname, got %v and %v", players, nicknameOwners)
+	}
+
+	// The nickname is free for the retry, which lands in the database.
+	rr = httptest.NewRecorder()
+	registerHandler(rr, httptest.NewRequest("GET", "/register?nickname=Unlucky", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected the retry to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if stored, err := db.GetPlayer(rr.Body.String()); err != nil || stored.Nickname != "Unlucky" {
+		t.Errorf("Expected the player in the database, got %+v (%v)", stored, err)
+	}
+}
+
+// TestDatabaseBusyTimeout tests that a write blocked by another connection's lock gives up after
+// the busy timeout instead of waiting forever, and goes through once the lock is released
+func TestDatabaseBusyTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "busy.db")
+	store, err := db.Open(path, db.Options{BusyTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	locker, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer locker.Close()
+	tx, err := locker.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO players (id, nickname) VALUES ('locker', 'locker')`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	if err := store.CreatePlayer(ctx, "blocked", "blocked"); err == nil {
+		t.Fatal("Expected the write to fail while the database is locked")
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond || waited > 5*time.Second {
+		t.Errorf("Expected to wait out the 100ms busy timeout, waited %v", waited)
+	}
+
+	tx.Rollback()
+	if err := store.CreatePlayer(ctx, "blocked", "blocked"); err != nil {
+		t.Errorf("Expected the write to go through once the lock is released, got %v", err)
+	}
+}
+
+// TestAssignRequiresSession tests that players cannot be assigned requests without their own session
+func TestAssignRequiresSession(t *testing.T) {
+	players = map[string]*Player{
+		"player-victim":   {ID: "player-victim", Nickname: "Victim"},
+		"player-attacker": {ID: "player-attacker", Nickname: "Attacker"},
+	}
+	attackerToken, _, err := createSession("player-attacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{"no token": "", "other player's token": attackerToken, "garbage": "not-a-token"} {
+		req := httptest.NewRequest("GET", "/assign?player_id=player-victim", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		assignDNSRequestHandler(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status %d, got %d", name, http.StatusUnauthorized, rr.Code)
+		}
+	}
+}
+
+// TestStreamHandler tests that a streaming player is pushed a new DNS request and can answer it on the same connection
+func TestStreamHandler(t *testing.T) {
+	dnsRequests = make(map[string]*DNSRequest)
+	players = map[string]*Player{"player-stream": {ID: "player-stream", Nickname: "Streamer"}}
+	pendingActions = sync.Map{}
+	pendingRequests = nil
+	token, _, err := createSession("player-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", streamHandler)
+	mux.HandleFunc("/dnsrequest", dnsRequestHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Connect before any DNS request exists so the assignment has to be pushed
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/stream?player_id=player-stream"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Submit a DNS request the way CoreDNS would
+	dnsResult := make(chan DNSResponse, 1)
+	go func() {
+		body, _ := json.Marshal(DNSRequest{Name: "example.com.", Type: "A", Class: "IN"})
+		resp, err := http.Post(server.URL+"/dnsrequest", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		var dnsResp DNSResponse
+		json.NewDecoder(resp.Body).Decode(&dnsResp)
+		dnsResult <- dnsResp
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var assignment StreamMessage
+	if err := conn.ReadJSON(&assignment); err != nil {
+		t.Fatal(err)
+	}
+	if assignment.Type != "assignment" || assignment.Request == nil || assignment.Request.Name != "example.com." {
+		t.Fatalf("Expected an assignment for example.com., got %+v", assignment)
+	}
+
+	action := StreamMessage{Type: "action", RequestID: assignment.Request.RequestID, Action: "nxdomain"}
+	if err := conn.WriteJSON(action); err != nil {
+		t.Fatal(err)
+	}
+
+	var result StreamMessage
+	if err := conn.ReadJSON(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Type != "result" || result.Error != "" {
+		t.Fatalf("Expected a successful result, got %+v", result)
+	}
+
+	select {
+	case resp := <-dnsResult:
+		if resp.Action != "nxdomain" {
+			t.Errorf("Expected action 'nxdomain', got '%s'", resp.Action)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("DNS request was not answered")
+	}
+}
+
+// TestEventsHandler tests that spectators only receive events matching their type and domain filters
+func TestEventsHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?type=request_received&domain=example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	// The subscription is registered before the headers are flushed
+	eventBus.Publish(events.Event{Type: events.RequestReceived, Domain: "other.org."})
+	eventBus.Publish(events.Event{Type: events.PlayerRegistered, PlayerID: "player-1"})
+	eventBus.Publish(events.Event{Type: events.RequestReceived, RequestID: "req-1", Domain: "www.example.com."})
+
+	lines := make(chan string, 64)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("Event stream closed before a matching event arrived")
+			}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var event events.Event
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatal(err)
+			}
+			if event.RequestID != "req-1" {
+				t.Fatalf("Received event that should have been filtered: %+v", event)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for event")
+		}
+	}
+}
+
+// TestHistoryHandlers tests that recorded decisions can be paged through and aggregated
+func TestHistoryHandlers(t *testing.T) {
+	dbJobs = queue.NewJobQueue(10, 1, handleDBJob)
+	decisionHistory = newDecisionBatcher(100, dbJobs)
+	defer func() { decisionHistory, dbJobs = nil, nil }()
+
+	now := time.Now()
+	for i, action := range []string{"corrupt", "correct", "corrupt"} {
+		recordDecision(&DNSRequest{
+			RequestID: fmt.Sprintf("req-history-%d", i),
+			Name:      "History.Example.",
+			Type:      "A",
+			Class:     "IN",
+			Timestamp: now.Add(-time.Second),
+		}, "player-history", action, false, now, nil)
+	}
+	recordDecision(&DNSRequest{RequestID: "req-history-other", Name: "other.example.", Type: "AAAA", Timestamp: now},
+		"player-history-other", "corrupt", false, now, nil)
+
+	// Flush and drain the queue so everything is in SQLite
+	decisionHistory.Flush()
+	dbJobs.Shutdown()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/players/", playerResourceHandler)
+	mux.HandleFunc("/domains/", domainResourceHandler)
+	mux.HandleFunc("/stats/domains/top", topDomainsHandler)
+
+	get := func(url string, v interface{}) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s returned %d: %s", url, rr.Code, rr.Body.String())
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Page through the player's history two at a time
+	var page HistoryPage
+	get("/players/player-history/history?limit=2", &page)
+	if len(page.Decisions) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected a full first page with a cursor, got %+v", page)
+	}
+	if page.Decisions[0].Name != "history.example" {
+		t.Errorf("Expected normalized name 'history.example', got '%s'", page.Decisions[0].Name)
+	}
+	var lastPage HistoryPage
+	get("/players/player-history/history?limit=2&cursor="+page.NextCursor, &lastPage)
+	if len(lastPage.Decisions) != 1 || lastPage.NextCursor != "" {
+		t.Fatalf("Expected a final page with one decision, got %+v", lastPage)
+	}
+
+	var domainPage HistoryPage
+	get("/domains/history.example/history?since=1h", &domainPage)
+	if len(domainPage.Decisions) != 3 {
+		t.Errorf("Expected 3 decisions for history.example, got %d", len(domainPage.Decisions))
+	}
+
+	var top []struct {
+		Domain string `json:"domain"`
+		Count  int64  `json:"count"`
+	}
+	get("/stats/domains/top?action=corrupt&since=today", &top)
+	if len(top) == 0 || top[0].Domain != "history.example" || top[0].Count != 2 {
+		t.Errorf("Expected history.example with 2 corruptions at the top, got %+v", top)
+	}
+}
+
+// TestSubmitActionScoring tests that submitted actions are scored by the configured rules and explained
+func TestSubmitActionScoring(t *testing.T) {
+	cfg := scoring.DefaultConfig()
+	cfg.Speed = scoring.SpeedRule{MaxBonus: 2, Window: config.Duration(RequestTimeout)}
+	cfg.QTypeWeights = map[string]float64{"AAAA": 2}
+	cfg.Categories = []scoring.CategoryRule{{Name: "banks", Patterns: []string{"*.bank.com"}, Weight: 3}}
+	scoringEngine = scoring.NewEngine(cfg)
+	defer func() { scoringEngine = scoring.NewEngine(scoring.DefaultConfig()) }()
+
+	dnsReq := &DNSRequest{
+		RequestID:  "req-scoring",
+		Name:       "www.bank.com.",
+		Type:       "AAAA",
+		Assigned:   true,
+		AssignedTo: "player-scoring",
+		Timestamp:  time.Now(),
+	}
+	dnsRequests = map[string]*DNSRequest{dnsReq.RequestID: dnsReq}
+	players = map[string]*Player{"player-scoring": {ID: "player-scoring", AssignedRequestID: dnsReq.RequestID}}
+	pendingActions = sync.Map{}
+	pendingActions.Store(dnsReq.RequestID, make(chan string, 1))
+
+	awards, err := submitPlayerAction("player-scoring", dnsReq.RequestID, "corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := make(map[string]float64)
+	for _, a := range awards {
+		if a.Alignment != scoring.Evil {
+			t.Errorf("Expected evil award, got %+v", a)
+		}
+		rules[a.Rule] = a.Points
+	}
+	// 1 base, doubled for AAAA, tripled for the bank, plus almost the full speed bonus
+	if rules["action:corrupt"] != 1 || rules["qtype:AAAA"] != 1 || rules["category:banks"] != 4 {
+		t.Errorf("Unexpected awards: %+v", awards)
+	}
+	if rules["speed"] < 1.9 {
+		t.Errorf("Expected a speed bonus close to 2, got %v", rules["speed"])
+	}
+
+	_, evil := scoring.Total(awards)
+	if players["player-scoring"].EvilPoints != evil {
+		t.Errorf("Expected player to have %v evil points, got %v", evil, players["player-scoring"].EvilPoints)
+	}
+}
+
+// TestCrowdVoting tests that a voted request is handed to several players and answered with the majority
+func TestCrowdVoting(t *testing.T) {
+	votingConfig = voting.Config{
+		Default: voting.Policy{Mode: voting.ModeSingle},
+		Domains: []voting.DomainPolicy{{
+			Pattern: "*.vote.example",
+			Policy:  voting.Policy{Mode: voting.ModeVote, Voters: 3, Quorum: 3, Deadline: config.Duration(10 * time.Second), Tally: voting.TallyMajority},
+		}},
+	}
+	defer func() { votingConfig = voting.DefaultConfig() }()
+
+	dnsRequests = make(map[string]*DNSRequest)
+	pendingRequests = nil
+	pendingActions = sync.Map{}
+	players = make(map[string]*Player)
+	for _, id := range []string{"voter-1", "voter-2", "voter-3", "voter-4"} {
+		players[id] = &Player{ID: id, Nickname: id}
+	}
+
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		body := strings.NewReader(`{"name":"www.vote.example.","type":"A","class":"IN"}`)
+		dnsRequestHandler(rr, httptest.NewRequest("POST", "/dnsrequest", body))
+	}()
+
+	// Wait for the request to be queued.
+	var dnsReq *DNSRequest
+	for i := 0; i < 100 && dnsReq == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		pendingRequestsMu.Lock()
+		if len(pendingRequests) > 0 {
+			dnsReq = pendingRequests[0]
+		}
+		pendingRequestsMu.Unlock()
+	}
+	if dnsReq == nil {
+		t.Fatal("DNS request was never queued")
+	}
+
+	// Three seats: the fourth player gets nothing.
+	for _, id := range []string{"voter-1", "voter-2", "voter-3"} {
+		got, err := assignRequestToPlayer(id)
+		if err != nil || got.RequestID != dnsReq.RequestID {
+			t.Fatalf("Expected %s to be handed the voted request, got %v, %v", id, got, err)
+		}
+	}
+	if _, err := assignRequestToPlayer("voter-4"); err != errNoRequests {
+		t.Fatalf("Expected no requests for a fourth voter, got %v", err)
+	}
+
+	if _, err := submitPlayerAction("voter-1", dnsReq.RequestID, "corrupt"); err != nil {
+		t.Fatal(err)
+	}
+	players["voter-1"].AssignedRequestID = dnsReq.RequestID
+	if _, err := submitPlayerAction("voter-1", dnsReq.RequestID, "corrupt"); err != errAlreadyVoted {
+		t.Errorf("Expected a second vote to be rejected, got %v", err)
+	}
+	submitPlayerAction("voter-2", dnsReq.RequestID, "corrupt")
+	submitPlayerAction("voter-3", dnsReq.RequestID, "correct")
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("DNS request handler did not return after quorum")
+	}
+
+	var resp DNSResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Action != "corrupt" {
+		t.Errorf("Expected the majority action 'corrupt', got '%s'", resp.Action)
+	}
+
+	playersMu.RLock()
+	defer playersMu.RUnlock()
+	if players["voter-1"].EvilPoints <= 0 || players["voter-2"].EvilPoints <= 0 {
+		t.Errorf("Expected the winning voters to score, got %+v and %+v", players["voter-1"], players["voter-2"])
+	}
+	if players["voter-3"].PurePoints != 0 {
+		t.Errorf("Expected the losing voter not to score, got %+v", players["voter-3"])
+	}
+	for id, p := range players {
+		if p.AssignedRequestID != "" {
+			t.Errorf("Expected %s's assignment to be cleared, got %s", id, p.AssignedRequestID)
+		}
+	}
+}
+
+// fakeIRCServer is a minimal in-process IRC server for chat tests.
+type fakeIRCServer struct {
+	ln    net.Listener
+	conn  net.Conn
+	lines chan string // lines the client sent, PONGs and PRIVMSGs included
+	ready chan struct{}
+}
+
+// newFakeIRCServer listens on a local port and welcomes the first client that logs in.
+func newFakeIRCServer(t *testing.T) *fakeIRCServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeIRCServer{ln: ln, lines: make(chan string, 100), ready: make(chan struct{})}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.conn = conn
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "NICK "):
+				fmt.Fprintf(conn, ":irc.test 001 %s :Welcome\r\n", strings.TrimPrefix(line, "NICK "))
+			case strings.HasPrefix(line, "JOIN "):
+				fmt.Fprintf(conn, "PING :irc.test\r\n")
+				close(s.ready)
+			}
+			s.lines <- line
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// send writes a raw line to the connected client.
+func (s *fakeIRCServer) send(line string) {
+	fmt.Fprintf(s.conn, "%s\r\n", line)
+}
+
+// expect waits for the client to send a line containing substr.
+func (s *fakeIRCServer) expect(t *testing.T, substr string) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-s.lines:
+			if strings.Contains(line, substr) {
+				return line
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for the client to send %q", substr)
+		}
+	}
+}
+
+// TestChatBot tests that chat commands decide the announced DNS request
+func TestChatBot(t *testing.T) {
+	dnsRequests = make(map[string]*DNSRequest)
+	pendingRequests = nil
+	pendingActions = sync.Map{}
+	players = make(map[string]*Player)
+
+	irc := newFakeIRCServer(t)
+	bot := newChatBot(chat.Config{Addr: irc.ln.Addr().String(), Nick: "dnsrp", Channel: "dnsrp"}, time.Hour, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bot.run(ctx)
+
+	select {
+	case <-irc.ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Bot never joined the channel")
+	}
+	irc.expect(t, "PONG :irc.test")
+
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		body := strings.NewReader(`{"name":"chat.example.","type":"A","class":"IN"}`)
+		dnsRequestHandler(rr, httptest.NewRequest("POST", "/dnsrequest", body))
+	}()
+	irc.expect(t, "PRIVMSG #dnsrp :DNS request: A chat.example")
+
+	irc.send("@display-name=Alice :alice!alice@chat.test PRIVMSG #dnsrp :!corrupt 10.0.0.1")
+	// Alice is rate limited; her second command must not count.
+	irc.send("@display-name=Alice :alice!alice@chat.test PRIVMSG #dnsrp :!correct")
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("DNS request handler did not get the chat's action")
+	}
+	var resp DNSResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Action != "corrupt" || resp.Answer != "10.0.0.1" {
+		t.Errorf("Expected corrupt to 10.0.0.1, got %+v", resp)
+	}
+	irc.expect(t, "A chat.example -> corrupt")
+
+	playersMu.RLock()
+	player, exists := players["chat-alice"]
+	playersMu.RUnlock()
+	if !exists || player.Nickname != "Alice" || player.EvilPoints <= 0 {
+		t.Errorf("Expected chat player Alice to be scored, got %+v", player)
+	}
+
+	limiter := ratelimit.New(time.Hour, 2)
+	if !limiter.Allow("bob") || !limiter.Allow("bob") || limiter.Allow("bob") || !limiter.Allow("carol") {
+		t.Error("Expected limiter to allow a burst of 2 per key")
+	}
+}
+
+// TestChatClaimReleased tests that a chat command whose action doesn't go through gives the request back
+func TestChatClaimReleased(t *testing.T) {
+	dnsRequests = make(map[string]*DNSRequest)
+	pendingActions = sync.Map{}
+	players = make(map[string]*Player)
+
+	playerID, err := chatPlayer(context.Background(), "Mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The request already has an action waiting, so the chatter's can't be delivered.
+	dnsReq := &DNSRequest{RequestID: "req-chat-lost", Name: "lost.example.", Type: "A", Timestamp: time.Now()}
+	dnsRequests[dnsReq.RequestID] = dnsReq
+	actionCh := make(chan string, 1)
+	actionCh <- "correct"
+	pendingActions.Store(dnsReq.RequestID, actionCh)
+	pendingRequests = []*DNSRequest{dnsReq}
+
+	if err := submitChatAction(playerID, dnsReq, "corrupt", "10.0.0.9"); err != errRequestHandled {
+		t.Fatalf("Expected errRequestHandled, got %v", err)
+	}
+	if assigned, to := requestAssignee(dnsReq); assigned || to != "" {
+		t.Errorf("Expected the claim to be undone, got assigned=%v to %q", assigned, to)
+	}
+	pendingRequestsMu.Lock()
+	queued, answer := len(pendingRequests) == 1 && pendingRequests[0] == dnsReq, dnsReq.answer
+	pendingRequestsMu.Unlock()
+	if !queued || answer != "" {
+		t.Errorf("Expected the request back in the queue without the chatter's answer, got queued=%v answer=%q", queued, answer)
+	}
+	playersMu.RLock()
+	held := players[playerID].AssignedRequestID
+	playersMu.RUnlock()
+	if held != "" {
+		t.Errorf("Expected the chatter to hold nothing, got %s", held)
+	}
+
+	// Actions the domain's rules forbid are turned down before anything is claimed.
+	rulesEngine = rules.NewEngine(actionNames)
+	if err := rulesEngine.Set(rules.Config{Rules: []rules.Rule{{Pattern: "lost.example", Allow: []string{"correct"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { rulesEngine = rules.NewEngine(actionNames) }()
+	if err := submitChatAction(playerID, dnsReq, "corrupt", "10.0.0.9"); err != errActionNotAllowed {
+		t.Errorf("Expected errActionNotAllowed, got %v", err)
+	}
+	if assigned, _ := requestAssignee(dnsReq); assigned {
+		t.Error("Expected a forbidden action not to claim the request")
+	}
+}
+
+// TestTeams tests joining a faction at registration, team scoring and the team leaderboard
+func TestTeams(t *testing.T) {
+	players = make(map[string]*Player)
+	dnsRequests = make(map[string]*DNSRequest)
+	pendingActions = sync.Map{}
+	loadTeams(teams.DefaultConfig())
+
+	rr := httptest.NewRecorder()
+	registerHandler(rr, httptest.NewRequest("GET", "/register?nickname=Villain&team=evil", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	playerID := rr.Body.String()
+	token := rr.Header().Get(SessionTokenHeader)
+	if players[playerID].TeamID != "evil" {
+		t.Fatalf("Expected player to be on team evil, got %q", players[playerID].TeamID)
+	}
+
+	rr = httptest.NewRecorder()
+	registerHandler(rr, httptest.NewRequest("GET", "/register?nickname=Lost&team=nope", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown team, got %d", rr.Code)
+	}
+
+	dnsReq := &DNSRequest{RequestID: "req-team", Name: "team.example.", Type: "A", Assigned: true, AssignedTo: playerID, Timestamp: time.Now()}
+	dnsRequests[dnsReq.RequestID] = dnsReq
+	players[playerID].AssignedRequestID = dnsReq.RequestID
+	pendingActions.Store(dnsReq.RequestID, make(chan string, 1))
+	if _, err := submitPlayerAction(playerID, dnsReq.RequestID, "corrupt"); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	leaderboardHandler(rr, httptest.NewRequest("GET", "/leaderboard?scope=team", nil))
+	var board []TeamView
+	if err := json.NewDecoder(rr.Body).Decode(&board); err != nil {
+		t.Fatal(err)
+	}
+	if len(board) < 2 || board[0].ID != "evil" || board[0].EvilPoints <= 0 || board[0].Members != 1 {
+		t.Errorf("Expected team evil to lead with one member, got %+v", board)
+	}
+
+	// Custom teams need a session and a unique name.
+	create := func(name string) int {
+		req := httptest.NewRequest("POST", "/teams?player_id="+playerID+"&name="+name, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		teamsHandler(rr, req)
+		return rr.Code
+	}
+	if code := create("Goblins"); code != http.StatusCreated {
+		t.Errorf("Expected 201 creating a team, got %d", code)
+	}
+	if code := create("goblins"); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate team name, got %d", code)
+	}
+	if players[playerID].TeamID == "evil" {
+		t.Error("Expected the team's creator to join it")
+	}
+	members, err := db.GetTeamMembers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if teamID := players[playerID].TeamID; members[playerID] != teamID {
+		t.Errorf("Expected the creator's membership of %s to be saved, got %q", teamID, members[playerID])
+	}
+
+	// Holding an objective: a rival's call breaks the hold, and the clock starts over.
+	start := time.Now()
+	tracker := teams.NewTracker([]teams.Objective{{
+		ID: "guard", Domain: "example.com", Action: "correct", Hold: config.Duration(time.Hour), Points: 10, Alignment: "pure",
+	}})
+	tracker.Observe("pure", "example.com", "correct", start)
+	tracker.Observe("", "example.com", "corrupt", start.Add(10*time.Minute))
+	tracker.Observe("pure", "example.com", "correct", start.Add(20*time.Minute))
+	if done := tracker.Check(start.Add(70 * time.Minute)); len(done) != 0 {
+		t.Errorf("Expected the broken hold not to complete, got %+v", done)
+	}
+	if done := tracker.Check(start.Add(80 * time.Minute)); len(done) != 1 || done[0].TeamID != "pure" {
+		t.Errorf("Expected team pure to complete the objective, got %+v", done)
+	}
+}
+
+// TestSeasonsAndRounds tests archiving a season on rollover and scoring a timed round
+func TestSeasonsAndRounds(t *testing.T) {
+	players = map[string]*Player{
+		"player-ace":   {ID: "player-ace", Nickname: "Ace", PurePoints: 10, EvilPoints: 5},
+		"player-deuce": {ID: "player-deuce", Nickname: "Deuce", PurePoints: 1},
+	}
+	loadSeason()
+	season := seasonNumber()
+
+	adminToken = "test-admin-token"
+	defer func() { adminToken = "" }()
+	rollover := func(token string) int {
+		req := httptest.NewRequest("POST", "/seasons/rollover", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		seasonRolloverHandler(rr, req)
+		return rr.Code
+	}
+	if code := rollover("wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without the admin token, got %d", code)
+	}
+	if code := rollover(adminToken); code != http.StatusOK {
+		t.Fatalf("Expected rollover to succeed, got %d", code)
+	}
+	if seasonNumber() != season+1 || players["player-ace"].PurePoints != 0 {
+		t.Fatalf("Expected season %d with points reset, got season %d and %+v", season+1, seasonNumber(), players["player-ace"])
+	}
+
+	rr := httptest.NewRecorder()
+	leaderboardHandler(rr, httptest.NewRequest("GET", fmt.Sprintf("/leaderboard?season=%d", season), nil))
+	var archived []StandingView
+	if err := json.NewDecoder(rr.Body).Decode(&archived); err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 2 || archived[0].PlayerID != "player-ace" || archived[0].Rank != 1 || archived[0].PurePoints != 10 {
+		t.Errorf("Expected Ace to top the archived season, got %+v", archived)
+	}
+	rr = httptest.NewRecorder()
+	leaderboardHandler(rr, httptest.NewRequest("GET", "/leaderboard?season=999", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown season, got %d", rr.Code)
+	}
+
+	round, err := startRound(100 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := startRound(time.Minute); err != errRoundRunning {
+		t.Errorf("Expected a second round to be refused, got %v", err)
+	}
+	playersMu.Lock()
+	applyAwards(players["player-deuce"], []scoring.Award{{Alignment: scoring.Evil, Points: 3}})
+	playersMu.Unlock()
+	time.Sleep(300 * time.Millisecond)
+
+	rounds, err := db.GetRounds(1, roundWinners)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rounds) != 1 || rounds[0].ID != round.ID || len(rounds[0].Winners) != 1 || rounds[0].Winners[0].PlayerID != "player-deuce" {
+		t.Errorf("Expected Deuce to win round %d, got %+v", round.ID, rounds)
+	}
+}
+
+// TestDomainRules tests that protected domains reject restricted actions and weighted actions score extra
+func TestDomainRules(t *testing.T) {
+	adminToken = "test-admin-token"
+	defer func() {
+		adminToken = ""
+		rulesEngine = rules.NewEngine(actionNames)
+	}()
+
+	put := func(body string) int {
+		req := httptest.NewRequest("PUT", "/admin/rules", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rr := httptest.NewRecorder()
+		adminRulesHandler(rr, req)
+		return rr.Code
+	}
+	if code := put(`{"rules":[{"pattern":"*.bank.com","allow":["launder"]}]}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown action, got %d", code)
+	}
+	if code := put(`{"rules":[{"pattern":"*.bank.com","allow":["correct"]},{"pattern":"ads.*","weights":{"corrupt":3}}]}`); code != http.StatusOK {
+		t.Fatalf("Expected rules to be accepted, got %d", code)
+	}
+
+	if v := rulesEngine.Evaluate("www.bank.com."); v.Allows("corrupt") || !v.Allows("correct") {
+		t.Errorf("Expected only correct on a bank domain, got %+v", v)
+	}
+
+	players = make(map[string]*Player)
+	dnsRequests = make(map[string]*DNSRequest)
+	pendingActions = sync.Map{}
+	submit := func(name string) (*httptest.ResponseRecorder, *DNSRequest) {
+		playerID := "player-rules-" + name
+		token, _, err := createSession(playerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dnsReq := &DNSRequest{RequestID: "req-" + name, Name: name, Type: "A", Assigned: true, AssignedTo: playerID, Timestamp: time.Now()}
+		dnsReq.Rules = rulesEngine.Evaluate(dnsReq.Name)
+		dnsRequests[dnsReq.RequestID] = dnsReq
+		players[playerID] = &Player{ID: playerID, AssignedRequestID: dnsReq.RequestID}
+		pendingActions.Store(dnsReq.RequestID, make(chan string, 1))
+
+		body := fmt.Sprintf(`{"player_id":%q,"request_id":%q,"action":"corrupt"}`, playerID, dnsReq.RequestID)
+		req := httptest.NewRequest("POST", "/submitaction", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		submitActionHandler(rr, req)
+		return rr, dnsReq
+	}
+
+	if rr, _ := submit("secure.bank.com."); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 corrupting a bank, got %d", rr.Code)
+	}
+
+	rr, _ := submit("ads.tracker.example.")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected corrupting an ad server to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result struct {
+		Awards []scoring.Award `json:"awards"`
+	}
+	json.NewDecoder(rr.Body).Decode(&result)
+	if _, evil := scoring.Total(result.Awards); evil != 3 {
+		t.Errorf("Expected 3 evil points for a 3x corruption, got %v from %+v", evil, result.Awards)
+	}
+}
+
+// Additional test functions for other handlers and functionalities can be added similarly
+
+// TestAdminAPI tests banning, point adjustments, force-resolving and pausing through /admin
+func TestAdminAPI(t *testing.T) {
+	adminToken = "test-admin-token"
+	defer func() { adminToken = "" }()
+
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set(AdminUserHeader, "mod-alice")
+		rr := httptest.NewRecorder()
+		adminHandler(rr, req)
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	adminHandler(rr, httptest.NewRequest("GET", "/admin/requests", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the admin token, got %d", rr.Code)
+	}
+
+	players = map[string]*Player{"player-cheat": {ID: "player-cheat", Nickname: "Cheat", EvilPoints: 100}}
+	rebuildRankings()
+	dnsRequests = make(map[string]*DNSRequest)
+	pendingRequests = nil
+	pendingActions = sync.Map{}
+	token, _, err := createSession("player-cheat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Banning needs a reason, then locks the player out and hides them.
+	if rr := call("POST", "/admin/players/player-cheat/ban", `{}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 banning without a reason, got %d", rr.Code)
+	}
+	if rr := call("POST", "/admin/players/player-cheat/ban", `{"reason":"scripted answers"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected ban to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	req := httptest.NewRequest("GET", "/assign?player_id=player-cheat", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	assignDNSRequestHandler(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 assigning to a banned player, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	leaderboardHandler(rr, httptest.NewRequest("GET", "/leaderboard", nil))
+	if strings.Contains(rr.Body.String(), "player-cheat") {
+		t.Errorf("Expected banned player to be hidden from the leaderboard, got %s", rr.Body.String())
+	}
+	if rr := call("POST", "/admin/players/player-cheat/unban", ``); rr.Code != http.StatusNoContent || players["player-cheat"].Banned {
+		t.Errorf("Expected unban to succeed, got %d", rr.Code)
+	}
+
+	// Point adjustments land on the player and in the audit trail.
+	if rr := call("POST", "/admin/players/player-cheat/points", `{"evil":-40,"reason":"refund abuse"}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected adjustment to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := players["player-cheat"].EvilPoints; got != 60 {
+		t.Errorf("Expected 60 evil points after adjustment, got %v", got)
+	}
+	rr = call("GET", "/admin/audit?target=player-cheat", ``)
+	var trail struct {
+		Entries []AuditView `json:"entries"`
+	}
+	json.NewDecoder(rr.Body).Decode(&trail)
+	if len(trail.Entries) != 3 || trail.Entries[0].Action != "adjust_points" || trail.Entries[2].Action != "ban" || trail.Entries[0].Actor != "mod-alice" {
+		t.Errorf("Expected adjust_points, unban, ban by mod-alice in the audit trail, got %+v", trail.Entries)
+	}
+
+	// Force-resolving answers the DNS request handler and can only happen once.
+	dnsReq := &DNSRequest{RequestID: "req-stuck", Name: "stuck.example.", Type: "A", Timestamp: time.Now()}
+	dnsRequests[dnsReq.RequestID] = dnsReq
+	actionChan := make(chan string, 1)
+	pendingActions.Store(dnsReq.RequestID, actionChan)
+	rr = call("GET", "/admin/requests", ``)
+	var listed []AdminRequestView
+	json.NewDecoder(rr.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].RequestID != "req-stuck" || !listed[0].Open {
+		t.Errorf("Expected the stuck request to be listed as open, got %+v", listed)
+	}
+	if rr := call("POST", "/admin/requests/req-stuck/resolve?action=nxdomain", ``); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected resolve to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if action := <-actionChan; action != "nxdomain" {
+		t.Errorf("Expected the handler to be told nxdomain, got %s", action)
+	}
+	if rr := call("POST", "/admin/requests/req-stuck/resolve", ``); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 resolving a request twice, got %d", rr.Code)
+	}
+
+	// While paused every DNS request is answered correct straight away.
+	if rr := call("POST", "/admin/pause", ``); rr.Code != http.StatusOK {
+		t.Fatalf("Expected pause to succeed, got %d", rr.Code)
+	}
+	defer gamePaused.Store(false)
+	rr = httptest.NewRecorder()
+	dnsRequestHandler(rr, httptest.NewRequest("POST", "/dnsrequest", strings.NewReader(`{"name":"paused.example.","type":"A","class":"IN"}`)))
+	var resp DNSResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Action != "correct" || len(dnsRequests) != 0 {
+		t.Errorf("Expected an immediate correct while paused, got %+v with %d requests held", resp, len(dnsRequests))
+	}
+	if rr := call("POST", "/admin/resume", ``); rr.Code != http.StatusNoContent || gamePaused.Load() {
+		t.Errorf("Expected resume to succeed, got %d", rr.Code)
+	}
+}
+
+// TestNicknames tests that nicknames are cleaned, filtered, unique across look-alikes and renamed with a cooldown
+func TestNicknames(t *testing.T) {
+	players = make(map[string]*Player)
+	nicknameOwners = make(map[string]string)
+	cfg := nicknames.DefaultConfig()
+	cfg.Blocked = []string{"badword"}
+	nicknamePolicy = nicknames.NewPolicy(cfg)
+	defer func() { nicknamePolicy = nicknames.NewPolicy(nicknames.DefaultConfig()) }()
+
+	register := func(nickname string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		registerHandler(rr, httptest.NewRequest("GET", "/register?nickname="+url.QueryEscape(nickname), nil))
+		return rr
+	}
+
+	rr := register("  Neo   One ")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected registration to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	playerID, token := rr.Body.String(), rr.Header().Get(SessionTokenHeader)
+	if got := players[playerID].Nickname; got != "Neo One" {
+		t.Errorf("Expected the nickname to be tidied to 'Neo One', got %q", got)
+	}
+
+	for nickname, want := range map[string]int{
+		"NEO_ONE":               http.StatusConflict,   // case and punctuation
+		"Nеo One":               http.StatusConflict,   // cyrillic e
+		"ｎｅｏ ｏｎｅ":               http.StatusConflict,   // fullwidth
+		"N3o 0ne":               http.StatusConflict,   // leetspeak
+		"":                      http.StatusBadRequest, // empty
+		"x":                     http.StatusBadRequest, // too short
+		strings.Repeat("a", 25): http.StatusBadRequest, // too long
+		"bell\a":                http.StatusBadRequest, // control character
+		"<script>":              http.StatusBadRequest, // punctuation
+		"Adm1n":                 http.StatusBadRequest, // reserved
+		"xXBadW0rdXx":           http.StatusBadRequest, // blocked word
+	} {
+		if rr := register(nickname); rr.Code != want {
+			t.Errorf("Registering %q: expected %d, got %d: %s", nickname, want, rr.Code, rr.Body.String())
+		}
+	}
+
+	rename := func(nickname string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/players/"+playerID+"/nickname", strings.NewReader(fmt.Sprintf(`{"nickname":%q}`, nickname)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		playerResourceHandler(rr, req)
+		return rr
+	}
+	if rr := rename("Trinity"); rr.Code != http.StatusOK || players[playerID].Nickname != "Trinity" {
+		t.Fatalf("Expected rename to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := register("Neo One"); rr.Code != http.StatusOK {
+		t.Errorf("Expected the old nickname to be free again, got %d", rr.Code)
+	}
+	if rr := rename("Morpheus"); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a second rename to wait out the cooldown, got %d", rr.Code)
+	}
+
+	// Moderators skip the cooldown.
+	adminToken = "test-admin-token"
+	defer func() { adminToken = "" }()
+	req := httptest.NewRequest("POST", "/admin/players/"+playerID+"/rename", strings.NewReader(`{"nickname":"Morpheus"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr = httptest.NewRecorder()
+	adminHandler(rr, req)
+	if rr.Code != http.StatusNoContent || players[playerID].Nickname != "Morpheus" {
+		t.Errorf("Expected admin rename to skip the cooldown, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The cooldown comes back after a restart.
+	renamedAt := players[playerID].LastRenamedAt
+	players[playerID].LastRenamedAt = time.Time{}
+	loadRenames()
+	if got := players[playerID].LastRenamedAt; got.Sub(renamedAt).Abs() > time.Second {
+		t.Errorf("Expected the last rename at %v to be loaded, got %v", renamedAt, got)
+	}
+
+	// A rename that can't be saved is undone.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := renamePlayer(ctx, playerID, "Oracle", "admin"); err != errRenameFailed {
+		t.Errorf("Expected %v, got %v", errRenameFailed, err)
+	}
+	if got := players[playerID].Nickname; got != "Morpheus" {
+		t.Errorf("Expected the nickname to go back to Morpheus, got %q", got)
+	}
+	if owner := nicknameOwners[nicknames.Key("Morpheus")]; owner != playerID {
+		t.Errorf("Expected Morpheus to still belong to %s, got %q", playerID, owner)
+	}
+	if _, taken := nicknameOwners[nicknames.Key("Oracle")]; taken {
+		t.Error("Expected Oracle to be free again")
+	}
+	players[playerID].LastRenamedAt = time.Time{}
+	if _, _, err := renamePlayer(ctx, playerID, "Oracle", ""); err != errRenameFailed || !players[playerID].LastRenamedAt.IsZero() {
+		t.Errorf("Expected a failed self rename not to start the cooldown, got %v", err)
+	}
+}
+
+// TestAntiCheat tests rate limits, bot detection and quarantine from the leaderboard
+func TestAntiCheat(t *testing.T) {
+	cfg := anticheat.DefaultConfig()
+	cfg.QuarantineScore = 3
+	antiCheat = anticheat.NewDetector(cfg)
+	endpointLimits = newEndpointLimits(cfg)
+	defer func() {
+		antiCheat = anticheat.NewDetector(anticheat.DefaultConfig())
+		endpointLimits = newEndpointLimits(anticheat.DefaultConfig())
+	}()
+
+	players = map[string]*Player{
+		"player-bot":   {ID: "player-bot", Nickname: "Bot", PurePoints: 500},
+		"player-clone": {ID: "player-clone", Nickname: "Clone", PurePoints: 400},
+		"player-human": {ID: "player-human", Nickname: "Human", PurePoints: 10},
+	}
+	rebuildRankings()
+	dnsRequests = make(map[string]*DNSRequest)
+	pendingRequests = nil
+
+	// Hammering assign runs into the per-player limit after the burst.
+	token, _, err := createSession("player-human")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := 0
+	for i := 0; i < cfg.Assign.Burst+2; i++ {
+		req := httptest.NewRequest("GET", "/assign?player_id=player-human", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		assignDNSRequestHandler(rr, req)
+		if rr.Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited != 2 {
+		t.Errorf("Expected 2 assign calls over the burst to be limited, got %d", limited)
+	}
+
+	// X-Forwarded-For is only believed from a trusted proxy.
+	req := httptest.NewRequest("GET", "/assign", nil)
+	req.RemoteAddr = "172.18.0.5:41234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 172.18.0.4")
+	if ip := clientIP(req); ip != "203.0.113.9" {
+		t.Errorf("Expected the client address behind the proxy, got %s", ip)
+	}
+	req.RemoteAddr = "198.51.100.7:41234"
+	if ip := clientIP(req); ip != "198.51.100.7" {
+		t.Errorf("Expected a forged X-Forwarded-For to be ignored, got %s", ip)
+	}
+
+	// Two accounts playing the same mixed script, instantly, get flagged and quarantined.
+	script := []string{"corrupt", "delay", "corrupt", "nxdomain", "corrupt", "correct"}
+	start := time.Now()
+	for i := 0; i < cfg.SequenceLength; i++ {
+		for j, playerID := range []string{"player-bot", "player-clone"} {
+			requestID := fmt.Sprintf("req-script-%d-%d", i, j)
+			at := start.Add(time.Duration(i) * 700 * time.Millisecond)
+			observeAssignment(playerID, requestID, at)
+			observeDecision(playerID, requestID, script[i%len(script)], at.Add(20*time.Millisecond))
+		}
+	}
+	report := antiCheat.Report("player-bot", time.Now())
+	if report.Signals[anticheat.SignalFast] == 0 || report.Signals[anticheat.SignalRegular] == 0 || report.Signals[anticheat.SignalSequence] == 0 {
+		t.Errorf("Expected fast, regular and shared sequence signals, got %+v", report)
+	}
+	if !players["player-bot"].Quarantined || !players["player-clone"].Quarantined || players["player-human"].Quarantined {
+		t.Fatalf("Expected both scripted accounts and only them to be quarantined")
+	}
+	rr := httptest.NewRecorder()
+	leaderboardHandler(rr, httptest.NewRequest("GET", "/leaderboard", nil))
+	if body := rr.Body.String(); strings.Contains(body, "player-bot") || !strings.Contains(body, "player-human") {
+		t.Errorf("Expected quarantined players to be hidden from the leaderboard, got %s", body)
+	}
+
+	// Admins see the suspects and can release them after review.
+	adminToken = "test-admin-token"
+	defer func() { adminToken = "" }()
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rr := httptest.NewRecorder()
+		adminHandler(rr, req)
+		return rr
+	}
+	var suspects []SuspectView
+	json.NewDecoder(admin("GET", "/admin/suspects").Body).Decode(&suspects)
+	if len(suspects) != 3 || !suspects[0].Quarantined || suspects[0].Score < cfg.QuarantineScore {
+		t.Errorf("Expected both bots (and the rate limited human) as suspects, got %+v", suspects)
+	}
+	if rr := admin("POST", "/admin/players/player-clone/release"); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected release to succeed, got %d", rr.Code)
+	}
+	if players["player-clone"].Quarantined || antiCheat.Report("player-clone", time.Now()).Score != 0 {
+		t.Errorf("Expected a released player to be back on the leaderboard with a clean slate")
+	}
+}
+
+// TestLeaderboard tests leaderboard sorting, paging, search, time windows and player ranks
+func TestLeaderboard(t *testing.T) {
+	players = map[string]*Player{
+		"lb-saint":  {ID: "lb-saint", Nickname: "Saint", PurePoints: 90, EvilPoints: 0},
+		"lb-sinner": {ID: "lb-sinner", Nickname: "Sinner", PurePoints: 0, EvilPoints: 80},
+		"lb-grey":   {ID: "lb-grey", Nickname: "Grey Saint", PurePoints: 50, EvilPoints: 45},
+		"lb-banned": {ID: "lb-banned", Nickname: "Banned", PurePoints: 999, Banned: true},
+	}
+	rebuildRankings()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		if strings.HasPrefix(path, "/leaderboard/rank") {
+			leaderboardRankHandler(rr, httptest.NewRequest("GET", path, nil))
+		} else {
+			leaderboardHandler(rr, httptest.NewRequest("GET", path, nil))
+		}
+		return rr
+	}
+	board := func(path string) []string {
+		rr := get(path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+		var entries []LeaderboardEntry
+		json.NewDecoder(rr.Body).Decode(&entries)
+		var ids []string
+		for i, entry := range entries {
+			ids = append(ids, fmt.Sprintf("%d:%s", entry.Rank, entry.PlayerID))
+			if i > 0 && entry.Rank <= entries[i-1].Rank {
+				t.Errorf("%s: expected ranks to increase, got %+v", path, entries)
+			}
+		}
+		return ids
+	}
+	expect := func(path string, want ...string) {
+		t.Helper()
+		if got := board(path); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+
+	// Each sort orders the board differently, and banned players never show up.
+	expect("/leaderboard", "1:lb-grey", "2:lb-saint", "3:lb-sinner")
+	expect("/leaderboard?sort=pure", "1:lb-saint", "2:lb-grey", "3:lb-sinner")
+	expect("/leaderboard?sort=evil", "1:lb-sinner", "2:lb-grey", "3:lb-saint")
+	expect("/leaderboard?sort=net", "1:lb-saint", "2:lb-grey", "3:lb-sinner")
+	expect("/leaderboard?page_size=2&page=2", "3:lb-sinner")
+	expect("/leaderboard?q=saint&sort=pure", "1:lb-saint", "2:lb-grey")
+	if rr := get("/leaderboard?sort=nope"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown sort to be rejected, got %d", rr.Code)
+	}
+
+	// Points and activity move players without a full re-sort.
+	playersMu.Lock()
+	applyAwards(players["lb-sinner"], []scoring.Award{{Rule: "test", Alignment: scoring.Evil, Points: 100}})
+	playersMu.Unlock()
+	touchPlayer("lb-saint", time.Now())
+	expect("/leaderboard?page_size=1", "1:lb-sinner")
+	expect("/leaderboard?sort=recent&page_size=1", "1:lb-saint")
+
+	var rank RankView
+	rr := get("/leaderboard/rank?player_id=lb-saint&sort=evil")
+	json.NewDecoder(rr.Body).Decode(&rank)
+	if rr.Code != http.StatusOK || rank.Rank != 3 || rank.Ranked != 3 {
+		t.Errorf("Expected Saint to rank 3rd of 3 for evil, got %d %+v", rr.Code, rank)
+	}
+	if rr := get("/leaderboard/rank?player_id=lb-banned"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected banned players to have no rank, got %d", rr.Code)
+	}
+
+	// Today's board only counts awards stored today.
+	now := time.Now()
+	for _, id := range []string{"lb-saint", "lb-sinner", "lb-grey"} {
+		if err := db.CreatePlayer(id, players[id].Nickname); err != nil {
+			t.Fatal(err)
+		}
+	}
+	award := func(playerID, alignment string, points float64, at time.Time) db.Decision {
+		return db.Decision{RequestID: "req-" + playerID, PlayerID: playerID, CreatedAt: at,
+			Awards: []db.Award{{Rule: "test", Alignment: alignment, Points: points}}}
+	}
+	decisions := []db.Decision{
+		award("lb-saint", "pure", 5, now),
+		award("lb-grey", "pure", 7, now),
+		award("lb-sinner", "evil", 500, now.AddDate(0, 0, -9)),
+	}
+	if err := db.InsertDecisions(decisions); err != nil {
+		t.Fatal(err)
+	}
+	expect("/leaderboard?window=today&q=saint", "1:lb-grey", "2:lb-saint")
+	rr = get("/leaderboard/rank?player_id=lb-saint&window=today&sort=pure")
+	json.NewDecoder(rr.Body).Decode(&rank)
+	if rr.Code != http.StatusOK || rank.Rank != 2 || rank.PurePoints != 5 {
+		t.Errorf("Expected Saint 2nd today with 5 points, got %d %+v", rr.Code, rank)
+	}
+	if rr := get("/leaderboard/rank?player_id=lb-sinner&window=week"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected awards from before the week to be left out, got %d", rr.Code)
+	}
+}
+
+// TestAchievements tests unlocking achievements from decisions, streaks, events and the achievements endpoint
+func TestAchievements(t *testing.T) {
+	achievementTracker = achievements.NewTracker(append(achievements.DefaultConfig().Achievements,
+		achievements.Definition{ID: "pure_streak_3", Name: "Three Good Deeds", Alignment: "pure", Streak: 3}))
+	defer func() { achievementTracker = achievements.NewTracker(achievements.DefaultConfig().Achievements) }()
+	rulesEngine = rules.NewEngine(actionNames)
+	if err := rulesEngine.Set(rules.Config{Rules: []rules.Rule{{Pattern: "*.bank.com", Allow: []string{"correct"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { rulesEngine = rules.NewEngine(actionNames) }()
+
+	players = map[string]*Player{"player-badges": {ID: "player-badges", Nickname: "Badges"}}
+	sub := eventBus.Subscribe(events.Filter{Types: map[events.Type]bool{events.AchievementUnlocked: true}, Player: "player-badges"}, 16)
+	defer sub.Close()
+
+	decide := func(requestID, name, qtype, action string, age time.Duration) {
+		t.Helper()
+		dnsReq := &DNSRequest{RequestID: requestID, Name: name, Type: qtype, Assigned: true, AssignedTo: "player-badges", Timestamp: time.Now().Add(-age)}
+		dnsRequests = map[string]*DNSRequest{requestID: dnsReq}
+		players["player-badges"].AssignedRequestID = requestID
+		pendingActions = sync.Map{}
+		pendingActions.Store(requestID, make(chan string, 1))
+		if _, err := submitPlayerAction("player-badges", requestID, action); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unlocked := func() []string {
+		var ids []string
+		for {
+			select {
+			case e := <-sub.C:
+				ids = append(ids, e.Data.(map[string]interface{})["achievement"].(string))
+			case <-time.After(100 * time.Millisecond):
+				return ids
+			}
+		}
+	}
+
+	// A slow corrupted AAAA unlocks the corruption badges but not the quick one.
+	decide("req-badge-1", "example.com.", "AAAA", "corrupt", 5*time.Second)
+	if got := strings.Join(unlocked(), ","); got != "first_corruption,corrupted_aaaa" {
+		t.Errorf("Expected the corruption achievements, got %s", got)
+	}
+
+	// Achievements are only unlocked once; streaks count decisions in a row.
+	decide("req-badge-2", "example.com.", "A", "corrupt", 5*time.Second)
+	decide("req-badge-3", "example.com.", "A", "correct", 5*time.Second)
+	decide("req-badge-4", "www.bank.com.", "A", "correct", time.Second)
+	if got := strings.Join(unlocked(), ","); got != "quick_draw,guardian" {
+		t.Errorf("Expected quick draw and guardian, got %s", got)
+	}
+	decide("req-badge-5", "example.com.", "A", "correct", 5*time.Second)
+	if got := strings.Join(unlocked(), ","); got != "pure_streak_3" {
+		t.Errorf("Expected the streak achievement on the third pure decision in a row, got %s", got)
+	}
+
+	// The endpoint shows what's unlocked and how far along the rest are.
+	var views []AchievementView
+	deadline := time.Now().Add(time.Second)
+	for {
+		rr := httptest.NewRecorder()
+		playerResourceHandler(rr, httptest.NewRequest("GET", "/players/player-badges/achievements", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rr.Code)
+		}
+		views = nil
+		json.NewDecoder(rr.Body).Decode(&views)
+		count := 0
+		for _, v := range views {
+			if v.Unlocked {
+				count++
+			}
+		}
+		if count == 5 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, v := range views {
+		switch v.ID {
+		case "pure_streak_100":
+			if v.Unlocked || v.Progress != 3 || v.Goal != 100 {
+				t.Errorf("Expected the 100 streak 3 decisions in, got %+v", v)
+			}
+		default:
+			if !v.Unlocked || v.UnlockedAt == nil || v.RequestID == "" {
+				t.Errorf("Expected %s to be unlocked, got %+v", v.ID, v)
+			}
+		}
+	}
+}
+
+// TestShutdown tests that draining answers waiting DNS requests, refuses new work and flushes unsynced points
+func TestShutdown(t *testing.T) {
+	defer shuttingDown.Store(false)
+	dnsRequests = make(map[string]*DNSRequest)
+	pendingRequests = nil
+	pendingActions = sync.Map{}
+	if err := db.CreatePlayer("player-draining", "Draining"); err != nil {
+		t.Fatal(err)
+	}
+	players = map[string]*Player{"player-draining": {ID: "player-draining", Nickname: "Draining", PurePoints: 3, PureDelta: 3, EvilDelta: 2}}
+
+	// A DNS request is left waiting on a player when the signal arrives.
+	body, _ := json.Marshal(DNSRequest{Name: "example.com.", Type: "A", Class: "IN"})
+	rr := httptest.NewRecorder()
+	answered := make(chan struct{})
+	go func() {
+		dnsRequestHandler(rr, httptest.NewRequest("POST", "/dnsrequest", bytes.NewReader(body)))
+		close(answered)
+	}()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		pendingRequestsMu.Lock()
+		waiting := len(pendingRequests)
+		pendingRequestsMu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("DNS request never queued")
+		}
+	}
+
+	// A spectator is watching the event stream, which must not hold the shutdown up.
+	spectators := httptest.NewServer(http.HandlerFunc(eventsHandler))
+	defer spectators.Close()
+	stream, err := http.Get(spectators.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+
+	report := drain(spectators.Config, 5*time.Second)
+	if report.Took > time.Second {
+		t.Errorf("Expected the open event stream to be ended, but the shutdown took %s", report.Took)
+	}
+	streamEnded := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, stream.Body)
+		close(streamEnded)
+	}()
+	select {
+	case <-streamEnded:
+	case <-time.After(time.Second):
+		t.Error("Expected the event stream to be closed")
+	}
+	select {
+	case <-answered:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the waiting DNS request to be answered")
+	}
+	var resp DNSResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Action != voting.FallbackAction || report.Resolved != 1 {
+		t.Errorf("Expected 1 request resolved with the fallback, got %q and %+v", resp.Action, report)
+	}
+
+	// Nothing new is handed out while draining, and new DNS requests skip the players.
+	if _, err := assignRequestToPlayer("player-draining"); err != errShuttingDown {
+		t.Errorf("Expected assignments to stop, got %v", err)
+	}
+	rr = httptest.NewRecorder()
+	dnsRequestHandler(rr, httptest.NewRequest("POST", "/dnsrequest", bytes.NewReader(body)))
+	if json.NewDecoder(rr.Body).Decode(&resp); resp.Action != voting.FallbackAction {
+		t.Errorf("Expected new DNS requests to get the fallback, got %q", resp.Action)
+	}
+
+	// Unsynced points made it to the database.
+	if report.FlushErr != nil || report.Players != 1 {
+		t.Fatalf("Expected one player flushed, got %+v", report)
+	}
+	stored, err := db.GetPlayer("player-draining")
+	if err != nil || stored.PurePoints != 3 || stored.EvilPoints != 2 {
+		t.Errorf("Expected the deltas in the database, got %+v (%v)", stored, err)
+	}
+	if p := players["player-draining"]; p.PureDelta != 0 || p.EvilDelta != 0 {
+		t.Errorf("Expected deltas to be cleared after the flush, got %+v", p)
+	}
+}
+
+// TestScoreSync tests that point deltas are written in one batch, counted and cleared
+func TestScoreSync(t *testing.T) {
+	for _, id := range []string{"player-sync-1", "player-sync-2"} {
+		if err := db.CreatePlayer(id, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	players = map[string]*Player{
+		"player-sync-1": {ID: "player-sync-1", PureDelta: 4},
+		"player-sync-2": {ID: "player-sync-2", EvilDelta: 1.5},
+		"player-sync-3": {ID: "player-sync-3"},
+	}
+	rowsBefore := testutil.ToFloat64(scoreSyncRows.WithLabelValues("players"))
+
+	playersSynced, _, err := syncDeltas()
+	if err != nil || playersSynced != 2 {
+		t.Fatalf("Expected 2 players synced, got %d (%v)", playersSynced, err)
+	}
+	if rows := testutil.ToFloat64(scoreSyncRows.WithLabelValues("players")) - rowsBefore; rows != 2 {
+		t.Errorf("Expected 2 rows counted, got %v", rows)
+	}
+
+	// Points earned after the snapshot go out with the next sync, on top of the first.
+	players["player-sync-1"].PureDelta += 1
+	if playersSynced, _, err := syncDeltas(); err != nil || playersSynced != 1 {
+		t.Fatalf("Expected 1 player synced, got %d (%v)", playersSynced, err)
+	}
+	if playersSynced, _, _ := syncDeltas(); playersSynced != 0 {
+		t.Errorf("Expected nothing left to sync, got %d", playersSynced)
+	}
+	first, _ := db.GetPlayer("player-sync-1")
+	second, _ := db.GetPlayer("player-sync-2")
+	if first.PurePoints != 5 || second.EvilPoints != 1.5 {
+		t.Errorf("Expected 5 pure and 1.5 evil in the database, got %v and %v", first.PurePoints, second.EvilPoints)
+	}
+}
+
+// TestStoreConformance runs the same checks against every storage backend. Postgres only runs
+// when TEST_POSTGRES_DSN points at a database, in a schema of its own that it drops afterwards.
+func TestStoreConformance(t *testing.T) {
+	backends := map[string]func(t *testing.T) db.Store{
+		"memory": func(t *testing.T) db.Store {
+			return db.NewMemoryStore()
+		},
+		"sqlite": func(t *testing.T) db.Store {
+			store, err := db.Open(filepath.Join(t.TempDir(), "conformance.db"), db.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+		"postgres": func(t *testing.T) db.Store {
+			dsn := os.Getenv("TEST_POSTGRES_DSN")
+			if dsn == "" {
+				t.Skip("TEST_POSTGRES_DSN not set")
+			}
+			// Work in a schema of our own, so nothing else in the database is touched.
+			conn, err := sql.Open("postgres", dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			schema := fmt.Sprintf("gameserver_test_%d", time.Now().UnixNano())
+			if _, err := conn.Exec(`CREATE SCHEMA ` + schema); err != nil {
+				conn.Close()
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				if _, err := conn.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+					t.Errorf("Failed to drop test schema %s: %v", schema, err)
+				}
+				conn.Close()
+			})
+
+			u, err := url.Parse(dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := u.Query()
+			query.Set("search_path", schema)
+			u.RawQuery = query.Encode()
+			store, err := db.Open(u.String(), db.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			defer store.Close()
+			t.Run("players", func(t *testing.T) { testStorePlayers(t, store) })
+			t.Run("decisions", func(t *testing.T) { testStoreDecisions(t, store) })
+			t.Run("sessions", func(t *testing.T) { testStoreSessions(t, store) })
+		})
+	}
+}
+
+// testStorePlayers checks creating players, updating them and ranking them
+func testStorePlayers(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	if p, err := store.GetPlayer(ctx, "nobody"); p != nil || !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v (%v)", p, err)
+	}
+	for _, id := range []string{"alice", "bob", "carol"} {
+		if err := store.CreatePlayer(ctx, id, strings.ToUpper(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.CreatePlayer(ctx, "alice", "again"); !errors.Is(err, db.ErrConflict) {
+		t.Errorf("Expected creating a player twice to conflict, got %v", err)
+	}
+	if err := store.UpdatePlayerRequest(ctx, "nobody", "req-1"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound updating a missing player, got %v", err)
+	}
+	if err := store.AddPlayerPoints(ctx, "nobody", 1, 0); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound scoring a missing player, got %v", err)
+	}
+
+	if err := store.UpdatePlayerRequest(ctx, "alice", "req-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddPlayerPoints(ctx, "alice", 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	// Deltas for a team or player that doesn't exist are dropped without failing the batch.
+	err := store.SyncPoints(ctx,
+		[]db.PointsDelta{{ID: "bob", Pure: 10}, {ID: "alice", Evil: 0.5}, {ID: "nobody", Pure: 1}},
+		[]db.PointsDelta{{ID: "no-team", Pure: 1}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := store.GetPlayer(ctx, "alice")
+	if err != nil || alice == nil {
+		t.Fatalf("Expected alice, got %v (%v)", alice, err)
+	}
+	if alice.Nickname != "ALICE" || alice.LastRequestID != "req-1" || alice.PurePoints != 3 || alice.EvilPoints != 1.5 {
+		t.Errorf("Unexpected player: %+v", alice)
+	}
+	if alice.CreatedAt.IsZero() || alice.UpdatedAt.IsZero() {
+		t.Errorf("Expected timestamps to be set, got %+v", alice)
+	}
+
+	board, err := store.GetLeaderboard(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, p := range board {
+		order = append(order, p.ID)
+	}
+	if strings.Join(order, ",") != "bob,alice,carol" {
+		t.Errorf("Expected bob, alice, carol, got %v", order)
+	}
+}
+
+// testStoreDecisions checks writing decisions and their awards, paging through them, counting and pruning
+func testStoreDecisions(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	decision := func(i int, player, qname, action string, timedOut bool, awards ...db.Award) db.Decision {
+		return db.Decision{
+			RequestID: fmt.Sprintf("req-%d", i),
+			QName:     qname,
+			QType:     "A",
+			QClass:    "IN",
+			ClientIP:  "10.0.0.1",
+			PlayerID:  player,
+			Action:    action,
+			LatencyMs: int64(100 * i),
+			TimedOut:  timedOut,
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+			Awards:    awards,
+		}
+	}
+	err := store.InsertDecisions(ctx, []db.Decision{
+		decision(0, "alice", "a.example.", "correct", false, db.Award{Rule: "base", Alignment: "pure", Points: 1, Detail: "correct"}),
+		decision(1, "alice", "b.example.", "corrupt", false, db.Award{Rule: "base", Alignment: "evil", Points: 2}, db.Award{Rule: "bonus", Alignment: "evil", Points: 0.5}),
+		decision(2, "bob", "a.example.", "corrupt", false),
+		decision(3, "", "a.example.", "correct", true),
+		decision(4, "alice", "c.example.", "corrupt", false, db.Award{Rule: "base", Alignment: "evil", Points: 2}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A player's decisions come back newest first, one page at a time.
+	page, err := store.QueryDecisions(ctx, db.DecisionQuery{PlayerID: "alice", Limit: 2})
+	if err != nil || len(page) != 2 || page[0].RequestID != "req-4" || page[1].RequestID != "req-1" {
+		t.Fatalf("Expected req-4 and req-1, got %+v (%v)", page, err)
+	}
+	if !page[0].CreatedAt.Equal(base.Add(4*time.Minute)) || page[0].LatencyMs != 400 || page[0].QClass != "IN" || page[0].ClientIP != "10.0.0.1" {
+		t.Errorf("Unexpected decision: %+v", page[0])
+	}
+	page, err = store.QueryDecisions(ctx, db.DecisionQuery{PlayerID: "alice", BeforeID: page[1].ID, Limit: 2})
+	if err != nil || len(page) != 1 || page[0].RequestID != "req-0" {
+		t.Fatalf("Expected req-0 on the second page, got %+v (%v)", page, err)
+	}
+	byDomain, err := store.QueryDecisions(ctx, db.DecisionQuery{QName: "a.example.", Since: base.Add(time.Minute), Until: base.Add(4 * time.Minute), Limit: 10})
+	if err != nil || len(byDomain) != 2 || byDomain[0].RequestID != "req-3" || !byDomain[0].TimedOut || byDomain[1].RequestID != "req-2" {
+		t.Fatalf("Expected req-3 and req-2, got %+v (%v)", byDomain, err)
+	}
+
+	awards, err := store.QueryAwards(ctx, "alice", 0, 2)
+	if err != nil || len(awards) != 2 || awards[0].RequestID != "req-4" || awards[1].Rule != "bonus" {
+		t.Fatalf("Expected the req-4 award then the req-1 bonus, got %+v (%v)", awards, err)
+	}
+	if awards[0].PlayerID != "alice" || awards[0].Points != 2 || !awards[0].CreatedAt.Equal(base.Add(4*time.Minute)) {
+		t.Errorf("Unexpected award: %+v", awards[0])
+	}
+	awards, err = store.QueryAwards(ctx, "alice", awards[1].ID, 10)
+	if err != nil || len(awards) != 2 || awards[0].Rule != "base" || awards[1].Detail != "correct" {
+		t.Fatalf("Expected the rest of alice's awards, got %+v (%v)", awards, err)
+	}
+
+	counts, err := store.CountActions(ctx, base, base.Add(time.Hour))
+	if err != nil || len(counts) != 2 {
+		t.Fatalf("Expected two actions, got %+v (%v)", counts, err)
+	}
+	if counts[0] != (db.ActionCount{Action: "corrupt", Count: 3}) || counts[1] != (db.ActionCount{Action: "correct", Count: 2, TimedOut: 1}) {
+		t.Errorf("Unexpected action counts: %+v", counts)
+	}
+	domains, err := store.TopDomains(ctx, "corrupt", time.Time{}, time.Time{}, 2)
+	if err != nil || len(domains) != 2 || domains[0] != (db.DomainCount{Domain: "a.example.", Count: 1}) || domains[1].Domain != "b.example." {
+		t.Errorf("Expected a.example. then b.example. by name, got %+v (%v)", domains, err)
+	}
+	domains, err = store.TopDomains(ctx, "", time.Time{}, time.Time{}, 1)
+	if err != nil || len(domains) != 1 || domains[0] != (db.DomainCount{Domain: "a.example.", Count: 3}) {
+		t.Errorf("Expected a.example. three times, got %+v (%v)", domains, err)
+	}
+
+	pruned, err := store.PruneDecisions(ctx, base.Add(2*time.Minute))
+	if err != nil || pruned != 2 {
+		t.Fatalf("Expected 2 decisions pruned, got %d (%v)", pruned, err)
+	}
+	if left, _ := store.QueryDecisions(ctx, db.DecisionQuery{Limit: 10}); len(left) != 3 {
+		t.Errorf("Expected 3 decisions left, got %d", len(left))
+	}
+	if awards, _ := store.QueryAwards(ctx, "alice", 0, 10); len(awards) != 1 || awards[0].RequestID != "req-4" {
+		t.Errorf("Expected only the req-4 award left, got %+v", awards)
+	}
+}
+
+// testStoreSessions checks logging in, looking sessions up, logging out and expiry
+func testStoreSessions(t *testing.T, store db.Store) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	live := db.Session{TokenHash: "live", PlayerID: "alice", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	expired := db.Session{TokenHash: "expired", PlayerID: "bob", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+	for _, s := range []db.Session{live, expired} {
+		if err := store.CreateSession(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.CreateSession(ctx, live); !errors.Is(err, db.ErrConflict) {
+		t.Errorf("Expected reusing a token hash to conflict, got %v", err)
+	}
+
+	got, err := store.GetSession(ctx, "live")
+	if err != nil || got == nil {
+		t.Fatalf("Expected the live session, got %v (%v)", got, err)
+	}
+	if got.PlayerID != "alice" || !got.CreatedAt.Equal(live.CreatedAt) || !got.ExpiresAt.Equal(live.ExpiresAt) {
+		t.Errorf("Unexpected session: %+v", got)
+	}
+	if got, err := store.GetSession(ctx, "missing"); got != nil || !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v (%v)", got, err)
+	}
+
+	if pruned, err := store.PruneSessions(ctx, now); err != nil || pruned != 1 {
+		t.Errorf("Expected 1 session pruned, got %d (%v)", pruned, err)
+	}
+	if got, _ := store.GetSession(ctx, "expired"); got != nil {
+		t.Error("Expected the expired session to be gone")
+	}
+	if err := store.DeleteSession(ctx, "live"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetSession(ctx, "live"); got != nil {
+		t.Error("Expected the session to be gone after logging out")
+	}
+}
+
+// TestMigrations tests that a database from before migrations is brought up to the latest schema,
+// that status and dry runs leave it alone, and that two servers migrating at once don't collide
+func TestMigrations(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/old_schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "old.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(string(fixture))
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run lists everything as pending and changes nothing.
+	var out bytes.Buffer
+	if code := runMigrate([]string{"-db", path, "-dry-run"}, &out); code != 0 {
+		t.Fatalf("Expected the dry run to succeed, got %d: %s", code, out.String())
+	}
+	states, err := db.MigrationStatus(path)
+	if err != nil || len(states) == 0 {
+		t.Fatalf("Expected migrations, got %v (%v)", states, err)
+	}
+	if want := fmt.Sprintf("Would apply %d migrations", len(states)); !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in the dry run, got %s", want, out.String())
+	}
+	for _, s := range states {
+		if s.Applied {
+			t.Errorf("Expected %s to still be pending after the dry run", s.Migration)
+		}
+	}
+
+	// Two servers starting at once: one applies everything, the other waits and finds nothing to do.
+	var wg sync.WaitGroup
+	applied := make([]int, 2)
+	errs := make([]error, 2)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			migrations, err := db.Migrate(path)
+			applied[i], errs[i] = len(migrations), err
+		}(i)
+	}
+	wg.Wait()
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("Expected both migrations to succeed, got %v and %v", errs[0], errs[1])
+	}
+	if applied[0]+applied[1] != len(states) {
+		t.Errorf("Expected %d migrations applied once between them, got %d and %d", len(states), applied[0], applied[1])
+	}
+
+	out.Reset()
+	if code := runMigrate([]string{"-db", path, "-status"}, &out); code != 0 || strings.Contains(out.String(), "pending") {
+		t.Errorf("Expected every migration applied, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), states[len(states)-1].Migration.String()) {
+		t.Errorf("Expected the latest migration in the status, got %s", out.String())
+	}
+	if migrations, err := db.Migrate(path); err != nil || len(migrations) != 0 {
+		t.Errorf("Expected nothing left to migrate, got %v (%v)", migrations, err)
+	}
+
+	// The old players survive and the newer tables work.
+	store, err := db.Open(path, db.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	veteran, err := store.GetPlayer(ctx, "old-player-1")
+	if err != nil || veteran == nil {
+		t.Fatalf("Expected the old player, got %v (%v)", veteran, err)
+	}
+	if veteran.Nickname != "Veteran" || veteran.PurePoints != 120.5 || veteran.LastRequestID != "req-old-1" {
+		t.Errorf("Unexpected player after migrating: %+v", veteran)
+	}
+	now := time.Now()
+	if err := store.CreateSession(ctx, db.Session{TokenHash: "migrated", PlayerID: "old-player-1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Errorf("Expected sessions to work after migrating: %v", err)
+	}
+}
+
+// TestAssignmentPersistence tests that a player's request is saved, handed back after a reload from the
+// database, and that moderators can see who held a request when it timed out
+func TestAssignmentPersistence(t *testing.T) {
+	adminToken = "test-admin-token"
+	defer func() { adminToken = "" }()
+	dbJobs = queue.NewJobQueue(100, 1, handleDBJob)
+	// flush waits for queued writes by draining the queue, then starts a fresh one.
+	flush := func() {
+		dbJobs.Shutdown()
+		dbJobs = queue.NewJobQueue(100, 1, handleDBJob)
+	}
+	defer func() {
+		dbJobs.Shutdown()
+		dbJobs = nil
+	}()
+
+	if err := db.CreatePlayer("player-holder", "Holder"); err != nil {
+		t.Fatal(err)
+	}
+	players = map[string]*Player{"player-holder": {ID: "player-holder", Nickname: "Holder"}}
+	dnsReq := &DNSRequest{RequestID: "req-held", Name: "Held.Example.", Type: "A", Timestamp: time.Now(), resolved: make(chan struct{})}
+	dnsRequests = map[string]*DNSRequest{dnsReq.RequestID: dnsReq}
+	pendingRequests = []*DNSRequest{dnsReq}
+	pendingActions = sync.Map{}
+
+	if got, err := assignRequestToPlayer("player-holder"); err != nil || got != dnsReq {
+		t.Fatalf("Expected req-held to be assigned, got %v (%v)", got, err)
+	}
+	flush()
+	if p, _ := db.GetPlayer("player-holder"); p == nil || p.LastRequestID != "req-held" {
+		t.Fatalf("Expected req-held to be saved as the player's request, got %+v", p)
+	}
+
+	// After a restart the player is loaded with the request they held and gets it straight back.
+	players = make(map[string]*Player)
+	if err := loadPlayers(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := assignRequestToPlayer("player-holder"); err != nil || got != dnsReq {
+		t.Fatalf("Expected req-held back after reloading, got %v (%v)", got, err)
+	}
+
+	// Once it times out the hold is ended as a timeout and the saved request is cleared.
+	dnsReq.TimedOut = true
+	cleanupDNSRequest(dnsReq.RequestID, "expired")
+	flush()
+	if p, _ := db.GetPlayer("player-holder"); p == nil || p.LastRequestID != "" {
+		t.Errorf("Expected the saved request to be cleared, got %+v", p)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/assignments?outcome=timed_out&player_id=player-holder", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr := httptest.NewRecorder()
+	adminHandler(rr, req)
+	var page struct {
+		Assignments []AssignmentView `json:"assignments"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Expected the assignment history, got %d: %v", rr.Code, err)
+	}
+	if len(page.Assignments) != 1 {
+		t.Fatalf("Expected one timed out assignment, got %+v", page.Assignments)
+	}
+	if a := page.Assignments[0]; a.RequestID != "req-held" || a.Domain != "held.example" || a.Outcome != outcomeTimedOut || a.EndedAt == nil {
+		t.Errorf("Unexpected assignment: %+v", a)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/assignments?outcome=lost", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr = httptest.NewRecorder()
+	adminHandler(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown outcome, got %d", rr.Code)
+	}
+}
+
+// TestExportImport tests that every kind of export survives a CSV round trip into another database,
+// that importing into the running game adds players once however often it's repeated, and that a
+// file with a bad record is turned away without writing any of it
+func TestExportImport(t *testing.T) {
+	adminToken = "test-admin-token"
+	defer func() { adminToken = "" }()
+	players = make(map[string]*Player)
+	nicknameOwners = make(map[string]string)
+	ctx := context.Background()
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// A source database with two players, their decisions, a finished season and a running one.
+	src := filepath.Join(t.TempDir(), "source.db")
+	store, err := db.Open(src, db.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"export-alice", "export-bob"} {
+		if err := store.CreatePlayer(ctx, id, strings.TrimPrefix(id, "export-")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.AddPlayerPoints(ctx, "export-alice", 2.5, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = store.InsertDecisions(ctx, []db.Decision{
+		{RequestID: "export-req-1", QName: "a.example", QType: "A", QClass: "IN", ClientIP: "10.0.0.1", PlayerID: "export-alice", Action: "corrupt", LatencyMs: 120, CreatedAt: base},
+		{RequestID: "export-req-2", QName: "b.example", QType: "AAAA", Action: "correct", TimedOut: true, CreatedAt: base.Add(time.Minute)},
+	})
+	store.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := db.OpenBackup(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = backup.ImportSeasons(ctx, []db.SeasonExport{
+		{Season: db.Season{Number: 1, StartedAt: base, EndedAt: base.Add(time.Hour)}, Results: []db.Standing{
+			{PlayerID: "export-alice", Nickname: "alice", PurePoints: 2.5, EvilPoints: 1, Rank: 1},
+			{PlayerID: "export-bob", Nickname: "bob", Rank: 2},
+		}},
+		{Season: db.Season{Number: 2, StartedAt: base.Add(time.Hour)}},
+	})
+	backup.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export := func(path, kind, format string) string {
+		var out, errOut bytes.Buffer
+		if code := runExport([]string{"-db", path, "-kind", kind, "-format", format}, &out, &errOut); code != 0 {
+			t.Fatalf("Expected the %s export to succeed, got %d: %s", kind, code, errOut.String())
+		}
+		return out.String()
+	}
+	if seasons := export(src, "seasons", "jsonl"); strings.Count(seasons, "\n") != 2 || !strings.Contains(seasons, `"player_id":"export-bob","nickname":"bob","pure_points":0,"evil_points":0,"rank":2`) {
+		t.Errorf("Expected two seasons with bob second in the first, got %s", seasons)
+	}
+
+	// Each kind goes out as CSV, into a fresh database, and comes back out as it went in.
+	dst := filepath.Join(t.TempDir(), "copy.db")
+	if _, err := db.Migrate(dst); err != nil {
+		t.Fatal(err)
+	}
+	copied, err := db.OpenBackup(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copied.Close()
+	for _, kind := range []string{"players", "decisions", "seasons"} {
+		records, err := readRecords(strings.NewReader(export(src, kind, "csv")), kind, "csv")
+		if err != nil {
+			t.Fatalf("Expected the %s CSV to read back, got %v", kind, err)
+		}
+		if _, _, err := importRecords(ctx, copied, kind, records); err != nil {
+			t.Fatal(err)
+		}
+		if want, got := export(src, kind, "jsonl"), export(dst, kind, "jsonl"); got != want {
+			t.Errorf("Expected %s to survive the round trip\nwant %s\ngot  %s", kind, want, got)
+		}
+	}
+
+	// Importing into the running game adds the players to it, and doing it again adds nothing.
+	importFile := func(kind, format, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/import?kind="+kind+"&format="+format, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rr := httptest.NewRecorder()
+		adminHandler(rr, req)
+		return rr
+	}
+	playersFile := export(src, "players", "jsonl")
+	for i, want := range []int64{2, 0} {
+		rr := importFile("players", "jsonl", playersFile)
+		var report ImportReport
+		if rr.Code != http.StatusOK || json.NewDecoder(rr.Body).Decode(&report) != nil || report.Records != 2 || report.Added != want {
+			t.Errorf("Expected import %d to add %d of 2 players, got %d: %+v", i+1, want, rr.Code, report)
+		}
+	}
+	if p := players["export-alice"]; p == nil || p.Nickname != "alice" || p.PurePoints != 2.5 || nicknameOwners[nicknames.Key("alice")] != "export-alice" {
+		t.Errorf("Expected alice in the game with her points, got %+v", p)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/export?kind=players&format=csv", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr := httptest.NewRecorder()
+	adminHandler(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv" || !strings.Contains(rr.Body.String(), "\nexport-bob,bob,0,0,") {
+		t.Errorf("Expected bob in the live CSV export, got %d %q: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+
+	// One bad record turns the whole file away, good records and all.
+	bad := `{"id":"export-carol","nickname":"carol","pure_points":1,"evil_points":0,"created_at":"2024-05-01T12:00:00Z","updated_at":"2024-05-01T12:00:00Z"}` + "\n" +
+		`{"id":"","nickname":"nobody","created_at":"2024-05-01T12:00:00Z"}` + "\n"
+	if rr := importFile("players", "jsonl", bad); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "line 2: id is required") {
+		t.Errorf("Expected 400 naming line 2, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := db.GetPlayer("export-carol"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Expected carol not to be imported, got %v", err)
+	}
+	// An import that fails part way only adds the players that were written to the game.
+	dave := `{"id":"export-dave","nickname":"dave","pure_points":4,"evil_points":0,"created_at":"2024-05-01T12:00:00Z","updated_at":"2024-05-01T12:00:00Z"}` + "\n"
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	req = httptest.NewRequest("POST", "/admin/import?kind=players&format=jsonl", strings.NewReader(dave)).WithContext(cancelled)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr = httptest.NewRecorder()
+	adminHandler(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected a failed import to be a 500, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if p := players["export-dave"]; p != nil {
+		t.Errorf("Expected dave not to join the game without being saved, got %+v", p)
+	}
+
+	// A running game only takes seasons that finished before the one being played, so the next
+	// rollover still has the season numbers to itself.
+	loadSeason()
+	if _, err := rolloverSeason(); err != nil {
+		t.Fatal(err)
+	}
+	current := seasonNumber()
+	season := func(number int64, ended bool) string {
+		record := fmt.Sprintf(`{"number":%d,"started_at":"2024-05-01T12:00:00Z"`, number)
+		if ended {
+			record += `,"ended_at":"2024-05-01T13:00:00Z"`
+		}
+		return record + "}\n"
+	}
+	for _, body := range []string{season(current, true), season(current+1, true), season(current-1, false)} {
+		if rr := importFile("seasons", "jsonl", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 importing %s into season %d, got %d: %s", strings.TrimSpace(body), current, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := importFile("seasons", "jsonl", season(current-1, true)); rr.Code != http.StatusOK {
+		t.Errorf("Expected finished season %d to import, got %d: %s", current-1, rr.Code, rr.Body.String())
+	}
+	_, err = db.CurrentBackup().ImportSeasons(ctx, []db.SeasonExport{{Season: db.Season{Number: current + 1, StartedAt: base, EndedAt: base.Add(time.Hour)}}})
+	if !errors.Is(err, db.ErrSeasonRunning) {
+		t.Errorf("Expected the database to turn away season %d too, got %v", current+1, err)
+	}
+	if _, err := rolloverSeason(); err != nil {
+		t.Fatalf("Expected a rollover after the imports to succeed, got %v", err)
+	}
+	if seasonNumber() != current+1 {
+		t.Errorf("Expected season %d after the rollover, got %d", current+1, seasonNumber())
+	}
+
+	badCSV := strings.Join(exportColumns["decisions"], ",") + "\nexport-req-3,c.example,A,IN,,,launder,5,false,2024-05-01T12:00:00Z\n"
+	if rr := importFile("decisions", "csv", badCSV); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `unknown action "launder"`) {
+		t.Errorf("Expected 400 for an unknown action, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := importFile("teams", "jsonl", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown kind, got %d", rr.Code)
+	}
+}
+
+// TestGameServerClient tests the client package against the real handlers, from registering
+// through playing a DNS request to reading the leaderboard
+func TestGameServerClient(t *testing.T) {
+	dnsRequests = make(map[string]*DNSRequest)
+	players = make(map[string]*Player)
+	nicknameOwners = make(map[string]string)
+	pendingActions = sync.Map{}
+	pendingRequests = nil
+	rebuildRankings()
+
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	mux.HandleFunc("/players/", playerResourceHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	c := client.New(server.URL)
+
+	session, err := c.Register(ctx, "ClientPlayer", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.PlayerID == "" || session.Token == "" || session.ExpiresAt.Before(time.Now()) {
+		t.Fatalf("Expected a usable session, got %+v", session)
+	}
+	var apiErr *client.Error
+	if _, err := c.Register(ctx, "ClientPlayer", ""); !errors.Is(err, client.ErrConflict) || !errors.As(err, &apiErr) || apiErr.Code != "nickname_taken" || apiErr.Message == "" {
+		t.Errorf("Expected a conflict with the reason for a taken nickname, got %v", err)
+	}
+	if _, err := c.Assign(ctx, session); !errors.Is(err, client.ErrNoRequests) {
+		t.Errorf("Expected no requests to play, got %v", err)
+	}
+	if _, err := c.Assign(ctx, client.Session{PlayerID: session.PlayerID, Token: "not-a-token"}); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("Expected a bad token to be unauthorized, got %v", err)
+	}
+
+	// Ask the way CoreDNS does, and answer as the player.
+	dnsResult := make(chan client.DNSResponse, 1)
+	go func() {
+		resp, err := c.SubmitDNSRequest(ctx, client.DNSQuery{Name: "client.example.com.", Type: "A", Class: "IN", ClientIP: "192.0.2.1"})
+		if err != nil {
+			t.Error(err)
+		}
+		dnsResult <- resp
+	}()
+	var assignment client.Assignment
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if assignment, err = c.Assign(ctx, session); err == nil {
+			break
+		}
+		if !errors.Is(err, client.ErrNoRequests) || time.Now().After(deadline) {
+			t.Fatalf("Expected an assignment, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if assignment.Name != "client.example.com." || assignment.RequestID == "" || !assignment.Rules.Allows(client.ActionNXDomain) {
+		t.Fatalf("Unexpected assignment %+v", assignment)
+	}
+
+	result, err := c.Submit(ctx, session, assignment.RequestID, client.ActionNXDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Awards) == 0 {
+		t.Errorf("Expected awards for the action, got %+v", result)
+	}
+	select {
+	case resp := <-dnsResult:
+		if resp.Action != client.ActionNXDomain {
+			t.Errorf("Expected CoreDNS to be told nxdomain, got %+v", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("DNS request was not answered")
+	}
+	if _, err := c.Submit(ctx, session, assignment.RequestID, client.ActionCorrect); !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("Expected answering twice to be refused, got %v", err)
+	}
+
+	entries, err := c.Leaderboard(ctx, client.LeaderboardQuery{Sort: "evil"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].PlayerID != session.PlayerID || entries[0].EvilPoints == 0 {
+		t.Errorf("Expected the player alone on the evil board, got %+v", entries)
+	}
+	if _, err := c.Leaderboard(ctx, client.LeaderboardQuery{Sort: "sideways"}); !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("Expected a bad sort to be a bad request, got %v", err)
+	}
+	rank, err := c.Rank(ctx, session.PlayerID, client.LeaderboardQuery{Sort: "evil"})
+	if err != nil || rank.Rank != 1 || rank.Ranked != 1 {
+		t.Errorf("Expected to be first of one, got %+v (%v)", rank, err)
+	}
+	if _, err := c.Rank(ctx, "nobody", client.LeaderboardQuery{}); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Expected an unknown player to be not found, got %v", err)
+	}
+
+	change, err := c.Rename(ctx, session, "ClientRenamed")
+	if err != nil || change.Nickname != "ClientRenamed" {
+		t.Errorf("Expected the rename to go through, got %+v (%v)", change, err)
+	}
+	if err := c.Logout(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Assign(ctx, session); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("Expected the session to be revoked, got %v", err)
+	}
+
+	// A busy server is retried, but not if it asks for longer than the client will wait.
+	var calls int
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Get("q") == "later" {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if calls < 3 {
+			http.Error(w, "Busy", http.StatusServiceUnavailable)
+			return
+		}
+		leaderboardHandler(w, r)
+	}))
+	defer flaky.Close()
+	c = client.New(flaky.URL)
+	c.RetryWait = time.Millisecond
+	if _, err := c.Leaderboard(ctx, client.LeaderboardQuery{}); err != nil || calls != 3 {
+		t.Errorf("Expected success on the third try, got %v after %d calls", err, calls)
+	}
+	calls = 0
+	_, err = c.Leaderboard(ctx, client.LeaderboardQuery{Search: "later"})
+	if !errors.Is(err, client.ErrUnavailable) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 30*time.Second || calls != 1 {
+		t.Errorf("Expected to give up at once with Retry-After 30s, got %v after %d calls", err, calls)
+	}
+}
+
+// openAPIDoc is the part of an OpenAPI document the /v1 tests check calls against.
+type openAPIDoc struct {
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*openAPISchema `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Parameters []struct {
+		Name     string         `json:"name"`
+		In       string         `json:"in"`
+		Required bool           `json:"required"`
+		Schema   *openAPISchema `json:"schema"`
+	} `json:"parameters"`
+	RequestBody *struct {
+		Required bool                        `json:"required"`
+		Content  map[string]openAPIMediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]openAPIMediaType `json:"content"`
+	} `json:"responses"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+// openAPISchema is the subset of JSON Schema the document uses.
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref"`
+	Type                 string                    `json:"type"`
+	Format               string                    `json:"format"`
+	Nullable             bool                      `json:"nullable"`
+	Enum                 []interface{}             `json:"enum"`
+	Minimum              *float64                  `json:"minimum"`
+	Properties           map[string]*openAPISchema `json:"properties"`
+	Required             []string                  `json:"required"`
+	Items                *openAPISchema            `json:"items"`
+	AnyOf                []*openAPISchema          `json:"anyOf"`
+	AdditionalProperties json.RawMessage           `json:"additionalProperties"`
+}
+
+// validate checks a decoded JSON value against a schema.
+func (d *openAPIDoc) validate(s *openAPISchema, v interface{}, at string) error {
+	if s.Ref != "" {
+		ref, ok := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", at, s.Ref)
+		}
+		return d.validate(ref, v, at)
+	}
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: unexpected null", at)
+	}
+	if len(s.AnyOf) > 0 {
+		var errs []string
+		for _, option := range s.AnyOf {
+			err := d.validate(option, v, at)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("%s: matches none of anyOf: %s", at, strings.Join(errs, "; "))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			found = found || e == v
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", at, v, s.Enum)
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %T", at, v)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required %q", at, name)
+			}
+		}
+		var extra *openAPISchema
+		closed := string(s.AdditionalProperties) == "false"
+		if len(s.AdditionalProperties) > 0 && !closed && string(s.AdditionalProperties) != "true" {
+			if err := json.Unmarshal(s.AdditionalProperties, &extra); err != nil {
+				return err
+			}
+		}
+		for name, value := range obj {
+			prop, ok := s.Properties[name]
+			switch {
+			case ok:
+			case extra != nil:
+				prop = extra
+			case closed:
+				return fmt.Errorf("%s: unexpected property %q", at, name)
+			default:
+				continue
+			}
+			if err := d.validate(prop, value, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %T", at, v)
+		}
+		for i, item := range arr {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string, got %T", at, v)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, str)
+			}
+		}
+	case "number", "integer":
+		n, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%s: expected a number, got %T", at, v)
+		}
+		if s.Type == "integer" && n != float64(int64(n)) {
+			return fmt.Errorf("%s: %v is not an integer", at, n)
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return fmt.Errorf("%s: %v is below %v", at, n, *s.Minimum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %T", at, v)
+		}
+	}
+	return nil
+}
+
+// validateParam checks a query parameter's text against its schema.
+func (d *openAPIDoc) validateParam(s *openAPISchema, value, at string) error {
+	var v interface{} = value
+	if s.Type == "integer" || s.Type == "number" {
+		var n float64
+		if _, err := fmt.Sscan(value, &n); err != nil {
+			return fmt.Errorf("%s: %q is not a number", at, value)
+		}
+		v = n
+	}
+	return d.validate(s, v, at)
+}
+
+// validateRequest checks that a /v1 request is one the document allows.
+func (d *openAPIDoc) validateRequest(op *openAPIOperation, r *http.Request, body []byte) error {
+	query := r.URL.Query()
+	declared := make(map[string]bool)
+	for _, p := range op.Parameters {
+		if p.In != "query" {
+			continue
+		}
+		declared[p.Name] = true
+		if _, ok := query[p.Name]; !ok {
+			if p.Required {
+				return fmt.Errorf("missing required parameter %q", p.Name)
+			}
+			continue
+		}
+		if err := d.validateParam(p.Schema, query.Get(p.Name), p.Name); err != nil {
+			return err
+		}
+	}
+	for name := range query {
+		if !declared[name] {
+			return fmt.Errorf("undeclared parameter %q", name)
+		}
+	}
+
+	if op.RequestBody == nil {
+		if len(body) > 0 {
+			return errors.New("unexpected request body")
+		}
+		return nil
+	}
+	if len(body) == 0 {
+		if op.RequestBody.Required {
+			return errors.New("missing request body")
+		}
+		return nil
+	}
+	media, ok := op.RequestBody.Content[r.Header.Get("Content-Type")]
+	if !ok {
+		return fmt.Errorf("undeclared request content type %q", r.Header.Get("Content-Type"))
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("request body: %v", err)
+	}
+	return d.validate(media.Schema, v, "body")
+}
+
+// validateResponse checks that a /v1 response is one the document promises. Without an operation
+// (an unknown path or method) it has to be an Error envelope.
+func (d *openAPIDoc) validateResponse(op *openAPIOperation, rr *httptest.ResponseRecorder) error {
+	schema := &openAPISchema{Ref: "#/components/schemas/Error"}
+	contentType := "application/json"
+	if op != nil {
+		resp, ok := op.Responses[fmt.Sprint(rr.Code)]
+		if !ok {
+			return fmt.Errorf("undeclared status %d", rr.Code)
+		}
+		if len(resp.Content) == 0 {
+			if rr.Body.Len() > 0 {
+				return fmt.Errorf("status %d should have no body, got %q", rr.Code, rr.Body.String())
+			}
+			return nil
+		}
+		for contentType = range resp.Content {
+		}
+		schema = resp.Content[contentType].Schema
+	}
+	if got := rr.Header().Get("Content-Type"); got != contentType {
+		return fmt.Errorf("status %d: expected content type %s, got %q", rr.Code, contentType, got)
+	}
+	var v interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &v); err != nil {
+		return fmt.Errorf("status %d: response body: %v", rr.Code, err)
+	}
+	return d.validate(schema, v, "response")
+}
+
+// apiTester makes /v1 calls through a mux, checking both sides of each against the OpenAPI document.
+type apiTester struct {
+	t   *testing.T
+	doc *openAPIDoc
+	mux *http.ServeMux
+}
+
+// call makes a request the document should allow.
+func (a *apiTester) call(method, target, body, token string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.do(method, target, body, token, true)
+}
+
+// callInvalid makes a request the document should turn down, to check the server does too.
+func (a *apiTester) callInvalid(method, target, body, token string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.do(method, target, body, token, false)
+}
+
+func (a *apiTester) do(method, target, body, token string, valid bool) *httptest.ResponseRecorder {
+	a.t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	var op *openAPIOperation
+	if item, ok := a.doc.Paths[strings.TrimPrefix(req.URL.Path, "/v1")]; ok {
+		op = item[strings.ToLower(method)]
+	}
+	reqErr := errors.New("no such operation")
+	if op != nil {
+		reqErr = a.doc.validateRequest(op, req, []byte(body))
+	}
+	if valid && reqErr != nil {
+		a.t.Errorf("%s %s: request doesn't match the OpenAPI document: %v", method, target, reqErr)
+	}
+	if !valid && reqErr == nil {
+		a.t.Errorf("%s %s: expected the OpenAPI document to reject the request", method, target)
+	}
+
+	rr := httptest.NewRecorder()
+	a.mux.ServeHTTP(rr, req)
+	if err := a.doc.validateResponse(op, rr); err != nil {
+		a.t.Errorf("%s %s: response doesn't match the OpenAPI document: %v", method, target, err)
+	}
+	return rr
+}
+
+// expectError checks a /v1 refusal's status and machine code.
+func (a *apiTester) expectError(rr *httptest.ResponseRecorder, status int, code string) {
+	a.t.Helper()
+	var envelope client.ErrorResponse
+	json.Unmarshal(rr.Body.Bytes(), &envelope)
+	if rr.Code != status || envelope.Error.Code != code || envelope.Error.Message == "" {
+		a.t.Errorf("Expected %d %s, got %d %s", status, code, rr.Code, rr.Body.String())
+	}
+}
+
+// TestAPIv1 plays through the /v1 API, checking every request and response against the embedded
+// OpenAPI document, and checks the deprecated routes still answer the way they used to.
+func TestAPIv1(t *testing.T) {
+	dnsRequests = make(map[string]*DNSRequest)
+	players = make(map[string]*Player)
+	nicknameOwners = make(map[string]string)
+	pendingActions = sync.Map{}
+	pendingRequests = nil
+	rebuildRankings()
+
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPIDocument, &doc); err != nil {
+		t.Fatalf("The embedded OpenAPI document isn't valid JSON: %v", err)
+	}
+	for _, route := range apiRoutes {
+		if doc.Paths[route.path][strings.ToLower(route.method)] == nil {
+			t.Errorf("%s /v1%s is not in the OpenAPI document", route.method, route.path)
+		}
+	}
+	for path, item := range doc.Paths {
+		for method := range item {
+			found := path == "/openapi.json" && method == "get"
+			for _, route := range apiRoutes {
+				found = found || route.path == path && strings.ToLower(route.method) == method
+			}
+			if !found {
+				t.Errorf("The OpenAPI document describes %s %s, which isn't served", method, path)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	registerAPIRoutes(mux)
+	api := &apiTester{t: t, doc: &doc, mux: mux}
+
+	rr := api.call(http.MethodGet, "/v1/openapi.json", "", "")
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), openAPIDocument) {
+		t.Errorf("Expected the OpenAPI document, got %d", rr.Code)
+	}
+
+	// Registering.
+	rr = api.call(http.MethodPost, "/v1/register", `{"nickname":"APIPlayer"}`, "")
+	var session client.Session
+	json.Unmarshal(rr.Body.Bytes(), &session)
+	if rr.Code != http.StatusCreated || session.PlayerID == "" || session.Token == "" {
+		t.Fatalf("Expected a session, got %d %s", rr.Code, rr.Body.String())
+	}
+	api.expectError(api.call(http.MethodPost, "/v1/register", `{"nickname":"APIPlayer"}`, ""), http.StatusConflict, "nickname_taken")
+	api.expectError(api.call(http.MethodPost, "/v1/register", `{"nickname":"APIPlayer2","team":"nope"}`, ""), http.StatusBadRequest, "invalid_team")
+	api.expectError(api.callInvalid(http.MethodPost, "/v1/register", `{"name":"APIPlayer3"}`, ""), http.StatusBadRequest, "invalid_nickname")
+
+	// Methods are enforced, and unknown endpoints are JSON too.
+	rr = api.callInvalid(http.MethodGet, "/v1/register?nickname=APIPlayer4", "", "")
+	api.expectError(rr, http.StatusMethodNotAllowed, "method_not_allowed")
+	if rr.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("Expected Allow: POST, got %q", rr.Header().Get("Allow"))
+	}
+	if _, taken := nicknameOwners[nicknames.Key("APIPlayer4")]; taken {
+		t.Error("Expected a refused method not to register anyone")
+	}
+	api.expectError(api.callInvalid(http.MethodPost, "/v1/leaderboard", "", ""), http.StatusMethodNotAllowed, "method_not_allowed")
+	api.expectError(api.callInvalid(http.MethodGet, "/v1/nowhere", "", ""), http.StatusNotFound, "not_found")
+
+	// Playing a DNS request.
+	assign := `{"player_id":"` + session.PlayerID + `"}`
+	api.expectError(api.call(http.MethodPost, "/v1/assign", assign, ""), http.StatusUnauthorized, "unauthorized")
+	api.expectError(api.callInvalid(http.MethodPost, "/v1/assign", `{}`, session.Token), http.StatusBadRequest, "missing_player_id")
+	if rr := api.call(http.MethodPost, "/v1/assign", assign, session.Token); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected nothing to play, got %d", rr.Code)
+	}
+	api.expectError(api.callInvalid(http.MethodPost, "/v1/dnsrequest", `{"name":`, ""), http.StatusBadRequest, "invalid_request")
+
+	dnsResult := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		dnsResult <- api.call(http.MethodPost, "/v1/dnsrequest", `{"name":"api.example.com.","type":"A","class":"IN","client_ip":"192.0.2.1"}`, "")
+	}()
+	var assignment client.Assignment
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		rr := api.call(http.MethodPost, "/v1/assign", assign, session.Token)
+		if rr.Code == http.StatusOK {
+			json.Unmarshal(rr.Body.Bytes(), &assignment)
+			break
+		}
+		if rr.Code != http.StatusNoContent || time.Now().After(deadline) {
+			t.Fatalf("Expected an assignment, got %d %s", rr.Code, rr.Body.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if assignment.Name != "api.example.com." || assignment.RequestID == "" {
+		t.Fatalf("Unexpected assignment %+v", assignment)
+	}
+
+	submit := func(action string) string {
+		return fmt.Sprintf(`{"player_id":%q,"request_id":%q,"action":%q}`, session.PlayerID, assignment.RequestID, action)
+	}
+	api.expectError(api.callInvalid(http.MethodPost, "/v1/submitaction", submit("explode"), session.Token), http.StatusBadRequest, "invalid_action")
+	if rr := api.call(http.MethodPost, "/v1/submitaction", submit(client.ActionCorrupt), session.Token); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the action to be accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+	select {
+	case rr := <-dnsResult:
+		var resp client.DNSResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if rr.Code != http.StatusOK || resp.Action != client.ActionCorrupt {
+			t.Errorf("Expected CoreDNS to be told corrupt, got %d %s", rr.Code, rr.Body.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("DNS request was not answered")
+	}
+	rr = api.call(http.MethodPost, "/v1/submitaction", submit(client.ActionCorrect), session.Token)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected answering twice to be refused, got %d", rr.Code)
+	}
+
+	// Reading the leaderboard.
+	var entries []client.LeaderboardEntry
+	rr = api.call(http.MethodGet, "/v1/leaderboard?sort=evil&window=season", "", "")
+	json.Unmarshal(rr.Body.Bytes(), &entries)
+	if rr.Code != http.StatusOK || len(entries) != 1 || entries[0].PlayerID != session.PlayerID {
+		t.Errorf("Expected the player alone on the board, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := api.call(http.MethodGet, "/v1/leaderboard?scope=team", "", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the team board, got %d %s", rr.Code, rr.Body.String())
+	}
+	api.expectError(api.callInvalid(http.MethodGet, "/v1/leaderboard?sort=sideways", "", ""), http.StatusBadRequest, "invalid_sort")
+	api.expectError(api.callInvalid(http.MethodGet, "/v1/leaderboard?page_size=0", "", ""), http.StatusBadRequest, "invalid_page_size")
+	api.expectError(api.call(http.MethodGet, "/v1/leaderboard?season=999", "", ""), http.StatusNotFound, "unknown_season")
+	if rr := api.call(http.MethodGet, "/v1/leaderboard/rank?player_id="+session.PlayerID, "", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the player's rank, got %d %s", rr.Code, rr.Body.String())
+	}
+	api.expectError(api.call(http.MethodGet, "/v1/leaderboard/rank?player_id=nobody", "", ""), http.StatusNotFound, "not_ranked")
+	api.expectError(api.callInvalid(http.MethodGet, "/v1/leaderboard/rank", "", ""), http.StatusBadRequest, "missing_player_id")
+
+	// Logging out.
+	api.expectError(api.call(http.MethodPost, "/v1/logout", "", ""), http.StatusUnauthorized, "unauthorized")
+	if rr := api.call(http.MethodPost, "/v1/logout", "", session.Token); rr.Code != http.StatusOK {
+		t.Errorf("Expected to log out, got %d %s", rr.Code, rr.Body.String())
+	}
+	api.expectError(api.call(http.MethodPost, "/v1/assign", assign, session.Token), http.StatusUnauthorized, "unauthorized")
+
+	// The deprecated routes answer as they always did, pointing at their successors.
+	req := httptest.NewRequest(http.MethodGet, "/register?nickname=LegacyPlayer", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) == "" || rr.Header().Get(SessionTokenHeader) == "" {
+		t.Errorf("Expected the old register to still work, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Deprecation") != "true" || rr.Header().Get("Link") != `</v1/register>; rel="successor-version"` {
+		t.Errorf("Expected deprecation headers, got %v", rr.Header())
+	}
+	req = httptest.NewRequest(http.MethodGet, "/leaderboard?sort=sideways", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected a plain-text error from the old route, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+}
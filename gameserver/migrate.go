@@ -0,0 +1,78 @@
+// gameserver/migrate.go
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nicewrld/gameserver/db"
+)
+
+//////////////////////////////////////////
+// Migration Command
+//////////////////////////////////////////
+
+// databaseDSN returns the database to use. DB_DSN takes a postgres:// URL or a SQLite path;
+// DB_PATH is the older name for a SQLite path.
+func databaseDSN() string {
+	return getEnv("DB_DSN", getEnv("DB_PATH", "/litefs/gameserver.db"))
+}
+
+// databaseOptions returns how long queries wait on another connection's lock (DB_BUSY_TIMEOUT)
+// and how long database calls without a request context get in total (DB_QUERY_TIMEOUT).
+func databaseOptions() db.Options {
+	return db.Options{
+		BusyTimeout:  getEnvDuration("DB_BUSY_TIMEOUT", db.DefaultBusyTimeout),
+		QueryTimeout: getEnvDuration("DB_QUERY_TIMEOUT", db.DefaultQueryTimeout),
+	}
+}
+
+// runMigrate implements `gameserver migrate`, which applies pending migrations. With -status it
+// lists every migration and when it was applied; with -dry-run it lists what would be applied.
+// Neither of those changes the database. It returns the process exit code.
+func runMigrate(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dsn := flags.String("db", databaseDSN(), "database to migrate, a SQLite path or postgres:// URL")
+	status := flags.Bool("status", false, "list every migration and whether it has been applied")
+	dryRun := flags.Bool("dry-run", false, "list the migrations that would be applied, without applying them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *status || *dryRun {
+		states, err := db.MigrationStatus(*dsn)
+		if err != nil {
+			fmt.Fprintf(out, "Failed to read migration status: %v\n", err)
+			return 1
+		}
+		pending := 0
+		for _, s := range states {
+			switch {
+			case s.Applied && *status:
+				fmt.Fprintf(out, "%-32s applied %s\n", s.Migration, s.AppliedAt.UTC().Format(time.RFC3339))
+			case !s.Applied:
+				pending++
+				fmt.Fprintf(out, "%-32s pending\n", s.Migration)
+			}
+		}
+		if *dryRun {
+			fmt.Fprintf(out, "Would apply %d migrations\n", pending)
+		}
+		return 0
+	}
+
+	applied, err := db.Migrate(*dsn)
+	if err != nil {
+		fmt.Fprintf(out, "Migration failed, nothing was applied: %v\n", err)
+		return 1
+	}
+	for _, m := range applied {
+		fmt.Fprintf(out, "%-32s applied\n", m)
+	}
+	fmt.Fprintf(out, "Applied %d migrations\n", len(applied))
+	return 0
+}
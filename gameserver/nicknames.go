@@ -0,0 +1,248 @@
+// gameserver/nicknames.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nicewrld/gameserver/client"
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/nicknames"
+)
+
+//////////////////////////////////////////
+// Nickname State
+//////////////////////////////////////////
+
+var (
+	// nicknamePolicy decides which nicknames are allowed. main replaces it when NICKNAME_CONFIG is set.
+	nicknamePolicy = nicknames.NewPolicy(nicknames.DefaultConfig())
+
+	// nicknameOwners maps each folded nickname (see nicknames.Key) to the player using it. Guarded by playersMu.
+	nicknameOwners = make(map[string]string)
+
+	errNicknameTaken  = errors.New("That nickname is already taken.")
+	errRenameCooldown = errors.New("You renamed recently. Please wait before renaming again.")
+	errRenameFailed   = errors.New("Failed to rename player")
+)
+
+//////////////////////////////////////////
+// Nickname Functions
+//////////////////////////////////////////
+
+// indexNicknames rebuilds nicknameOwners from the players in memory. Players who registered
+// look-alike names before nicknames were unique keep them; the first one loaded owns the name.
+func indexNicknames() {
+	playersMu.Lock()
+	defer playersMu.Unlock()
+
+	nicknameOwners = make(map[string]string, len(players))
+	for _, player := range players {
+		key := nicknames.Key(player.Nickname)
+		if owner, taken := nicknameOwners[key]; taken && owner != player.ID {
+			log.Printf("Warning: Nickname %q of player %s clashes with player %s", player.Nickname, player.ID, owner)
+			continue
+		}
+		nicknameOwners[key] = player.ID
+	}
+}
+
+// checkNickname cleans a nickname and makes sure nobody else has it, returning the name to store.
+// Callers must hold playersMu.
+func checkNickname(playerID, nickname string) (string, error) {
+	nickname, err := nicknamePolicy.Clean(nickname)
+	if err != nil {
+		return "", err
+	}
+	if owner, taken := nicknameOwners[nicknames.Key(nickname)]; taken && owner != playerID {
+		return "", errNicknameTaken
+	}
+	return nickname, nil
+}
+
+// claimNickname gives a player a nickname checkNickname has already approved, releasing their old one.
+// Callers must hold playersMu.
+func claimNickname(player *Player, nickname string) {
+	releaseNickname(player)
+	player.Nickname = nickname
+	nicknameOwners[nicknames.Key(nickname)] = player.ID
+}
+
+// releaseNickname frees a player's nickname for others, if it's theirs. Callers must hold playersMu.
+func releaseNickname(player *Player) {
+	if key := nicknames.Key(player.Nickname); nicknameOwners[key] == player.ID {
+		delete(nicknameOwners, key)
+	}
+}
+
+// releaseUnusedNickname frees a nickname a player holds on to but isn't using, like the old name
+// during a rename. Callers must hold playersMu.
+func releaseUnusedNickname(player *Player, nickname string) {
+	key := nicknames.Key(nickname)
+	if key != nicknames.Key(player.Nickname) && nicknameOwners[key] == player.ID {
+		delete(nicknameOwners, key)
+	}
+}
+
+// loadRenames restores when each loaded player last renamed themselves, so restarts don't reset the cooldown.
+func loadRenames() {
+	renames, err := db.GetLastSelfRenames()
+	if err != nil {
+		log.Printf("Warning: Failed to load renames from database: %v", err)
+		return
+	}
+	playersMu.Lock()
+	for id, at := range renames {
+		if player, exists := players[id]; exists {
+			player.LastRenamedAt = at
+		}
+	}
+	playersMu.Unlock()
+}
+
+// nextRenameAt returns when a player may next rename themselves. Callers must hold playersMu.
+func nextRenameAt(player *Player) time.Time {
+	if player.LastRenamedAt.IsZero() {
+		return time.Time{}
+	}
+	return player.LastRenamedAt.Add(time.Duration(nicknamePolicy.Config().RenameCooldown))
+}
+
+// renameAvailableAt returns when a player may next rename themselves.
+func renameAvailableAt(playerID string) time.Time {
+	playersMu.RLock()
+	defer playersMu.RUnlock()
+	player, exists := players[playerID]
+	if !exists {
+		return time.Time{}
+	}
+	return nextRenameAt(player)
+}
+
+// renamePlayer changes a player's nickname and returns the old and new names. Players renaming
+// themselves wait out the rename cooldown; moderators (renamedBy set) don't. The rename is undone
+// if it can't be saved.
+func renamePlayer(ctx context.Context, playerID, nickname, renamedBy string) (string, string, error) {
+	now := time.Now()
+
+	playersMu.Lock()
+	player, exists := players[playerID]
+	if !exists {
+		playersMu.Unlock()
+		return "", "", errInvalidPlayer
+	}
+	if renamedBy == "" && now.Before(nextRenameAt(player)) {
+		playersMu.Unlock()
+		return "", "", errRenameCooldown
+	}
+	nickname, err := checkNickname(playerID, nickname)
+	if err != nil {
+		playersMu.Unlock()
+		return "", "", err
+	}
+	// The old name stays reserved until the rename is saved, so there's something to go back to.
+	previous, lastRenamedAt := player.Nickname, player.LastRenamedAt
+	player.Nickname = nickname
+	nicknameOwners[nicknames.Key(nickname)] = playerID
+	if renamedBy == "" {
+		player.LastRenamedAt = now
+	}
+	playersMu.Unlock()
+
+	err = db.RenamePlayerContext(ctx, db.Rename{
+		PlayerID:    playerID,
+		OldNickname: previous,
+		NewNickname: nickname,
+		RenamedBy:   renamedBy,
+		RenamedAt:   now,
+	})
+
+	playersMu.Lock()
+	defer playersMu.Unlock()
+	if err != nil {
+		log.Printf("Failed to persist rename of player %s: %v", playerID, err)
+		// Only undo it if nobody has renamed the player again in the meantime.
+		if player.Nickname == nickname {
+			player.Nickname = previous
+			nicknameOwners[nicknames.Key(previous)] = playerID
+			player.LastRenamedAt = lastRenamedAt
+		}
+		releaseUnusedNickname(player, nickname)
+		return "", "", errRenameFailed
+	}
+	releaseUnusedNickname(player, previous)
+	return previous, nickname, nil
+}
+
+// nicknameErrorStatus picks the HTTP status for an error from checkNickname or renamePlayer.
+func nicknameErrorStatus(err error) int {
+	switch err {
+	case errInvalidPlayer:
+		return http.StatusNotFound
+	case errNicknameTaken:
+		return http.StatusConflict
+	case errRenameCooldown:
+		return http.StatusTooManyRequests
+	case errRenameFailed:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// nicknameErrorCode picks the /v1 error code for an error from checkNickname or renamePlayer.
+func nicknameErrorCode(err error) string {
+	switch err {
+	case errInvalidPlayer:
+		return "invalid_player"
+	case errNicknameTaken:
+		return "nickname_taken"
+	case errRenameCooldown:
+		return "rename_cooldown"
+	case errRenameFailed:
+		return "internal_error"
+	}
+	return "invalid_nickname"
+}
+
+//////////////////////////////////////////
+// Nickname Handlers
+//////////////////////////////////////////
+
+// nicknameHandler lets a player rename themselves, once per rename cooldown.
+func nicknameHandler(w http.ResponseWriter, r *http.Request, playerID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := authenticatePlayer(r, playerID); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var body client.NicknameRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request data.", http.StatusBadRequest)
+		return
+	}
+
+	previous, nickname, err := renamePlayer(r.Context(), playerID, body.Nickname, "")
+	if err == errRenameCooldown {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(renameAvailableAt(playerID)).Seconds())+1))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), nicknameErrorStatus(err))
+		return
+	}
+	log.Printf("Player %s renamed from %s to %s", playerID, previous, nickname)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client.NicknameChange{
+		Nickname:     nickname,
+		NextRenameAt: renameAvailableAt(playerID).UTC(),
+	})
+}
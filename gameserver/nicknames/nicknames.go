@@ -0,0 +1,186 @@
+// nickname rules: what's allowed, what's blocked and when two names count as the same
+// so nobody can register "Admin" next to "admin" or "аdmin" with a cyrillic a
+// gameserver/nicknames/nicknames.go
+
+package nicknames
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nicewrld/gameserver/config"
+)
+
+// errors a player can see as is
+var (
+	ErrEmpty   = errors.New("Please pick a nickname.")
+	ErrCharset = errors.New("Nicknames can only use letters, numbers, spaces, dots, dashes and underscores.")
+	ErrBlocked = errors.New("That nickname isn't allowed. Please pick another.")
+)
+
+// Config is the nickname policy
+type Config struct {
+	MinLength      int             `json:"min_length"`      // in characters
+	MaxLength      int             `json:"max_length"`      // in characters
+	Blocked        []string        `json:"blocked"`         // words no nickname may contain, matched after folding
+	Reserved       []string        `json:"reserved"`        // whole nicknames nobody may take
+	RenameCooldown config.Duration `json:"rename_cooldown"` // how long a player waits between renames
+}
+
+// DefaultConfig keeps names short and printable and reserves the names staff use
+func DefaultConfig() Config {
+	return Config{
+		MinLength:      2,
+		MaxLength:      24,
+		Reserved:       []string{"admin", "administrator", "moderator", "mod", "dnsrp", "system"},
+		RenameCooldown: config.Duration(24 * time.Hour),
+	}
+}
+
+// LoadConfig reads a nickname config file over the defaults
+func LoadConfig(path string) (Config, error) {
+	return config.Load(path, DefaultConfig())
+}
+
+// Validate catches limits that would reject every name
+func (c Config) Validate() error {
+	if c.MinLength < 1 {
+		return fmt.Errorf("min_length must be at least 1")
+	}
+	if c.MaxLength < c.MinLength {
+		return fmt.Errorf("max_length must be at least min_length")
+	}
+	if c.RenameCooldown < 0 {
+		return fmt.Errorf("rename_cooldown can't be negative")
+	}
+	for _, w := range c.Blocked {
+		if Key(w) == "" {
+			return fmt.Errorf("blocked word %q has no letters or numbers", w)
+		}
+	}
+	return nil
+}
+
+// Policy checks nicknames against a config
+type Policy struct {
+	cfg      Config
+	blocked  []string
+	reserved map[string]bool
+}
+
+// NewPolicy folds the config's word lists once up front
+func NewPolicy(cfg Config) *Policy {
+	p := &Policy{cfg: cfg, reserved: make(map[string]bool)}
+	for _, w := range cfg.Blocked {
+		p.blocked = append(p.blocked, Key(w))
+	}
+	for _, w := range cfg.Reserved {
+		p.reserved[Key(w)] = true
+	}
+	return p
+}
+
+// Config returns the policy's config
+func (p *Policy) Config() Config {
+	return p.cfg
+}
+
+// Clean tidies a nickname and checks it, returning the name to store
+//
+// surrounding space is trimmed and runs of spaces squashed, so "  neo   1 " becomes "neo 1"
+func (p *Policy) Clean(nickname string) (string, error) {
+	nickname = strings.Join(strings.Fields(nickname), " ")
+	if nickname == "" {
+		return "", ErrEmpty
+	}
+	if !utf8.ValidString(nickname) {
+		return "", ErrCharset
+	}
+	if n := utf8.RuneCountInString(nickname); n < p.cfg.MinLength || n > p.cfg.MaxLength {
+		return "", fmt.Errorf("Nicknames must be %d to %d characters long.", p.cfg.MinLength, p.cfg.MaxLength)
+	}
+	for _, r := range nickname {
+		if !allowedRune(r) {
+			return "", ErrCharset
+		}
+	}
+
+	key := Key(nickname)
+	if key == "" {
+		return "", ErrCharset
+	}
+	if p.reserved[key] {
+		return "", ErrBlocked
+	}
+	for _, w := range p.blocked {
+		if strings.Contains(key, w) {
+			return "", ErrBlocked
+		}
+	}
+	return nickname, nil
+}
+
+// allowedRune is letters, numbers, spaces and a little punctuation
+// combining marks are out, which keeps zalgo text off the leaderboard
+func allowedRune(r rune) bool {
+	switch {
+	case unicode.IsLetter(r), unicode.IsNumber(r):
+		return true
+	case r == ' ', r == '_', r == '-', r == '.':
+		return true
+	}
+	return false
+}
+
+// Key folds a nickname down to what it looks like, so names that look alike get the same key
+//
+// case, accents, fullwidth forms, lookalike letters from other scripts, leetspeak
+// digits, spaces and punctuation all fold away: "Nеo_1", "NEO 1" and "ｎｅｏ-l" share "neol"
+func Key(nickname string) string {
+	var b strings.Builder
+	for _, r := range nickname {
+		if r >= 0xFF01 && r <= 0xFF5E {
+			// fullwidth ascii
+			r -= 0xFEE0
+		}
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if folded, ok := confusables[r]; ok {
+			b.WriteString(folded)
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// confusables maps lowercase runes to the ascii they pass for
+var confusables = map[rune]string{
+	// leetspeak
+	'0': "o", '1': "l", '3': "e", '4': "a", '5': "s", '7': "t", '8': "b", '9': "g",
+	'i': "l", '|': "l", '@': "a", '$': "s",
+	// latin with accents
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "l", 'í': "l", 'î': "l", 'ï': "l", 'ī': "l", 'į': "l", 'ı': "l",
+	'ł': "l", 'ľ': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y", 'ž': "z", 'ź': "z", 'ż': "z",
+	// cyrillic
+	'а': "a", 'в': "b", 'е': "e", 'ё': "e", 'к': "k", 'м': "m", 'н': "h", 'о': "o", 'р': "p",
+	'с': "c", 'т': "t", 'у': "y", 'х': "x", 'і': "l", 'ї': "l", 'ј': "j", 'ѕ': "s", 'һ': "h", 'ԁ': "d",
+	// greek
+	'α': "a", 'β': "b", 'ε': "e", 'η': "n", 'ι': "l", 'κ': "k", 'ν': "v", 'ο': "o", 'ρ': "p",
+	'τ': "t", 'υ': "u", 'χ': "x", 'ω': "w",
+}
@@ -0,0 +1,105 @@
+// gameserver/nicknames/nicknames_test.go
+
+package nicknames
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+)
+
+// TestKey tests that nicknames which look alike fold to the same key
+func TestKey(t *testing.T) {
+	tests := []struct {
+		nickname string
+		want     string
+	}{
+		{"neo", "neo"},
+		{"NEO", "neo"},
+		{"Neo 1", "neol"},
+		{"n_e-o.1", "neol"},
+		{"N\u0435o_1", "neol"},           // cyrillic e
+		{"\uff4e\uff45\uff4f-l", "neol"}, // fullwidth
+		{"Admin", "admln"},               // i passes for l
+		{"\u0430dmin", "admln"},          // cyrillic a
+		{"4DM1N", "admln"},               // leetspeak
+		{"Zo\u00eb", "zoe"},              // precomposed accent
+		{"Zoe\u0308", "zoe"},             // combining accent
+		{"Stra\u00dfe", "strasse"},
+		{"\u03b1\u03b2", "ab"},
+		{"--__..", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.nickname); got != tt.want {
+			t.Errorf("Key(%q): expected %q, got %q", tt.nickname, tt.want, got)
+		}
+	}
+}
+
+// TestClean tests which nicknames a policy stores, and how it tidies them
+func TestClean(t *testing.T) {
+	p := NewPolicy(Config{
+		MinLength: 2,
+		MaxLength: 8,
+		Blocked:   []string{"darn"},
+		Reserved:  []string{"admin"},
+	})
+	const badLength = "Nicknames must be 2 to 8 characters long."
+	tests := []struct {
+		nickname string
+		want     string
+		wantErr  string
+	}{
+		{"neo", "neo", ""},
+		{"  neo   1 ", "neo 1", ""},
+		{"Zo\u00eb", "Zo\u00eb", ""},
+		{"", "", ErrEmpty.Error()},
+		{"   ", "", ErrEmpty.Error()},
+		{"n", "", badLength},
+		{"ninechars", "", badLength},
+		{"neo!", "", ErrCharset.Error()},
+		{"Zoe\u0308", "", ErrCharset.Error()},
+		{"...", "", ErrCharset.Error()},
+		{"\xff\xfe", "", ErrCharset.Error()},
+		{"ADMIN", "", ErrBlocked.Error()},
+		{"\u0430dmin", "", ErrBlocked.Error()},
+		{"admin2", "admin2", ""},
+		{"D4rnIt", "", ErrBlocked.Error()},
+	}
+	for _, tt := range tests {
+		got, err := p.Clean(tt.nickname)
+		gotErr := ""
+		if err != nil {
+			gotErr = err.Error()
+		}
+		if got != tt.want || gotErr != tt.wantErr {
+			t.Errorf("Clean(%q): expected %q, %q, got %q, %q", tt.nickname, tt.want, tt.wantErr, got, gotErr)
+		}
+	}
+}
+
+// TestValidate tests the nickname configs that would turn every name away
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr bool
+	}{
+		{"default", func(*Config) {}, false},
+		{"no minimum", func(c *Config) { c.MinLength = 0 }, true},
+		{"maximum below minimum", func(c *Config) { c.MaxLength = 1 }, true},
+		{"negative cooldown", func(c *Config) { c.RenameCooldown = config.Duration(-time.Hour) }, true},
+		{"blocked word of punctuation", func(c *Config) { c.Blocked = []string{"--"} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.change(&cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -47,25 +47,37 @@ func (jq *JobQueue) worker() {
 	for {
 		select {
 		case job := <-jq.queue:
-			// Try to process the job with retries
-			var err error
-			for attempts := 0; attempts < 3; attempts++ {
-				err = jq.handler(job)
-				if err == nil {
-					break
+			jq.process(job)
+		case <-jq.shutdown:
+			// Finish whatever was already queued before bailing
+			for {
+				select {
+				case job := <-jq.queue:
+					jq.process(job)
+				default:
+					return
 				}
-				log.Printf("Job failed (attempt %d/3): %v", attempts+1, err)
-				time.Sleep(time.Duration(attempts+1) * time.Second)
-			}
-			if err != nil {
-				log.Printf("Job failed permanently: %v", err)
 			}
-		case <-jq.shutdown:
-			return
 		}
 	}
 }
 
+func (jq *JobQueue) process(job Job) {
+	// Try to process the job with retries
+	var err error
+	for attempts := 0; attempts < 3; attempts++ {
+		err = jq.handler(job)
+		if err == nil {
+			break
+		}
+		log.Printf("Job failed (attempt %d/3): %v", attempts+1, err)
+		time.Sleep(time.Duration(attempts+1) * time.Second)
+	}
+	if err != nil {
+		log.Printf("Job failed permanently: %v", err)
+	}
+}
+
 func (jq *JobQueue) Submit(job Job) {
 	select {
 	case jq.queue <- job:
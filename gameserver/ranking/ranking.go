@@ -0,0 +1,211 @@
+// a leaderboard that stays sorted as scores change
+// so ranking 100k players doesn't mean sorting 100k players on every page view
+// gameserver/ranking/ranking.go
+
+package ranking
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// maxLevel is enough for millions of entries at p = 1/4
+const maxLevel = 16
+
+// Entry is one ranked id and its score
+type Entry struct {
+	ID    string
+	Score float64
+}
+
+// Index keeps ids ordered by score, highest first, ties broken by id
+//
+// it's an indexable skip list: every link remembers how many entries it jumps
+// over, so finding the nth entry or an entry's rank is O(log n) like an update
+type Index struct {
+	mu     sync.RWMutex
+	head   *node
+	level  int
+	length int
+	scores map[string]float64
+	rng    *rand.Rand
+}
+
+type node struct {
+	entry Entry
+	next  []*node
+	span  []int // entries skipped by next[i], counting the one landed on
+}
+
+// New returns an empty index
+func New() *Index {
+	return &Index{
+		head:   &node{next: make([]*node, maxLevel), span: make([]int, maxLevel)},
+		level:  1,
+		scores: make(map[string]float64),
+		rng:    rand.New(rand.NewSource(1)),
+	}
+}
+
+// before reports whether a sorts ahead of b
+func before(a, b Entry) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.ID < b.ID
+}
+
+// Len returns how many ids are ranked
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.length
+}
+
+// Set ranks id at score, moving it if it was already ranked
+func (ix *Index) Set(id string, score float64) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if old, ok := ix.scores[id]; ok {
+		if old == score {
+			return
+		}
+		ix.remove(Entry{id, old})
+	}
+	ix.insert(Entry{id, score})
+	ix.scores[id] = score
+}
+
+// Remove drops id from the ranking
+func (ix *Index) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if old, ok := ix.scores[id]; ok {
+		ix.remove(Entry{id, old})
+		delete(ix.scores, id)
+	}
+}
+
+// Rank returns id's 1-based position, or false if it isn't ranked
+func (ix *Index) Rank(id string) (int, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	score, ok := ix.scores[id]
+	if !ok {
+		return 0, false
+	}
+	target := Entry{id, score}
+	rank := 0
+	x := ix.head
+	for i := ix.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && !before(target, x.next[i].entry) {
+			rank += x.span[i]
+			x = x.next[i]
+		}
+	}
+	return rank, x.entry.ID == id
+}
+
+// Range returns up to limit entries starting at the 0-based offset
+func (ix *Index) Range(offset, limit int) []Entry {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	if offset < 0 || limit <= 0 || offset >= ix.length {
+		return nil
+	}
+
+	// walk down to the entry just before offset, then along the bottom
+	x := ix.head
+	traversed := 0
+	for i := ix.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && traversed+x.span[i] <= offset {
+			traversed += x.span[i]
+			x = x.next[i]
+		}
+	}
+	entries := make([]Entry, 0, limit)
+	for x = x.next[0]; x != nil && len(entries) < limit; x = x.next[0] {
+		entries = append(entries, x.entry)
+	}
+	return entries
+}
+
+func (ix *Index) randomLevel() int {
+	level := 1
+	for level < maxLevel && ix.rng.Intn(4) == 0 {
+		level++
+	}
+	return level
+}
+
+func (ix *Index) insert(e Entry) {
+	var update [maxLevel]*node
+	var rank [maxLevel]int
+
+	x := ix.head
+	for i := ix.level - 1; i >= 0; i-- {
+		if i < ix.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i] != nil && before(x.next[i].entry, e) {
+			rank[i] += x.span[i]
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+
+	level := ix.randomLevel()
+	if level > ix.level {
+		for i := ix.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = ix.head
+			update[i].span[i] = ix.length
+		}
+		ix.level = level
+	}
+
+	n := &node{entry: e, next: make([]*node, level), span: make([]int, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+		n.span[i] = update[i].span[i] - (rank[0] - rank[i])
+		update[i].span[i] = rank[0] - rank[i] + 1
+	}
+	for i := level; i < ix.level; i++ {
+		update[i].span[i]++
+	}
+	ix.length++
+}
+
+func (ix *Index) remove(e Entry) {
+	var update [maxLevel]*node
+
+	x := ix.head
+	for i := ix.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && before(x.next[i].entry, e) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	x = x.next[0]
+	if x == nil || x.entry.ID != e.ID {
+		return
+	}
+
+	for i := 0; i < ix.level; i++ {
+		if update[i].next[i] == x {
+			update[i].span[i] += x.span[i] - 1
+			update[i].next[i] = x.next[i]
+		} else {
+			update[i].span[i]--
+		}
+	}
+	for ix.level > 1 && ix.head.next[ix.level-1] == nil {
+		ix.level--
+	}
+	ix.length--
+}
@@ -0,0 +1,160 @@
+// gameserver/ranking/ranking_test.go
+
+package ranking
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestIndex tests ranking, moving and removing ids, with ties broken by id
+func TestIndex(t *testing.T) {
+	type op struct {
+		id     string
+		score  float64
+		remove bool
+	}
+	tests := []struct {
+		name string
+		ops  []op
+		want []Entry
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "highest first",
+			ops:  []op{{id: "a", score: 1}, {id: "b", score: 3}, {id: "c", score: 2}},
+			want: []Entry{{"b", 3}, {"c", 2}, {"a", 1}},
+		},
+		{
+			name: "ties go by id",
+			ops:  []op{{id: "carol", score: 5}, {id: "alice", score: 5}, {id: "bob", score: 5}},
+			want: []Entry{{"alice", 5}, {"bob", 5}, {"carol", 5}},
+		},
+		{
+			name: "set again moves the id",
+			ops:  []op{{id: "a", score: 1}, {id: "b", score: 2}, {id: "a", score: 3}},
+			want: []Entry{{"a", 3}, {"b", 2}},
+		},
+		{
+			name: "set to the same score changes nothing",
+			ops:  []op{{id: "a", score: 1}, {id: "a", score: 1}},
+			want: []Entry{{"a", 1}},
+		},
+		{
+			name: "remove",
+			ops:  []op{{id: "a", score: 1}, {id: "b", score: 2}, {id: "c", score: 3}, {id: "b", remove: true}},
+			want: []Entry{{"c", 3}, {"a", 1}},
+		},
+		{
+			name: "remove an id that isn't ranked",
+			ops:  []op{{id: "a", score: 1}, {id: "nobody", remove: true}},
+			want: []Entry{{"a", 1}},
+		},
+		{
+			name: "negative scores rank last",
+			ops:  []op{{id: "a", score: -2}, {id: "b", score: 0}, {id: "c", score: -1}},
+			want: []Entry{{"b", 0}, {"c", -1}, {"a", -2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ix := New()
+			for _, o := range tt.ops {
+				if o.remove {
+					ix.Remove(o.id)
+				} else {
+					ix.Set(o.id, o.score)
+				}
+			}
+			if ix.Len() != len(tt.want) {
+				t.Errorf("Expected %d ranked, got %d", len(tt.want), ix.Len())
+			}
+			if got := ix.Range(0, len(tt.want)+1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			for i, e := range tt.want {
+				if rank, ok := ix.Rank(e.ID); !ok || rank != i+1 {
+					t.Errorf("Expected %s at rank %d, got %d (ranked %v)", e.ID, i+1, rank, ok)
+				}
+			}
+		})
+	}
+}
+
+// TestIndexRank tests that ids that were never ranked, or were removed, have no rank
+func TestIndexRank(t *testing.T) {
+	ix := New()
+	ix.Set("a", 1)
+	ix.Set("b", 2)
+	ix.Remove("a")
+	for _, id := range []string{"a", "nobody"} {
+		if rank, ok := ix.Rank(id); ok {
+			t.Errorf("Expected %s not to be ranked, got rank %d", id, rank)
+		}
+	}
+}
+
+// TestIndexRange tests paging through the ranking
+func TestIndexRange(t *testing.T) {
+	ix := New()
+	for i := 0; i < 5; i++ {
+		ix.Set(fmt.Sprintf("p%d", i), float64(i))
+	}
+	tests := []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 2, []string{"p4", "p3"}},
+		{2, 2, []string{"p2", "p1"}},
+		{4, 10, []string{"p0"}},
+		{5, 2, nil},
+		{-1, 2, nil},
+		{0, 0, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, e := range ix.Range(tt.offset, tt.limit) {
+			got = append(got, e.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Range(%d, %d): expected %v, got %v", tt.offset, tt.limit, tt.want, got)
+		}
+	}
+}
+
+// TestIndexMatchesSort tests the skip list against a plain sort after many updates
+func TestIndexMatchesSort(t *testing.T) {
+	ix := New()
+	scores := make(map[string]float64)
+	for i := 0; i < 2000; i++ {
+		id := fmt.Sprintf("p%d", i%300)
+		switch {
+		case i%7 == 0:
+			ix.Remove(id)
+			delete(scores, id)
+		default:
+			score := float64((i * 37) % 50)
+			ix.Set(id, score)
+			scores[id] = score
+		}
+	}
+
+	want := make([]Entry, 0, len(scores))
+	for id, score := range scores {
+		want = append(want, Entry{id, score})
+	}
+	sort.Slice(want, func(i, j int) bool { return before(want[i], want[j]) })
+
+	if got := ix.Range(0, len(want)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected the index to match a sort of %d entries", len(want))
+	}
+	for i, e := range want {
+		if rank, ok := ix.Rank(e.ID); !ok || rank != i+1 {
+			t.Fatalf("Expected %s at rank %d, got %d", e.ID, i+1, rank)
+		}
+	}
+}
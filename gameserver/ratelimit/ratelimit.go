@@ -0,0 +1,83 @@
+// token bucket rate limiting, so a flooding chat or a cheating player can't flood the game
+// gameserver/ratelimit/ratelimit.go
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneEvery is how many Allow calls go by between sweeps for idle buckets
+const pruneEvery = 1024
+
+// Limiter hands out one token per interval per key, up to burst saved up
+type Limiter struct {
+	mu      sync.Mutex
+	every   time.Duration
+	burst   float64
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New allows one event per every, with bursts up to burst
+func New(every time.Duration, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		every:   every,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow spends a token for key if there's one to spend
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%pruneEvery == 0 {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + float64(now.Sub(b.last))/float64(l.every)
+	if tokens > l.burst {
+		tokens = l.burst
+	}
+	return tokens
+}
+
+// prune forgets buckets that have filled back up, since a fresh one is the same thing
+// keeps memory flat when thousands of chatters each say one thing
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
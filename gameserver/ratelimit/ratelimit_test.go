@@ -0,0 +1,55 @@
+// gameserver/ratelimit/ratelimit_test.go
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLimiter tests bursts, refilling and that every key has its own bucket
+func TestLimiter(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	type call struct {
+		key   string
+		after time.Duration
+		want  bool
+	}
+	tests := []struct {
+		name  string
+		burst int
+		calls []call
+	}{
+		{"burst then nothing", 2, []call{{"bob", 0, true}, {"bob", 0, true}, {"bob", 0, false}}},
+		{"keys don't share", 1, []call{{"bob", 0, true}, {"bob", 0, false}, {"carol", 0, true}}},
+		{"a token comes back every interval", 1, []call{{"bob", 0, true}, {"bob", 500 * time.Millisecond, false}, {"bob", time.Second, true}}},
+		{"saving up stops at the burst", 2, []call{{"bob", 0, true}, {"bob", time.Hour, true}, {"bob", time.Hour, true}, {"bob", time.Hour, false}}},
+		{"burst below 1 is 1", 0, []call{{"bob", 0, true}, {"bob", 0, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(time.Second, tt.burst)
+			for i, c := range tt.calls {
+				l.now = func() time.Time { return start.Add(c.after) }
+				if got := l.Allow(c.key); got != c.want {
+					t.Errorf("Call %d for %s after %s: expected %v, got %v", i+1, c.key, c.after, c.want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestLimiterPrune tests that buckets which have filled back up are forgotten
+func TestLimiterPrune(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := New(time.Second, 1)
+	l.now = func() time.Time { return start }
+	for i := 0; i < pruneEvery-1; i++ {
+		l.Allow(string(rune('a' + i%26)))
+	}
+	l.now = func() time.Time { return start.Add(time.Minute) }
+	l.Allow("fresh")
+	if len(l.buckets) != 1 {
+		t.Errorf("Expected only the newest bucket to be kept, got %d", len(l.buckets))
+	}
+}
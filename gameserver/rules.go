@@ -0,0 +1,71 @@
+// gameserver/rules.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/nicewrld/gameserver/rules"
+)
+
+//////////////////////////////////////////
+// Domain Rules State
+//////////////////////////////////////////
+
+var (
+	// actionNames lists every action in the order players are shown them.
+	actionNames = []string{"correct", "corrupt", "delay", "nxdomain"}
+
+	// rulesEngine decides which actions are allowed on which domains. It starts empty, allowing everything.
+	rulesEngine = rules.NewEngine(actionNames)
+
+	// rulesConfigPath is the file rule changes made through the admin API are saved to, if any.
+	rulesConfigPath string
+
+	errActionNotAllowed = errors.New("That action is not allowed for this domain.")
+)
+
+//////////////////////////////////////////
+// Domain Rules Handlers
+//////////////////////////////////////////
+
+// adminRulesHandler shows the domain rules on GET and replaces them on PUT. Admin only.
+//
+// Replaced rules take effect immediately and are written back to RULES_CONFIG when it is set.
+func adminRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if err := authenticateAdmin(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var cfg rules.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			http.Error(w, "Invalid rules: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := rulesEngine.Set(cfg); err != nil {
+			http.Error(w, "Invalid rules: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		audit(r, "set_rules", "", cfg)
+		if rulesConfigPath != "" {
+			if err := rules.SaveConfig(rulesConfigPath, cfg); err != nil {
+				log.Printf("Failed to save domain rules to %s: %v", rulesConfigPath, err)
+				http.Error(w, "Rules applied but could not be saved", http.StatusInternalServerError)
+				return
+			}
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rulesEngine.Config())
+}
@@ -0,0 +1,173 @@
+// per-domain rules - which actions are allowed on which domains and
+// what they're worth, so nobody gets to corrupt the bank
+// gameserver/rules/rules.go
+
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/nicewrld/gameserver/config"
+	"github.com/nicewrld/gameserver/domains"
+)
+
+// Rule applies to every domain matching Pattern
+type Rule struct {
+	Pattern     string             `json:"pattern"`               // see domains.Match
+	Description string             `json:"description,omitempty"` // shown to players
+	Allow       []string           `json:"allow,omitempty"`       // only these actions, everything if empty
+	Weights     map[string]float64 `json:"weights,omitempty"`     // points multiplier per action
+}
+
+// Config is the full rule list, first match wins
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadConfig reads a rules file
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	err := config.Read(path, &cfg)
+	return cfg, err
+}
+
+// SaveConfig writes a rules file, swapping it in whole so a crash can't leave half a file
+func SaveConfig(path string, cfg Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Verdict is what the rules say about one domain
+type Verdict struct {
+	Pattern     string             `json:"pattern,omitempty"` // matching rule, empty if none did
+	Description string             `json:"description,omitempty"`
+	Allowed     []string           `json:"allowed"`           // actions players may pick
+	Weights     map[string]float64 `json:"weights,omitempty"` // multipliers other than 1
+}
+
+// Allows reports whether an action may be taken
+func (v Verdict) Allows(action string) bool {
+	for _, a := range v.Allowed {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Weight is the points multiplier for an action, 1 if the rule doesn't say
+func (v Verdict) Weight(action string) float64 {
+	if w, ok := v.Weights[action]; ok {
+		return w
+	}
+	return 1
+}
+
+// Engine evaluates domains against the rules and can be reconfigured while running
+type Engine struct {
+	actions []string // every action the game knows, in display order
+
+	mu  sync.RWMutex
+	cfg Config
+}
+
+// NewEngine starts with no rules, so everything is allowed
+func NewEngine(actions []string) *Engine {
+	return &Engine{actions: actions}
+}
+
+// Config returns the rules in effect
+func (e *Engine) Config() Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.cfg
+}
+
+// Set swaps in new rules after checking them
+func (e *Engine) Set(cfg Config) error {
+	if err := e.Validate(cfg); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.cfg = cfg
+	e.mu.Unlock()
+	return nil
+}
+
+// Validate catches rules that mention unknown actions or make no sense
+func (e *Engine) Validate(cfg Config) error {
+	known := make(map[string]bool)
+	for _, a := range e.actions {
+		known[a] = true
+	}
+	for _, r := range cfg.Rules {
+		if r.Pattern == "" {
+			return fmt.Errorf("rule needs a pattern")
+		}
+		for _, a := range r.Allow {
+			if !known[a] {
+				return fmt.Errorf("rule %q: unknown action %q", r.Pattern, a)
+			}
+		}
+		for a, w := range r.Weights {
+			if !known[a] {
+				return fmt.Errorf("rule %q: unknown action %q", r.Pattern, a)
+			}
+			if w <= 0 {
+				return fmt.Errorf("rule %q: weight for %s must be positive", r.Pattern, a)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate finds the first rule matching name and says what it allows
+func (e *Engine) Evaluate(name string) Verdict {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, r := range e.cfg.Rules {
+		if !domains.Match(r.Pattern, name) {
+			continue
+		}
+		v := Verdict{Pattern: r.Pattern, Description: r.Description, Allowed: e.allowed(r.Allow)}
+		for a, w := range r.Weights {
+			if w != 1 {
+				if v.Weights == nil {
+					v.Weights = make(map[string]float64)
+				}
+				v.Weights[a] = w
+			}
+		}
+		return v
+	}
+	return Verdict{Allowed: e.allowed(nil)}
+}
+
+// allowed lists the permitted actions in display order
+func (e *Engine) allowed(allow []string) []string {
+	if len(allow) == 0 {
+		return append([]string(nil), e.actions...)
+	}
+	permitted := make(map[string]bool)
+	for _, a := range allow {
+		permitted[a] = true
+	}
+	var out []string
+	for _, a := range e.actions {
+		if permitted[a] {
+			out = append(out, a)
+		}
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+// gameserver/rules/rules_test.go
+
+package rules
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var actions = []string{"correct", "corrupt", "delay", "nxdomain"}
+
+// TestEvaluatePrecedence tests that the first rule matching a domain decides, whatever comes after it
+func TestEvaluatePrecedence(t *testing.T) {
+	e := NewEngine(actions)
+	err := e.Set(Config{Rules: []Rule{
+		{Pattern: "login.bank.com", Allow: []string{"correct"}, Description: "the login page"},
+		{Pattern: "*.bank.com", Allow: []string{"correct", "delay"}, Weights: map[string]float64{"delay": 2, "correct": 1}},
+		{Pattern: "bank.com", Allow: []string{"nxdomain"}},
+		{Pattern: "ads.*", Weights: map[string]float64{"nxdomain": 0.5}},
+		{Pattern: "*", Allow: []string{"correct", "corrupt"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		wantPattern string
+		wantAllowed []string
+		wantWeights map[string]float64
+	}{
+		{"login.bank.com", "login.bank.com", []string{"correct"}, nil},
+		{"LOGIN.Bank.com.", "login.bank.com", []string{"correct"}, nil},
+		{"www.bank.com", "*.bank.com", []string{"correct", "delay"}, map[string]float64{"delay": 2}},
+		{"bank.com", "bank.com", []string{"nxdomain"}, nil},
+		{"ads.example.com", "ads.*", actions, map[string]float64{"nxdomain": 0.5}},
+		{"example.com", "*", []string{"correct", "corrupt"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := e.Evaluate(tt.name)
+			if v.Pattern != tt.wantPattern {
+				t.Errorf("Expected rule %q to decide, got %q", tt.wantPattern, v.Pattern)
+			}
+			if !reflect.DeepEqual(v.Allowed, tt.wantAllowed) {
+				t.Errorf("Expected %v allowed, got %v", tt.wantAllowed, v.Allowed)
+			}
+			if !reflect.DeepEqual(v.Weights, tt.wantWeights) {
+				t.Errorf("Expected weights %v, got %v", tt.wantWeights, v.Weights)
+			}
+		})
+	}
+}
+
+// TestEvaluateNoRules tests that a domain no rule matches allows everything at the usual weight
+func TestEvaluateNoRules(t *testing.T) {
+	e := NewEngine(actions)
+	if err := e.Set(Config{Rules: []Rule{{Pattern: "*.bank.com", Allow: []string{"correct"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	v := e.Evaluate("example.com")
+	if v.Pattern != "" || !reflect.DeepEqual(v.Allowed, actions) {
+		t.Errorf("Expected every action with no rule, got %+v", v)
+	}
+	for _, a := range actions {
+		if !v.Allows(a) || v.Weight(a) != 1 {
+			t.Errorf("Expected %s allowed at weight 1, got %v at %v", a, v.Allows(a), v.Weight(a))
+		}
+	}
+	if v.Allows("launder") {
+		t.Error("Expected an unknown action not to be allowed")
+	}
+}
+
+// TestValidate tests the rule sets Set turns away, keeping the rules it had
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"allow", Rule{Pattern: "*.bank.com", Allow: []string{"correct"}}, false},
+		{"weights", Rule{Pattern: "*", Weights: map[string]float64{"corrupt": 1.5}}, false},
+		{"no pattern", Rule{Allow: []string{"correct"}}, true},
+		{"unknown allowed action", Rule{Pattern: "*", Allow: []string{"launder"}}, true},
+		{"unknown weighted action", Rule{Pattern: "*", Weights: map[string]float64{"launder": 2}}, true},
+		{"zero weight", Rule{Pattern: "*", Weights: map[string]float64{"delay": 0}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine(actions)
+			err := e.Set(Config{Rules: []Rule{tt.rule}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && len(e.Config().Rules) != 0 {
+				t.Errorf("Expected the rejected rules not to take effect, got %+v", e.Config())
+			}
+		})
+	}
+}
+
+// TestSaveConfig tests that saved rules load back the same
+func TestSaveConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	cfg := Config{Rules: []Rule{{Pattern: "*.bank.com", Description: "banks", Allow: []string{"correct"}, Weights: map[string]float64{"correct": 2}}}}
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("Expected %+v back, got %+v", cfg, loaded)
+	}
+}
@@ -0,0 +1,179 @@
+// gameserver/score.go
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/scoring"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//////////////////////////////////////////
+// Scoring State
+//////////////////////////////////////////
+
+var (
+	// scoringEngine turns decisions into points. main replaces it when SCORING_CONFIG is set,
+	// and admins can swap it at runtime; read it through currentScoringEngine.
+	scoringEngine   = scoring.NewEngine(scoring.DefaultConfig())
+	scoringEngineMu sync.RWMutex
+)
+
+// currentScoringEngine returns the scoring engine in effect.
+func currentScoringEngine() *scoring.Engine {
+	scoringEngineMu.RLock()
+	defer scoringEngineMu.RUnlock()
+	return scoringEngine
+}
+
+// setScoringEngine swaps in a new scoring engine.
+func setScoringEngine(engine *scoring.Engine) {
+	scoringEngineMu.Lock()
+	scoringEngine = engine
+	scoringEngineMu.Unlock()
+}
+
+//////////////////////////////////////////
+// Scoring Functions
+//////////////////////////////////////////
+
+// scoreDecision runs a player's decision through the scoring engine, applies the resulting awards
+// to the player and returns them.
+func scoreDecision(playerID string, dnsReq *DNSRequest, action string, decidedAt time.Time) []scoring.Award {
+	engine := currentScoringEngine()
+
+	playersMu.Lock()
+	defer playersMu.Unlock()
+
+	player, exists := players[playerID]
+	if !exists {
+		log.Printf("Player %s not found while updating score", playerID)
+		return nil
+	}
+
+	// Extend the player's streak or start a new one.
+	alignment := engine.Alignment(action)
+	if alignment == player.StreakAlignment {
+		player.Streak++
+	} else {
+		player.StreakAlignment = alignment
+		player.Streak = 1
+	}
+
+	awards := engine.Score(scoring.Decision{
+		Action:  action,
+		QName:   dnsReq.Name,
+		QType:   dnsReq.Type,
+		Elapsed: decidedAt.Sub(dnsReq.Timestamp),
+		Streak:  player.Streak,
+
+		Rule:       dnsReq.Rules.Pattern,
+		RuleWeight: dnsReq.Rules.Weight(action),
+	})
+	applyAwards(player, awards)
+	playerActionCounter.With(prometheus.Labels{"action": action}).Inc()
+
+	return awards
+}
+
+// penalizeTimeout applies the timeout penalty to a player who let an assigned request expire and breaks their streak.
+func penalizeTimeout(playerID string) []scoring.Award {
+	playersMu.Lock()
+	defer playersMu.Unlock()
+
+	player, exists := players[playerID]
+	if !exists {
+		return nil
+	}
+
+	player.Streak = 0
+	player.StreakAlignment = ""
+
+	awards := currentScoringEngine().TimeoutPenalty()
+	applyAwards(player, awards)
+	return awards
+}
+
+// applyAwards adds awards to a player's points and pending deltas. Callers must hold playersMu.
+func applyAwards(player *Player, awards []scoring.Award) {
+	pure, evil := scoring.Total(awards)
+	player.PurePoints += pure
+	player.PureDelta += pure
+	player.EvilPoints += evil
+	player.EvilDelta += evil
+	if player.TeamID != "" {
+		addTeamPoints(player.TeamID, pure, evil)
+	}
+	creditRound(player, pure, evil)
+	rankPlayer(player)
+}
+
+//////////////////////////////////////////
+// Scoring Handlers
+//////////////////////////////////////////
+
+// AwardView is a stored award as returned by /players/{id}/awards.
+type AwardView struct {
+	ID        int64     `json:"id"`
+	RequestID string    `json:"request_id"`
+	Rule      string    `json:"rule"`
+	Alignment string    `json:"alignment"`
+	Points    float64   `json:"points"`
+	Detail    string    `json:"detail"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// awardsHandler returns a page of a player's awards, newest first, so they can see why they scored what they did.
+//
+// Query parameters: cursor, limit.
+func awardsHandler(w http.ResponseWriter, r *http.Request, playerID string) {
+	limit, err := parseLimit(r, defaultHistoryLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var beforeID int64
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		beforeID, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || beforeID <= 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	awards, err := db.QueryAwards(playerID, beforeID, limit)
+	if err != nil {
+		log.Printf("Failed to query awards for player %s: %v", playerID, err)
+		http.Error(w, "Failed to load awards", http.StatusInternalServerError)
+		return
+	}
+
+	page := struct {
+		Awards     []AwardView `json:"awards"`
+		NextCursor string      `json:"next_cursor,omitempty"`
+	}{Awards: make([]AwardView, 0, len(awards))}
+	for _, a := range awards {
+		page.Awards = append(page.Awards, AwardView{
+			ID:        a.ID,
+			RequestID: a.RequestID,
+			Rule:      a.Rule,
+			Alignment: a.Alignment,
+			Points:    a.Points,
+			Detail:    a.Detail,
+			Timestamp: a.CreatedAt,
+		})
+	}
+	if len(awards) == limit {
+		page.NextCursor = strconv.FormatInt(awards[len(awards)-1].ID, 10)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,132 @@
+// gameserver/scoresync.go
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//////////////////////////////////////////
+// Score Sync Constants
+//////////////////////////////////////////
+
+// defaultScoreSyncInterval is how often point deltas are written to the database unless SCORE_SYNC_INTERVAL says otherwise.
+const defaultScoreSyncInterval = 30 * time.Second
+
+//////////////////////////////////////////
+// Score Sync Metrics and State
+//////////////////////////////////////////
+
+var (
+	// scoreSyncDuration measures how long writing a batch of point deltas takes.
+	scoreSyncDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gameserver_score_sync_duration_seconds",
+		Help:    "Time taken to write a batch of point deltas to the database, by result (ok, error)",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// scoreSyncRows counts point deltas written to the database.
+	scoreSyncRows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gameserver_score_sync_rows_total",
+		Help: "Point deltas written to the database, by table (players, teams)",
+	}, []string{"table"})
+
+	// scoreSyncMu lets one sync write at a time, and keeps a season rollover from resetting
+	// points while a snapshot taken before the reset is still being written.
+	scoreSyncMu sync.Mutex
+)
+
+//////////////////////////////////////////
+// Score Sync Functions
+//////////////////////////////////////////
+
+// syncPlayersToDatabase periodically syncs in-memory player and team points to SQLite.
+func syncPlayersToDatabase(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		playersSynced, teamsSynced, err := syncDeltas()
+		if err != nil {
+			log.Printf("Error syncing point deltas to database, will retry: %v", err)
+			continue
+		}
+		if playersSynced > 0 || teamsSynced > 0 {
+			log.Printf("Synced point deltas for %d players and %d teams to database", playersSynced, teamsSynced)
+		}
+	}
+}
+
+// syncDeltas writes every pending player and team point change in one transaction and returns
+// how many players and teams it wrote. The deltas are taken and cleared under the locks, so
+// handlers aren't held up by the write; if the write fails they are added back to be retried.
+func syncDeltas() (int, int, error) {
+	scoreSyncMu.Lock()
+	defer scoreSyncMu.Unlock()
+
+	playerDeltas, teamDeltas := takeDeltas()
+	if len(playerDeltas) == 0 && len(teamDeltas) == 0 {
+		return 0, 0, nil
+	}
+
+	start := time.Now()
+	if err := db.SyncPoints(playerDeltas, teamDeltas); err != nil {
+		scoreSyncDuration.With(prometheus.Labels{"result": "error"}).Observe(time.Since(start).Seconds())
+		restoreDeltas(playerDeltas, teamDeltas)
+		return 0, 0, err
+	}
+	scoreSyncDuration.With(prometheus.Labels{"result": "ok"}).Observe(time.Since(start).Seconds())
+	scoreSyncRows.With(prometheus.Labels{"table": "players"}).Add(float64(len(playerDeltas)))
+	scoreSyncRows.With(prometheus.Labels{"table": "teams"}).Add(float64(len(teamDeltas)))
+	return len(playerDeltas), len(teamDeltas), nil
+}
+
+// takeDeltas snapshots and clears every pending player and team point change.
+func takeDeltas() ([]db.PointsDelta, []db.PointsDelta) {
+	playersMu.Lock()
+	defer playersMu.Unlock()
+	teamsMu.Lock()
+	defer teamsMu.Unlock()
+
+	var playerDeltas, teamDeltas []db.PointsDelta
+	for _, player := range players {
+		if player.PureDelta != 0 || player.EvilDelta != 0 {
+			playerDeltas = append(playerDeltas, db.PointsDelta{ID: player.ID, Pure: player.PureDelta, Evil: player.EvilDelta})
+			player.PureDelta, player.EvilDelta = 0, 0
+		}
+	}
+	for _, team := range teamsByID {
+		if team.PureDelta != 0 || team.EvilDelta != 0 {
+			teamDeltas = append(teamDeltas, db.PointsDelta{ID: team.ID, Pure: team.PureDelta, Evil: team.EvilDelta})
+			team.PureDelta, team.EvilDelta = 0, 0
+		}
+	}
+	return playerDeltas, teamDeltas
+}
+
+// restoreDeltas adds deltas from a failed sync back on top of whatever was earned since.
+func restoreDeltas(playerDeltas, teamDeltas []db.PointsDelta) {
+	playersMu.Lock()
+	defer playersMu.Unlock()
+	teamsMu.Lock()
+	defer teamsMu.Unlock()
+
+	for _, d := range playerDeltas {
+		if player, exists := players[d.ID]; exists {
+			player.PureDelta += d.Pure
+			player.EvilDelta += d.Evil
+		}
+	}
+	for _, d := range teamDeltas {
+		if team, exists := teamsByID[d.ID]; exists {
+			team.PureDelta += d.Pure
+			team.EvilDelta += d.Evil
+		}
+	}
+}
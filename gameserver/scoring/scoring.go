@@ -0,0 +1,277 @@
+// scoring engine - turns a player's decision into points
+// every point comes with the rule that produced it so players
+// can see exactly why they got what they got
+// gameserver/scoring/scoring.go
+
+package scoring
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+	"github.com/nicewrld/gameserver/domains"
+)
+
+// which column the points land in
+const (
+	Pure = "pure"
+	Evil = "evil"
+)
+
+// ActionRule is what picking an action is worth
+type ActionRule struct {
+	Points    float64 `json:"points"`
+	Alignment string  `json:"alignment"` // pure or evil
+}
+
+// SpeedRule rewards deciding fast
+// the bonus shrinks linearly from MaxBonus at 0s to nothing at Window
+type SpeedRule struct {
+	MaxBonus float64         `json:"max_bonus"`
+	Window   config.Duration `json:"window"`
+}
+
+// StreakRule rewards sticking to one side
+// once a player has MinLength decisions in a row with the same alignment,
+// each further one multiplies their points by 1 + Step*(streak-MinLength+1), up to Max
+type StreakRule struct {
+	MinLength int     `json:"min_length"`
+	Step      float64 `json:"step"`
+	Max       float64 `json:"max"`
+}
+
+// CategoryRule weights a group of domains, e.g. banks are worth more
+type CategoryRule struct {
+	Name     string   `json:"name"`
+	Patterns []string `json:"patterns"` // see domains.Match
+	Weight   float64  `json:"weight"`
+}
+
+// PenaltyRule is what letting an assigned request time out costs
+type PenaltyRule struct {
+	Points    float64 `json:"points"`
+	Alignment string  `json:"alignment"`
+}
+
+// Config is the whole scoring setup, usually loaded from a json file
+type Config struct {
+	Actions        map[string]ActionRule `json:"actions"`
+	Speed          SpeedRule             `json:"speed"`
+	Streak         StreakRule            `json:"streak"`
+	QTypeWeights   map[string]float64    `json:"qtype_weights"`
+	Categories     []CategoryRule        `json:"categories"`
+	TimeoutPenalty PenaltyRule           `json:"timeout_penalty"`
+}
+
+// DefaultConfig is the classic game: one point per action, no bonuses
+func DefaultConfig() Config {
+	return Config{
+		Actions: map[string]ActionRule{
+			"correct":  {Points: 1, Alignment: Pure},
+			"corrupt":  {Points: 1, Alignment: Evil},
+			"delay":    {Points: 1, Alignment: Evil},
+			"nxdomain": {Points: 1, Alignment: Evil},
+		},
+		TimeoutPenalty: PenaltyRule{Alignment: Pure},
+	}
+}
+
+// LoadConfig reads a config file on top of the defaults
+// anything the file leaves out keeps its default value
+func LoadConfig(path string) (Config, error) {
+	return config.Load(path, DefaultConfig())
+}
+
+// Validate catches configs that would score nonsense
+func (c Config) Validate() error {
+	for action, rule := range c.Actions {
+		if rule.Alignment != Pure && rule.Alignment != Evil {
+			return fmt.Errorf("action %q: alignment must be %q or %q", action, Pure, Evil)
+		}
+	}
+	if c.Speed.MaxBonus > 0 && c.Speed.Window <= 0 {
+		return fmt.Errorf("speed: window must be positive")
+	}
+	if c.Streak.Step < 0 || (c.Streak.Max != 0 && c.Streak.Max < 1) {
+		return fmt.Errorf("streak: step must be >= 0 and max >= 1")
+	}
+	for _, cat := range c.Categories {
+		if cat.Weight < 0 {
+			return fmt.Errorf("category %q: weight must be >= 0", cat.Name)
+		}
+	}
+	if c.TimeoutPenalty.Points != 0 && c.TimeoutPenalty.Alignment != Pure && c.TimeoutPenalty.Alignment != Evil {
+		return fmt.Errorf("timeout_penalty: alignment must be %q or %q", Pure, Evil)
+	}
+	return nil
+}
+
+// Decision is everything the engine needs to know about one call
+type Decision struct {
+	Action  string
+	QName   string
+	QType   string
+	Elapsed time.Duration // time from query arriving to decision
+	Streak  int           // decisions in a row with this action's alignment, including this one
+
+	Rule       string  // domain rule that matched, if any
+	RuleWeight float64 // the rule's multiplier for this action, 0 or 1 for none
+}
+
+// Award is one line on the receipt
+type Award struct {
+	Rule      string  `json:"rule"`      // which rule produced it, e.g. "speed" or "category:banks"
+	Alignment string  `json:"alignment"` // pure or evil
+	Points    float64 `json:"points"`    // can be negative for penalties
+	Detail    string  `json:"detail"`    // human readable why
+}
+
+// Total adds up a set of awards per alignment
+func Total(awards []Award) (pure, evil float64) {
+	for _, a := range awards {
+		switch a.Alignment {
+		case Pure:
+			pure += a.Points
+		case Evil:
+			evil += a.Points
+		}
+	}
+	return pure, evil
+}
+
+// Engine scores decisions against a config
+// it holds no mutable state so it's safe to share
+type Engine struct {
+	cfg Config
+}
+
+// NewEngine wraps a config
+func NewEngine(cfg Config) *Engine {
+	return &Engine{cfg: cfg}
+}
+
+// Config hands back the config the engine was built with
+func (e *Engine) Config() Config {
+	return e.cfg
+}
+
+// Alignment says which side an action counts for, empty if it's unknown
+func (e *Engine) Alignment(action string) string {
+	return e.cfg.Actions[action].Alignment
+}
+
+// Score works out the awards for a decision
+// each multiplier is applied to the running total and shows up as its own award
+func (e *Engine) Score(d Decision) []Award {
+	rule, ok := e.cfg.Actions[d.Action]
+	if !ok {
+		return nil
+	}
+	align := rule.Alignment
+
+	awards := []Award{{
+		Rule:      "action:" + d.Action,
+		Alignment: align,
+		Points:    rule.Points,
+		Detail:    fmt.Sprintf("%g points for choosing %s", rule.Points, d.Action),
+	}}
+	running := rule.Points
+
+	// multiply the running total and record the difference
+	multiply := func(ruleName string, weight float64, detail string) {
+		if weight == 1 {
+			return
+		}
+		extra := round(running * (weight - 1))
+		running += extra
+		awards = append(awards, Award{Rule: ruleName, Alignment: align, Points: extra, Detail: detail})
+	}
+
+	if w, ok := e.cfg.QTypeWeights[d.QType]; ok {
+		multiply("qtype:"+d.QType, w, fmt.Sprintf("x%g for a %s query", w, d.QType))
+	}
+
+	for _, cat := range e.cfg.Categories {
+		if matchesAny(cat.Patterns, d.QName) {
+			multiply("category:"+cat.Name, cat.Weight, fmt.Sprintf("x%g for a %s domain", cat.Weight, cat.Name))
+			break
+		}
+	}
+
+	if d.RuleWeight > 0 {
+		multiply("rule:"+d.Rule, d.RuleWeight, fmt.Sprintf("x%g for %s under the %s rule", d.RuleWeight, d.Action, d.Rule))
+	}
+
+	if bonus := e.speedBonus(d.Elapsed); bonus > 0 {
+		awards = append(awards, Award{
+			Rule:      "speed",
+			Alignment: align,
+			Points:    bonus,
+			Detail:    fmt.Sprintf("+%g for deciding in %.1fs", bonus, d.Elapsed.Seconds()),
+		})
+		running += bonus
+	}
+
+	if m := e.streakMultiplier(d.Streak); m > 1 {
+		multiply("streak", m, fmt.Sprintf("x%g for a %d decision %s streak", m, d.Streak, align))
+	}
+
+	return awards
+}
+
+// TimeoutPenalty is what a player loses for sitting on a request until it expired
+func (e *Engine) TimeoutPenalty() []Award {
+	p := e.cfg.TimeoutPenalty
+	if p.Points == 0 {
+		return nil
+	}
+	return []Award{{
+		Rule:      "timeout_penalty",
+		Alignment: p.Alignment,
+		Points:    -p.Points,
+		Detail:    fmt.Sprintf("-%g for letting an assigned request time out", p.Points),
+	}}
+}
+
+// speedBonus scales MaxBonus down linearly over the window
+func (e *Engine) speedBonus(elapsed time.Duration) float64 {
+	s := e.cfg.Speed
+	window := time.Duration(s.Window)
+	if s.MaxBonus <= 0 || window <= 0 || elapsed >= window {
+		return 0
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return round(s.MaxBonus * (1 - float64(elapsed)/float64(window)))
+}
+
+// streakMultiplier works out the bonus multiplier for a streak length
+func (e *Engine) streakMultiplier(streak int) float64 {
+	s := e.cfg.Streak
+	if s.MinLength <= 0 || s.Step <= 0 || streak < s.MinLength {
+		return 1
+	}
+	m := 1 + s.Step*float64(streak-s.MinLength+1)
+	if s.Max > 0 && m > s.Max {
+		m = s.Max
+	}
+	return m
+}
+
+// matchesAny reports whether a name matches any of the patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if domains.Match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// round keeps points to two decimals so receipts stay readable
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,128 @@
+// gameserver/scoring/scoring_test.go
+
+package scoring
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+)
+
+// receipt is an award's rule and points, which is what the tests care about
+type receipt struct {
+	rule   string
+	points float64
+}
+
+func receipts(awards []Award) []receipt {
+	var out []receipt
+	for _, a := range awards {
+		out = append(out, receipt{a.Rule, a.Points})
+	}
+	return out
+}
+
+// TestScore tests each rule's award and the order multipliers apply in
+func TestScore(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Actions["corrupt"] = ActionRule{Points: 2, Alignment: Evil}
+	cfg.Speed = SpeedRule{MaxBonus: 1, Window: config.Duration(10 * time.Second)}
+	cfg.Streak = StreakRule{MinLength: 3, Step: 0.5, Max: 2}
+	cfg.QTypeWeights = map[string]float64{"AAAA": 1.5, "A": 1}
+	cfg.Categories = []CategoryRule{
+		{Name: "banks", Patterns: []string{"*.bank.com"}, Weight: 2},
+		{Name: "everything", Patterns: []string{"*"}, Weight: 3},
+	}
+	e := NewEngine(cfg)
+
+	slow := time.Minute
+	tests := []struct {
+		name string
+		d    Decision
+		want []receipt
+	}{
+		{"unknown action", Decision{Action: "launder"}, nil},
+		{"action only", Decision{Action: "corrupt", QName: "example.com", Elapsed: slow}, []receipt{{"action:corrupt", 2}, {"category:everything", 4}}},
+		{"weight of 1 adds nothing", Decision{Action: "correct", QType: "A", QName: "www.bank.com", Elapsed: slow}, []receipt{{"action:correct", 1}, {"category:banks", 1}}},
+		{"first category wins", Decision{Action: "correct", QName: "www.bank.com", Elapsed: slow}, []receipt{{"action:correct", 1}, {"category:banks", 1}}},
+		{"qtype then category", Decision{Action: "corrupt", QType: "AAAA", QName: "www.bank.com", Elapsed: slow}, []receipt{{"action:corrupt", 2}, {"qtype:AAAA", 1}, {"category:banks", 3}}},
+		{"domain rule", Decision{Action: "correct", QName: "www.bank.com", Elapsed: slow, Rule: "*.bank.com", RuleWeight: 0.5}, []receipt{{"action:correct", 1}, {"category:banks", 1}, {"rule:*.bank.com", -1}}},
+		{"instant speed bonus", Decision{Action: "correct", QName: "www.bank.com"}, []receipt{{"action:correct", 1}, {"category:banks", 1}, {"speed", 1}}},
+		{"speed bonus shrinks", Decision{Action: "correct", QName: "www.bank.com", Elapsed: 7500 * time.Millisecond}, []receipt{{"action:correct", 1}, {"category:banks", 1}, {"speed", 0.25}}},
+		{"short streak", Decision{Action: "correct", QName: "www.bank.com", Elapsed: slow, Streak: 2}, []receipt{{"action:correct", 1}, {"category:banks", 1}}},
+		{"streak", Decision{Action: "correct", QName: "www.bank.com", Elapsed: slow, Streak: 3}, []receipt{{"action:correct", 1}, {"category:banks", 1}, {"streak", 1}}},
+		{"streak capped", Decision{Action: "correct", QName: "www.bank.com", Elapsed: slow, Streak: 50}, []receipt{{"action:correct", 1}, {"category:banks", 1}, {"streak", 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awards := e.Score(tt.d)
+			if got := receipts(awards); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			for _, a := range awards {
+				if a.Alignment != e.Alignment(tt.d.Action) {
+					t.Errorf("Expected every award on the %s side, got %+v", e.Alignment(tt.d.Action), a)
+				}
+			}
+		})
+	}
+}
+
+// TestTotal tests adding awards up per side
+func TestTotal(t *testing.T) {
+	tests := []struct {
+		awards     []Award
+		pure, evil float64
+	}{
+		{nil, 0, 0},
+		{[]Award{{Alignment: Pure, Points: 1}, {Alignment: Pure, Points: 0.5}}, 1.5, 0},
+		{[]Award{{Alignment: Evil, Points: 2}, {Alignment: Pure, Points: -1}}, -1, 2},
+		{[]Award{{Alignment: "", Points: 9}}, 0, 0},
+	}
+	for _, tt := range tests {
+		if pure, evil := Total(tt.awards); pure != tt.pure || evil != tt.evil {
+			t.Errorf("Total(%+v): expected %v pure and %v evil, got %v and %v", tt.awards, tt.pure, tt.evil, pure, evil)
+		}
+	}
+}
+
+// TestTimeoutPenalty tests that letting a request time out costs points only when configured to
+func TestTimeoutPenalty(t *testing.T) {
+	if awards := NewEngine(DefaultConfig()).TimeoutPenalty(); awards != nil {
+		t.Errorf("Expected no penalty by default, got %+v", awards)
+	}
+	cfg := DefaultConfig()
+	cfg.TimeoutPenalty = PenaltyRule{Points: 2, Alignment: Evil}
+	awards := NewEngine(cfg).TimeoutPenalty()
+	if got := receipts(awards); !reflect.DeepEqual(got, []receipt{{"timeout_penalty", -2}}) || awards[0].Alignment != Evil {
+		t.Errorf("Expected -2 evil, got %+v", awards)
+	}
+}
+
+// TestValidate tests the scoring configs that would score nonsense
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr bool
+	}{
+		{"default", func(*Config) {}, false},
+		{"unknown alignment", func(c *Config) { c.Actions["delay"] = ActionRule{Points: 1, Alignment: "chaotic"} }, true},
+		{"speed bonus without a window", func(c *Config) { c.Speed.MaxBonus = 1 }, true},
+		{"negative streak step", func(c *Config) { c.Streak.Step = -1 }, true},
+		{"streak max below 1", func(c *Config) { c.Streak.Max = 0.5 }, true},
+		{"negative category weight", func(c *Config) { c.Categories = []CategoryRule{{Name: "banks", Weight: -1}} }, true},
+		{"penalty without a side", func(c *Config) { c.TimeoutPenalty = PenaltyRule{Points: 1} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.change(&cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,472 @@
+// gameserver/seasons.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/events"
+)
+
+//////////////////////////////////////////
+// Season Constants
+//////////////////////////////////////////
+
+const (
+	// seasonCheckInterval is how often the scheduler checks whether the season has run its length.
+	seasonCheckInterval = 1 * time.Minute
+
+	// roundWinners is how many of a round's top players count as its winners.
+	roundWinners = 3
+
+	// recentRoundsLimit is how many finished rounds /rounds lists.
+	recentRoundsLimit = 10
+
+	// defaultRoundLength is used when a round is started without a duration.
+	defaultRoundLength = 15 * time.Minute
+)
+
+//////////////////////////////////////////
+// Season Data Structures
+//////////////////////////////////////////
+
+// Round is a short timed sprint with its own scores, separate from the season leaderboard.
+type Round struct {
+	ID        int64
+	StartedAt time.Time
+	EndsAt    time.Time
+	scores    map[string]*db.Standing // points earned during the round, by player ID
+}
+
+// SeasonView is a season as returned by /seasons.
+type SeasonView struct {
+	Number    int64      `json:"number"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Current   bool       `json:"current"`
+}
+
+// StandingView is a player's placing in a season or round.
+type StandingView struct {
+	Rank         int     `json:"rank"`
+	PlayerID     string  `json:"player_id"`
+	Nickname     string  `json:"nickname"`
+	PurePoints   float64 `json:"pure_points"`
+	EvilPoints   float64 `json:"evil_points"`
+	NetAlignment float64 `json:"net_alignment"`
+}
+
+// RoundView is a round as returned by /rounds.
+type RoundView struct {
+	ID        int64          `json:"id"`
+	StartedAt time.Time      `json:"started_at"`
+	EndsAt    time.Time      `json:"ends_at"`
+	EndedAt   *time.Time     `json:"ended_at,omitempty"`
+	Standings []StandingView `json:"standings"`
+}
+
+//////////////////////////////////////////
+// Season State
+//////////////////////////////////////////
+
+var (
+	// currentSeason is the season being played. seasonMu also serializes rollovers.
+	currentSeason = db.Season{Number: 1, StartedAt: time.Now()}
+	seasonMu      sync.Mutex
+
+	// currentRound is the round being played, or nil between rounds.
+	currentRound *Round
+	roundMu      sync.Mutex
+
+	errRoundRunning  = errors.New("A round is already running.")
+	errUnknownSeason = errors.New("Unknown season")
+)
+
+//////////////////////////////////////////
+// Season Functions
+//////////////////////////////////////////
+
+// loadSeason restores the running season from the database, starting season 1 on a fresh database.
+func loadSeason() {
+	season, err := db.CurrentSeason(time.Now())
+	if err != nil {
+		log.Printf("Warning: Failed to load current season: %v", err)
+		return
+	}
+	seasonMu.Lock()
+	currentSeason = season
+	seasonMu.Unlock()
+	log.Printf("Playing season %d, started %s", season.Number, season.StartedAt.Format(time.RFC3339))
+}
+
+// seasonNumber returns the number of the season being played.
+func seasonNumber() int64 {
+	seasonMu.Lock()
+	defer seasonMu.Unlock()
+	return currentSeason.Number
+}
+
+// rolloverSeason archives the current standings, resets every player and team to zero and starts the next season.
+func rolloverSeason() (db.Season, error) {
+	seasonMu.Lock()
+	defer seasonMu.Unlock()
+
+	// Wait out any point sync in progress, so deltas from before the reset don't land after it.
+	scoreSyncMu.Lock()
+	defer scoreSyncMu.Unlock()
+
+	// Hold the players lock across the write so no points land between the snapshot and the reset.
+	playersMu.Lock()
+	standings := make([]db.Standing, 0, len(players))
+	for _, player := range players {
+		standings = append(standings, db.Standing{
+			PlayerID:   player.ID,
+			Nickname:   player.Nickname,
+			PurePoints: player.PurePoints,
+			EvilPoints: player.EvilPoints,
+		})
+	}
+	rankStandings(standings)
+
+	next, err := db.RolloverSeason(currentSeason.Number, standings, time.Now())
+	if err != nil {
+		playersMu.Unlock()
+		return currentSeason, err
+	}
+	for _, player := range players {
+		player.PurePoints, player.EvilPoints = 0, 0
+		player.PureDelta, player.EvilDelta = 0, 0
+		player.Streak, player.StreakAlignment = 0, ""
+		rankPlayer(player)
+	}
+	playersMu.Unlock()
+
+	teamsMu.Lock()
+	for _, team := range teamsByID {
+		team.PurePoints, team.EvilPoints = 0, 0
+		team.PureDelta, team.EvilDelta = 0, 0
+	}
+	teamsMu.Unlock()
+
+	previous := currentSeason.Number
+	currentSeason = next
+	log.Printf("Season %d ended with %d players; season %d has begun", previous, len(standings), next.Number)
+
+	eventBus.Publish(events.Event{
+		Type: events.SeasonStarted,
+		Data: map[string]int64{"season": next.Number, "previous": previous},
+	})
+	return next, nil
+}
+
+// scheduleSeasons rolls the season over every length.
+func scheduleSeasons(length time.Duration) {
+	ticker := time.NewTicker(seasonCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		seasonMu.Lock()
+		due := now.Sub(currentSeason.StartedAt) >= length
+		seasonMu.Unlock()
+		if !due {
+			continue
+		}
+		if _, err := rolloverSeason(); err != nil {
+			log.Printf("Error rolling over season: %v", err)
+		}
+	}
+}
+
+// rankStandings sorts standings by total points and numbers them from 1.
+func rankStandings(standings []db.Standing) {
+	sort.Slice(standings, func(i, j int) bool {
+		totalI := standings[i].PurePoints + standings[i].EvilPoints
+		totalJ := standings[j].PurePoints + standings[j].EvilPoints
+		if totalI != totalJ {
+			return totalI > totalJ
+		}
+		return standings[i].PlayerID < standings[j].PlayerID
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+}
+
+//////////////////////////////////////////
+// Round Functions
+//////////////////////////////////////////
+
+// startRound begins a round that ends on its own after length.
+func startRound(length time.Duration) (*Round, error) {
+	roundMu.Lock()
+	defer roundMu.Unlock()
+
+	if currentRound != nil {
+		return nil, errRoundRunning
+	}
+
+	now := time.Now()
+	round := &Round{StartedAt: now, EndsAt: now.Add(length), scores: make(map[string]*db.Standing)}
+	id, err := db.CreateRound(round.StartedAt, round.EndsAt)
+	if err != nil {
+		return nil, err
+	}
+	round.ID = id
+	currentRound = round
+	time.AfterFunc(length, func() { endRound(id) })
+
+	log.Printf("Round %d started; it ends at %s", id, round.EndsAt.Format(time.RFC3339))
+	eventBus.Publish(events.Event{
+		Type: events.RoundStarted,
+		Data: map[string]interface{}{"round_id": id, "ends_at": round.EndsAt},
+	})
+	return round, nil
+}
+
+// creditRound adds points to a player's score for the running round. Callers hold playersMu.
+func creditRound(player *Player, pure, evil float64) {
+	roundMu.Lock()
+	defer roundMu.Unlock()
+
+	if currentRound == nil {
+		return
+	}
+	score, exists := currentRound.scores[player.ID]
+	if !exists {
+		score = &db.Standing{PlayerID: player.ID, Nickname: player.Nickname}
+		currentRound.scores[player.ID] = score
+	}
+	score.PurePoints += pure
+	score.EvilPoints += evil
+}
+
+// endRound finishes the round with the given ID, saving its standings and announcing the winners.
+func endRound(id int64) {
+	roundMu.Lock()
+	round := currentRound
+	if round == nil || round.ID != id {
+		roundMu.Unlock()
+		return
+	}
+	currentRound = nil
+	standings := roundStandings(round)
+	roundMu.Unlock()
+
+	if err := db.FinishRound(round.ID, time.Now(), standings); err != nil {
+		log.Printf("Error saving results of round %d: %v", round.ID, err)
+	}
+
+	winners := standings
+	if len(winners) > roundWinners {
+		winners = winners[:roundWinners]
+	}
+	log.Printf("Round %d ended with %d players scoring", round.ID, len(standings))
+	eventBus.Publish(events.Event{
+		Type: events.RoundEnded,
+		Data: map[string]interface{}{"round_id": round.ID, "winners": standingViews(winners)},
+	})
+}
+
+// runRounds plays rounds of the given length back to back, with a pause in between.
+func runRounds(length, pause time.Duration) {
+	for {
+		if _, err := startRound(length); err != nil && err != errRoundRunning {
+			log.Printf("Error starting round: %v", err)
+		}
+		time.Sleep(length + pause)
+	}
+}
+
+// roundStandings ranks a round's scores. Callers hold roundMu.
+func roundStandings(round *Round) []db.Standing {
+	standings := make([]db.Standing, 0, len(round.scores))
+	for _, score := range round.scores {
+		standings = append(standings, *score)
+	}
+	rankStandings(standings)
+	return standings
+}
+
+// standingViews converts stored standings for the API.
+func standingViews(standings []db.Standing) []StandingView {
+	views := make([]StandingView, 0, len(standings))
+	for _, s := range standings {
+		views = append(views, StandingView{
+			Rank:         s.Rank,
+			PlayerID:     s.PlayerID,
+			Nickname:     s.Nickname,
+			PurePoints:   s.PurePoints,
+			EvilPoints:   s.EvilPoints,
+			NetAlignment: s.PurePoints - s.EvilPoints,
+		})
+	}
+	return views
+}
+
+//////////////////////////////////////////
+// Season Handlers
+//////////////////////////////////////////
+
+// seasonsHandler lists every season, newest first.
+func seasonsHandler(w http.ResponseWriter, r *http.Request) {
+	seasons, err := db.GetSeasonsContext(r.Context())
+	if err != nil {
+		log.Printf("Failed to list seasons: %v", err)
+		http.Error(w, "Failed to load seasons", http.StatusInternalServerError)
+		return
+	}
+
+	current := seasonNumber()
+	views := make([]SeasonView, 0, len(seasons))
+	for _, s := range seasons {
+		view := SeasonView{Number: s.Number, StartedAt: s.StartedAt, Current: s.Number == current}
+		if !s.EndedAt.IsZero() {
+			endedAt := s.EndedAt
+			view.EndedAt = &endedAt
+		}
+		views = append(views, view)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// seasonRolloverHandler ends the current season. Admin only.
+func seasonRolloverHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := authenticateAdmin(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	season, err := rolloverSeason()
+	if err != nil {
+		log.Printf("Failed to roll over season: %v", err)
+		http.Error(w, "Failed to roll over season", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SeasonView{Number: season.Number, StartedAt: season.StartedAt, Current: true})
+}
+
+// seasonLeaderboardHandler serves a page of a finished season's final leaderboard.
+func seasonLeaderboardHandler(w http.ResponseWriter, r *http.Request, season int64, page, pageSize int) {
+	results, ok, err := db.GetSeasonResultsContext(r.Context(), season, (page-1)*pageSize, pageSize)
+	if err != nil {
+		log.Printf("Failed to load results of season %d: %v", season, err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", errLeaderboardFailed)
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "unknown_season", errUnknownSeason)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(standingViews(results))
+}
+
+// roundsHandler shows the running round's standings and recent winners on GET, and starts a round on POST.
+//
+// Starting is admin only and takes an optional duration query parameter (default 15m).
+func roundsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		roundsListHandler(w, r)
+	case http.MethodPost:
+		if err := authenticateAdmin(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		length := defaultRoundLength
+		if value := r.URL.Query().Get("duration"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid duration", http.StatusBadRequest)
+				return
+			}
+			length = d
+		}
+
+		round, err := startRound(length)
+		switch err {
+		case nil:
+		case errRoundRunning:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			log.Printf("Failed to start round: %v", err)
+			http.Error(w, "Failed to start round", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(RoundView{ID: round.ID, StartedAt: round.StartedAt, EndsAt: round.EndsAt, Standings: []StandingView{}})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// roundsListHandler writes the running round, if any, and the most recent finished rounds with their winners.
+func roundsListHandler(w http.ResponseWriter, r *http.Request) {
+	var current *RoundView
+	roundMu.Lock()
+	if currentRound != nil {
+		current = &RoundView{
+			ID:        currentRound.ID,
+			StartedAt: currentRound.StartedAt,
+			EndsAt:    currentRound.EndsAt,
+			Standings: standingViews(roundStandings(currentRound)),
+		}
+	}
+	roundMu.Unlock()
+
+	rounds, err := db.GetRoundsContext(r.Context(), recentRoundsLimit, roundWinners)
+	if err != nil {
+		log.Printf("Failed to list rounds: %v", err)
+		http.Error(w, "Failed to load rounds", http.StatusInternalServerError)
+		return
+	}
+	recent := make([]RoundView, 0, len(rounds))
+	for _, round := range rounds {
+		endedAt := round.EndedAt
+		recent = append(recent, RoundView{
+			ID:        round.ID,
+			StartedAt: round.StartedAt,
+			EndsAt:    round.EndsAt,
+			EndedAt:   &endedAt,
+			Standings: standingViews(round.Winners),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Current *RoundView  `json:"current"`
+		Recent  []RoundView `json:"recent"`
+	}{current, recent})
+}
+
+// parseSeason reads the season query parameter. Zero means the current season.
+func parseSeason(r *http.Request) (int64, error) {
+	value := r.URL.Query().Get("season")
+	if value == "" {
+		return 0, nil
+	}
+	season, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || season < 1 {
+		return 0, errors.New("Invalid season")
+	}
+	return season, nil
+}
@@ -0,0 +1,197 @@
+// gameserver/sessions.go
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nicewrld/gameserver/cache"
+	"github.com/nicewrld/gameserver/client"
+	"github.com/nicewrld/gameserver/db"
+)
+
+//////////////////////////////////////////
+// Session Constants
+//////////////////////////////////////////
+
+const (
+	// sessionTokenBytes is the amount of randomness in a session token.
+	sessionTokenBytes = 32
+
+	// sessionCacheTTL is how long a validated session is trusted without rereading SQLite.
+	sessionCacheTTL = 5 * time.Minute
+
+	// sessionPruneInterval is how often expired sessions are deleted.
+	sessionPruneInterval = 1 * time.Hour
+
+	// SessionTokenHeader carries the session token in /register responses.
+	SessionTokenHeader = client.SessionTokenHeader
+
+	// SessionExpiresHeader carries the session expiry (RFC 3339) in /register responses.
+	SessionExpiresHeader = client.SessionExpiresHeader
+)
+
+//////////////////////////////////////////
+// Session State
+//////////////////////////////////////////
+
+var (
+	// sessionTTL is how long a newly issued session stays valid.
+	sessionTTL = 30 * 24 * time.Hour
+
+	// sessionCache holds recently validated sessions keyed by token hash.
+	sessionCache = cache.NewCache(sessionCacheTTL, nil)
+
+	// errUnauthorized is returned when a request lacks a valid session for the player it acts as.
+	errUnauthorized = errors.New("Unauthorized")
+
+	errLogoutFailed = errors.New("Failed to log out")
+)
+
+//////////////////////////////////////////
+// Session Functions
+//////////////////////////////////////////
+
+// newSessionToken returns a random, URL-safe session token.
+func newSessionToken() (string, error) {
+	b := make([]byte, sessionTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSessionToken returns the hex SHA-256 of a token. Only hashes are stored, so a leaked database does not leak sessions.
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createSession issues and stores a new session for a player, returning the secret token.
+func createSession(playerID string) (string, time.Time, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	session := db.Session{
+		TokenHash: hashSessionToken(token),
+		PlayerID:  playerID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionTTL),
+	}
+	if err := db.CreateSession(session); err != nil {
+		return "", time.Time{}, err
+	}
+	sessionCache.Set(session.TokenHash, &session)
+	return token, session.ExpiresAt, nil
+}
+
+// sessionTokenFromRequest extracts the bearer token from the Authorization header.
+func sessionTokenFromRequest(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+	return ""
+}
+
+// lookupSession returns the unexpired session for a token, or nil if there is none.
+func lookupSession(token string) (*db.Session, error) {
+	if token == "" {
+		return nil, nil
+	}
+	hash := hashSessionToken(token)
+
+	var session *db.Session
+	if cached, ok := sessionCache.Get(hash); ok {
+		session = cached.(*db.Session)
+	} else {
+		var err error
+		session, err = db.GetSession(hash)
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessionCache.Set(hash, session)
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		sessionCache.Delete(hash)
+		return nil, nil
+	}
+	return session, nil
+}
+
+// authenticatePlayer checks that the request carries a valid session for playerID.
+func authenticatePlayer(r *http.Request, playerID string) error {
+	session, err := lookupSession(sessionTokenFromRequest(r))
+	if err != nil {
+		log.Printf("Failed to look up session: %v", err)
+		return errUnauthorized
+	}
+	if session == nil || session.PlayerID != playerID {
+		log.Printf("[PlayerID: %s] Rejected request without a valid session", playerID)
+		return errUnauthorized
+	}
+	return nil
+}
+
+//////////////////////////////////////////
+// Session Handlers
+//////////////////////////////////////////
+
+// logoutHandler revokes the session presented in the Authorization header.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "method_not_allowed", errMethodNotAllowed)
+		return
+	}
+
+	token := sessionTokenFromRequest(r)
+	if token == "" {
+		writeError(w, r, http.StatusUnauthorized, "unauthorized", errUnauthorized)
+		return
+	}
+
+	hash := hashSessionToken(token)
+	sessionCache.Delete(hash)
+	if err := db.DeleteSession(hash); err != nil {
+		log.Printf("Failed to delete session: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", errLogoutFailed)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+//////////////////////////////////////////
+// Session Background Goroutines
+//////////////////////////////////////////
+
+// pruneSessions periodically deletes expired sessions.
+func pruneSessions() {
+	ticker := time.NewTicker(sessionPruneInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := db.PruneSessions(time.Now())
+		if err != nil {
+			log.Printf("Error pruning sessions: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("Pruned %d expired sessions", deleted)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// gameserver/shutdown.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/nicewrld/gameserver/voting"
+)
+
+//////////////////////////////////////////
+// Shutdown State
+//////////////////////////////////////////
+
+var (
+	// shuttingDown stops new assignments and answers new DNS requests with the fallback while the server drains.
+	shuttingDown atomic.Bool
+
+	errShuttingDown = errors.New("The game server is restarting. Please try again in a moment.")
+)
+
+// shutdownReport is what a shutdown got done, logged on the way out.
+type shutdownReport struct {
+	Resolved  int           // DNS requests still waiting on players, answered with the fallback
+	Decisions int           // buffered decisions written to the history
+	Players   int           // players whose unsynced points were flushed
+	Teams     int           // teams whose unsynced points were flushed
+	FlushErr  error         // why the final point flush failed, if it did
+	Took      time.Duration // how long draining took
+}
+
+//////////////////////////////////////////
+// Shutdown Functions
+//////////////////////////////////////////
+
+// drain winds the game down without losing anything: no new assignments are handed out, every DNS
+// request still waiting on a player is answered with the fallback, spectators' event streams are
+// ended, the HTTP server finishes what's in flight, and buffered decisions and point deltas are
+// written out. The caller closes the database.
+func drain(server *http.Server, timeout time.Duration) shutdownReport {
+	start := time.Now()
+	shuttingDown.Store(true)
+
+	// Answer CoreDNS before the server stops waiting for its requests.
+	report := shutdownReport{Resolved: resolveOpenRequests(voting.FallbackAction)}
+
+	// Spectators' event streams never finish on their own, so end them rather than wait them out.
+	server.RegisterOnShutdown(stopEventStreams)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Warning: HTTP server did not shut down cleanly: %v", err)
+	}
+
+	// Write any buffered decisions, then the points they earned, before the process exits.
+	if decisionHistory != nil {
+		report.Decisions = decisionHistory.Flush()
+		dbJobs.Shutdown()
+	}
+	report.Players, report.Teams, report.FlushErr = syncDeltas()
+
+	report.Took = time.Since(start)
+	return report
+}
+
+// logShutdown reports what a shutdown did.
+func logShutdown(report shutdownReport) {
+	log.Printf("Shutdown: resolved %d waiting DNS requests with %q, wrote %d decisions", report.Resolved, voting.FallbackAction, report.Decisions)
+	if report.FlushErr != nil {
+		log.Printf("Shutdown: failed to flush unsynced points, they are lost: %v", report.FlushErr)
+	} else {
+		log.Printf("Shutdown: flushed unsynced points for %d players and %d teams", report.Players, report.Teams)
+	}
+	log.Printf("Shutdown complete in %s", report.Took.Round(time.Millisecond))
+}
@@ -0,0 +1,267 @@
+// gameserver/stream.go
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nicewrld/gameserver/scoring"
+)
+
+//////////////////////////////////////////
+// Streaming Constants
+//////////////////////////////////////////
+
+const (
+	// streamWriteWait is the time allowed to write a single message to a streaming player.
+	streamWriteWait = 10 * time.Second
+
+	// streamPongWait is the time allowed between pongs before a streaming player is considered gone.
+	streamPongWait = 60 * time.Second
+
+	// streamPingPeriod is how often the server pings streaming players. Must be less than streamPongWait.
+	streamPingPeriod = (streamPongWait * 9) / 10
+)
+
+//////////////////////////////////////////
+// Streaming Data Structures
+//////////////////////////////////////////
+
+// StreamMessage is a single frame exchanged over a player's stream connection.
+//
+// Server to player types: assignment, expired, cancelled, result.
+// Player to server types: action.
+type StreamMessage struct {
+	Type      string          `json:"type"`                 // Message type
+	Request   *DNSRequest     `json:"request,omitempty"`    // Assigned DNS request (assignment)
+	Deadline  *time.Time      `json:"deadline,omitempty"`   // When the assigned request times out (assignment)
+	RequestID string          `json:"request_id,omitempty"` // DNS request the message refers to
+	Action    string          `json:"action,omitempty"`     // Chosen action (action, result)
+	Error     string          `json:"error,omitempty"`      // Reason the action was rejected (result)
+	Awards    []scoring.Award `json:"awards,omitempty"`     // Points earned and the rules behind them (result)
+}
+
+// playerStream wraps a player's WebSocket connection and serializes writes to it.
+type playerStream struct {
+	playerID string
+	ip       string // client address, for rate limiting
+	conn     *websocket.Conn
+	writeMu  sync.Mutex
+}
+
+//////////////////////////////////////////
+// Request Arrival Signal
+//////////////////////////////////////////
+
+var (
+	// requestSignal is closed and replaced every time a DNS request is queued,
+	// waking every streaming player that is waiting for work.
+	requestSignal   = make(chan struct{})
+	requestSignalMu sync.Mutex
+
+	upgrader = websocket.Upgrader{
+		HandshakeTimeout: 5 * time.Second,
+	}
+)
+
+// signalNewRequest wakes all streaming players waiting for a DNS request.
+func signalNewRequest() {
+	requestSignalMu.Lock()
+	close(requestSignal)
+	requestSignal = make(chan struct{})
+	requestSignalMu.Unlock()
+}
+
+// waitForRequest returns a channel that is closed when the next DNS request is queued.
+func waitForRequest() <-chan struct{} {
+	requestSignalMu.Lock()
+	defer requestSignalMu.Unlock()
+	return requestSignal
+}
+
+//////////////////////////////////////////
+// Stream Handler
+//////////////////////////////////////////
+
+// streamHandler upgrades a player to a WebSocket connection, pushes DNS requests to them as soon as
+// they arrive, and accepts their actions on the same connection.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	playerID := r.URL.Query().Get("player_id")
+	if playerID == "" {
+		http.Error(w, "Missing player_id", http.StatusBadRequest)
+		return
+	}
+
+	playersMu.RLock()
+	_, exists := players[playerID]
+	playersMu.RUnlock()
+	if !exists {
+		http.Error(w, "Invalid player_id", http.StatusBadRequest)
+		return
+	}
+	if err := authenticatePlayer(r, playerID); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client.
+		log.Printf("[PlayerID: %s] Failed to upgrade stream: %v", playerID, err)
+		return
+	}
+	defer conn.Close()
+
+	stream := &playerStream{playerID: playerID, ip: clientIP(r), conn: conn}
+	log.Printf("[PlayerID: %s] Stream connected", playerID)
+
+	// The read pump feeds actions to the main loop and closes done when the player goes away.
+	actions := make(chan StreamMessage)
+	done := make(chan struct{})
+	quit := make(chan struct{})
+	defer close(quit)
+	go stream.readPump(actions, done, quit)
+	go stream.pingPump(done)
+
+	stream.run(actions, done)
+	log.Printf("[PlayerID: %s] Stream disconnected", playerID)
+}
+
+// run assigns DNS requests to the player and relays their actions until the connection closes.
+func (s *playerStream) run(actions <-chan StreamMessage, done <-chan struct{}) {
+	for {
+		// Grab the signal before trying to assign so a request queued in between is not missed.
+		wake := waitForRequest()
+
+		dnsReq, err := assignRequestToPlayer(s.playerID)
+		switch err {
+		case nil:
+		case errNoRequests:
+			select {
+			case <-wake:
+				continue
+			case <-done:
+				return
+			}
+		case errRequestTooOld:
+			continue
+		default:
+			s.send(StreamMessage{Type: "cancelled", Error: err.Error()})
+			return
+		}
+
+		deadline := dnsReq.Timestamp.Add(RequestTimeout)
+		if err := s.send(StreamMessage{Type: "assignment", Request: dnsReq.snapshot(), Deadline: &deadline}); err != nil {
+			return
+		}
+
+		if !s.awaitAction(dnsReq, actions, done) {
+			return
+		}
+	}
+}
+
+// awaitAction waits for the player's decision on an assigned request, pushing expiry or cancellation
+// if the request is resolved without them. It reports whether the stream should keep running.
+func (s *playerStream) awaitAction(dnsReq *DNSRequest, actions <-chan StreamMessage, done <-chan struct{}) bool {
+	for {
+		select {
+		case msg := <-actions:
+			if msg.Type != "action" {
+				s.send(StreamMessage{Type: "result", RequestID: msg.RequestID, Error: "Unknown message type"})
+				continue
+			}
+			result := StreamMessage{Type: "result", RequestID: msg.RequestID, Action: msg.Action}
+			err := allowCall("submit", s.playerID, s.ip)
+			var awards []scoring.Award
+			if err == nil {
+				awards, err = submitPlayerAction(s.playerID, msg.RequestID, msg.Action)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			result.Awards = awards
+			if s.send(result) != nil {
+				return false
+			}
+			// A rejected action leaves the assignment in place unless it is no longer valid.
+			if err == nil || err == errRequestHandled || err == errRequestExpired {
+				return true
+			}
+		case <-dnsReq.resolved:
+			msgType := "cancelled"
+			if dnsReq.timedOut() {
+				msgType = "expired"
+			}
+			clearPlayerAssignment(s.playerID, releaseOutcome(dnsReq))
+			return s.send(StreamMessage{Type: msgType, RequestID: dnsReq.RequestID}) == nil
+		case <-done:
+			return false
+		}
+	}
+}
+
+// readPump reads player messages until the connection fails, then closes done.
+// quit is closed once the main loop has stopped consuming actions.
+func (s *playerStream) readPump(actions chan<- StreamMessage, done chan<- struct{}, quit <-chan struct{}) {
+	defer close(done)
+
+	s.conn.SetReadLimit(4096)
+	s.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+
+	for {
+		var msg StreamMessage
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("[PlayerID: %s] Stream read error: %v", s.playerID, err)
+			}
+			return
+		}
+		select {
+		case actions <- msg:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// pingPump keeps the connection alive through proxies until done is closed.
+func (s *playerStream) pingPump(done <-chan struct{}) {
+	ticker := time.NewTicker(streamPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.writeMu.Lock()
+			s.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			err := s.conn.WriteMessage(websocket.PingMessage, nil)
+			s.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// send writes a JSON message to the player.
+func (s *playerStream) send(msg StreamMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	if err := s.conn.WriteJSON(msg); err != nil {
+		log.Printf("[PlayerID: %s] Failed to write to stream: %v", s.playerID, err)
+		return err
+	}
+	return nil
+}
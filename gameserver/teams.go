@@ -0,0 +1,425 @@
+// gameserver/teams.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nicewrld/gameserver/client"
+	"github.com/nicewrld/gameserver/db"
+	"github.com/nicewrld/gameserver/events"
+	"github.com/nicewrld/gameserver/queue"
+	"github.com/nicewrld/gameserver/teams"
+)
+
+//////////////////////////////////////////
+// Team Constants
+//////////////////////////////////////////
+
+const (
+	// maxTeamNameLength caps team names, in characters.
+	maxTeamNameLength = 32
+
+	// objectiveCheckInterval is how often held objectives are checked for completion when no decisions come in.
+	objectiveCheckInterval = 1 * time.Minute
+
+	// objectiveJobType identifies job queue jobs that record a completed objective.
+	objectiveJobType = "objective"
+)
+
+//////////////////////////////////////////
+// Team Data Structures
+//////////////////////////////////////////
+
+// Team is a faction or custom team and the points its members earned while on it.
+type Team struct {
+	ID         string  // Unique team identifier
+	Name       string  // Display name of the team
+	PurePoints float64 // Pure points earned by members while on the team, plus objective bonuses
+	EvilPoints float64 // Evil points earned by members while on the team, plus objective bonuses
+	PureDelta  float64 // Pending pure point changes to be synced to the database
+	EvilDelta  float64 // Pending evil point changes to be synced to the database
+}
+
+// TeamView is a team as returned by the teams API and the team leaderboard.
+type TeamView = client.TeamView
+
+// ObjectiveView is a team's progress on one objective.
+type ObjectiveView struct {
+	ID          string  `json:"id"`
+	Description string  `json:"description"`
+	Domain      string  `json:"domain"`
+	Action      string  `json:"action"`
+	HoldSeconds float64 `json:"hold_seconds"`
+	HeldSeconds float64 `json:"held_seconds"`
+	Points      float64 `json:"points"`
+	Alignment   string  `json:"alignment"`
+	Completions int64   `json:"completions"`
+}
+
+//////////////////////////////////////////
+// Team State
+//////////////////////////////////////////
+
+var (
+	teamsByID = make(map[string]*Team)
+	teamsMu   sync.RWMutex
+
+	// teamObjectives tracks which teams are holding which objectives. main replaces it when TEAMS_CONFIG is set.
+	teamObjectives = teams.NewTracker(nil)
+
+	// Errors surfaced to players when joining or creating a team fails.
+	errInvalidTeam = errors.New("Unknown team")
+	errTeamName    = fmt.Errorf("Team name must be 1 to %d characters.", maxTeamNameLength)
+	errTeamExists  = errors.New("A team with that name already exists.")
+	errTeamSave    = errors.New("Could not save the team change, please try again.")
+)
+
+//////////////////////////////////////////
+// Team Functions
+//////////////////////////////////////////
+
+// loadTeams restores teams and memberships from the database and makes sure every configured faction exists.
+func loadTeams(cfg teams.Config) {
+	dbTeams, err := db.GetTeams()
+	if err != nil {
+		log.Printf("Warning: Failed to load teams from database: %v", err)
+	}
+
+	teamsMu.Lock()
+	for _, t := range dbTeams {
+		teamsByID[t.ID] = &Team{ID: t.ID, Name: t.Name, PurePoints: t.PurePoints, EvilPoints: t.EvilPoints}
+	}
+	var missing []teams.Faction
+	for _, f := range cfg.Factions {
+		if _, exists := teamsByID[f.ID]; !exists {
+			teamsByID[f.ID] = &Team{ID: f.ID, Name: f.Name}
+			missing = append(missing, f)
+		}
+	}
+	teamsMu.Unlock()
+
+	for _, f := range missing {
+		if err := db.CreateTeam(db.Team{ID: f.ID, Name: f.Name, CreatedAt: time.Now()}); err != nil {
+			log.Printf("Warning: Failed to persist faction %s: %v", f.ID, err)
+		}
+	}
+
+	members, err := db.GetTeamMembers()
+	if err != nil {
+		log.Printf("Warning: Failed to load team memberships from database: %v", err)
+		return
+	}
+	playersMu.Lock()
+	for playerID, teamID := range members {
+		if player, exists := players[playerID]; exists {
+			player.TeamID = teamID
+		}
+	}
+	playersMu.Unlock()
+	log.Printf("Loaded %d teams and %d team members from database", len(dbTeams), len(members))
+}
+
+// teamExists reports whether a team ID is known.
+func teamExists(teamID string) bool {
+	teamsMu.RLock()
+	defer teamsMu.RUnlock()
+	_, exists := teamsByID[teamID]
+	return exists
+}
+
+// createTeam creates a custom team with a unique name. The team is written to the database before
+// anyone can join it, so a membership never points at a team that was lost.
+func createTeam(ctx context.Context, name string) (*Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxTeamNameLength {
+		return nil, errTeamName
+	}
+
+	teamsMu.Lock()
+	for _, t := range teamsByID {
+		if strings.EqualFold(t.Name, name) {
+			teamsMu.Unlock()
+			return nil, errTeamExists
+		}
+	}
+	team := &Team{ID: fmt.Sprintf("team-%d", time.Now().UnixNano()), Name: name}
+	teamsByID[team.ID] = team
+	teamsMu.Unlock()
+
+	if err := db.CreateTeamContext(ctx, db.Team{ID: team.ID, Name: team.Name, CreatedAt: time.Now()}); err != nil {
+		log.Printf("Failed to persist team %s to database: %v", team.ID, err)
+		teamsMu.Lock()
+		delete(teamsByID, team.ID)
+		teamsMu.Unlock()
+		return nil, errTeamSave
+	}
+	log.Printf("Created team: %s (%s)", team.Name, team.ID)
+	return team, nil
+}
+
+// joinTeam moves a player onto a team. Points they already earned stay with their old team.
+// The membership is saved first and only takes effect once it has been.
+func joinTeam(ctx context.Context, playerID, teamID string) error {
+	if !teamExists(teamID) {
+		return errInvalidTeam
+	}
+	playersMu.RLock()
+	_, exists := players[playerID]
+	playersMu.RUnlock()
+	if !exists {
+		return errInvalidPlayer
+	}
+
+	if err := db.SetPlayerTeamContext(ctx, playerID, teamID, time.Now()); err != nil {
+		log.Printf("Failed to persist team membership for player %s: %v", playerID, err)
+		return errTeamSave
+	}
+	playersMu.Lock()
+	if player, exists := players[playerID]; exists {
+		player.TeamID = teamID
+	}
+	playersMu.Unlock()
+
+	log.Printf("Player %s joined team %s", playerID, teamID)
+	eventBus.Publish(events.Event{
+		Type:     events.TeamJoined,
+		PlayerID: playerID,
+		Data:     map[string]string{"team_id": teamID},
+	})
+	return nil
+}
+
+// addTeamPoints credits a team with points. Callers may hold playersMu.
+func addTeamPoints(teamID string, pure, evil float64) {
+	teamsMu.Lock()
+	defer teamsMu.Unlock()
+
+	team, exists := teamsByID[teamID]
+	if !exists {
+		return
+	}
+	team.PurePoints += pure
+	team.PureDelta += pure
+	team.EvilPoints += evil
+	team.EvilDelta += evil
+}
+
+// trackObjectives feeds a decision to the objective tracker and rewards any team that completed one.
+func trackObjectives(dnsReq *DNSRequest, playerID, action string, decidedAt time.Time) {
+	var teamID string
+	if playerID != "" {
+		playersMu.RLock()
+		if player, exists := players[playerID]; exists {
+			teamID = player.TeamID
+		}
+		playersMu.RUnlock()
+	}
+
+	for _, c := range teamObjectives.Observe(teamID, normalizeQName(dnsReq.Name), action, decidedAt) {
+		completeObjective(c)
+	}
+}
+
+// completeObjective awards a team its objective bonus. The completion is saved through the job queue,
+// in order with the rest of the game's writes.
+func completeObjective(c teams.Completion) {
+	o := c.Objective
+	if o.Alignment == "pure" {
+		addTeamPoints(c.TeamID, o.Points, 0)
+	} else {
+		addTeamPoints(c.TeamID, 0, o.Points)
+	}
+
+	if dbJobs != nil {
+		dbJobs.Submit(queue.Job{Type: objectiveJobType, Data: c})
+	}
+
+	log.Printf("Team %s completed objective %s", c.TeamID, o.ID)
+	eventBus.Publish(events.Event{
+		Type:   events.ObjectiveCompleted,
+		Domain: o.Domain,
+		Data: map[string]interface{}{
+			"team_id":     c.TeamID,
+			"objective":   o.ID,
+			"description": o.Description,
+			"points":      o.Points,
+		},
+	})
+}
+
+// saveObjective writes a queued objective completion.
+func saveObjective(c teams.Completion) error {
+	return db.RecordObjectiveCompletion(c.TeamID, c.Objective.ID, c.Objective.Points, c.At)
+}
+
+// teamErrorStatus maps an error from createTeam or joinTeam to an HTTP status.
+func teamErrorStatus(err error) int {
+	switch err {
+	case errTeamExists:
+		return http.StatusConflict
+	case errTeamSave:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// watchObjectives completes objectives that were held long enough while no decisions came in.
+func watchObjectives() {
+	ticker := time.NewTicker(objectiveCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, c := range teamObjectives.Check(now) {
+			completeObjective(c)
+		}
+	}
+}
+
+// teamViews returns every team with its member count, highest total points first.
+func teamViews() []TeamView {
+	members := make(map[string]int)
+	playersMu.RLock()
+	for _, player := range players {
+		if player.TeamID != "" {
+			members[player.TeamID]++
+		}
+	}
+	playersMu.RUnlock()
+
+	teamsMu.RLock()
+	views := make([]TeamView, 0, len(teamsByID))
+	for _, team := range teamsByID {
+		views = append(views, TeamView{
+			ID:           team.ID,
+			Name:         team.Name,
+			Members:      members[team.ID],
+			PurePoints:   team.PurePoints,
+			EvilPoints:   team.EvilPoints,
+			NetAlignment: team.PurePoints - team.EvilPoints,
+		})
+	}
+	teamsMu.RUnlock()
+
+	sort.Slice(views, func(i, j int) bool {
+		totalI := views[i].PurePoints + views[i].EvilPoints
+		totalJ := views[j].PurePoints + views[j].EvilPoints
+		if totalI != totalJ {
+			return totalI > totalJ
+		}
+		return views[i].Name < views[j].Name
+	})
+	return views
+}
+
+//////////////////////////////////////////
+// Team Handlers
+//////////////////////////////////////////
+
+// teamsHandler lists teams on GET and creates a custom team on POST.
+//
+// Creating takes player_id and name query parameters; the creator joins the new team.
+func teamsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(teamViews())
+	case http.MethodPost:
+		playerID := r.URL.Query().Get("player_id")
+		if err := authenticatePlayer(r, playerID); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		team, err := createTeam(r.Context(), r.URL.Query().Get("name"))
+		if err != nil {
+			http.Error(w, err.Error(), teamErrorStatus(err))
+			return
+		}
+		if err := joinTeam(r.Context(), playerID, team.ID); err != nil {
+			http.Error(w, err.Error(), teamErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(TeamView{ID: team.ID, Name: team.Name, Members: 1})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// teamResourceHandler routes /teams/{id}/{resource} requests.
+func teamResourceHandler(w http.ResponseWriter, r *http.Request) {
+	teamID, resource, ok := splitResourcePath(r.URL.Path, "/teams/")
+	if !ok || !teamExists(teamID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch resource {
+	case "join":
+		joinTeamHandler(w, r, teamID)
+	case "objectives":
+		objectivesHandler(w, r, teamID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// joinTeamHandler moves the authenticated player onto a team.
+func joinTeamHandler(w http.ResponseWriter, r *http.Request, teamID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	playerID := r.URL.Query().Get("player_id")
+	if err := authenticatePlayer(r, playerID); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := joinTeam(r.Context(), playerID, teamID); err != nil {
+		http.Error(w, err.Error(), teamErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// objectivesHandler returns a team's progress on every objective.
+func objectivesHandler(w http.ResponseWriter, r *http.Request, teamID string) {
+	completions, err := db.CountObjectiveCompletionsContext(r.Context(), teamID)
+	if err != nil {
+		log.Printf("Failed to count objective completions for team %s: %v", teamID, err)
+		http.Error(w, "Failed to load objectives", http.StatusInternalServerError)
+		return
+	}
+
+	progress := teamObjectives.Progress(teamID, time.Now())
+	views := make([]ObjectiveView, 0, len(progress))
+	for _, p := range progress {
+		o := p.Objective
+		views = append(views, ObjectiveView{
+			ID:          o.ID,
+			Description: o.Description,
+			Domain:      o.Domain,
+			Action:      o.Action,
+			HoldSeconds: time.Duration(o.Hold).Seconds(),
+			HeldSeconds: p.HeldFor.Seconds(),
+			Points:      o.Points,
+			Alignment:   o.Alignment,
+			Completions: completions[o.ID],
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
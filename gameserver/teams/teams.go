@@ -0,0 +1,193 @@
+// teams, factions and the objectives they chase
+// players fight for a side instead of just themselves
+// gameserver/teams/teams.go
+
+package teams
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+	"github.com/nicewrld/gameserver/domains"
+)
+
+// Faction is a team that always exists
+type Faction struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Objective is something a team can hold for long enough to earn a bonus,
+// like "keep example.com correct for an hour"
+type Objective struct {
+	ID          string          `json:"id"`
+	Description string          `json:"description"`
+	Domain      string          `json:"domain"`    // pattern, see domains.Match
+	Action      string          `json:"action"`    // every decision on the domain has to be this
+	Hold        config.Duration `json:"hold"`      // for this long
+	Points      float64         `json:"points"`    // bonus for the team when it's done
+	Alignment   string          `json:"alignment"` // pure or evil
+}
+
+// Config lists the factions and objectives
+type Config struct {
+	Factions   []Faction   `json:"factions"`
+	Objectives []Objective `json:"objectives"`
+}
+
+// DefaultConfig is the classic pure vs evil split with no objectives
+func DefaultConfig() Config {
+	return Config{Factions: []Faction{{ID: "pure", Name: "Pure"}, {ID: "evil", Name: "Evil"}}}
+}
+
+// LoadConfig reads a teams config file
+func LoadConfig(path string) (Config, error) {
+	return config.Load(path, DefaultConfig())
+}
+
+// Validate catches objectives that could never be completed
+func (c Config) Validate() error {
+	seen := make(map[string]bool)
+	for _, f := range c.Factions {
+		if f.ID == "" || f.Name == "" {
+			return fmt.Errorf("faction needs an id and a name")
+		}
+		if seen[f.ID] {
+			return fmt.Errorf("duplicate faction %q", f.ID)
+		}
+		seen[f.ID] = true
+	}
+	seen = make(map[string]bool)
+	for _, o := range c.Objectives {
+		if o.ID == "" || o.Domain == "" || o.Action == "" {
+			return fmt.Errorf("objective needs an id, domain and action")
+		}
+		if seen[o.ID] {
+			return fmt.Errorf("duplicate objective %q", o.ID)
+		}
+		seen[o.ID] = true
+		if o.Hold <= 0 {
+			return fmt.Errorf("objective %q: hold must be positive", o.ID)
+		}
+		if o.Alignment != "pure" && o.Alignment != "evil" {
+			return fmt.Errorf("objective %q: alignment must be pure or evil", o.ID)
+		}
+	}
+	return nil
+}
+
+// Completion is a team finishing an objective
+type Completion struct {
+	TeamID    string
+	Objective Objective
+	At        time.Time
+}
+
+// Progress is how long a team has held an objective so far
+type Progress struct {
+	Objective Objective
+	HeldFor   time.Duration // zero if they aren't holding it
+}
+
+// Tracker follows every team's hold on every objective
+//
+// a team starts holding an objective when one of its members makes the
+// objective's action on a matching domain. anyone making a different call
+// on that domain breaks every team's hold.
+type Tracker struct {
+	objectives []Objective
+
+	mu    sync.Mutex
+	holds map[string]map[string]time.Time // objective id -> team id -> held since
+}
+
+// NewTracker starts tracking the given objectives
+func NewTracker(objectives []Objective) *Tracker {
+	t := &Tracker{
+		objectives: objectives,
+		holds:      make(map[string]map[string]time.Time),
+	}
+	for _, o := range objectives {
+		t.holds[o.ID] = make(map[string]time.Time)
+	}
+	return t
+}
+
+// Objectives returns what's being tracked
+func (t *Tracker) Objectives() []Objective {
+	return t.objectives
+}
+
+// Observe feeds in a decision and returns any objectives it completed
+// teamID is empty when the decider isn't on a team (or nobody decided)
+func (t *Tracker) Observe(teamID, domain, action string, at time.Time) []Completion {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, o := range t.objectives {
+		if !domains.Match(o.Domain, domain) {
+			continue
+		}
+		holds := t.holds[o.ID]
+		if action != o.Action {
+			for team := range holds {
+				delete(holds, team)
+			}
+			continue
+		}
+		if _, holding := holds[teamID]; teamID != "" && !holding {
+			holds[teamID] = at
+		}
+	}
+	return t.completed(at)
+}
+
+// Check returns objectives completed just by time passing
+func (t *Tracker) Check(at time.Time) []Completion {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.completed(at)
+}
+
+// completed collects finished holds and starts them over
+func (t *Tracker) completed(at time.Time) []Completion {
+	var done []Completion
+	for _, o := range t.objectives {
+		holds := t.holds[o.ID]
+		for _, team := range sortedTeams(holds) {
+			if at.Sub(holds[team]) >= time.Duration(o.Hold) {
+				done = append(done, Completion{TeamID: team, Objective: o, At: at})
+				holds[team] = at
+			}
+		}
+	}
+	return done
+}
+
+// Progress reports a team's hold on each objective
+func (t *Tracker) Progress(teamID string, at time.Time) []Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	progress := make([]Progress, 0, len(t.objectives))
+	for _, o := range t.objectives {
+		p := Progress{Objective: o}
+		if since, holding := t.holds[o.ID][teamID]; holding {
+			p.HeldFor = at.Sub(since)
+		}
+		progress = append(progress, p)
+	}
+	return progress
+}
+
+func sortedTeams(holds map[string]time.Time) []string {
+	teams := make([]string, 0, len(holds))
+	for team := range holds {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	return teams
+}
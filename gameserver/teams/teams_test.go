@@ -0,0 +1,146 @@
+// gameserver/teams/teams_test.go
+
+package teams
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+)
+
+var guard = Objective{ID: "guard", Domain: "*.example.com", Action: "correct", Hold: config.Duration(time.Hour), Points: 10, Alignment: "pure"}
+
+// TestTracker tests when holding an objective completes it, for which teams
+func TestTracker(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	type decision struct {
+		team, domain, action string
+		after                time.Duration
+	}
+	tests := []struct {
+		name      string
+		decisions []decision
+		checkAt   time.Duration
+		want      []string // teams that completed guard at checkAt
+	}{
+		{
+			name:      "held long enough",
+			decisions: []decision{{"pure", "www.example.com", "correct", 0}},
+			checkAt:   time.Hour,
+			want:      []string{"pure"},
+		},
+		{
+			name:      "not held long enough",
+			decisions: []decision{{"pure", "www.example.com", "correct", 0}},
+			checkAt:   59 * time.Minute,
+		},
+		{
+			name: "another call breaks the hold",
+			decisions: []decision{
+				{"pure", "www.example.com", "correct", 0},
+				{"", "www.example.com", "corrupt", 10 * time.Minute},
+			},
+			checkAt: time.Hour,
+		},
+		{
+			name: "the clock starts over after a break",
+			decisions: []decision{
+				{"pure", "www.example.com", "correct", 0},
+				{"evil", "www.example.com", "delay", 10 * time.Minute},
+				{"pure", "www.example.com", "correct", 20 * time.Minute},
+			},
+			checkAt: 80 * time.Minute,
+			want:    []string{"pure"},
+		},
+		{
+			name: "teams hold it side by side",
+			decisions: []decision{
+				{"pure", "a.example.com", "correct", 0},
+				{"evil", "b.example.com", "correct", 5 * time.Minute},
+				{"pure", "a.example.com", "correct", 30 * time.Minute},
+			},
+			checkAt: 65 * time.Minute,
+			want:    []string{"evil", "pure"},
+		},
+		{
+			name:      "decisions without a team hold nothing",
+			decisions: []decision{{"", "www.example.com", "correct", 0}},
+			checkAt:   time.Hour,
+		},
+		{
+			name: "other domains don't count",
+			decisions: []decision{
+				{"pure", "www.example.com", "correct", 0},
+				{"", "example.org", "corrupt", 10 * time.Minute},
+			},
+			checkAt: time.Hour,
+			want:    []string{"pure"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTracker([]Objective{guard})
+			for _, d := range tt.decisions {
+				if done := tr.Observe(d.team, d.domain, d.action, start.Add(d.after)); len(done) != 0 {
+					t.Fatalf("Expected nothing to complete on a decision, got %+v", done)
+				}
+			}
+			var got []string
+			for _, c := range tr.Check(start.Add(tt.checkAt)) {
+				got = append(got, c.TeamID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v to complete, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestTrackerRepeats tests that a completed hold starts over rather than paying out again at once
+func TestTrackerRepeats(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tr := NewTracker([]Objective{guard})
+	tr.Observe("pure", "www.example.com", "correct", start)
+	if done := tr.Check(start.Add(time.Hour)); len(done) != 1 || done[0].Objective.ID != "guard" || !done[0].At.Equal(start.Add(time.Hour)) {
+		t.Fatalf("Expected guard to complete at the hour, got %+v", done)
+	}
+	if done := tr.Check(start.Add(time.Hour + time.Minute)); len(done) != 0 {
+		t.Errorf("Expected the hold to start over, got %+v", done)
+	}
+	progress := tr.Progress("pure", start.Add(90*time.Minute))
+	if len(progress) != 1 || progress[0].HeldFor != 30*time.Minute {
+		t.Errorf("Expected pure to have held guard for 30m again, got %+v", progress)
+	}
+	if progress := tr.Progress("evil", start.Add(90*time.Minute)); progress[0].HeldFor != 0 {
+		t.Errorf("Expected evil to hold nothing, got %+v", progress)
+	}
+}
+
+// TestValidate tests the team configs that could never be played
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr bool
+	}{
+		{"default", func(*Config) {}, false},
+		{"objective", func(c *Config) { c.Objectives = []Objective{guard} }, false},
+		{"faction without a name", func(c *Config) { c.Factions[0].Name = "" }, true},
+		{"duplicate faction", func(c *Config) { c.Factions[1].ID = c.Factions[0].ID }, true},
+		{"duplicate objective", func(c *Config) { c.Objectives = []Objective{guard, guard} }, true},
+		{"objective without a domain", func(c *Config) { o := guard; o.Domain = ""; c.Objectives = []Objective{o} }, true},
+		{"no hold", func(c *Config) { o := guard; o.Hold = 0; c.Objectives = []Objective{o} }, true},
+		{"unknown alignment", func(c *Config) { o := guard; o.Alignment = "chaotic"; c.Objectives = []Objective{o} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.change(&cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+-- A database from before migrations, when db.Initialize only created the players table.
+-- TestMigrations brings it up to the latest schema.
+PRAGMA journal_mode=WAL;
+
+CREATE TABLE IF NOT EXISTS players (
+	id TEXT PRIMARY KEY,
+	nickname TEXT NOT NULL,
+	pure_points REAL DEFAULT 0,
+	evil_points REAL DEFAULT 0,
+	last_request_id TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO players (id, nickname, pure_points, evil_points, last_request_id, created_at, updated_at) VALUES
+	('old-player-1', 'Veteran', 120.5, 30, 'req-old-1', '2024-01-02 03:04:05', '2024-02-03 04:05:06'),
+	('old-player-2', 'Lurker', 0, 4, NULL, '2024-01-05 00:00:00', '2024-01-05 00:00:00');
@@ -0,0 +1,229 @@
+// gameserver/votes.go
+
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+	"github.com/nicewrld/gameserver/events"
+	"github.com/nicewrld/gameserver/scoring"
+	"github.com/nicewrld/gameserver/voting"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//////////////////////////////////////////
+// Voting Constants
+//////////////////////////////////////////
+
+// MinimumVoteTime defines the minimum time a ballot must stay open after a player is handed the request.
+const MinimumVoteTime = 3 * time.Second
+
+//////////////////////////////////////////
+// Voting Metrics and State
+//////////////////////////////////////////
+
+var (
+	// ballotsTotal counts closed ballots by whether the crowd settled on an action.
+	ballotsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gameserver_ballots_total",
+		Help: "Closed crowd votes by outcome (decided or fallback)",
+	}, []string{"outcome"})
+
+	// votesCast counts individual votes by action.
+	votesCast = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gameserver_votes_total",
+		Help: "Votes cast in crowd voting mode by action",
+	}, []string{"action"})
+
+	// votingConfig decides which requests are voted on. main replaces it when VOTING_CONFIG is set,
+	// and admins can swap it at runtime; read it through currentVotingConfig.
+	votingConfig   = voting.DefaultConfig()
+	votingConfigMu sync.RWMutex
+
+	// voteRand drives random_weighted tallies.
+	voteRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	voteRandMu sync.Mutex
+
+	// Errors surfaced to players when a vote is rejected.
+	errVotingClosed = errors.New("Voting has closed for this request.")
+	errAlreadyVoted = errors.New("You already voted on this request.")
+)
+
+//////////////////////////////////////////
+// Voting Functions
+//////////////////////////////////////////
+
+// currentVotingConfig returns the voting config in effect.
+func currentVotingConfig() voting.Config {
+	votingConfigMu.RLock()
+	defer votingConfigMu.RUnlock()
+	return votingConfig
+}
+
+// setVotingConfig swaps in a new voting config.
+func setVotingConfig(cfg voting.Config) {
+	votingConfigMu.Lock()
+	votingConfig = cfg
+	votingConfigMu.Unlock()
+}
+
+// openBallot opens a ballot for the DNS request if its domain is played in voting mode, or returns nil.
+func openBallot(dnsReq *DNSRequest) *voting.Ballot {
+	policy := currentVotingConfig().PolicyFor(dnsReq.Name)
+	if policy.Mode != voting.ModeVote {
+		return nil
+	}
+	// Voting can never outlast the DNS request itself.
+	if time.Duration(policy.Deadline) > RequestTimeout {
+		policy.Deadline = config.Duration(RequestTimeout)
+	}
+	return voting.NewBallot(policy, dnsReq.Timestamp)
+}
+
+// assignable reports whether enough time is left on a DNS request to hand it to a player.
+func assignable(dnsReq *DNSRequest, now time.Time) bool {
+	if dnsReq.ballot != nil {
+		return dnsReq.ballot.Deadline.Sub(now) > MinimumVoteTime
+	}
+	return RequestTimeout-now.Sub(dnsReq.Timestamp) > MinimumRemainingTime
+}
+
+// voteWeight is how much a player's vote counts in weighted tallies. It grows slowly with their total points,
+// so veterans count for more without drowning out newcomers.
+func voteWeight(playerID string) float64 {
+	playersMu.RLock()
+	defer playersMu.RUnlock()
+
+	player, exists := players[playerID]
+	if !exists {
+		return 1
+	}
+	return 1 + math.Log10(1+math.Max(0, player.PurePoints+player.EvilPoints))
+}
+
+// castVote records a player's vote on a DNS request being decided by the crowd.
+func castVote(playerID string, dnsReq *DNSRequest, action string) error {
+	err := dnsReq.ballot.Cast(voting.Vote{
+		PlayerID: playerID,
+		Action:   action,
+		Weight:   voteWeight(playerID),
+		CastAt:   time.Now(),
+	})
+	switch err {
+	case nil:
+	case voting.ErrClosed:
+		return errVotingClosed
+	case voting.ErrAlreadyVoted:
+		return errAlreadyVoted
+	default:
+		return errRequestMismatch
+	}
+
+	votesCast.With(prometheus.Labels{"action": action}).Inc()
+	log.Printf("Player %s voted '%s' on request %s", playerID, action, dnsReq.RequestID)
+	return nil
+}
+
+// awaitBallot waits until the crowd reaches quorum or the ballot deadline passes, then resolves the request
+// and returns the winning action. An admin can cut voting short by sending an action on actionChan.
+func awaitBallot(dnsReq *DNSRequest, actionChan chan string) string {
+	ballot := dnsReq.ballot
+	select {
+	case <-ballot.Ready():
+	case <-time.After(time.Until(ballot.Deadline)):
+	case action := <-actionChan:
+		// Forced by an admin: stop voting and nobody scores.
+		voteRandMu.Lock()
+		ballot.Close(voteRand)
+		voteRandMu.Unlock()
+		log.Printf("[RequestID: %s] Vote overridden with '%s'", dnsReq.RequestID, action)
+		recordDecision(dnsReq, "", action, false, time.Now(), nil)
+		trackObjectives(dnsReq, "", action, time.Now())
+		eventBus.Publish(events.Event{
+			Type:      events.RequestDecided,
+			RequestID: dnsReq.RequestID,
+			Domain:    dnsReq.Name,
+			Data:      map[string]interface{}{"action": action, "mode": voting.ModeVote, "forced": true},
+		})
+		cleanupDNSRequest(dnsReq.RequestID, action)
+		return action
+	}
+
+	voteRandMu.Lock()
+	result := ballot.Close(voteRand)
+	voteRandMu.Unlock()
+
+	outcome := "fallback"
+	if result.Decided {
+		outcome = "decided"
+	}
+	ballotsTotal.With(prometheus.Labels{"outcome": outcome}).Inc()
+
+	if len(result.Counts) == 0 {
+		// Nobody voted at all; treat it like any other timeout.
+		dnsReq.markTimedOut()
+		log.Printf("[RequestID: %s] Nobody voted before the deadline", dnsReq.RequestID)
+		eventBus.Publish(events.Event{
+			Type:      events.RequestTimedOut,
+			RequestID: dnsReq.RequestID,
+			Domain:    dnsReq.Name,
+		})
+		recordDecision(dnsReq, "", result.Action, true, time.Now(), nil)
+		trackObjectives(dnsReq, "", result.Action, time.Now())
+		cleanupDNSRequest(dnsReq.RequestID, result.Action)
+		return result.Action
+	}
+
+	// Score the winning side and record every vote, in the order they were cast.
+	winners := make(map[string]bool)
+	for _, v := range result.Winners {
+		winners[v.PlayerID] = true
+	}
+	winnerIDs := make([]string, 0, len(result.Winners))
+	for _, v := range ballot.Votes() {
+		var awards []scoring.Award
+		if winners[v.PlayerID] {
+			awards = scoreDecision(v.PlayerID, dnsReq, v.Action, v.CastAt)
+			winnerIDs = append(winnerIDs, v.PlayerID)
+		}
+		recordDecision(dnsReq, v.PlayerID, v.Action, false, v.CastAt, awards)
+	}
+
+	// Only the answer CoreDNS actually gives counts towards objectives, credited to the winning side.
+	decidedAt := time.Now()
+	if len(winnerIDs) == 0 {
+		trackObjectives(dnsReq, "", result.Action, decidedAt)
+	}
+	for _, playerID := range winnerIDs {
+		trackObjectives(dnsReq, playerID, result.Action, decidedAt)
+	}
+	for _, v := range ballot.Votes() {
+		if winners[v.PlayerID] {
+			trackAchievements(dnsReq, v.PlayerID, v.Action, v.CastAt)
+		}
+	}
+
+	log.Printf("[RequestID: %s] Crowd chose '%s' (%v)", dnsReq.RequestID, result.Action, result.Counts)
+	eventBus.Publish(events.Event{
+		Type:      events.RequestDecided,
+		RequestID: dnsReq.RequestID,
+		Domain:    dnsReq.Name,
+		Data: map[string]interface{}{
+			"action":  result.Action,
+			"mode":    voting.ModeVote,
+			"decided": result.Decided,
+			"counts":  result.Counts,
+			"winners": winnerIDs,
+		},
+	})
+
+	cleanupDNSRequest(dnsReq.RequestID, result.Action)
+	return result.Action
+}
@@ -0,0 +1,344 @@
+// crowd voting - lets a bunch of players vote on one dns request
+// instead of handing it to a single player
+// gameserver/voting/voting.go
+
+package voting
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+	"github.com/nicewrld/gameserver/domains"
+)
+
+// how a request gets decided
+const (
+	ModeSingle = "single" // first player to grab it decides (the classic game)
+	ModeVote   = "vote"   // broadcast to many players and tally their votes
+)
+
+// how votes get turned into one action
+const (
+	TallyMajority       = "majority"        // needs more than half the votes, otherwise the fallback
+	TallyPlurality      = "plurality"       // most votes wins
+	TallyWeighted       = "weighted"        // most total vote weight wins
+	TallyRandomWeighted = "random_weighted" // pick randomly, odds proportional to weight
+)
+
+// what we answer when a vote can't settle on anything
+const FallbackAction = "correct"
+
+var (
+	ErrClosed       = errors.New("voting has closed for this request")
+	ErrAlreadyVoted = errors.New("you already voted on this request")
+	ErrNotAssigned  = errors.New("this request was not sent to you")
+)
+
+// Policy says how requests get decided
+type Policy struct {
+	Mode     string          `json:"mode"`     // single or vote
+	Voters   int             `json:"voters"`   // how many players get the request, 0 means everyone
+	Quorum   int             `json:"quorum"`   // close early once this many have voted, 0 waits for the deadline
+	Deadline config.Duration `json:"deadline"` // how long voting stays open
+	Tally    string          `json:"tally"`    // majority, plurality, weighted or random_weighted
+}
+
+// DomainPolicy overrides the default for matching domains
+type DomainPolicy struct {
+	Pattern string `json:"pattern"` // see domains.Match
+	Policy
+}
+
+// Config is the whole voting setup
+type Config struct {
+	Default Policy         `json:"default"`
+	Domains []DomainPolicy `json:"domains"` // first match wins
+}
+
+// DefaultConfig keeps the classic one-player-per-request game
+func DefaultConfig() Config {
+	return Config{Default: Policy{Mode: ModeSingle}}
+}
+
+// LoadConfig reads a voting config file
+func LoadConfig(path string) (Config, error) {
+	return config.Load(path, DefaultConfig())
+}
+
+// Validate catches policies that could never resolve
+func (c Config) Validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for _, d := range c.Domains {
+		if err := d.Policy.validate(); err != nil {
+			return fmt.Errorf("domain %q: %w", d.Pattern, err)
+		}
+	}
+	return nil
+}
+
+func (p Policy) validate() error {
+	switch p.Mode {
+	case ModeSingle, "":
+		return nil
+	case ModeVote:
+	default:
+		return fmt.Errorf("unknown mode %q", p.Mode)
+	}
+	switch p.Tally {
+	case TallyMajority, TallyPlurality, TallyWeighted, TallyRandomWeighted:
+	default:
+		return fmt.Errorf("unknown tally %q", p.Tally)
+	}
+	if p.Deadline <= 0 {
+		return fmt.Errorf("deadline must be positive")
+	}
+	if p.Voters < 0 || p.Quorum < 0 {
+		return fmt.Errorf("voters and quorum can't be negative")
+	}
+	if p.Voters > 0 && p.Quorum > p.Voters {
+		return fmt.Errorf("quorum %d can never be reached with %d voters", p.Quorum, p.Voters)
+	}
+	return nil
+}
+
+// PolicyFor picks the policy for a queried name
+func (c Config) PolicyFor(name string) Policy {
+	for _, d := range c.Domains {
+		if domains.Match(d.Pattern, name) {
+			return d.Policy
+		}
+	}
+	return c.Default
+}
+
+// Vote is one player's pick
+type Vote struct {
+	PlayerID string
+	Action   string
+	Weight   float64
+	CastAt   time.Time
+}
+
+// Result is how a ballot ended up
+type Result struct {
+	Action  string             // what we're answering with
+	Decided bool               // false if we fell back because nobody could agree (or nobody voted)
+	Counts  map[string]int     // votes per action
+	Weights map[string]float64 // total weight per action
+	Winners []Vote             // votes on the winning side
+}
+
+// Ballot collects votes for one dns request
+type Ballot struct {
+	Policy   Policy
+	Deadline time.Time
+
+	mu       sync.Mutex
+	assigned map[string]bool
+	votes    []Vote
+	closed   bool
+	ready    chan struct{}
+}
+
+// NewBallot opens voting until the policy's deadline
+func NewBallot(p Policy, opened time.Time) *Ballot {
+	return &Ballot{
+		Policy:   p,
+		Deadline: opened.Add(time.Duration(p.Deadline)),
+		assigned: make(map[string]bool),
+		ready:    make(chan struct{}),
+	}
+}
+
+// Ready is closed once enough votes are in to tally early
+func (b *Ballot) Ready() <-chan struct{} {
+	return b.ready
+}
+
+// Assign hands the request to a player if there's room for another voter
+func (b *Ballot) Assign(playerID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.assigned[playerID] {
+		return false
+	}
+	if b.Policy.Voters > 0 && len(b.assigned) >= b.Policy.Voters {
+		return false
+	}
+	b.assigned[playerID] = true
+	return true
+}
+
+// Cast records a player's vote
+func (b *Ballot) Cast(v Vote) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if !b.assigned[v.PlayerID] {
+		return ErrNotAssigned
+	}
+	for _, existing := range b.votes {
+		if existing.PlayerID == v.PlayerID {
+			return ErrAlreadyVoted
+		}
+	}
+	if v.Weight <= 0 {
+		v.Weight = 1
+	}
+	b.votes = append(b.votes, v)
+
+	// close early once the quorum is in, or once every seat has voted
+	n := len(b.votes)
+	if (b.Policy.Quorum > 0 && n >= b.Policy.Quorum) || (b.Policy.Voters > 0 && n >= b.Policy.Voters) {
+		b.closed = true
+		close(b.ready)
+	}
+	return nil
+}
+
+// Votes returns a copy of the votes cast so far, in the order they came in
+func (b *Ballot) Votes() []Vote {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Vote(nil), b.votes...)
+}
+
+// Close stops voting and tallies what came in
+// rng is only used by random_weighted
+func (b *Ballot) Close(rng *rand.Rand) Result {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.ready)
+	}
+	votes := append([]Vote(nil), b.votes...)
+	b.mu.Unlock()
+
+	return Tally(b.Policy.Tally, votes, rng)
+}
+
+// Tally turns a set of votes into a result
+func Tally(method string, votes []Vote, rng *rand.Rand) Result {
+	res := Result{
+		Action:  FallbackAction,
+		Counts:  make(map[string]int),
+		Weights: make(map[string]float64),
+	}
+	if len(votes) == 0 {
+		return res
+	}
+
+	var total float64
+	for _, v := range votes {
+		res.Counts[v.Action]++
+		res.Weights[v.Action] += v.Weight
+		total += v.Weight
+	}
+
+	switch method {
+	case TallyMajority:
+		action, n := leader(res.Counts)
+		if n*2 > len(votes) {
+			res.Action, res.Decided = action, true
+		}
+	case TallyWeighted:
+		if action, ok := leaderWeighted(res.Weights); ok {
+			res.Action, res.Decided = action, true
+		}
+	case TallyRandomWeighted:
+		pick := rng.Float64() * total
+		for _, action := range sortedActions(res.Weights) {
+			pick -= res.Weights[action]
+			if pick < 0 {
+				res.Action, res.Decided = action, true
+				break
+			}
+		}
+		if !res.Decided {
+			// float rounding left us just past the end
+			actions := sortedActions(res.Weights)
+			res.Action, res.Decided = actions[len(actions)-1], true
+		}
+	default: // plurality
+		if action, n := leader(res.Counts); n > 0 && !tied(res.Counts, n) {
+			res.Action, res.Decided = action, true
+		}
+	}
+
+	if res.Decided {
+		for _, v := range votes {
+			if v.Action == res.Action {
+				res.Winners = append(res.Winners, v)
+			}
+		}
+	}
+	return res
+}
+
+// leader finds the action with the most votes (alphabetically first on ties)
+func leader(counts map[string]int) (string, int) {
+	var best string
+	var most int
+	for _, action := range sortedKeys(counts) {
+		if counts[action] > most {
+			best, most = action, counts[action]
+		}
+	}
+	return best, most
+}
+
+// tied reports whether more than one action has the top count
+func tied(counts map[string]int, top int) bool {
+	n := 0
+	for _, c := range counts {
+		if c == top {
+			n++
+		}
+	}
+	return n > 1
+}
+
+// leaderWeighted finds the heaviest action, refusing to pick on an exact tie
+func leaderWeighted(weights map[string]float64) (string, bool) {
+	var best string
+	var most float64
+	tie := false
+	for _, action := range sortedActions(weights) {
+		switch w := weights[action]; {
+		case w > most:
+			best, most, tie = action, w, false
+		case w == most:
+			tie = true
+		}
+	}
+	return best, best != "" && !tie
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedActions(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
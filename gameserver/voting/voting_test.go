@@ -0,0 +1,182 @@
+// gameserver/voting/voting_test.go
+
+package voting
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/nicewrld/gameserver/config"
+)
+
+// votes builds one vote per action, weighted 1 unless a weight follows it
+func votes(picks ...interface{}) []Vote {
+	var vs []Vote
+	for _, p := range picks {
+		switch p := p.(type) {
+		case string:
+			vs = append(vs, Vote{PlayerID: string(rune('a' + len(vs))), Action: p, Weight: 1})
+		case float64:
+			vs[len(vs)-1].Weight = p
+		}
+	}
+	return vs
+}
+
+// TestTally tests turning votes into a result with each tally method
+func TestTally(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		votes       []Vote
+		wantAction  string
+		wantDecided bool
+		wantWinners int
+	}{
+		{"no votes fall back", TallyPlurality, nil, FallbackAction, false, 0},
+		{"majority", TallyMajority, votes("corrupt", "corrupt", "correct"), "corrupt", true, 2},
+		{"majority needs more than half", TallyMajority, votes("corrupt", "correct"), FallbackAction, false, 0},
+		{"majority without one", TallyMajority, votes("corrupt", "delay", "nxdomain", "corrupt", "delay"), FallbackAction, false, 0},
+		{"plurality", TallyPlurality, votes("corrupt", "delay", "nxdomain", "corrupt"), "corrupt", true, 2},
+		{"plurality tie falls back", TallyPlurality, votes("corrupt", "delay"), FallbackAction, false, 0},
+		{"weighted", TallyWeighted, votes("corrupt", 1.0, "correct", 2.5, "corrupt", 1.0), "correct", true, 1},
+		{"weighted tie falls back", TallyWeighted, votes("corrupt", 2.0, "correct", 2.0), FallbackAction, false, 0},
+		{"unknown method counts as plurality", "", votes("delay", "delay", "correct"), "delay", true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Tally(tt.method, tt.votes, nil)
+			if res.Action != tt.wantAction || res.Decided != tt.wantDecided || len(res.Winners) != tt.wantWinners {
+				t.Errorf("Expected %s (decided %v, %d winners), got %s (decided %v, %d winners)",
+					tt.wantAction, tt.wantDecided, tt.wantWinners, res.Action, res.Decided, len(res.Winners))
+			}
+			if n := len(tt.votes); n > 0 {
+				total := 0
+				for _, c := range res.Counts {
+					total += c
+				}
+				if total != n {
+					t.Errorf("Expected counts to add up to %d votes, got %v", n, res.Counts)
+				}
+			}
+		})
+	}
+}
+
+// TestTallyRandomWeighted tests that a random weighted tally always decides, on an action someone voted for
+func TestTallyRandomWeighted(t *testing.T) {
+	vs := votes("corrupt", 1.0, "correct", 3.0)
+	rng := rand.New(rand.NewSource(1))
+	picked := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		res := Tally(TallyRandomWeighted, vs, rng)
+		if !res.Decided || (res.Action != "corrupt" && res.Action != "correct") {
+			t.Fatalf("Expected a decided pick between the voted actions, got %+v", res)
+		}
+		picked[res.Action]++
+	}
+	if picked["correct"] <= picked["corrupt"] {
+		t.Errorf("Expected the heavier action to be picked more often, got %v", picked)
+	}
+}
+
+// TestBallotQuorum tests when a ballot closes early and who may vote on it
+func TestBallotQuorum(t *testing.T) {
+	tests := []struct {
+		name      string
+		voters    int
+		quorum    int
+		cast      int
+		wantReady bool
+	}{
+		{"quorum reached", 5, 2, 2, true},
+		{"quorum not reached", 5, 3, 2, false},
+		{"every seat voted", 2, 0, 2, true},
+		{"no quorum waits for the deadline", 0, 0, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBallot(Policy{Mode: ModeVote, Voters: tt.voters, Quorum: tt.quorum, Deadline: config.Duration(time.Minute), Tally: TallyPlurality}, time.Now())
+			for _, v := range votes("corrupt", "corrupt", "corrupt", "corrupt")[:tt.cast] {
+				if !b.Assign(v.PlayerID) {
+					t.Fatalf("Expected %s to get a seat", v.PlayerID)
+				}
+				if err := b.Cast(v); err != nil {
+					t.Fatalf("Expected %s's vote to count, got %v", v.PlayerID, err)
+				}
+			}
+			select {
+			case <-b.Ready():
+				if !tt.wantReady {
+					t.Error("Expected the ballot to stay open")
+				}
+			default:
+				if tt.wantReady {
+					t.Error("Expected the ballot to close early")
+				}
+			}
+		})
+	}
+}
+
+// TestBallotCast tests the votes a ballot turns away
+func TestBallotCast(t *testing.T) {
+	b := NewBallot(Policy{Mode: ModeVote, Voters: 2, Deadline: config.Duration(time.Minute), Tally: TallyMajority}, time.Now())
+	if !b.Assign("alice") || b.Assign("alice") {
+		t.Fatal("Expected alice to get exactly one seat")
+	}
+	if err := b.Cast(Vote{PlayerID: "mallory", Action: "corrupt"}); err != ErrNotAssigned {
+		t.Errorf("Expected ErrNotAssigned for a player without a seat, got %v", err)
+	}
+	if err := b.Cast(Vote{PlayerID: "alice", Action: "corrupt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Cast(Vote{PlayerID: "alice", Action: "correct"}); err != ErrAlreadyVoted {
+		t.Errorf("Expected ErrAlreadyVoted, got %v", err)
+	}
+	if b.Votes()[0].Weight != 1 {
+		t.Errorf("Expected an unweighted vote to count once, got %v", b.Votes()[0].Weight)
+	}
+	if !b.Assign("bob") || b.Assign("carol") {
+		t.Error("Expected only two seats")
+	}
+
+	res := b.Close(nil)
+	if res.Action != "corrupt" || !res.Decided {
+		t.Errorf("Expected the lone vote to carry the majority, got %+v", res)
+	}
+	if err := b.Cast(Vote{PlayerID: "bob", Action: "correct"}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed after closing, got %v", err)
+	}
+	if b.Assign("dave") {
+		t.Error("Expected a closed ballot to hand out no seats")
+	}
+}
+
+// TestPolicyValidate tests the voting policies that could never resolve
+func TestPolicyValidate(t *testing.T) {
+	minute := config.Duration(time.Minute)
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{"single", Policy{Mode: ModeSingle}, false},
+		{"empty mode is single", Policy{}, false},
+		{"vote", Policy{Mode: ModeVote, Voters: 3, Quorum: 2, Deadline: minute, Tally: TallyMajority}, false},
+		{"unknown mode", Policy{Mode: "poll"}, true},
+		{"unknown tally", Policy{Mode: ModeVote, Deadline: minute, Tally: "loudest"}, true},
+		{"no deadline", Policy{Mode: ModeVote, Tally: TallyMajority}, true},
+		{"negative quorum", Policy{Mode: ModeVote, Quorum: -1, Deadline: minute, Tally: TallyMajority}, true},
+		{"quorum above voters", Policy{Mode: ModeVote, Voters: 2, Quorum: 3, Deadline: minute, Tally: TallyMajority}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Config{Default: tt.policy}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
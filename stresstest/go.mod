@@ -2,9 +2,15 @@ module stresstest
 
 go 1.23
 
-require github.com/PuerkitoBio/goquery v1.10.0
+require (
+	github.com/PuerkitoBio/goquery v1.10.0
+	github.com/nicewrld/gameserver v0.0.0
+)
 
 require (
 	github.com/andybalholm/cascadia v1.3.2 // indirect
 	golang.org/x/net v0.29.0 // indirect
 )
+
+// The game server client lives in the gameserver module next door
+replace github.com/nicewrld/gameserver => ../gameserver
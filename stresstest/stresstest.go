@@ -3,6 +3,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -15,6 +16,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/nicewrld/gameserver/client"
 )
 
 // Configuration variables
@@ -29,13 +32,6 @@ var (
 	domains          []string
 )
 
-type DNSRequest struct {
-	RequestID string `json:"request_id"`
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	Class     string `json:"class"`
-}
-
 // Initialize configuration from environment variables
 func initConfig() {
 	numPlayers, _ = strconv.Atoi(getEnv("NUM_PLAYERS", "100")) // Adjusted number of players
@@ -140,12 +136,12 @@ func simulatePlayer(playerNumber int, sem chan struct{}, wg *sync.WaitGroup) {
 	defer wg.Done()
 	defer func() { <-sem }() // Release the semaphore
 
-	client := &http.Client{
+	httpClient := &http.Client{
 		Timeout: 10 * time.Second,
 	}
 
 	// Register the player once
-	playerID, err := registerPlayer(client, playerNumber)
+	playerID, err := registerPlayer(httpClient, playerNumber)
 	if err != nil {
 		log.Printf("Player %d: Failed to register - %v", playerNumber, err)
 		return // Exit the goroutine if registration fails
@@ -153,10 +149,10 @@ func simulatePlayer(playerNumber int, sem chan struct{}, wg *sync.WaitGroup) {
 	log.Printf("Player %d: Registered successfully with PlayerID %s", playerNumber, playerID)
 
 	// Proceed to play the game continuously
-	playGame(client, playerID, playerNumber)
+	playGame(httpClient, playerID, playerNumber)
 }
 
-func registerPlayer(client *http.Client, playerNumber int) (string, error) {
+func registerPlayer(httpClient *http.Client, playerNumber int) (string, error) {
 	// Generate a random nickname
 	nickname := fmt.Sprintf("Player%d_%s", playerNumber, randomString(5))
 
@@ -176,7 +172,7 @@ func registerPlayer(client *http.Client, playerNumber int) (string, error) {
 	req.Header.Set("Content-Type", "application/json")
 
 	// Execute the request
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -187,16 +183,16 @@ func registerPlayer(client *http.Client, playerNumber int) (string, error) {
 		return "", fmt.Errorf("registration failed with status code %d", resp.StatusCode)
 	}
 
-	// Extract player_id cookie
-	var playerID string
+	// Extract the signed session cookie
+	var session *http.Cookie
 	for _, cookie := range resp.Cookies() {
-		if cookie.Name == "player_id" {
-			playerID = cookie.Value
+		if cookie.Name == "session" {
+			session = cookie
 			break
 		}
 	}
-	if playerID == "" {
-		return "", fmt.Errorf("failed to get player_id cookie")
+	if session == nil || session.Value == "" {
+		return "", fmt.Errorf("failed to get session cookie")
 	}
 
 	// Initialize cookie jar and set the cookie
@@ -204,17 +200,22 @@ func registerPlayer(client *http.Client, playerNumber int) (string, error) {
 	u, _ := url.Parse(fmt.Sprintf("http://%s", webInterfaceHost))
 	jar.SetCookies(u, []*http.Cookie{
 		{
-			Name:  "player_id",
-			Value: playerID,
+			Name:  "session",
+			Value: session.Value,
 			Path:  "/",
 		},
 	})
-	client.Jar = jar
+	httpClient.Jar = jar
 
-	return playerID, nil
+	// The player ID is the base64 encoded first part of the session cookie
+	playerID, err := base64.RawURLEncoding.DecodeString(strings.SplitN(session.Value, ".", 2)[0])
+	if err != nil {
+		return "", fmt.Errorf("malformed session cookie: %v", err)
+	}
+	return string(playerID), nil
 }
 
-func playGame(client *http.Client, playerID string, playerNumber int) {
+func playGame(httpClient *http.Client, playerID string, playerNumber int) {
 	for {
 		err := func() error {
 			// Get assigned DNS request
@@ -222,8 +223,8 @@ func playGame(client *http.Client, playerID string, playerNumber int) {
 			if err != nil {
 				return err
 			}
-			// The cookie is already set in client.Jar
-			resp, err := client.Do(req)
+			// The cookie is already set in httpClient.Jar
+			resp, err := httpClient.Do(req)
 			if err != nil {
 				return err
 			}
@@ -232,7 +233,7 @@ func playGame(client *http.Client, playerID string, playerNumber int) {
 			if resp.StatusCode == http.StatusUnauthorized {
 				log.Printf("Player %d: Unauthorized. Re-registering...", playerNumber)
 				// Re-register the player
-				playerID, err = registerPlayer(client, playerNumber)
+				playerID, err = registerPlayer(httpClient, playerNumber)
 				if err != nil {
 					return err
 				}
@@ -251,7 +252,8 @@ func playGame(client *http.Client, playerID string, playerNumber int) {
 				return nil
 			}
 
-			var dnsReq DNSRequest
+			// The web interface hands over the game server's assignment as is
+			var dnsReq client.Assignment
 			err = json.NewDecoder(resp.Body).Decode(&dnsReq)
 			if err != nil {
 				return err
@@ -276,8 +278,8 @@ func playGame(client *http.Client, playerID string, playerNumber int) {
 				return err
 			}
 			submitReq.Header.Set("Content-Type", "application/json")
-			// Cookie is managed by client.Jar
-			submitResp, err := client.Do(submitReq)
+			// Cookie is managed by httpClient.Jar
+			submitResp, err := httpClient.Do(submitReq)
 			if err != nil {
 				return err
 			}
@@ -338,14 +340,18 @@ func randomString(n int) string {
 }
 
 func randomAction() string {
-	actions := []string{
-		"correct", "correct", "correct", "correct", "correct",
-		"correct", "correct", "correct", "correct", "correct",
-		"correct", "correct", "correct", "correct", "correct",
-		"correct", "correct", "correct", "correct", "correct",
-		"corrupt", "corrupt", "corrupt", "corrupt",
-		"delay",
-		"nxdomain",
+	// Mostly honest, like real players
+	weights := map[string]int{
+		client.ActionCorrect:  20,
+		client.ActionCorrupt:  4,
+		client.ActionDelay:    1,
+		client.ActionNXDomain: 1,
+	}
+	var actions []string
+	for _, action := range client.Actions {
+		for i := 0; i < weights[action]; i++ {
+			actions = append(actions, action)
+		}
 	}
 	return actions[rand.Intn(len(actions))]
 }
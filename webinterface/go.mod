@@ -1,3 +1,8 @@
 module github.com/nicewrld/webinterface
 
 go 1.23
+
+require github.com/nicewrld/gameserver v0.0.0
+
+// The game server client lives in the gameserver module next door
+replace github.com/nicewrld/gameserver => ../gameserver
@@ -2,100 +2,170 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
-	"time"
-)
 
-type DNSRequest struct {
-	RequestID string `json:"request_id"`
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	Class     string `json:"class"`
-}
+	"github.com/nicewrld/gameserver/client"
+)
 
-type DNSResponse struct {
-	Action string `json:"action"`
-}
+// Where the game server lives on the compose network
+const gameServerURL = "http://gameserver:8080"
 
 // Global variables
 var (
-	client *http.Client
+	gameServer      *client.Client
+	gameServerProxy *httputil.ReverseProxy
 )
 
 func init() {
-	// Create an HTTP client with timeouts
-	client = &http.Client{
-		Timeout: 10 * time.Second,
+	// The game server client times out, retries and maps errors for us
+	gameServer = client.New(gameServerURL)
+
+	// Proxy long-lived streams straight through to the game server; ReverseProxy
+	// handles the WebSocket upgrade and flushes event streams for us
+	target, _ := url.Parse(gameServerURL)
+	gameServerProxy = httputil.NewSingleHostReverseProxy(target)
+}
+
+// forwardedFor tells the game server who the player really is, so its rate limits
+// apply per player address rather than to the web interface as a whole
+func forwardedFor(r *http.Request) context.Context {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+		host = prior + ", " + host
 	}
+	return client.ForwardedFor(r.Context(), host)
 }
 
-func playHandler(w http.ResponseWriter, r *http.Request) {
-	// Generate or retrieve player ID (e.g., via cookie)
-	playerID := getPlayerID(w, r)
+// passThrough hands a refusal from the game server on to the player, reason and all,
+// if its status is one of the given ones, and reports whether it did
+func passThrough(w http.ResponseWriter, err error, statuses ...int) bool {
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, status := range statuses {
+		if apiErr.Status == status {
+			if apiErr.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(apiErr.RetryAfter.Seconds())))
+			}
+			http.Error(w, apiErr.Message, apiErr.Status)
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON sends a value as the JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
 
-	if playerID == "" {
-		// getPlayerID already handled the error response
+func playHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve the player's session from their cookie
+	session, ok := getSession(w, r)
+	if !ok {
+		// getSession already handled the error response
 		return
 	}
 
 	// Request an assigned DNS query from the game server
-	resp, err := client.Get("http://gameserver:8080/assign?player_id=" + url.QueryEscape(playerID))
-	if err != nil {
+	assignment, err := gameServer.Assign(forwardedFor(r), session)
+	switch {
+	case err == nil:
+	case errors.Is(err, client.ErrUnauthorized):
+		// The game server no longer recognises this session
+		clearSessionCookie(w)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	case errors.Is(err, client.ErrNoRequests):
+		log.Printf("No DNS requests available for player %s", session.PlayerID)
+		http.Error(w, "No DNS requests available.", http.StatusNoContent)
+		return
+	case passThrough(w, err, http.StatusTooManyRequests, http.StatusForbidden, http.StatusBadRequest):
+		return
+	default:
 		// Log the error for debugging
 		log.Printf("Failed to get assigned DNS request: %v", err)
 		http.Error(w, "No DNS requests available. Please try again later.", http.StatusServiceUnavailable)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNoContent {
-		log.Printf("No DNS requests available for player %s", playerID)
-		http.Error(w, "No DNS requests available.", http.StatusNoContent)
-		return
-	}
+	// Return DNS request as JSON
+	writeJSON(w, assignment)
+}
 
-	if resp.StatusCode == http.StatusBadRequest {
-		bodyBytes, _ := ioutil.ReadAll(resp.Body)
-		bodyString := string(bodyBytes)
-		log.Printf("Failed to get DNS request: %s", bodyString)
-		http.Error(w, bodyString, http.StatusBadRequest)
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := getSession(w, r)
+	if !ok {
+		// getSession already handled the error response
 		return
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Failed to get assigned DNS request: status code %d", resp.StatusCode)
-		http.Error(w, "Failed to get DNS request.", http.StatusInternalServerError)
+	// Rewrite the request onto the game server's stream endpoint for this player,
+	// swapping the cookie for the session token
+	r.URL.Path = "/stream"
+	r.URL.RawQuery = "player_id=" + url.QueryEscape(session.PlayerID)
+	r.Header.Del("Cookie")
+	authorize(r, session)
+	gameServerProxy.ServeHTTP(w, r)
+}
+
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Spectating is public, so just pass the filters through
+	r.URL.Path = "/events"
+	gameServerProxy.ServeHTTP(w, r)
+}
+
+func achievementEventsHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := getSession(w, r)
+	if !ok {
 		return
 	}
 
-	var dnsReq DNSRequest
-	err = json.NewDecoder(resp.Body).Decode(&dnsReq)
-	if err != nil {
-		log.Printf("Failed to decode DNS request: %v", err)
-		http.Error(w, "Failed to decode DNS request.", http.StatusInternalServerError)
+	// Only this player's achievements, so the play page can pop a toast for each
+	r.URL.Path = "/events"
+	r.URL.RawQuery = url.Values{
+		"type":   {"achievement_unlocked"},
+		"player": {session.PlayerID},
+	}.Encode()
+	gameServerProxy.ServeHTTP(w, r)
+}
+
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	// History, stats and teams are public and read-only, so pass them straight through
+	// minus the /api prefix
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
 		return
 	}
-
-	// Return DNS request as JSON
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(dnsReq)
+	r.URL.Path = strings.TrimPrefix(r.URL.Path, "/api")
+	gameServerProxy.ServeHTTP(w, r)
 }
 
 func submitHandler(w http.ResponseWriter, r *http.Request) {
-	playerID := getPlayerID(w, r)
-
-	if playerID == "" {
-		// getPlayerID already handled the error response
+	session, ok := getSession(w, r)
+	if !ok {
+		// getSession already handled the error response
 		return
 	}
 
-	var actionReq map[string]string
+	var actionReq struct {
+		RequestID string `json:"request_id"`
+		Action    string `json:"action"`
+	}
 	err := json.NewDecoder(r.Body).Decode(&actionReq)
 	if err != nil {
 		log.Printf("Failed to parse request body: %v", err)
@@ -103,69 +173,79 @@ func submitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	actionReq["player_id"] = playerID
-
-	data, _ := json.Marshal(actionReq)
-	resp, err := client.Post("http://gameserver:8080/submitaction", "application/json", bytes.NewBuffer(data))
+	result, err := gameServer.Submit(forwardedFor(r), session, actionReq.RequestID, actionReq.Action)
 	if err != nil {
 		log.Printf("Failed to submit action: %v", err)
-		http.Error(w, "Failed to submit action.", http.StatusInternalServerError)
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			http.Error(w, apiErr.Message, apiErr.Status)
+		} else {
+			http.Error(w, "Failed to submit action.", http.StatusInternalServerError)
+		}
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := ioutil.ReadAll(resp.Body)
-		bodyString := string(bodyBytes)
-		log.Printf("Failed to submit action: status code %d, response: %s", resp.StatusCode, bodyString)
-		http.Error(w, bodyString, resp.StatusCode)
-		return
-	}
+	// Pass the awards breakdown through so the player sees why they scored
+	writeJSON(w, result)
+}
 
-	// Return success response
-	w.WriteHeader(http.StatusOK)
+// leaderboardQuery reads the paging, sorting and filtering parameters the frontend sent
+func leaderboardQuery(r *http.Request) client.LeaderboardQuery {
+	query := r.URL.Query()
+	q := client.LeaderboardQuery{
+		Sort:   query.Get("sort"),
+		Window: query.Get("window"),
+		Search: query.Get("q"),
+	}
+	q.Page, _ = strconv.Atoi(query.Get("page"))
+	q.PageSize, _ = strconv.Atoi(query.Get("page_size"))
+	return q
 }
 
 func leaderboardHandler(w http.ResponseWriter, r *http.Request) {
-	// Forward the page parameter from the frontend to the gameserver
-	page := r.URL.Query().Get("page")
-	url := "http://gameserver:8080/leaderboard"
-	if page != "" {
-		url += "?page=" + page
-	}
-	
-	resp, err := client.Get(url)
+	// Forward the paging, sorting and filtering parameters from the frontend to the gameserver
+	q := leaderboardQuery(r)
+
+	var leaderboard interface{}
+	var err error
+	if r.URL.Query().Get("scope") == "team" {
+		leaderboard, err = gameServer.TeamLeaderboard(r.Context(), q)
+	} else {
+		leaderboard, err = gameServer.Leaderboard(r.Context(), q)
+	}
 	if err != nil {
+		// Bad sort or window, so let the frontend say which
+		if passThrough(w, err, http.StatusBadRequest) {
+			return
+		}
 		log.Printf("Failed to get leaderboard: %v", err)
 		http.Error(w, "Failed to get leaderboard.", http.StatusInternalServerError)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Failed to get leaderboard: status code %d", resp.StatusCode)
-		http.Error(w, "Failed to get leaderboard.", http.StatusInternalServerError)
-		return
-	}
+	// Return leaderboard as JSON
+	writeJSON(w, leaderboard)
+}
 
-	var leaderboard []struct {
-		PlayerID     string  `json:"player_id"`
-		Nickname     string  `json:"nickname"`
-		PurePoints   float64 `json:"pure_points"`
-		EvilPoints   float64 `json:"evil_points"`
-		NetAlignment float64 `json:"net_alignment"`
+func rankHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := getSession(w, r)
+	if !ok {
+		return
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&leaderboard)
+	// Look up where the logged in player stands on the board the frontend is showing
+	view, err := gameServer.Rank(r.Context(), session.PlayerID, leaderboardQuery(r))
 	if err != nil {
-		log.Printf("Failed to decode leaderboard: %v", err)
-		http.Error(w, "Failed to decode leaderboard.", http.StatusInternalServerError)
+		// Not on this board yet is normal, so pass it through
+		if passThrough(w, err, http.StatusBadRequest, http.StatusNotFound) {
+			return
+		}
+		log.Printf("Failed to get rank: %v", err)
+		http.Error(w, "Failed to get rank.", http.StatusInternalServerError)
 		return
 	}
 
-	// Return leaderboard as JSON
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(leaderboard)
+	writeJSON(w, view)
 }
 
 func registerHandler(w http.ResponseWriter, r *http.Request) {
@@ -182,30 +262,21 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		nickname := reqData["nickname"]
 		log.Printf("Registering player with nickname: %s", nickname)
 
-		resp, err := client.Get("http://gameserver:8080/register?nickname=" + url.QueryEscape(nickname))
+		session, err := gameServer.Register(r.Context(), nickname, reqData["team"])
 		if err != nil {
+			// A refused nickname comes with the game server's reason
+			if passThrough(w, err, http.StatusBadRequest, http.StatusConflict) {
+				return
+			}
 			log.Printf("Failed to register player: %v", err)
 			http.Error(w, "Failed to register player.", http.StatusInternalServerError)
 			return
 		}
-		defer resp.Body.Close()
+		log.Printf("Player registered with ID: %s", session.PlayerID)
 
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Failed to register player: status code %d", resp.StatusCode)
-			http.Error(w, "Failed to register player.", http.StatusInternalServerError)
-			return
-		}
-
-		data, _ := ioutil.ReadAll(resp.Body)
-		playerID := string(data)
-		log.Printf("Player registered with ID: %s", playerID)
-
-		// Set cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:  "player_id",
-			Value: playerID,
-			Path:  "/",
-		})
+		// Set the signed session cookie and drop the old unsigned one
+		setSessionCookie(w, session)
+		http.SetCookie(w, &http.Cookie{Name: "player_id", Value: "", Path: "/", MaxAge: -1})
 
 		// Return success response
 		w.WriteHeader(http.StatusOK)
@@ -214,15 +285,57 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func getPlayerID(w http.ResponseWriter, r *http.Request) string {
-	cookie, err := r.Cookie("player_id")
-	if err == nil {
-		return cookie.Value
+func nicknameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+	session, ok := getSession(w, r)
+	if !ok {
+		// getSession already handled the error response
+		return
+	}
+
+	var body client.NicknameRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request data.", http.StatusBadRequest)
+		return
+	}
+
+	change, err := gameServer.Rename(r.Context(), session, body.Nickname)
+	if err != nil {
+		// Pass the outcome through, including the friendly reasons a nickname is refused
+		// and when a player in cooldown may try again
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			passThrough(w, err, apiErr.Status)
+			return
+		}
+		log.Printf("Failed to rename player: %v", err)
+		http.Error(w, "Failed to change nickname.", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, change)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return
 	}
 
-	// Return empty string and set status code
-	http.Error(w, "Unauthorized", http.StatusUnauthorized)
-	return ""
+	// Revoke the session on the game server if we still have a valid one
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if session, ok := parseSession(cookie.Value); ok {
+			if err := gameServer.Logout(r.Context(), session); err != nil {
+				log.Printf("Failed to revoke session for player %s: %v", session.PlayerID, err)
+			}
+		}
+	}
+
+	clearSessionCookie(w)
+	w.WriteHeader(http.StatusOK)
 }
 
 func main() {
@@ -232,7 +345,18 @@ func main() {
 	mux.HandleFunc("/api/play", playHandler)
 	mux.HandleFunc("/api/submit", submitHandler)
 	mux.HandleFunc("/api/leaderboard", leaderboardHandler)
+	mux.HandleFunc("/api/leaderboard/rank", rankHandler)
 	mux.HandleFunc("/api/register", registerHandler)
+	mux.HandleFunc("/api/logout", logoutHandler)
+	mux.HandleFunc("/api/nickname", nicknameHandler)
+	mux.HandleFunc("/api/stream", streamHandler)
+	mux.HandleFunc("/api/events", eventsHandler)
+	mux.HandleFunc("/api/achievements/events", achievementEventsHandler)
+	mux.HandleFunc("/api/players/", historyHandler)
+	mux.HandleFunc("/api/domains/", historyHandler)
+	mux.HandleFunc("/api/stats/", historyHandler)
+	mux.HandleFunc("/api/teams", historyHandler)
+	mux.HandleFunc("/api/teams/", historyHandler)
 
 	// Serve static files
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
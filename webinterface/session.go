@@ -0,0 +1,145 @@
+// webinterface/session.go
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicewrld/gameserver/client"
+)
+
+// Name of the cookie holding the signed player session
+const sessionCookieName = "session"
+
+// Session is what we keep in the player's cookie: who they are, the secret
+// token the game server gave them, and when it runs out
+type Session = client.Session
+
+var (
+	// Key used to sign session cookies so they can't be forged or edited
+	sessionSecret []byte
+
+	// Whether to mark cookies Secure (only sent over HTTPS)
+	cookieSecure bool
+)
+
+func init() {
+	if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+		sessionSecret = []byte(secret)
+	} else {
+		// Without a configured secret every restart logs everyone out
+		log.Printf("Warning: SESSION_SECRET not set, using a random key for this process")
+		sessionSecret = make([]byte, 32)
+		if _, err := rand.Read(sessionSecret); err != nil {
+			log.Fatalf("Failed to generate session secret: %v", err)
+		}
+	}
+	cookieSecure = os.Getenv("COOKIE_SECURE") == "true"
+}
+
+// signSession encodes a session as payload.signature
+func signSession(s Session) string {
+	payload := strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(s.PlayerID)),
+		s.Token,
+		strconv.FormatInt(s.ExpiresAt.Unix(), 10),
+	}, ".")
+	return payload + "." + sessionSignature(payload)
+}
+
+// sessionSignature is the base64 HMAC-SHA256 of the payload
+func sessionSignature(payload string) string {
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseSession checks a cookie value's signature and expiry
+func parseSession(value string) (Session, bool) {
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return Session{}, false
+	}
+	payload, signature := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(sessionSignature(payload))) {
+		return Session{}, false
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return Session{}, false
+	}
+	playerID, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Session{}, false
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return Session{}, false
+	}
+
+	s := Session{
+		PlayerID:  string(playerID),
+		Token:     parts[1],
+		ExpiresAt: time.Unix(expires, 0),
+	}
+	if time.Now().After(s.ExpiresAt) {
+		return Session{}, false
+	}
+	return s, true
+}
+
+// setSessionCookie stores the signed session in an HttpOnly cookie
+func setSessionCookie(w http.ResponseWriter, s Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    signSession(s),
+		Path:     "/",
+		Expires:  s.ExpiresAt,
+		HttpOnly: true,
+		Secure:   cookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearSessionCookie deletes the session cookie
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// getSession reads the player's session from their cookie
+func getSession(w http.ResponseWriter, r *http.Request) (Session, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err == nil {
+		if s, ok := parseSession(cookie.Value); ok {
+			return s, true
+		}
+		// Tampered or expired, so throw it away
+		clearSessionCookie(w)
+	}
+
+	// Return no session and set status code
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return Session{}, false
+}
+
+// authorize attaches the player's session token to a game server request
+func authorize(req *http.Request, s Session) {
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+}